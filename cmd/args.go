@@ -0,0 +1,1534 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// --- Argument Parsing ---
+
+// subcommands replace the rankings with their own report; the name must be the first argument
+var subcommands = []string{"simulate-retention", "backup-gap", "plan-copy", "heavy-files-by-type", "logs", "dev", "git-repos", "databases", "mail", "tag", "collector", "verify-report", "history",
+	"scan", "serve", "check", "diff", "watch", "dupes"}
+
+// commandAliases maps the fs-analyzer subcommand names to the original ones: find_heavy_dirs
+// without a subcommand is scan, and its collector is serve.
+var commandAliases = map[string]string{"scan": "", "serve": "collector"}
+
+// asFSAnalyzer reports whether the binary was started as fs-analyzer, which requires a subcommand.
+// Under any other name (find_heavy_dirs) options without a subcommand run a scan as they always did.
+func asFSAnalyzer() bool {
+	name := strings.TrimSuffix(strings.ToLower(filepath.Base(os.Args[0])), ".exe")
+	return strings.HasPrefix(name, "fs-analyzer")
+}
+
+func parseArgs() {
+	args := os.Args[1:]
+	if len(args) > 0 && slices.Contains(subcommands, args[0]) {
+		command = args[0]
+		args = args[1:]
+	} else if asFSAnalyzer() && (len(args) == 0 || !slices.Contains([]string{"-h", "--help", "--version"}, args[0])) {
+		if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+			fmt.Printf("Error: Unknown subcommand: %s\n", args[0])
+		} else {
+			fmt.Println("Error: fs-analyzer requires a subcommand, e.g. fs-analyzer scan --path /data")
+		}
+		printUsage()
+		os.Exit(1)
+	}
+	if alias, ok := commandAliases[command]; ok {
+		command = alias
+	}
+	if command == "watch" {
+		// Each round reruns the scan with the same options (the profile is expanded again there)
+		watchArgs = slices.Clone(args)
+	}
+	args = expandProfile(args)
+	// If no arguments provided, defaults will be used (targetPaths handled below)
+
+	given := make(map[string]bool) // Options present on the command line (or in the profile)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		given[arg] = true
+		if command == "tag" && !strings.HasPrefix(arg, "--") {
+			tagArgs = append(tagArgs, arg)
+			continue
+		}
+		if command == "history" && !strings.HasPrefix(arg, "--") {
+			historyArgs = append(historyArgs, arg)
+			continue
+		}
+		if command == "verify-report" && !strings.HasPrefix(arg, "--") {
+			verifyFiles = append(verifyFiles, arg)
+			continue
+		}
+		if command == "diff" && !strings.HasPrefix(arg, "--") {
+			diffFiles = append(diffFiles, arg)
+			continue
+		}
+		switch arg {
+		case "--path":
+			// Read all subsequent non-option arguments as paths
+			for i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
+				targetPaths = append(targetPaths, args[i+1])
+				i++
+			}
+		case "--maxdepth":
+			if i+1 < len(args) {
+				val, err := strconv.Atoi(args[i+1])
+				if err != nil {
+					fmt.Println("Error: --maxdepth requires a numeric value")
+					os.Exit(1)
+				}
+				maxDepth = val
+				i++
+			}
+		case "--top":
+			if i+1 < len(args) {
+				val, err := strconv.Atoi(args[i+1])
+				if err != nil {
+					fmt.Println("Error: --top requires a numeric value")
+					os.Exit(1)
+				}
+				topN = val
+				i++
+			}
+		case "--size-mode":
+			if i+1 < len(args) {
+				mode := strings.ToLower(args[i+1])
+				if mode != "disk" && mode != "apparent" {
+					fmt.Println("Error: --size-mode must be one of: disk, apparent")
+					os.Exit(1)
+				}
+				sizeMode = mode
+				i++
+			} else {
+				fmt.Println("Error: --size-mode requires a value: disk or apparent")
+				os.Exit(1)
+			}
+		case "--exclude":
+			// Read all subsequent non-option arguments as exclude paths
+			for i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
+				excludePaths = append(excludePaths, args[i+1])
+				i++
+			}
+		case "--verbose":
+			verbose = true
+		case "--display-runtime":
+			displayRuntime = true
+		case "--collapse-chains":
+			collapseChains = true
+		case "--unique-top":
+			uniqueTop = true
+		case "--skip-cross-os":
+			skipCrossOS = true
+		case "--btrfs-subvolumes":
+			btrfsSubvols = true
+		case "--zfs":
+			zfsDatasets = true
+		case "--anonymize":
+			anonymize = true
+		case "--relative":
+			relativePaths = true
+		case "--path-template":
+			if i+1 < len(args) {
+				t, err := parsePathTemplate(args[i+1])
+				if err != nil {
+					fmt.Printf("Error: --path-template %s: %v\n", args[i+1], err)
+					os.Exit(1)
+				}
+				pathTemplates = append(pathTemplates, t)
+				i++
+			} else {
+				fmt.Println("Error: --path-template requires a template such as '/data/{team}/{project}/**'")
+				os.Exit(1)
+			}
+		case "--rewrite":
+			if i+1 < len(args) {
+				rw, err := parseRewrite(args[i+1])
+				if err != nil {
+					fmt.Printf("Error: --rewrite: %v\n", err)
+					os.Exit(1)
+				}
+				pathRewrites = append(pathRewrites, rw)
+				i++
+			} else {
+				fmt.Println("Error: --rewrite requires a rule such as '/mnt/data[0-9]+=/data'")
+				os.Exit(1)
+			}
+		case "--only-mine":
+			onlyUid = int64(os.Getuid())
+			// Optional uid, e.g. --only-mine 1001 (paths are given with --path, so a number is unambiguous)
+			if i+1 < len(args) {
+				if val, err := strconv.ParseInt(args[i+1], 10, 64); err == nil && val >= 0 {
+					onlyUid = val
+					i++
+				}
+			}
+			if onlyUid < 0 {
+				fmt.Println("Error: --only-mine requires file owners (uid), which this platform does not provide")
+				os.Exit(1)
+			}
+		case "--by-project":
+			byProject = true
+		case "--group-by-component":
+			if i+1 < len(args) {
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil || n < 1 {
+					fmt.Println("Error: --group-by-component requires a component number of 1 or more")
+					os.Exit(1)
+				}
+				groupLevel = n
+				i++
+			} else {
+				fmt.Println("Error: --group-by-component requires a component number, e.g. 3 for /srv/tenants/<name>")
+				os.Exit(1)
+			}
+		case "--format":
+			if i+1 < len(args) {
+				format := strings.ToLower(args[i+1])
+				if format != "table" && format != "parquet" && format != "csv" && format != "pdf" && format != "dot" {
+					fmt.Println("Error: --format must be one of: table, parquet, csv, pdf, dot")
+					os.Exit(1)
+				}
+				outputFormat = format
+				i++
+			} else {
+				fmt.Println("Error: --format requires a value: table, parquet, csv, pdf or dot")
+				os.Exit(1)
+			}
+		case "--template":
+			if i+1 < len(args) {
+				templateFile = args[i+1]
+				if err := loadReportTemplate(templateFile); err != nil {
+					fmt.Printf("Error: --template %s: %v\n", templateFile, err)
+					os.Exit(1)
+				}
+				i++
+			} else {
+				fmt.Println("Error: --template requires a template file, e.g. report.tmpl or report.html")
+				os.Exit(1)
+			}
+		case "--departments":
+			if i+1 < len(args) {
+				departmentCSV = args[i+1]
+				i++
+			} else {
+				fmt.Println("Error: --departments requires a CSV file")
+				os.Exit(1)
+			}
+		case "--chart":
+			if i+1 < len(args) {
+				c, err := parseChartSpec(args[i+1])
+				if err != nil {
+					fmt.Printf("Error: --chart %s: %v\n", args[i+1], err)
+					os.Exit(1)
+				}
+				charts = append(charts, c)
+				i++
+			} else {
+				fmt.Println("Error: --chart requires a file, e.g. sunburst.svg, flame.svg or flame.folded")
+				os.Exit(1)
+			}
+		case "--output":
+			if i+1 < len(args) {
+				outputFile = args[i+1]
+				i++
+			} else {
+				fmt.Println("Error: --output requires a file")
+				os.Exit(1)
+			}
+		case "--rule":
+			if i+1 < len(args) {
+				addRetentionRule(args[i+1])
+				i++
+			} else {
+				fmt.Println("Error: --rule requires a rule such as \"delete *.log older than 30d\"")
+				os.Exit(1)
+			}
+		case "--catalog":
+			if i+1 < len(args) {
+				catalogFile = args[i+1]
+				i++
+			} else {
+				fmt.Println("Error: --catalog requires a file")
+				os.Exit(1)
+			}
+		case "--catalog-root":
+			if i+1 < len(args) {
+				catalogRoot = args[i+1]
+				i++
+			} else {
+				fmt.Println("Error: --catalog-root requires a directory")
+				os.Exit(1)
+			}
+		case "--shards":
+			if i+1 < len(args) {
+				val, err := strconv.Atoi(args[i+1])
+				if err != nil || val < 1 {
+					fmt.Println("Error: --shards requires a positive numeric value")
+					os.Exit(1)
+				}
+				shardCount = val
+				i++
+			} else {
+				fmt.Println("Error: --shards requires a numeric value")
+				os.Exit(1)
+			}
+		case "--balance":
+			if i+1 < len(args) {
+				shardBalance = strings.ToLower(args[i+1])
+				if shardBalance != "bytes" && shardBalance != "files" {
+					fmt.Println("Error: --balance must be one of: bytes, files")
+					os.Exit(1)
+				}
+				i++
+			} else {
+				fmt.Println("Error: --balance requires a value: bytes or files")
+				os.Exit(1)
+			}
+		case "--rules":
+			if i+1 < len(args) {
+				data, err := os.ReadFile(args[i+1])
+				if err != nil {
+					fmt.Printf("Error: Could not read rules file: %v\n", err)
+					os.Exit(1)
+				}
+				for _, line := range strings.Split(string(data), "\n") {
+					if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+						addRetentionRule(line)
+					}
+				}
+				i++
+			} else {
+				fmt.Println("Error: --rules requires a file")
+				os.Exit(1)
+			}
+		case "--emit-exclude-file":
+			if i+1 < len(args) {
+				emitExclude = strings.ToLower(args[i+1])
+				if emitExclude != "rsync" && emitExclude != "borg" && emitExclude != "restic" {
+					fmt.Println("Error: --emit-exclude-file must be one of: rsync, borg, restic")
+					os.Exit(1)
+				}
+				i++
+			} else {
+				fmt.Println("Error: --emit-exclude-file requires a value: rsync, borg or restic")
+				os.Exit(1)
+			}
+		case "--exclude-older-than":
+			if i+1 < len(args) {
+				age, err := parseAge(args[i+1])
+				if err != nil {
+					fmt.Printf("Error: --exclude-older-than: %v\n", err)
+					os.Exit(1)
+				}
+				excludeAge = age
+				i++
+			} else {
+				fmt.Println("Error: --exclude-older-than requires an age such as 180d")
+				os.Exit(1)
+			}
+		case "--all":
+			showAll = true
+		case "--min-size":
+			if i+1 < len(args) {
+				size, err := parseSize(args[i+1])
+				if err != nil {
+					fmt.Printf("Error: --min-size: %v\n", err)
+					os.Exit(1)
+				}
+				minSize = size
+				i++
+			} else {
+				fmt.Println("Error: --min-size requires a size such as 1G")
+				os.Exit(1)
+			}
+		case "--no-pager":
+			usePager = false
+		case "--precision":
+			if i+1 < len(args) {
+				val, err := strconv.Atoi(args[i+1])
+				if err != nil || val < 0 || val > 6 {
+					fmt.Println("Error: --precision must be a number of decimals from 0 to 6")
+					os.Exit(1)
+				}
+				sizePrecision = val
+				i++
+			} else {
+				fmt.Println("Error: --precision requires a number of decimals, e.g. 2")
+				os.Exit(1)
+			}
+		case "--round":
+			if i+1 < len(args) {
+				mode := args[i+1]
+				if mode != "up" && mode != "down" && mode != "nearest" {
+					fmt.Println("Error: --round must be one of: up, down, nearest")
+					os.Exit(1)
+				}
+				sizeRounding = mode
+				i++
+			} else {
+				fmt.Println("Error: --round requires a value: up, down or nearest")
+				os.Exit(1)
+			}
+		case "--exact-bytes":
+			exactBytes = true
+		case "--locale":
+			if i+1 < len(args) {
+				f, err := parseLocale(args[i+1])
+				if err != nil {
+					fmt.Printf("Error: --locale: %v\n", err)
+					os.Exit(1)
+				}
+				numFormat = f
+				i++
+			} else {
+				fmt.Println("Error: --locale requires a locale such as de_DE, fr or auto")
+				os.Exit(1)
+			}
+		case "--dot-min-size":
+			if i+1 < len(args) {
+				size, err := parseSize(args[i+1])
+				if err != nil {
+					fmt.Printf("Error: --dot-min-size: %v\n", err)
+					os.Exit(1)
+				}
+				dotMinSize = size
+				i++
+			} else {
+				fmt.Println("Error: --dot-min-size requires a size such as 1G")
+				os.Exit(1)
+			}
+		case "--exclude-larger-than":
+			if i+1 < len(args) {
+				size, err := parseSize(args[i+1])
+				if err != nil {
+					fmt.Printf("Error: --exclude-larger-than: %v\n", err)
+					os.Exit(1)
+				}
+				excludeSize = size
+				i++
+			} else {
+				fmt.Println("Error: --exclude-larger-than requires a size such as 50G")
+				os.Exit(1)
+			}
+		case "--permissions":
+			permReport = true
+		case "--crash-dumps":
+			crashDumps = true
+		case "--symlinks":
+			symlinkReport = true
+		case "--special-files":
+			specialFiles = true
+		case "--deleted-open":
+			deletedOpen = true
+		case "--reconcile":
+			reconcile = true
+		case "--regenerable":
+			regenerable = true
+		case "--versioned-files":
+			versionedFiles = true
+		case "--temp-files":
+			if i+1 < len(args) {
+				age, err := parseAge(args[i+1])
+				if err != nil {
+					fmt.Printf("Error: --temp-files: %v\n", err)
+					os.Exit(1)
+				}
+				tempReport, tempAge, tempAgeArg = true, age, args[i+1]
+				i++
+			} else {
+				fmt.Println("Error: --temp-files requires an age such as 7d")
+				os.Exit(1)
+			}
+		case "--slowest":
+			if i+1 < len(args) {
+				val, err := strconv.Atoi(args[i+1])
+				if err != nil || val <= 0 {
+					fmt.Println("Error: --slowest requires a positive numeric value")
+					os.Exit(1)
+				}
+				slowestN = val
+				i++
+			} else {
+				fmt.Println("Error: --slowest requires a numeric value")
+				os.Exit(1)
+			}
+		case "--gogc":
+			if i+1 < len(args) {
+				if args[i+1] == "off" {
+					gcPercent = -1
+				} else {
+					val, err := strconv.Atoi(args[i+1])
+					if err != nil || val <= 0 {
+						fmt.Println("Error: --gogc requires a positive percentage or off")
+						os.Exit(1)
+					}
+					gcPercent = val
+				}
+				i++
+			} else {
+				fmt.Println("Error: --gogc requires a value")
+				os.Exit(1)
+			}
+		case "--progressive":
+			progressive = true
+		case "--max-memory":
+			if i+1 < len(args) {
+				val, err := parseSize(args[i+1])
+				if err != nil || val <= 0 {
+					fmt.Println("Error: --max-memory requires a size such as 512M")
+					os.Exit(1)
+				}
+				maxMemory = val
+				i++
+			} else {
+				fmt.Println("Error: --max-memory requires a size such as 512M")
+				os.Exit(1)
+			}
+		case "--resource-usage":
+			resourceUsage = true
+		case "--throttle":
+			if i+1 < len(args) {
+				val, err := strconv.Atoi(args[i+1])
+				if err != nil || val <= 0 {
+					fmt.Println("Error: --throttle requires a number of entries per second such as 500")
+					os.Exit(1)
+				}
+				throttleRate = val
+				i++
+			} else {
+				fmt.Println("Error: --throttle requires a number of entries per second such as 500")
+				os.Exit(1)
+			}
+		case "--full-speed":
+			if i+1 < len(args) {
+				windows, err := parseDayWindows(args[i+1])
+				if err != nil {
+					fmt.Printf("Error: --full-speed: %v\n", err)
+					os.Exit(1)
+				}
+				fullSpeed = append(fullSpeed, windows...)
+				i++
+			} else {
+				fmt.Println("Error: --full-speed requires times of day such as 01:00-05:00")
+				os.Exit(1)
+			}
+		case "--memory-limit":
+			if i+1 < len(args) {
+				val, err := parseSize(args[i+1])
+				if err != nil || val <= 0 {
+					fmt.Println("Error: --memory-limit requires a size such as 4G")
+					os.Exit(1)
+				}
+				memoryLimit = val
+				i++
+			} else {
+				fmt.Println("Error: --memory-limit requires a size such as 4G")
+				os.Exit(1)
+			}
+		case "--entry-limit":
+			if i+1 < len(args) {
+				val, err := strconv.ParseInt(args[i+1], 10, 64)
+				if err != nil || val < 0 {
+					fmt.Println("Error: --entry-limit requires a non-negative numeric value")
+					os.Exit(1)
+				}
+				entryLimit = val
+				i++
+			} else {
+				fmt.Println("Error: --entry-limit requires a numeric value")
+				os.Exit(1)
+			}
+		case "--path-lengths":
+			pathLengths = true
+		case "--name-audit":
+			nameAudit = true
+		case "--target-fs":
+			if i+1 < len(args) {
+				targetFS = strings.ToLower(args[i+1])
+				if _, ok := targetFSLimits[targetFS]; !ok {
+					fmt.Println("Error: --target-fs must be one of: ntfs, exfat, fat32, apfs, ext4")
+					os.Exit(1)
+				}
+				i++
+			} else {
+				fmt.Println("Error: --target-fs requires a value: ntfs, exfat, fat32, apfs or ext4")
+				os.Exit(1)
+			}
+		case "--fingerprint":
+			fingerprint = true
+		case "--fingerprint-content":
+			fingerprint = true
+			hashContent = true
+		case "--name-patterns":
+			namePatterns = true
+		case "--stream":
+			if i+1 < len(args) {
+				u, err := url.Parse(args[i+1])
+				if err != nil || (u.Scheme != "nats" && u.Scheme != "kafka") || u.Host == "" {
+					fmt.Println("Error: --stream must be nats://host:port[/subject] or kafka://broker:port[/topic]")
+					os.Exit(1)
+				}
+				streamURL = args[i+1]
+				i++
+			} else {
+				fmt.Println("Error: --stream requires a value: nats://host:port[/subject] or kafka://broker:port[/topic]")
+				os.Exit(1)
+			}
+		case "--where":
+			if i+1 < len(args) {
+				filter, err := compileExpr(args[i+1])
+				if err != nil {
+					fmt.Printf("Error: --where: %v\n", err)
+					os.Exit(1)
+				}
+				whereFilter = filter
+				i++
+			} else {
+				fmt.Println("Error: --where requires a condition such as 'size > 10GB && depth <= 3'")
+				os.Exit(1)
+			}
+		case "--upload":
+			if i+1 < len(args) {
+				u, err := url.Parse(args[i+1])
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					fmt.Println("Error: --upload must be an http:// or https:// URL")
+					os.Exit(1)
+				}
+				uploadURL = args[i+1]
+				i++
+			} else {
+				fmt.Println("Error: --upload requires a URL, e.g. https://collector.example.com/ingest")
+				os.Exit(1)
+			}
+		case "--upload-header":
+			if i+1 < len(args) {
+				name, value, ok := strings.Cut(args[i+1], ":")
+				if !ok || strings.TrimSpace(name) == "" {
+					fmt.Println("Error: --upload-header requires 'Name: value'")
+					os.Exit(1)
+				}
+				uploadHeaders = append(uploadHeaders, [2]string{strings.TrimSpace(name), strings.TrimSpace(value)})
+				i++
+			} else {
+				fmt.Println("Error: --upload-header requires 'Name: value'")
+				os.Exit(1)
+			}
+		case "--budget":
+			if i+1 < len(args) {
+				eq := strings.LastIndex(args[i+1], "=")
+				if eq <= 0 {
+					fmt.Println("Error: --budget requires <dir>=<size>, e.g. /srv/projects/alpha=2T")
+					os.Exit(1)
+				}
+				dir, err := filepath.Abs(args[i+1][:eq])
+				size, serr := parseSize(args[i+1][eq+1:])
+				if err != nil || serr != nil || size <= 0 {
+					fmt.Println("Error: --budget requires <dir>=<size>, e.g. /srv/projects/alpha=2T")
+					os.Exit(1)
+				}
+				budgets = append(budgets, dirBudget{dir, size})
+				i++
+			} else {
+				fmt.Println("Error: --budget requires <dir>=<size>, e.g. /srv/projects/alpha=2T")
+				os.Exit(1)
+			}
+		case "--ticket":
+			if i+1 < len(args) {
+				kind, ref, _ := strings.Cut(args[i+1], ":")
+				if kind == "github" && strings.Count(ref, "/") != 1 || kind == "jira" && ref == "" || kind != "github" && kind != "jira" {
+					fmt.Println("Error: --ticket requires github:<owner>/<repo> or jira:<project key>")
+					os.Exit(1)
+				}
+				ticketTarget = args[i+1]
+				i++
+			} else {
+				fmt.Println("Error: --ticket requires github:<owner>/<repo> or jira:<project key>")
+				os.Exit(1)
+			}
+		case "--ticket-api":
+			if i+1 < len(args) {
+				if u, err := url.Parse(args[i+1]); err != nil || u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+					fmt.Println("Error: --ticket-api requires a URL such as https://jira.example.com")
+					os.Exit(1)
+				}
+				ticketAPI = args[i+1]
+				i++
+			} else {
+				fmt.Println("Error: --ticket-api requires a URL such as https://jira.example.com")
+				os.Exit(1)
+			}
+		case "--ticket-header":
+			if i+1 < len(args) {
+				name, value, ok := strings.Cut(args[i+1], ":")
+				if !ok || strings.TrimSpace(name) == "" {
+					fmt.Println("Error: --ticket-header requires 'Name: value'")
+					os.Exit(1)
+				}
+				ticketHeaders = append(ticketHeaders, [2]string{strings.TrimSpace(name), strings.TrimSpace(value)})
+				i++
+			} else {
+				fmt.Println("Error: --ticket-header requires 'Name: value'")
+				os.Exit(1)
+			}
+		case "--ticket-template":
+			if i+1 < len(args) {
+				data, err := os.ReadFile(args[i+1])
+				if err == nil {
+					ticketBody, err = texttemplate.New(filepath.Base(args[i+1])).Funcs(templateFuncs).Parse(string(data))
+				}
+				if err != nil {
+					fmt.Printf("Error: --ticket-template: %v\n", err)
+					os.Exit(1)
+				}
+				i++
+			} else {
+				fmt.Println("Error: --ticket-template requires a file")
+				os.Exit(1)
+			}
+		case "--upload-retries":
+			if i+1 < len(args) {
+				val, err := strconv.Atoi(args[i+1])
+				if err != nil || val < 0 {
+					fmt.Println("Error: --upload-retries requires a non-negative number")
+					os.Exit(1)
+				}
+				uploadRetries = val
+				i++
+			}
+		case "--store":
+			if i+1 < len(args) {
+				collectorStore = args[i+1]
+				i++
+			} else {
+				fmt.Println("Error: --store requires a directory")
+				os.Exit(1)
+			}
+		case "--keep-daily", "--keep-weekly", "--keep-monthly":
+			n := -1
+			if i+1 < len(args) {
+				n, _ = strconv.Atoi(args[i+1])
+				i++
+			}
+			if n < 0 {
+				fmt.Printf("Error: %s requires a number of periods, e.g. %s 8\n", arg, arg)
+				os.Exit(1)
+			}
+			switch arg {
+			case "--keep-daily":
+				keepDaily = n
+			case "--keep-weekly":
+				keepWeekly = n
+			default:
+				keepMonthly = n
+			}
+		case "--dry-run":
+			dryRun = true
+		case "--interval":
+			if i+1 < len(args) {
+				d, err := time.ParseDuration(args[i+1])
+				if err != nil || d <= 0 {
+					fmt.Printf("Error: --interval must be a positive duration such as 10m, got %s\n", args[i+1])
+					os.Exit(1)
+				}
+				watchInterval = d
+				i++
+			} else {
+				fmt.Println("Error: --interval requires a duration such as 10m")
+				os.Exit(1)
+			}
+		case "--listen":
+			if i+1 < len(args) {
+				listenAddr = args[i+1]
+				i++
+			} else {
+				fmt.Println("Error: --listen requires an address such as :8931 or 127.0.0.1:8931")
+				os.Exit(1)
+			}
+		case "--offline":
+			offline = true
+		case "--strict-read-only":
+			strictReadOnly = true
+		case "--sign-key":
+			if i+1 < len(args) {
+				key, err := loadSigningKey(args[i+1])
+				if err != nil {
+					fmt.Printf("Error: --sign-key %s: %v\n", args[i+1], err)
+					os.Exit(1)
+				}
+				signKey = key
+				i++
+			} else {
+				fmt.Println("Error: --sign-key requires an Ed25519 private key file (PEM)")
+				os.Exit(1)
+			}
+		case "--key":
+			if i+1 < len(args) {
+				verifyKey = args[i+1]
+				i++
+			} else {
+				fmt.Println("Error: --key requires an Ed25519 public key file (PEM)")
+				os.Exit(1)
+			}
+		case "--tls-cert", "--tls-key":
+			if i+1 < len(args) {
+				if arg == "--tls-cert" {
+					tlsCert = args[i+1]
+				} else {
+					tlsKey = args[i+1]
+				}
+				i++
+			} else {
+				fmt.Printf("Error: %s requires a PEM file\n", arg)
+				os.Exit(1)
+			}
+		case "--access":
+			if i+1 < len(args) {
+				accessFile = args[i+1]
+				i++
+			} else {
+				fmt.Println("Error: --access requires a file")
+				os.Exit(1)
+			}
+		case "--run-as":
+			if i+1 < len(args) && args[i+1] != "" {
+				runAs = args[i+1]
+				i++
+			} else {
+				fmt.Println("Error: --run-as requires a user name or uid")
+				os.Exit(1)
+			}
+		case "--post-hook":
+			if i+1 < len(args) && strings.TrimSpace(args[i+1]) != "" {
+				postHooks = append(postHooks, args[i+1])
+				i++
+			} else {
+				fmt.Println("Error: --post-hook requires a command, e.g. 'logger -t fs-analyzer'")
+				os.Exit(1)
+			}
+		case "--analyzer":
+			if i+1 < len(args) && strings.TrimSpace(args[i+1]) != "" {
+				registerAnalyzer(&commandAnalyzer{Command: args[i+1]})
+				i++
+			} else {
+				fmt.Println("Error: --analyzer requires a command, e.g. './site-report --min-size 1G'")
+				os.Exit(1)
+			}
+		case "--add-column":
+			if i+1 < len(args) {
+				col, err := parseAddColumn(args[i+1])
+				if err != nil {
+					fmt.Printf("Error: --add-column: %v\n", err)
+					os.Exit(1)
+				}
+				addColumns = append(addColumns, col)
+				i++
+			} else {
+				fmt.Println("Error: --add-column requires a definition such as 'files_per_gb = files / (size/1e9)'")
+				os.Exit(1)
+			}
+		case "--partition-by":
+			if i+1 < len(args) {
+				partitionBy = nil
+				for _, key := range strings.Split(args[i+1], ",") {
+					key = strings.ToLower(strings.TrimSpace(key))
+					if key != "host" && key != "date" && key != "target" {
+						fmt.Printf("Error: Unknown partition key '%s' (use host, date, target)\n", key)
+						os.Exit(1)
+					}
+					partitionBy = append(partitionBy, key)
+				}
+				i++
+			} else {
+				fmt.Println("Error: --partition-by requires a comma-separated list of keys")
+				os.Exit(1)
+			}
+		case "--cost-per-gb":
+			if i+1 < len(args) {
+				val, err := strconv.ParseFloat(args[i+1], 64)
+				if err != nil || val < 0 {
+					fmt.Println("Error: --cost-per-gb requires a non-negative number, e.g. 0.023")
+					os.Exit(1)
+				}
+				costPerGB = val
+				i++
+			}
+		case "--currency":
+			if i+1 < len(args) {
+				currency = args[i+1]
+				i++
+			}
+		case "--project-markers":
+			if i+1 < len(args) {
+				projectMarkers = nil
+				for _, m := range strings.Split(args[i+1], ",") {
+					if m = strings.TrimSpace(m); m != "" {
+						projectMarkers = append(projectMarkers, m)
+					}
+				}
+				i++
+			}
+		case "--summary-fd":
+			if i+1 < len(args) {
+				val, err := strconv.Atoi(args[i+1])
+				if err != nil || val < 1 {
+					fmt.Println("Error: --summary-fd requires a file descriptor number (1 or higher)")
+					os.Exit(1)
+				}
+				summaryFD = val
+				i++
+			} else {
+				fmt.Println("Error: --summary-fd requires a file descriptor number")
+				os.Exit(1)
+			}
+		case "--summary-file":
+			if i+1 < len(args) {
+				summaryFile = args[i+1]
+				i++
+			} else {
+				fmt.Println("Error: --summary-file requires a file")
+				os.Exit(1)
+			}
+		case "--tags":
+			if i+1 < len(args) {
+				tagsFile = args[i+1]
+				i++
+			} else {
+				fmt.Println("Error: --tags requires a file")
+				os.Exit(1)
+			}
+		case "--assume-immutable":
+			dir, snap, ok := "", "", false
+			if i+1 < len(args) {
+				dir, snap, ok = strings.Cut(args[i+1], "=")
+			}
+			if !ok || dir == "" || snap == "" {
+				fmt.Println("Error: --assume-immutable requires <dir>=<snapshot>, e.g. /data/archive=archive.snap")
+				os.Exit(1)
+			}
+			abs, err := filepath.Abs(dir)
+			if err != nil {
+				fmt.Printf("Error: --assume-immutable: %v\n", err)
+				os.Exit(1)
+			}
+			immutableAreas = append(immutableAreas, &immutableArea{Dir: abs, Snapshot: snap})
+			i++
+		case "--save", "--load":
+			if i+1 < len(args) {
+				if arg == "--save" {
+					saveFile = args[i+1]
+				} else {
+					loadFile = args[i+1]
+				}
+				i++
+			} else {
+				fmt.Printf("Error: %s requires a file\n", arg)
+				os.Exit(1)
+			}
+		case "--from-listing":
+			if i+1 < len(args) {
+				fromListing = args[i+1]
+				i++
+			} else {
+				fmt.Println("Error: --from-listing requires a file")
+				os.Exit(1)
+			}
+		case "--sample":
+			if i+1 < len(args) {
+				raw := strings.TrimSpace(args[i+1])
+				percent := strings.HasSuffix(raw, "%")
+				val, err := strconv.ParseFloat(strings.TrimSuffix(raw, "%"), 64)
+				if percent {
+					val /= 100
+				}
+				if err != nil || val <= 0 || val > 1 {
+					fmt.Println("Error: --sample requires a share such as 10% or 0.1 (greater than 0, at most 100%)")
+					os.Exit(1)
+				}
+				sampleRate = val
+				i++
+			} else {
+				fmt.Println("Error: --sample requires a value such as 10% or 0.1")
+				os.Exit(1)
+			}
+		case "--metrics":
+			if i+1 < len(args) {
+				u, err := url.Parse(args[i+1])
+				if err != nil || (u.Scheme != "graphite" && u.Scheme != "statsd") || u.Host == "" {
+					fmt.Println("Error: --metrics must be graphite://host:port or statsd://host:port")
+					os.Exit(1)
+				}
+				metricsURL = args[i+1]
+				i++
+			} else {
+				fmt.Println("Error: --metrics requires a value: graphite://host:port or statsd://host:port")
+				os.Exit(1)
+			}
+		case "--metric-template":
+			if i+1 < len(args) {
+				metricTemplate = args[i+1]
+				i++
+			}
+		case "--metric-depth":
+			if i+1 < len(args) {
+				val, err := strconv.Atoi(args[i+1])
+				if err != nil {
+					fmt.Println("Error: --metric-depth requires a numeric value")
+					os.Exit(1)
+				}
+				metricDepth = val
+				i++
+			}
+		case "--otlp-endpoint":
+			if i+1 < len(args) {
+				u, err := url.Parse(args[i+1])
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+					fmt.Println("Error: --otlp-endpoint must be an http:// or https:// URL")
+					os.Exit(1)
+				}
+				otlpEndpoint = args[i+1]
+				i++
+			} else {
+				fmt.Println("Error: --otlp-endpoint requires a URL, e.g. http://localhost:4318")
+				os.Exit(1)
+			}
+		case "--trace-min-duration":
+			if i+1 < len(args) {
+				val, err := time.ParseDuration(args[i+1])
+				if err != nil {
+					fmt.Println("Error: --trace-min-duration requires a duration such as 500ms or 2s")
+					os.Exit(1)
+				}
+				traceMinDur = val
+				i++
+			}
+		case "--version":
+			if offlineBuild == "true" {
+				fmt.Printf("%s (%s/%s, offline build)\n", version, runtime.GOOS, runtime.GOARCH)
+			} else {
+				fmt.Printf("%s (%s/%s)\n", version, runtime.GOOS, runtime.GOARCH)
+			}
+			os.Exit(0)
+		case "-h", "--help":
+			printUsage()
+			os.Exit(0)
+		default:
+			fmt.Printf("Unknown option: %s\n", arg)
+			printUsage()
+			os.Exit(1)
+		}
+	}
+
+	if reportTemplate != nil && (outputFormat != "table" || emitExclude != "" || command != "" || len(analyzers) > 0) {
+		fmt.Println("Error: --template replaces the report and cannot be used with subcommands, --format, --emit-exclude-file or --analyzer")
+		os.Exit(1)
+	}
+	if outputFormat != "table" && outputFile == "" {
+		fmt.Printf("Error: --format %s requires --output <file>\n", outputFormat)
+		os.Exit(1)
+	}
+	if len(partitionBy) > 0 && !strings.HasPrefix(outputFile, "dir:") {
+		fmt.Println("Error: --partition-by requires --output dir:<dir>")
+		os.Exit(1)
+	}
+	if (command == "backup-gap") != (catalogFile != "") {
+		fmt.Println("Error: backup-gap requires --catalog <file>, and --catalog is only valid with backup-gap")
+		os.Exit(1)
+	}
+	if storeCommand := command == "collector" || command == "history"; storeCommand && collectorStore == "" ||
+		!storeCommand && collectorStore != "" && outputFormat != "pdf" {
+		fmt.Println("Error: collector and history require --store <dir>; otherwise --store is only valid with --format pdf")
+		os.Exit(1)
+	}
+	if (outputFormat == "pdf" || outputFormat == "dot") && strings.HasPrefix(outputFile, "dir:") {
+		fmt.Printf("Error: --format %s writes a single file, not --output dir:<dir>\n", outputFormat)
+		os.Exit(1)
+	}
+	if given["--dot-min-size"] && outputFormat != "dot" {
+		fmt.Println("Error: --dot-min-size is only valid with --format dot")
+		os.Exit(1)
+	}
+	if command == "history" {
+		if len(historyArgs) != 1 || (historyArgs[0] != "prune" && historyArgs[0] != "compact") {
+			fmt.Println("Error: history requires one action: prune or compact")
+			os.Exit(1)
+		}
+		if keepDaily+keepWeekly+keepMonthly == 0 {
+			fmt.Println("Error: history requires --keep-daily, --keep-weekly or --keep-monthly")
+			os.Exit(1)
+		}
+	} else if given["--keep-daily"] || given["--keep-weekly"] || given["--keep-monthly"] || dryRun {
+		fmt.Println("Error: --keep-daily, --keep-weekly, --keep-monthly and --dry-run are only valid with history")
+		os.Exit(1)
+	}
+	if command == "diff" && len(diffFiles) != 2 {
+		fmt.Println("Error: diff requires two snapshot files (--save): diff <old> <new>")
+		os.Exit(1)
+	}
+	if command == "watch" && (saveFile != "" || loadFile != "") {
+		fmt.Println("Error: watch saves its own snapshots and cannot be used with --save or --load")
+		os.Exit(1)
+	}
+	if ticketTarget != "" && (command != "check" || len(budgets) == 0) {
+		fmt.Println("Error: --ticket is only valid with check and at least one --budget")
+		os.Exit(1)
+	}
+	for _, name := range []string{"--ticket-api", "--ticket-header", "--ticket-template"} {
+		if given[name] && ticketTarget == "" {
+			fmt.Printf("Error: %s is only valid with --ticket\n", name)
+			os.Exit(1)
+		}
+	}
+	if strings.HasPrefix(ticketTarget, "jira:") && ticketAPI == "" {
+		fmt.Println("Error: --ticket jira:<project> requires --ticket-api with the Jira URL")
+		os.Exit(1)
+	}
+	if len(fullSpeed) > 0 && throttleRate == 0 {
+		fmt.Println("Error: --full-speed only applies with --throttle")
+		os.Exit(1)
+	}
+	if throttleRate > 0 && (loadFile != "" || fromListing != "") {
+		fmt.Println("Error: --throttle paces a scan and cannot be used with --load or --from-listing")
+		os.Exit(1)
+	}
+	if given["--interval"] && command != "watch" {
+		fmt.Println("Error: --interval is only valid with watch")
+		os.Exit(1)
+	}
+	if i := slices.Index(watchArgs, "--interval"); i >= 0 && i+1 < len(watchArgs) {
+		watchArgs = slices.Delete(watchArgs, i, i+2)
+	}
+	if command == "check" && entryLimit == 0 && !pathLengths && !symlinkReport && !crashDumps && !tempReport && !permReport && len(budgets) == 0 {
+		fmt.Println("Error: check requires at least one check: --entry-limit, --path-lengths, --symlinks, --crash-dumps, --temp-files, --permissions or --budget")
+		os.Exit(1)
+	}
+	if (command == "verify-report") != (verifyKey != "") {
+		fmt.Println("Error: verify-report requires --key <public key>, and --key is only valid with verify-report")
+		os.Exit(1)
+	}
+	if command == "verify-report" && len(verifyFiles) == 0 {
+		fmt.Println("Error: verify-report requires one or more files to verify")
+		os.Exit(1)
+	}
+	if signKey != nil && saveFile == "" && summaryFile == "" && outputFile == "" {
+		fmt.Println("Error: --sign-key signs the files of --save, --summary-file and --output; give at least one of them")
+		os.Exit(1)
+	}
+	if offline {
+		for _, name := range []string{"--upload", "--stream", "--metrics", "--otlp-endpoint", "--ticket"} {
+			if given[name] {
+				fmt.Printf("Error: %s connects to other hosts and cannot be used in offline mode\n", name)
+				os.Exit(1)
+			}
+		}
+		if command == "collector" {
+			fmt.Println("Error: collector accepts network connections and cannot be used in offline mode")
+			os.Exit(1)
+		}
+	}
+	if strictReadOnly {
+		for _, name := range []string{"--save", "--output", "--summary-file", "--sign-key", "--store", "--chart", "--departments"} {
+			if given[name] {
+				fmt.Printf("Error: %s writes files and cannot be used in strict read-only mode\n", name)
+				os.Exit(1)
+			}
+		}
+		for _, name := range []string{"--post-hook", "--analyzer", "--zfs", "--reconcile"} {
+			if given[name] {
+				fmt.Printf("Error: %s runs other programs, which may write, and cannot be used in strict read-only mode\n", name)
+				os.Exit(1)
+			}
+		}
+		if command == "collector" || command == "watch" || command == "history" && !dryRun || command == "tag" && len(tagArgs) > 0 {
+			fmt.Printf("Error: %s writes files and cannot be used in strict read-only mode\n", command)
+			os.Exit(1)
+		}
+		// A pager such as less keeps a history file
+		usePager = false
+	}
+	if accessFile != "" && command != "collector" {
+		fmt.Println("Error: --access is only valid with collector")
+		os.Exit(1)
+	}
+	if runAs != "" && command != "collector" {
+		fmt.Println("Error: --run-as is only valid with collector")
+		os.Exit(1)
+	}
+	if (tlsCert != "" || tlsKey != "") && command != "collector" || (tlsCert == "") != (tlsKey == "") {
+		fmt.Println("Error: --tls-cert and --tls-key are only valid together, with collector")
+		os.Exit(1)
+	}
+	// Tokens and basic-auth passwords must not cross the network in clear text
+	if command == "collector" && tlsCert == "" {
+		if !given["--listen"] {
+			listenAddr = "127.0.0.1:8931"
+		} else if !isLoopbackAddr(listenAddr) {
+			fmt.Printf("Error: collector without TLS only listens on a loopback address: give --tls-cert and --tls-key, or --listen 127.0.0.1:%s behind a TLS proxy\n", listenPort(listenAddr))
+			os.Exit(1)
+		}
+	}
+	if (command == "plan-copy") != (shardCount > 0) {
+		fmt.Println("Error: plan-copy requires --shards <N>, and --shards is only valid with plan-copy")
+		os.Exit(1)
+	}
+	if (command == "simulate-retention") != (len(retentionRules) > 0) {
+		fmt.Println("Error: simulate-retention requires at least one --rule or --rules, and rules are only valid with simulate-retention")
+		os.Exit(1)
+	}
+
+	if permReport && (fromListing != "" || runtime.GOOS == "windows") {
+		fmt.Println("Error: --permissions needs Unix file modes from a file system scan (not available with --from-listing or on Windows)")
+		os.Exit(1)
+	}
+	if symlinkReport && fromListing != "" {
+		fmt.Println("Error: --symlinks reads link targets and cannot be used with --from-listing")
+		os.Exit(1)
+	}
+	if deletedOpen && (runtime.GOOS != "linux" || fromListing != "") {
+		fmt.Println("Error: --deleted-open inspects the open files of running processes through /proc (Linux only, not with --from-listing)")
+		os.Exit(1)
+	}
+	if reconcile && (runtime.GOOS == "windows" || sizeMode == "apparent" || fromListing != "" || loadFile != "") {
+		fmt.Println("Error: --reconcile compares a file system scan in --size-mode disk with df (not on Windows, with --from-listing or --load)")
+		os.Exit(1)
+	}
+	if specialFiles && fromListing != "" {
+		fmt.Println("Error: --special-files needs the file types from a file system scan and cannot be used with --from-listing")
+		os.Exit(1)
+	}
+	if regenerable && fromListing != "" {
+		fmt.Println("Error: --regenerable checks for the source of each file and cannot be used with --from-listing")
+		os.Exit(1)
+	}
+	if versionedFiles && fromListing != "" {
+		fmt.Println("Error: --versioned-files checks for the unversioned name of each family and cannot be used with --from-listing")
+		os.Exit(1)
+	}
+	if (command == "dev" || command == "git-repos" || command == "mail") && fromListing != "" {
+		fmt.Printf("Error: %s checks the files in each directory and cannot be used with --from-listing\n", command)
+		os.Exit(1)
+	}
+	if command == "dupes" {
+		if saveFile != "" || maxMemory > 0 {
+			fmt.Println("Error: dupes computes its own fingerprints and cannot be used with --save or --max-memory")
+			os.Exit(1)
+		}
+		fingerprint = true
+		hashMtimes = false
+	}
+	if len(immutableAreas) > 0 && (fromListing != "" || loadFile != "" || fingerprint) {
+		fmt.Println("Error: --assume-immutable merges snapshots into a file system scan and cannot be used with --from-listing, --load or --fingerprint")
+		os.Exit(1)
+	}
+	if progressive && (fromListing != "" || loadFile != "") {
+		fmt.Println("Error: --progressive shows the progress of a file system scan and cannot be used with --from-listing or --load")
+		os.Exit(1)
+	}
+	if maxMemory > 0 {
+		// These keep per-directory state that cannot be folded into an ancestor
+		var conflicts []string
+		for _, name := range []string{"--from-listing", "--load", "--fingerprint", "--fingerprint-content", "--sample", "--slowest"} {
+			if given[name] {
+				conflicts = append(conflicts, name)
+			}
+		}
+		if len(conflicts) > 0 {
+			fmt.Printf("Error: --max-memory cannot be combined with %s\n", strings.Join(conflicts, ", "))
+			os.Exit(1)
+		}
+	}
+	if len(analyzers) > 0 && (command != "" || outputFormat != "table" || emitExclude != "") {
+		fmt.Println("Error: --analyzer adds sections to the scan report and cannot be used with subcommands, --format or --emit-exclude-file")
+		os.Exit(1)
+	}
+	if slowestN > 0 && fromListing != "" {
+		fmt.Println("Error: --slowest measures the file system scan and cannot be used with --from-listing")
+		os.Exit(1)
+	}
+
+	if loadFile != "" {
+		// Everything that needs individual files (or the walk itself) is gone from a snapshot
+		var needScan []string
+		if command != "" {
+			needScan = append(needScan, command)
+		}
+		for _, name := range []string{"--from-listing", "--exclude", "--maxdepth", "--sample", "--by-project",
+			"--name-patterns", "--path-lengths", "--name-audit", "--target-fs", "--btrfs-subvolumes",
+			"--only-mine", "--fingerprint-content", "--otlp-endpoint", "--crash-dumps", "--symlinks", "--special-files", "--temp-files", "--regenerable", "--versioned-files"} {
+			if given[name] {
+				needScan = append(needScan, name)
+			}
+		}
+		if len(needScan) > 0 {
+			fmt.Printf("Error: --load cannot be combined with %s (they need a file system scan)\n", strings.Join(needScan, ", "))
+			os.Exit(1)
+		}
+	}
+
+	if len(targetPaths) == 0 && fromListing == "" && loadFile == "" {
+		// Default to current directory if no path specified
+		targetPaths = append(targetPaths, ".")
+	}
+}
+
+// expandProfile removes --config/--profile from args and, if a profile was requested, prepends the
+// options stored in it. Options given on the command line are parsed later and therefore win for
+// single-value options; list options (--path, --exclude) are combined.
+func expandProfile(args []string) []string {
+	configFile, profile := "", ""
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--config", "--profile":
+			if i+1 >= len(args) || strings.HasPrefix(args[i+1], "--") {
+				fmt.Printf("Error: %s requires a value\n", args[i])
+				os.Exit(1)
+			}
+			if args[i] == "--config" {
+				configFile = args[i+1]
+			} else {
+				profile = args[i+1]
+			}
+			i++
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	if profile == "" {
+		return rest
+	}
+
+	if configFile == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			fmt.Printf("Error: Could not locate the user config directory: %v\n", err)
+			os.Exit(1)
+		}
+		configFile = filepath.Join(dir, "fs-analyzer", "profiles.conf")
+	}
+	profileArgs, err := loadProfile(configFile, profile)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	return append(profileArgs, rest...)
+}
+
+// loadProfile reads the [name] section of an INI-style config file and turns every
+// "option = value" line into command-line arguments ("--option value"). Boolean options are
+// written as "option = true"; list options such as path or exclude may be repeated.
+func loadProfile(configFile, name string) ([]string, error) {
+	f, err := os.Open(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %v", err)
+	}
+	defer f.Close()
+
+	var args []string
+	found, inSection := false, false
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			inSection = strings.TrimSpace(line[1:len(line)-1]) == name
+			found = found || inSection
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected \"option = value\"", configFile, lineNo)
+		}
+		key = "--" + strings.TrimPrefix(strings.TrimSpace(key), "--")
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(value) {
+		case "true":
+			args = append(args, key)
+		case "false":
+		default:
+			args = append(args, key, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("profile %q not found in %s", name, configFile)
+	}
+	return args, nil
+}
+
+func printUsage() {
+	fmt.Println("Usage: find_heavy_dirs [--path <path1> path2...] [--exclude <path1> path2...] [--size-mode <disk|apparent>] [--maxdepth <N>] [--top <N>] [--all] [--min-size <size>] [--no-pager] [--precision <N>] [--round <up|down|nearest>] [--exact-bytes] [--locale <name|auto>] [--collapse-chains] [--unique-top] [--sample <P>] [--metrics <url>] [--metric-template <tpl>] [--metric-depth <N>] [--otlp-endpoint <url>] [--trace-min-duration <d>] [--save <file>] [--load <file>] [--assume-immutable <dir>=<snapshot>] [--tags <file>] [--from-listing <file>] [--rewrite <re>=<path>] [--anonymize] [--relative] [--only-mine [uid]] [--by-project] [--project-markers <list>] [--departments <file.csv>] [--group-by-component <N>] [--path-template <tpl>] [--cost-per-gb <price>] [--currency <code>] [--format <table|parquet|csv|pdf|dot>] [--dot-min-size <size>] [--output <file|dir:dir>] [--template <file>] [--chart <file>] [--partition-by <keys>] [--where <cond>] [--add-column <name=expr>] [--analyzer <cmd>] [--stream <url>] [--name-patterns] [--entry-limit <N>] [--crash-dumps] [--symlinks] [--special-files] [--deleted-open] [--reconcile] [--temp-files <age>] [--regenerable] [--versioned-files] [--permissions] [--slowest <N>] [--path-lengths] [--name-audit] [--target-fs <fs>] [--fingerprint] [--fingerprint-content] [--emit-exclude-file <rsync|borg|restic>] [--exclude-older-than <age>] [--exclude-larger-than <size>] [--skip-cross-os] [--btrfs-subvolumes] [--zfs] [--profile <name>] [--config <file>] [--gogc <N|off>] [--memory-limit <size>] [--max-memory <size>] [--throttle <N>] [--full-speed <ranges>] [--resource-usage] [--summary-fd <N>] [--summary-file <file>] [--upload <url>] [--upload-header <h>] [--upload-retries <N>] [--budget <dir>=<size>] [--post-hook <cmd>] [--offline] [--strict-read-only] [--sign-key <file>] [--verbose] [--progressive] [--display-runtime] [--version]")
+	fmt.Println("       find_heavy_dirs simulate-retention --rule <rule> [--rule <rule>...] [--rules <file>] [options]")
+	fmt.Println("       find_heavy_dirs backup-gap --catalog <file> [--catalog-root <dir>] [options]")
+	fmt.Println("       find_heavy_dirs plan-copy --shards <N> [--balance bytes|files] [--output <dir>] [options]")
+	fmt.Println("       find_heavy_dirs heavy-files-by-type [options]")
+	fmt.Println("       find_heavy_dirs logs [options]")
+	fmt.Println("       find_heavy_dirs dev [--project-markers <list>] [options]")
+	fmt.Println("       find_heavy_dirs git-repos [options]")
+	fmt.Println("       find_heavy_dirs databases [options]")
+	fmt.Println("       find_heavy_dirs mail [options]")
+	fmt.Println("       find_heavy_dirs tag [<dir> [key=value | flag | -key ...]] [--tags <file>]")
+	fmt.Println("       find_heavy_dirs collector --store <dir> [--listen <addr>] [--tls-cert <file> --tls-key <file>] [--access <file>] [--run-as <user>]")
+	fmt.Println("       find_heavy_dirs verify-report --key <public key> <file>...")
+	fmt.Println("       find_heavy_dirs history <prune|compact> --store <dir> [--keep-daily <N>] [--keep-weekly <N>] [--keep-monthly <N>] [--dry-run]")
+	fmt.Println("       find_heavy_dirs check [--entry-limit <N>] [--path-lengths] [--symlinks] [--crash-dumps] [--temp-files <age>] [--permissions] [--budget <dir>=<size>] [--ticket <tracker>] [options]")
+	fmt.Println("       find_heavy_dirs diff <old snapshot> <new snapshot> [--top <N>] [--all]")
+	fmt.Println("       find_heavy_dirs watch [--interval <duration>] [--throttle <N> [--full-speed <ranges>]] [options]")
+	fmt.Println("       find_heavy_dirs dupes [--fingerprint-content] [--min-size <size>] [options]")
+	fmt.Println("       fs-analyzer scan|serve|check|diff|watch|dupes|history|<report> [options]  (as fs-analyzer, a subcommand is required)")
+	fmt.Println("Options:")
+	fmt.Println("  --path <path...>: One or more paths to search. Default is current directory.")
+	fmt.Println("  --exclude <path...>: One or more subpaths to exclude from scanning and statistics.")
+	fmt.Println("  --size-mode <disk|apparent>: Size metric mode. Default is disk (Windows falls back to apparent).")
+	fmt.Println("  --maxdepth <N>:   Limit the search to N levels deep. Default is 1000000.")
+	fmt.Println("  --top <N>:        Display the top N entries. Default is 20.")
+	fmt.Println("  --all:            List every directory in the size and file count rankings (paged on a terminal).")
+	fmt.Println("  --precision <N>:  Decimals of displayed sizes (0-6). Default is 1.")
+	fmt.Println("  --round <up|down|nearest>: Rounding of displayed sizes. Default is nearest.")
+	fmt.Println("  --exact-bytes:    Add the exact size in bytes to the size rankings and diff.")
+	fmt.Println("  --locale <name|auto>: Thousands and decimal separators of the tables, e.g. en, de, fr_CH or auto (LANG).")
+	fmt.Println("  --min-size <size>:Only report directories of at least <size>, e.g. 1G.")
+	fmt.Println("  --no-pager:       Do not page --all output through $PAGER (default less -FRX).")
+	fmt.Println("  --collapse-chains:Merge single-child chains of near-identical size into one entry (a/…/d).")
+	fmt.Println("  --unique-top:     Replace ancestors that are >=95% one listed descendant by that descendant.")
+	fmt.Println("  --sample <P>:     Walk only a share P (e.g. 10% or 0.1) of the subtrees at depth 2 and extrapolate.")
+	fmt.Println("  --metrics <url>:  Push size/file-count gauges to graphite://host:port or statsd://host:port.")
+	fmt.Println("  --metric-template <tpl>: Metric name template. Default is fs_analyzer.{host}.{path}.{metric}.")
+	fmt.Println("  --metric-depth <N>: Only push directories up to N levels below the target. Default is 2.")
+	fmt.Println("  --otlp-endpoint <url>: Export scan traces and metrics via OTLP/HTTP (JSON), e.g. http://localhost:4318.")
+	fmt.Println("  --trace-min-duration <d>: Emit a span for every subtree that took at least this long. Default is 1s.")
+	fmt.Println("  --skip-cross-os:  Skip mounts of another OS's file systems (WSL /mnt/c drvfs, 9p, VM shared folders).")
+	fmt.Println("  --btrfs-subvolumes: Detect btrfs subvolumes/snapshots and report them as separate roots.")
+	fmt.Println("  --save <file>:    Save the aggregated scan to a snapshot file (for --load).")
+	fmt.Println("  --load <file>:    Re-report from a snapshot saved with --save instead of scanning.")
+	fmt.Println("  --tags <file>:    Directory tags file (default <config dir>/fs-analyzer/tags.json), shown in reports.")
+	fmt.Println("  --assume-immutable <dir>=<snapshot>: Take a read-only subtree from a snapshot (--save) instead of walking it.")
+	fmt.Println("  --from-listing <file>: Build the reports from a CSV/JSON listing (path,size,mtime,uid) instead of scanning.")
+	fmt.Println("  --rewrite <re>=<path>: Rewrite leading path parts in reports and exports, e.g. '/mnt/data[0-9]+=/data'. Repeatable.")
+	fmt.Println("  --anonymize:      Replace path components by stable hashes (depth and extensions are kept).")
+	fmt.Println("  --relative:       Show the paths of the rankings relative to their scan root, named once in the header.")
+	fmt.Println("  --only-mine [uid]: Count only files owned by the invoking user (or uid); skip unreadable directories of others.")
+	fmt.Println("  --by-project:     Report usage per project/owner (nearest .git, go.mod, package.json or .owner).")
+	fmt.Println("  --project-markers <list>: Comma-separated marker names for --by-project and dev. Default is .git,go.mod,package.json,.owner.")
+	fmt.Println("  --departments <file.csv>: Report the directories right below each path with their owner, size and last activity, and write them with per-owner totals to a CSV file.")
+	fmt.Println("  --group-by-component <N>: Report usage per name of the Nth path component, e.g. 3 for /srv/tenants/<name>.")
+	fmt.Println("  --path-template <tpl>: Extract labels from paths, e.g. '/data/{team}/{project}/**', and report usage per label. Repeatable.")
+	fmt.Println("  --cost-per-gb <price>: Annotate sizes with a monthly cost estimate (price per GiB and month).")
+	fmt.Println("  --currency <code>: Currency label for --cost-per-gb. Default is USD.")
+	fmt.Println("  --format <table|parquet|csv|pdf|dot>: Output format. Default is table; parquet/csv write every directory to --output, pdf a report, dot a Graphviz graph.")
+	fmt.Println("  --dot-min-size <size>: Smallest directory in the --format dot graph. Default is 1% of the total.")
+	fmt.Println("  --output <file|dir:dir>: Output file for non-table formats and --template, or dir:<dir> for a partitioned data set.")
+	fmt.Println("  --template <file>: Render the report with a Go template instead of the tables (html/template for .html files).")
+	fmt.Println("  --chart <file>: Also draw the tree as sunburst.svg, flame.svg or flame.folded (speedscope). Repeatable.")
+	fmt.Println("  --where <cond>:   Only report directories matching a condition, e.g. 'size > 10GB && path =~ \"cache\"'.")
+	fmt.Println("  --add-column <name=expr>: Add a computed column, e.g. 'files_per_gb = files / (size/1e9)'. Repeatable.")
+	fmt.Println("  --analyzer <cmd>: Run a report plugin: gets every directory as JSON lines on stdin, prints the sections it returns. Repeatable.")
+	fmt.Println("  --partition-by <keys>: Comma-separated partition keys for --output dir:<dir> (host, date, target).")
+	fmt.Println("  --rule <rule>:    simulate-retention: \"delete <glob> [older than <age>]\" or \"keep <N> newest [<glob>] per directory\".")
+	fmt.Println("  --rules <file>:   simulate-retention: Read rules from a file, one per line (# comments).")
+	fmt.Println("  --catalog <file>: backup-gap: Backup listing (restic ls --json, borg list --json-lines or tar -tv output).")
+	fmt.Println("  --catalog-root <dir>: backup-gap: Prefix for relative catalog paths (borg, tar). Default is /.")
+	fmt.Println("  --shards <N>:     plan-copy: Split the targets into N shards of about equal size.")
+	fmt.Println("  --balance <bytes|files>: plan-copy: Balance shards by bytes or file count. Default is bytes.")
+	fmt.Println("  --emit-exclude-file <rsync|borg|restic>: Write an exclude list (caches, temp dirs, thresholds) to --output or stdout instead of the reports.")
+	fmt.Println("  --exclude-older-than <age>: --emit-exclude-file: Also exclude directories unchanged for <age> (e.g. 180d, 2y).")
+	fmt.Println("  --exclude-larger-than <size>: --emit-exclude-file: Also exclude directories of at least <size> (e.g. 50G).")
+	fmt.Println("  --entry-limit <N>: Report directories with more than N direct entries. Default is 100000 (0 disables).")
+	fmt.Println("  --temp-files <age>: Report temporary files (~, .swp, .tmp, .partial, tmp/ dirs, ...) older than <age> per directory.")
+	fmt.Println("  --regenerable:    Report derived files (thumbnails, transcodes, .pyc, source maps, ...) whose source is next to them.")
+	fmt.Println("  --versioned-files: Report families of versioned files (report_v1.docx ... report_v27_final.docx) and the space of all but the newest.")
+	fmt.Println("  --symlinks:       Report symlinks by target and per directory, flagging broken links and links leaving the scanned roots.")
+	fmt.Println("  --special-files:  Report sockets, FIFOs and device nodes per directory (leftover runtime state).")
+	fmt.Println("  --deleted-open:   Linux: Report deleted files still held open (per process and original directory), the usual df/du gap.")
+	fmt.Println("  --reconcile:      Compare the scan with df per file system and itemize the gap (open deleted files, hard links, ...).")
+	fmt.Println("  --crash-dumps:    Report core dumps, minidumps, JVM crash logs and heap dumps with their ages.")
+	fmt.Println("  --permissions: Report group/other-writable and setuid/setgid files and the widest modes per directory.")
+	fmt.Println("  --slowest <N>: Report the N directories that took longest to scan per entry. Default is 0 (off).")
+	fmt.Println("  --path-lengths:   Report the deepest nesting levels and longest paths (MAX_PATH/PATH_MAX offenders).")
+	fmt.Println("  --name-audit:     Report names with invalid UTF-8, control characters, trailing space/dot, case collisions or Windows device names.")
+	fmt.Println("  --target-fs <fs>: Report entries that would break on ntfs, exfat, fat32, apfs or ext4 (lengths, names, sizes, links, case).")
+	fmt.Println("  --fingerprint:    Compute a Merkle-style fingerprint per directory (names, sizes, mtimes) for exports.")
+	fmt.Println("  --fingerprint-content: With --fingerprint, also hash file contents (reads every file).")
+	fmt.Println("  --name-patterns:  Report generated file name families (digits/dates/ids as *) by size and count.")
+	fmt.Println("  --stream <url>:   Publish every directory as a JSON message to nats://host:port/subject or kafka://broker:port/topic.")
+	fmt.Println("  --zfs:            Reconcile scanned totals with ZFS dataset used/referenced/snapshot space.")
+	fmt.Println("  --profile <name>: Apply a named profile (paths, excludes, options) from the config file.")
+	fmt.Println("  --config <file>:  Config file with profiles. Default is <user config dir>/fs-analyzer/profiles.conf.")
+	fmt.Println("  --gogc <N|off>:   Garbage collector target percentage (like GOGC). Default is the GOGC environment value or 100.")
+	fmt.Println("  --memory-limit <size>: Soft memory limit for the Go runtime (like GOMEMLIMIT), e.g. 4G. Default is no limit.")
+	fmt.Println("  --max-memory <size>: Soft memory limit: near it, deep directories are folded into their ancestors (e.g. 512M).")
+	fmt.Println("  --throttle <N>: Walk at most N directory entries per second, to spare production I/O.")
+	fmt.Println("  --full-speed <ranges>: Times of day (local) without --throttle, e.g. 01:00-05:00. Repeatable.")
+	fmt.Println("  --resource-usage: Report the scanner's own peak RSS, CPU time, syscalls and GC pauses at the end.")
+	fmt.Println("  --summary-fd <N>: Write a JSON summary (totals, duration, errors, threshold violations) to file descriptor N.")
+	fmt.Println("  --summary-file <file>: Write the JSON summary to a file instead.")
+	fmt.Println("  --upload <url>: POST the report (summary and directories as gzip-compressed JSON) to a collector.")
+	fmt.Println("  --upload-header <h>: Extra request header for --upload, e.g. 'Authorization: Bearer ...'. Repeatable.")
+	fmt.Println("  --upload-retries <N>: Retries of a failed upload (network errors, 429, 5xx). Default is 3.")
+	fmt.Println("  --budget <dir>=<size>: Size a directory may grow to; over it, check fails (dirs_over_budget). Repeatable.")
+	fmt.Println("  --ticket <tracker>: check: Open or update an issue per directory over budget: github:<owner>/<repo> or jira:<project>.")
+	fmt.Println("  --ticket-api <url>: API base URL for --ticket (GitHub Enterprise, Jira). Default is https://api.github.com.")
+	fmt.Println("  --ticket-header <h>: Extra request header for --ticket, e.g. 'Authorization: Basic ...'. Repeatable.")
+	fmt.Println("  --ticket-template <file>: Go text template for the issue text (fields Path, Host, Size, Budget, Files, Children).")
+	fmt.Println("  --store <dir>: collector, history: Directory of the received reports (created if missing); --format pdf: trend source.")
+	fmt.Println("  --listen <addr>: collector: Address to listen on. Default is :8931 with TLS, 127.0.0.1:8931 without.")
+	fmt.Println("  --tls-cert <file>: collector: TLS certificate (PEM); required to listen on other than a loopback address.")
+	fmt.Println("  --tls-key <file>: collector: Private key (PEM) of --tls-cert.")
+	fmt.Println("  --access <file>: collector: Users with tokens, roles (admin, viewer, uploader) and host/path scopes.")
+	fmt.Println("  --run-as <user>: collector: Switch to this user after opening the listening socket (Unix).")
+	fmt.Println("  --keep-daily <N>: history: Keep one report per day for the N most recent days with reports.")
+	fmt.Println("  --keep-weekly <N>: history: Then one report per ISO week for N weeks.")
+	fmt.Println("  --keep-monthly <N>: history: Then one report per month for N months; older reports are removed.")
+	fmt.Println("  --interval <duration>: watch: Time between scans. Default is 10m.")
+	fmt.Println("  --dry-run:        history: Only show what would be merged and removed.")
+	fmt.Println("  --post-hook <cmd>: Run a command after the scan with the JSON summary on stdin and FS_ANALYZER_* variables. Repeatable.")
+	fmt.Println("  --offline:        Refuse every network connection (upload, stream, metrics, traces, collector).")
+	fmt.Println("  --strict-read-only: Refuse every option that writes files, run no pager, and read without updating access times (O_NOATIME, Linux).")
+	fmt.Println("  --sign-key <file>: Sign the snapshot, summary file and exports with an Ed25519 key (PEM), writing <file>.sig.")
+	fmt.Println("  --key <file>:     verify-report: Ed25519 public key (PEM) to check the signatures with.")
+	fmt.Println("  --verbose:        Show detailed progress information.")
+	fmt.Println("  --progressive:    Show first-level subdirectories within seconds, then update their sizes while scanning.")
+	fmt.Println("  --display-runtime:Show total execution time.")
+	fmt.Println("  --version:        Show program version.")
+	fmt.Println("  -h, --help:       Show this help message.")
+}
+
+// listenPort returns the port of a listen address, 8931 if it has none
+func listenPort(addr string) string {
+	if _, port, err := net.SplitHostPort(addr); err == nil && port != "" {
+		return port
+	}
+	return "8931"
+}
+
+// isLoopbackAddr reports whether a listen address only accepts connections from this host
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,1063 @@
+//go:build !offline
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Collector ---
+//
+// The collector subcommand is the receiving end of --upload: it stores every report below
+// --store as <host>/<start>.json.gz (the document as uploaded) plus <host>/<start>.summary.json,
+// and answers fleet-wide queries from the latest report of each host. Plain files keep it free of
+// database dependencies; the reports can be re-read or archived with ordinary tools.
+
+// collectorHost holds the summaries of a host's reports (oldest first) and its latest report
+type collectorHost struct {
+	Summaries []runSummary
+	latest    *uploadDocument // Loaded on first use
+}
+
+type collector struct {
+	mu      sync.Mutex
+	dir     string
+	token   string           // Bearer token required for /ingest (FS_ANALYZER_UPLOAD_TOKEN), empty for none
+	users   []*collectorUser // From --access; nil for open reads
+	hosts   map[string]*collectorHost
+	uploads chan struct{} // One slot per upload being received (maxUploads)
+	// Clients of /api/events, each told the host of every report stored
+	watchers map[chan string]struct{}
+}
+
+// collectorUser is a team or service with access to the collector (--access). Admins see and
+// upload everything, viewers read within their scope, uploaders may only upload for their hosts.
+type collectorUser struct {
+	Name  string   `json:"name"`
+	Token string   `json:"token"`
+	Role  string   `json:"role"`            // admin, viewer or uploader
+	Hosts []string `json:"hosts,omitempty"` // Host name patterns (* ? [...]), empty for all hosts
+	Paths []string `json:"paths,omitempty"` // Path prefixes, empty for all paths
+}
+
+// loadAccess reads the users of an --access file: {"users": [{"name": ..., "token": ..., ...}]}
+func loadAccess(name string) ([]*collectorUser, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Users []*collectorUser `json:"users"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	tokens := make(map[string]bool)
+	for _, u := range file.Users {
+		if u.Role != "admin" && u.Role != "viewer" && u.Role != "uploader" {
+			return nil, fmt.Errorf("user %q: role must be admin, viewer or uploader", u.Name)
+		}
+		if u.Token == "" || tokens[u.Token] {
+			return nil, fmt.Errorf("user %q: every user needs a token of their own", u.Name)
+		}
+		tokens[u.Token] = true
+		for _, p := range u.Hosts {
+			if _, err := filepath.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("user %q: host pattern %q: %v", u.Name, p, err)
+			}
+		}
+	}
+	if len(file.Users) == 0 {
+		return nil, fmt.Errorf("no users defined")
+	}
+	return file.Users, nil
+}
+
+func (u *collectorUser) seesHost(host string) bool {
+	if len(u.Hosts) == 0 {
+		return true
+	}
+	for _, p := range u.Hosts {
+		if ok, _ := filepath.Match(p, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *collectorUser) seesPath(p string) bool {
+	if len(u.Paths) == 0 {
+		return true
+	}
+	for _, prefix := range u.Paths {
+		if isPathEqualOrSubpath(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize returns the user making the request if it may upload (upload) or read (!upload), and
+// otherwise answers the request itself. The token is sent as bearer token or, for browsers, as
+// the password of HTTP basic authentication.
+func (c *collector) authorize(w http.ResponseWriter, r *http.Request, upload bool) *collectorUser {
+	token := ""
+	if v, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		token = v
+	} else if _, pass, ok := r.BasicAuth(); ok {
+		token = pass
+	}
+
+	var user *collectorUser
+	switch {
+	case upload && c.token != "" && tokenEqual(token, c.token):
+		user = &collectorUser{Name: "upload token", Role: "uploader"}
+	case c.users == nil:
+		// Without --access reads are open and uploads need the upload token, if one is set
+		if !upload || c.token == "" {
+			user = &collectorUser{Name: "anonymous", Role: "admin"}
+		}
+	default:
+		for _, u := range c.users {
+			if tokenEqual(u.Token, token) {
+				user = u
+			}
+		}
+	}
+	if user == nil {
+		if !upload {
+			w.Header().Set("WWW-Authenticate", `Basic realm="fs-analyzer collector"`)
+		}
+		http.Error(w, "invalid or missing token", http.StatusUnauthorized)
+		return nil
+	}
+	if upload && user.Role == "viewer" {
+		http.Error(w, user.Name+" may not upload reports", http.StatusForbidden)
+		return nil
+	}
+	if !upload && user.Role == "uploader" {
+		http.Error(w, user.Name+" may not read reports", http.StatusForbidden)
+		return nil
+	}
+	return user
+}
+
+// tokenEqual compares tokens in constant time, so that response times do not tell an attacker
+// how much of a guessed token was right
+func tokenEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+const (
+	// maxUploadSize limits an uploaded report as sent (--upload compresses it with gzip)
+	maxUploadSize = 256 << 20
+	// maxReportSize limits the JSON of a report after decompression, so that a small gzip bomb
+	// cannot exhaust the collector's memory
+	maxReportSize = 2 << 30
+	// maxUploads is the number of uploads received at the same time; more are asked to retry
+	maxUploads = 4
+)
+
+func runCollector() {
+	c := &collector{dir: collectorStore, token: os.Getenv("FS_ANALYZER_UPLOAD_TOKEN"), hosts: make(map[string]*collectorHost),
+		uploads: make(chan struct{}, maxUploads), watchers: make(map[chan string]struct{})}
+	if accessFile != "" {
+		users, err := loadAccess(accessFile)
+		if err != nil {
+			fmt.Printf("Error reading access file %s: %v\n", accessFile, err)
+			os.Exit(1)
+		}
+		c.users = users
+	}
+	if err := c.load(); err != nil {
+		fmt.Printf("Error reading store %s: %v\n", collectorStore, err)
+		os.Exit(1)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ingest", c.handleIngest)
+	mux.HandleFunc("/api/hosts", c.handleHosts)
+	mux.HandleFunc("/api/history", c.handleHistory)
+	mux.HandleFunc("/api/dirs", c.handleDirs)
+	mux.HandleFunc("/api/events", c.handleEvents)
+	mux.HandleFunc("/", c.handleDashboard)
+	fmt.Printf("Collector listening on %s (store %s, %d host(s))\n", listenAddr, collectorStore, len(c.hosts))
+	if c.users == nil {
+		fmt.Println("Warning: No --access file, every client can read all reports")
+	}
+	if c.token == "" && c.users == nil {
+		fmt.Println("Warning: FS_ANALYZER_UPLOAD_TOKEN is not set, anyone who can connect may upload reports")
+	}
+	srv := &http.Server{
+		Addr:              listenAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       10 * time.Minute, // Whole request: a large report over a slow link
+		IdleTimeout:       2 * time.Minute,
+	}
+	// The socket is opened and the key read before --run-as gives up the privileges they may need
+	if tlsCert != "" {
+		certs := &certReloader{}
+		if err := certs.reload(); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		srv.TLSConfig = &tls.Config{GetCertificate: certs.getCertificate}
+	}
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if runAs != "" {
+		if err := dropPrivileges(runAs); err != nil {
+			fmt.Printf("Error: --run-as: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if tlsCert != "" {
+		err = srv.ServeTLS(ln, "", "")
+	} else {
+		err = srv.Serve(ln)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// certReloader serves the certificate of --tls-cert and --tls-key and reads the files again when
+// they change, so that certificates renewed by an ACME client (certbot, lego, acme.sh) are used
+// without a restart. The files are checked at most once a minute.
+type certReloader struct {
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time // Of the newer of the two files when they were read
+	checked time.Time
+}
+
+// reload reads the certificate and key if either file changed since they were last read
+func (l *certReloader) reload() error {
+	var modTime time.Time
+	for _, name := range []string{tlsCert, tlsKey} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	if l.cert != nil && !modTime.After(l.modTime) {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(tlsCert, tlsKey)
+	if err != nil {
+		return err
+	}
+	l.cert, l.modTime = &cert, modTime
+	return nil
+}
+
+func (l *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.checked) >= time.Minute {
+		l.checked = time.Now()
+		// A renewal being written, or a key the --run-as user cannot read: keep the current one
+		if err := l.reload(); err != nil {
+			fmt.Printf("Warning: Could not reload the TLS certificate: %v\n", err)
+		}
+	}
+	return l.cert, nil
+}
+
+// load reads the summaries of all stored reports
+func (c *collector) load() error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	hostDirs, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, hd := range hostDirs {
+		if !hd.IsDir() || !collectorHostRe.MatchString(hd.Name()) {
+			continue
+		}
+		names, err := filepath.Glob(filepath.Join(c.dir, hd.Name(), "*.summary.json"))
+		if err != nil {
+			return err
+		}
+		sort.Strings(names) // Named by start time
+		h := &collectorHost{}
+		for _, name := range names {
+			data, err := os.ReadFile(name)
+			if err != nil {
+				return err
+			}
+			var sum runSummary
+			if err := json.Unmarshal(data, &sum); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			h.Summaries = append(h.Summaries, sum)
+		}
+		if len(h.Summaries) > 0 {
+			c.hosts[hd.Name()] = h
+		}
+	}
+	return nil
+}
+
+func (c *collector) handleIngest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST a report (find_heavy_dirs --upload)", http.StatusMethodNotAllowed)
+		return
+	}
+	user := c.authorize(w, r, true)
+	if user == nil {
+		return
+	}
+	select {
+	case c.uploads <- struct{}{}:
+		defer func() { <-c.uploads }()
+	default:
+		// --upload retries with backoff
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "too many uploads at the same time", http.StatusServiceUnavailable)
+		return
+	}
+
+	// The report is decoded while it is received, and kept compressed for storing either way
+	var stored bytes.Buffer
+	var zw *gzip.Writer
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(io.TeeReader(body, &stored))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = zr
+	} else {
+		zw = gzip.NewWriter(&stored)
+		body = io.TeeReader(body, zw)
+	}
+	limited := &io.LimitedReader{R: body, N: maxReportSize}
+	var doc uploadDocument
+	if err := json.NewDecoder(limited).Decode(&doc); err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			http.Error(w, fmt.Sprintf("report larger than %s", formatBytes(maxUploadSize)), http.StatusRequestEntityTooLarge)
+		case limited.N <= 0:
+			http.Error(w, fmt.Sprintf("report larger than %s decompressed", formatBytes(maxReportSize)), http.StatusRequestEntityTooLarge)
+		default:
+			http.Error(w, "invalid report: "+err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	// The decoder stops after the document: read the rest (the gzip trailer) into the stored copy too
+	if _, err := io.Copy(io.Discard, limited); err != nil {
+		http.Error(w, "invalid report: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if zw != nil {
+		zw.Close()
+	}
+	start, err := time.Parse(time.RFC3339, doc.Summary.Start)
+	if err != nil || !collectorHostRe.MatchString(doc.Summary.Host) {
+		http.Error(w, "invalid report: summary needs a host name and an RFC 3339 start time", http.StatusBadRequest)
+		return
+	}
+	if !user.seesHost(doc.Summary.Host) {
+		http.Error(w, user.Name+" may not upload reports of "+doc.Summary.Host, http.StatusForbidden)
+		return
+	}
+	if p, ok := doc.outsidePaths(user); !ok {
+		http.Error(w, user.Name+" may not upload reports of "+p, http.StatusForbidden)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if r.URL.Query().Get("patch") == "1" {
+		merged, err := c.patchReport(doc)
+		if err != nil {
+			http.Error(w, "cannot patch the latest report: "+err.Error(), http.StatusConflict)
+			return
+		}
+		doc = *merged
+		stored.Reset()
+		zw := gzip.NewWriter(&stored)
+		if err := json.NewEncoder(zw).Encode(doc); err != nil || zw.Close() != nil {
+			http.Error(w, "could not store the report", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := c.store(doc, stored.Bytes(), start); err != nil {
+		fmt.Printf("Warning: Could not store the report of %s: %v\n", doc.Summary.Host, err)
+		http.Error(w, "could not store the report", http.StatusInternalServerError)
+		return
+	}
+	if verbose {
+		fmt.Printf("Stored report of %s from %s (%d directories)\n", doc.Summary.Host, doc.Summary.Start, len(doc.Directories))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// patchReport merges the report of rescanned subtrees (POST /ingest?patch=1) into the host's latest
+// report, so one directory can be refreshed without a full scan. The directories below each target
+// of doc replace those of the latest report, and the totals of their ancestors, targets and summary
+// change by the difference. Each target must be a directory of the latest report. The unreadable
+// entries and violations of the latest report are kept. The caller holds c.mu.
+func (c *collector) patchReport(doc uploadDocument) (*uploadDocument, error) {
+	if _, ok := c.hosts[doc.Summary.Host]; !ok {
+		return nil, fmt.Errorf("no report of %s", doc.Summary.Host)
+	}
+	base, err := c.latestReport(doc.Summary.Host)
+	if err != nil {
+		return nil, err
+	}
+	start, _ := time.Parse(time.RFC3339, doc.Summary.Start)
+	if baseStart, err := time.Parse(time.RFC3339, base.Summary.Start); err != nil || !start.After(baseStart) {
+		return nil, fmt.Errorf("the rescan is not newer than the latest report (%s)", base.Summary.Start)
+	}
+	if len(doc.Summary.Targets) == 0 {
+		return nil, errors.New("the rescan has no targets")
+	}
+	merged := &uploadDocument{Summary: base.Summary, Directories: slices.Clone(base.Directories)}
+	merged.Summary.Start = doc.Summary.Start
+	merged.Summary.Targets = slices.Clone(base.Summary.Targets)
+	for _, t := range doc.Summary.Targets {
+		i := slices.IndexFunc(merged.Directories, func(d dirEvent) bool { return d.Path == t.Path })
+		if i < 0 {
+			return nil, fmt.Errorf("%s is not a directory of the latest report", t.Path)
+		}
+		old := merged.Directories[i]
+		sizeDelta, filesDelta := t.Size-old.Size, t.Files-old.Files
+		dirs := merged.Directories[:0]
+		for _, d := range merged.Directories {
+			switch {
+			case d.Path != t.Path && isPathEqualOrSubpath(d.Path, t.Path):
+				continue // Replaced by the rescan
+			case isPathEqualOrSubpath(t.Path, d.Path):
+				d.Size += sizeDelta
+				d.Files += filesDelta
+			}
+			dirs = append(dirs, d)
+		}
+		for _, d := range doc.Directories {
+			if d.Path != t.Path && isPathEqualOrSubpath(d.Path, t.Path) {
+				d.Depth += old.Depth // Depths of the rescan count from its target
+				dirs = append(dirs, d)
+			}
+		}
+		merged.Directories = dirs
+		for j := range merged.Summary.Targets {
+			if isPathEqualOrSubpath(t.Path, merged.Summary.Targets[j].Path) {
+				merged.Summary.Targets[j].Size += sizeDelta
+				merged.Summary.Targets[j].Files += filesDelta
+			}
+		}
+		merged.Summary.TotalSize += sizeDelta
+		merged.Summary.TotalFiles += filesDelta
+	}
+	sort.SliceStable(merged.Directories, func(i, j int) bool { return merged.Directories[i].Size > merged.Directories[j].Size })
+	merged.Summary.Directories = len(merged.Directories)
+	merged.Summary.Compacted = nil
+	return merged, nil
+}
+
+// store writes the report and its summary and updates the index; the caller holds c.mu.
+// A report with the same host and start time (a retried upload) replaces the stored one.
+func (c *collector) store(doc uploadDocument, compressed []byte, start time.Time) error {
+	dir := filepath.Join(c.dir, doc.Summary.Host)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	base := filepath.Join(dir, start.UTC().Format("20060102T150405Z"))
+	sumData, err := json.Marshal(doc.Summary)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(base+".json.gz", compressed); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(base+".summary.json", sumData); err != nil {
+		return err
+	}
+
+	h := c.hosts[doc.Summary.Host]
+	if h == nil {
+		h = &collectorHost{}
+		c.hosts[doc.Summary.Host] = h
+	}
+	// Starts may be written with any UTC offset: order them by time, as the file names do
+	at := summaryTime(doc.Summary)
+	i := sort.Search(len(h.Summaries), func(i int) bool { return !summaryTime(h.Summaries[i]).Before(at) })
+	if i < len(h.Summaries) && summaryTime(h.Summaries[i]).Equal(at) {
+		h.Summaries[i] = doc.Summary
+	} else {
+		h.Summaries = slices.Insert(h.Summaries, i, doc.Summary)
+	}
+	if i == len(h.Summaries)-1 {
+		h.latest = &doc
+	}
+	// A client that has not read the previous events misses this one rather than holding up uploads
+	for ch := range c.watchers {
+		select {
+		case ch <- doc.Summary.Host:
+		default:
+		}
+	}
+	return nil
+}
+
+// summaryTime returns the start of a stored report at the precision of its file name
+func summaryTime(sum runSummary) time.Time {
+	t, _ := time.Parse(time.RFC3339, sum.Start)
+	return t.Truncate(time.Second)
+}
+
+// latestReport returns the newest report of a host; the caller holds c.mu
+func (c *collector) latestReport(host string) (*uploadDocument, error) {
+	h := c.hosts[host]
+	if h.latest != nil {
+		return h.latest, nil
+	}
+	start, err := time.Parse(time.RFC3339, h.Summaries[len(h.Summaries)-1].Start)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := readStoredReport(filepath.Join(c.dir, host, start.UTC().Format("20060102T150405Z")+".json.gz"))
+	if err != nil {
+		return nil, err
+	}
+	h.latest = doc
+	return h.latest, nil
+}
+
+// hostStatus is a host's line in /api/hosts and the dashboard
+type hostStatus struct {
+	Host         string           `json:"host"`
+	LastScan     string           `json:"last_scan"`
+	Scans        int              `json:"scans"`
+	TotalSize    int64            `json:"total_size"`
+	TotalFiles   int64            `json:"total_files"`
+	Inaccessible int64            `json:"inaccessible"`
+	Violations   map[string]int64 `json:"violations,omitempty"`
+	// Size change since the previous report, 0 for the first one
+	Growth int64 `json:"growth"`
+}
+
+// hostStatuses lists the hosts the user sees. For users limited to path prefixes the totals are
+// those of the outermost visible directories of the latest report, and the host-wide figures
+// (unreadable entries, violations, growth) are left out.
+func (c *collector) hostStatuses(u *collectorUser) ([]hostStatus, error) {
+	list := []hostStatus{}
+	for host, h := range c.hosts {
+		if !u.seesHost(host) {
+			continue
+		}
+		last := h.Summaries[len(h.Summaries)-1]
+		st := hostStatus{Host: host, LastScan: last.Start, Scans: len(h.Summaries), TotalSize: last.TotalSize,
+			TotalFiles: last.TotalFiles, Inaccessible: last.Inaccessible, Violations: last.Violations}
+		if len(h.Summaries) > 1 {
+			st.Growth = last.TotalSize - h.Summaries[len(h.Summaries)-2].TotalSize
+		}
+		if len(u.Paths) > 0 {
+			doc, err := c.latestReport(host)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", host, err)
+			}
+			st = hostStatus{Host: host, LastScan: last.Start, Scans: len(h.Summaries)}
+			for _, t := range doc.Summary.Targets {
+				if u.seesPath(t.Path) {
+					st.TotalSize += t.Size
+					st.TotalFiles += t.Files
+				}
+			}
+			for _, d := range doc.Directories {
+				if u.seesPath(d.Path) && !u.seesPath(filepath.Dir(d.Path)) {
+					st.TotalSize += d.Size
+					st.TotalFiles += d.Files
+				}
+			}
+			if st.TotalSize == 0 && st.TotalFiles == 0 {
+				continue
+			}
+		}
+		list = append(list, st)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].TotalSize != list[j].TotalSize {
+			return list[i].TotalSize > list[j].TotalSize
+		}
+		return list[i].Host < list[j].Host
+	})
+	return list, nil
+}
+
+// fleetDirs returns the n largest directories of the latest reports that the user sees, optionally
+// for one host, below a path prefix or at a maximum depth (negative for any depth)
+func (c *collector) fleetDirs(u *collectorUser, host, prefix string, maxDepth, n int) ([]dirEvent, error) {
+	list := []dirEvent{}
+	for name := range c.hosts {
+		if host != "" && name != host || !u.seesHost(name) {
+			continue
+		}
+		doc, err := c.latestReport(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		for _, d := range doc.Directories {
+			if (maxDepth < 0 || d.Depth <= maxDepth) && (prefix == "" || isPathEqualOrSubpath(d.Path, prefix)) && u.seesPath(d.Path) {
+				list = append(list, d)
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Size != list[j].Size {
+			return list[i].Size > list[j].Size
+		}
+		if list[i].Host != list[j].Host {
+			return list[i].Host < list[j].Host
+		}
+		return list[i].Path < list[j].Path
+	})
+	return list[:min(n, len(list))], nil
+}
+
+func writeJSONResponse(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (c *collector) handleHosts(w http.ResponseWriter, r *http.Request) {
+	u := c.authorize(w, r, false)
+	if u == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list, err := c.hostStatuses(u)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, list)
+}
+
+func (c *collector) handleHistory(w http.ResponseWriter, r *http.Request) {
+	u := c.authorize(w, r, false)
+	if u == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	host := r.URL.Query().Get("host")
+	h, ok := c.hosts[host]
+	if !ok || !u.seesHost(host) {
+		http.Error(w, "unknown host (use ?host=<name>)", http.StatusNotFound)
+		return
+	}
+	// Summaries cover whole hosts
+	if len(u.Paths) > 0 {
+		http.Error(w, u.Name+" may only see directories below "+strings.Join(u.Paths, ", "), http.StatusForbidden)
+		return
+	}
+	writeJSONResponse(w, h.Summaries)
+}
+
+// handleDirs answers /api/dirs?host=&path=&depth=&n= with the largest directories of the fleet
+func (c *collector) handleDirs(w http.ResponseWriter, r *http.Request) {
+	u := c.authorize(w, r, false)
+	if u == nil {
+		return
+	}
+	q := r.URL.Query()
+	depth, n := -1, topN
+	if v := q.Get("depth"); v != "" {
+		if d, err := strconv.Atoi(v); err == nil {
+			depth = d
+		}
+	}
+	if v := q.Get("n"); v != "" {
+		if d, err := strconv.Atoi(v); err == nil && d > 0 {
+			n = d
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list, err := c.fleetDirs(u, q.Get("host"), q.Get("path"), depth, n)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, list)
+}
+
+// handleEvents answers /api/events with a stream of server-sent events: a "report" event with the
+// host's new line of /api/hosts for every report stored, so dashboards update without polling
+func (c *collector) handleEvents(w http.ResponseWriter, r *http.Request) {
+	u := c.authorize(w, r, false)
+	if u == nil {
+		return
+	}
+	// The stream stays open longer than the read timeout of requests
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	ch := make(chan string, 16)
+	c.mu.Lock()
+	c.watchers[ch] = struct{}{}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.watchers, ch)
+		c.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	// Proxies close idle connections, so a comment is sent when nothing else was
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case host := <-ch:
+			c.mu.Lock()
+			list, err := c.hostStatuses(u)
+			c.mu.Unlock()
+			if err != nil {
+				return
+			}
+			i := slices.IndexFunc(list, func(st hostStatus) bool { return st.Host == host })
+			if i < 0 {
+				continue // Outside the user's scope
+			}
+			data, _ := json.Marshal(list[i])
+			fmt.Fprintf(w, "event: report\ndata: %s\n\n", data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// dashboardDir is a directory row of the dashboard
+type dashboardDir struct {
+	dirEvent
+	Link    string // Drill-down URL
+	Change  int64  // Size change since the compared report
+	Compare bool   // Change is set; false without a compared report or for a new directory
+}
+
+// dashboardTile is a rectangle of the treemap, in SVG coordinates
+type dashboardTile struct {
+	Dir        dashboardDir
+	X, Y, W, H float64
+	Color      string
+}
+
+// dashboardView is the data of the dashboard page
+type dashboardView struct {
+	Host, Path, Min, Age, Compare string // As given in the query, for the form
+	Hosts                         []hostStatus
+	Crumbs                        []dashboardDir // From the top directory down to Path
+	Children                      []dashboardDir // Right below Path, or the top directories
+	Tiles                         []dashboardTile
+	Dirs                          []dashboardDir // Largest directories
+	Reports                       []string       // Start times of the host's reports, newest first
+}
+
+// dashboardFilter keeps the directories of at least min bytes (--min-size) not modified for age
+type dashboardFilter struct {
+	min    int64
+	before time.Time // Zero for any age
+}
+
+func (f dashboardFilter) keeps(d dirEvent) bool {
+	if d.Size < f.min {
+		return false
+	}
+	if f.before.IsZero() {
+		return true
+	}
+	t, err := time.Parse(time.RFC3339, d.NewestMtime)
+	return err == nil && t.Before(f.before)
+}
+
+// dashboardLink returns the dashboard URL of a host and directory with the current filters
+func dashboardLink(view *dashboardView, path string) string {
+	q := url.Values{"host": {view.Host}}
+	for k, v := range map[string]string{"path": path, "min": view.Min, "age": view.Age, "compare": view.Compare} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	return "/?" + q.Encode()
+}
+
+// hostTree returns the directories of a host's latest report that the user sees, with the targets
+// (which reports do not list as directories) added, and the top ones: the targets, or for users
+// limited to path prefixes, the outermost directories they see
+func hostTree(doc *uploadDocument, u *collectorUser) (dirs map[string]dirEvent, top []dirEvent) {
+	dirs = make(map[string]dirEvent, len(doc.Directories)+len(doc.Summary.Targets))
+	for _, t := range doc.Summary.Targets {
+		dirs[t.Path] = dirEvent{Host: doc.Summary.Host, Path: t.Path, Size: t.Size, Files: t.Files}
+	}
+	for _, d := range doc.Directories {
+		dirs[d.Path] = d
+	}
+	for p := range dirs {
+		if !u.seesPath(p) {
+			delete(dirs, p)
+		}
+	}
+	for p, d := range dirs {
+		parent := filepath.Dir(p)
+		if _, ok := dirs[parent]; !ok || parent == p {
+			top = append(top, d)
+		}
+	}
+	return dirs, top
+}
+
+// dashboardColors are the fills of the treemap tiles
+var dashboardColors = []string{"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac"}
+
+// dashboardTreemap lays out the directories (largest first) as a treemap of width x height, with
+// the directories after the first treemapItems left out
+func dashboardTreemap(list []dashboardDir, width, height float64) []dashboardTile {
+	list = list[:min(len(list), treemapItems)]
+	var total float64
+	for _, d := range list {
+		total += float64(d.Size)
+	}
+	if total == 0 {
+		return nil
+	}
+	areas := make([]float64, 0, len(list))
+	for _, d := range list {
+		if d.Size == 0 {
+			break
+		}
+		areas = append(areas, float64(d.Size)/total*width*height)
+	}
+	var tiles []dashboardTile
+	for i, r := range squarify(areas, 0, 0, width, height) {
+		// squarify counts y upwards, like PDF
+		tiles = append(tiles, dashboardTile{Dir: list[i], X: r[0], Y: height - r[1] - r[3], W: r[2], H: r[3], Color: dashboardColors[i%len(dashboardColors)]})
+	}
+	return tiles
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"bytes": formatBytes,
+	"growth": func(v int64) string {
+		if v < 0 {
+			return "-" + formatBytes(-v)
+		}
+		return "+" + formatBytes(v)
+	},
+	"violations": func(m map[string]int64) int64 {
+		var n int64
+		for _, v := range m {
+			n += v
+		}
+		return n
+	},
+	"base": filepath.Base,
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>fs-analyzer fleet</title>
+<style>body{font-family:sans-serif;margin:2em}table{border-collapse:collapse}td,th{padding:.2em .8em;border-bottom:1px solid #ddd;text-align:left}td.n{text-align:right}th{cursor:pointer}form{margin:1em 0}svg text{font-size:11px;fill:#fff;pointer-events:none}</style>
+</head><body>
+<h1>Storage by Host</h1>
+<table class="sort"><thead><tr><th>Host</th><th>Size</th><th>Change</th><th>Files</th><th>Unreadable</th><th>Violations</th><th>Last Scan</th><th>Scans</th></tr></thead><tbody>
+{{range .Hosts}}<tr><td><a href="/?host={{.Host}}">{{.Host}}</a></td><td class="n" data-v="{{.TotalSize}}">{{bytes .TotalSize}}</td><td class="n" data-v="{{.Growth}}">{{growth .Growth}}</td><td class="n" data-v="{{.TotalFiles}}">{{.TotalFiles}}</td><td class="n" data-v="{{.Inaccessible}}">{{.Inaccessible}}</td><td class="n" data-v="{{violations .Violations}}">{{violations .Violations}}</td><td>{{.LastScan}}</td><td class="n" data-v="{{.Scans}}">{{.Scans}}</td></tr>
+{{end}}</tbody></table>
+<form method="get" action="/">{{if .Host}}<input type="hidden" name="host" value="{{.Host}}">{{end}}{{if .Path}}<input type="hidden" name="path" value="{{.Path}}">{{end}}
+At least <input name="min" size="6" value="{{.Min}}" placeholder="1G">
+unchanged for <input name="age" size="5" value="{{.Age}}" placeholder="180d">
+{{if .Reports}}compared with <select name="compare"><option value="">(no report)</option>{{$c := .Compare}}{{range .Reports}}<option{{if eq . $c}} selected{{end}}>{{.}}</option>{{end}}</select>{{end}}
+<button>Filter</button></form>
+{{if .Host}}<h1>{{.Host}}{{range .Crumbs}} / <a href="{{.Link}}">{{base .Path}}</a>{{end}}</h1>
+{{if .Tiles}}<svg width="900" height="360" viewBox="0 0 900 360">{{range .Tiles}}<a href="{{.Dir.Link}}"><rect x="{{.X}}" y="{{.Y}}" width="{{.W}}" height="{{.H}}" fill="{{.Color}}" stroke="#fff"><title>{{.Dir.Path}}: {{bytes .Dir.Size}}</title></rect>{{if and (gt .W 60.0) (gt .H 16.0)}}<text x="{{.X}}" y="{{.Y}}" dx="4" dy="13">{{base .Dir.Path}}</text>{{end}}</a>{{end}}</svg>{{end}}
+<table class="sort"><thead><tr><th>Size</th>{{if .Compare}}<th>Change</th>{{end}}<th>Files</th><th>Directory</th><th>Owner</th><th>Newest</th></tr></thead><tbody>
+{{range .Children}}<tr><td class="n" data-v="{{.Size}}">{{bytes .Size}}</td>{{if $.Compare}}<td class="n" data-v="{{.Change}}">{{if .Compare}}{{growth .Change}}{{else}}new{{end}}</td>{{end}}<td class="n" data-v="{{.Files}}">{{.Files}}</td><td><a href="{{.Link}}">{{.Path}}</a></td><td>{{.Owner}}</td><td>{{.NewestMtime}}</td></tr>
+{{else}}<tr><td colspan="6">No subdirectories in the report</td></tr>
+{{end}}</tbody></table>{{end}}
+<h1>Largest Directories{{if .Host}} on {{.Host}}{{end}}</h1>
+<table class="sort"><thead><tr><th>Size</th>{{if .Compare}}<th>Change</th>{{end}}<th>Files</th><th>Host</th><th>Path</th><th>Owner</th><th>Newest</th></tr></thead><tbody>
+{{range .Dirs}}<tr><td class="n" data-v="{{.Size}}">{{bytes .Size}}</td>{{if $.Compare}}<td class="n" data-v="{{.Change}}">{{if .Compare}}{{growth .Change}}{{else}}new{{end}}</td>{{end}}<td class="n" data-v="{{.Files}}">{{.Files}}</td><td>{{.Host}}</td><td><a href="{{.Link}}">{{.Path}}</a></td><td>{{.Owner}}</td><td>{{.NewestMtime}}</td></tr>
+{{end}}</tbody></table>
+<script>
+document.querySelectorAll("table.sort th").forEach((th, col) => th.onclick = () => {
+	const body = th.closest("table").tBodies[0], rows = [...body.rows];
+	const asc = th.dataset.dir = th.dataset.dir === "asc" ? "desc" : "asc";
+	const key = r => r.cells[col] && r.cells[col].dataset.v !== undefined ? Number(r.cells[col].dataset.v) : (r.cells[col] || {}).textContent;
+	rows.sort((a, b) => (key(a) < key(b) ? -1 : key(a) > key(b) ? 1 : 0) * (asc === "asc" ? 1 : -1));
+	rows.forEach(r => body.appendChild(r));
+});
+new EventSource("/api/events").addEventListener("report", () => location.reload());
+</script>
+</body></html>
+`))
+
+// handleDashboard answers / with the host table and, narrowed by host=, path=, min= (a size) and
+// age= (not modified for, e.g. 180d), the directories below path with a treemap and the largest
+// directories; compare= (the start time of an earlier report of the host) adds their size change.
+func (c *collector) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	u := c.authorize(w, r, false)
+	if u == nil {
+		return
+	}
+	q := r.URL.Query()
+	view := &dashboardView{Host: q.Get("host"), Path: q.Get("path"), Min: q.Get("min"), Age: q.Get("age"), Compare: q.Get("compare")}
+	var filter dashboardFilter
+	if view.Min != "" {
+		v, err := parseSize(view.Min)
+		if err != nil {
+			http.Error(w, "min: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.min = v
+	}
+	if view.Age != "" {
+		age, err := parseAge(view.Age)
+		if err != nil {
+			http.Error(w, "age: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.before = time.Now().Add(-age)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err error
+	if view.Hosts, err = c.hostStatuses(u); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fleet, err := c.fleetDirs(u, view.Host, view.Path, -1, math.MaxInt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Sizes of the compared report, by path
+	var before map[string]int64
+	if h, ok := c.hosts[view.Host]; ok && u.seesHost(view.Host) {
+		for i := len(h.Summaries) - 1; i >= 0; i-- {
+			view.Reports = append(view.Reports, h.Summaries[i].Start)
+		}
+		if view.Compare != "" {
+			start, err := time.Parse(time.RFC3339, view.Compare)
+			if err != nil || !slices.Contains(view.Reports, view.Compare) {
+				http.Error(w, "compare: not a report of "+view.Host, http.StatusBadRequest)
+				return
+			}
+			old, err := readStoredReport(filepath.Join(c.dir, view.Host, start.UTC().Format("20060102T150405Z")+".json.gz"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			oldDirs, _ := hostTree(old, u)
+			before = make(map[string]int64, len(oldDirs))
+			for p, d := range oldDirs {
+				before[p] = d.Size
+			}
+		}
+	} else {
+		view.Compare = ""
+	}
+	row := func(d dirEvent) dashboardDir {
+		dd := dashboardDir{dirEvent: d, Link: dashboardLink(&dashboardView{Host: d.Host, Min: view.Min, Age: view.Age, Compare: view.Compare}, d.Path)}
+		if size, ok := before[d.Path]; ok && d.Host == view.Host {
+			dd.Change, dd.Compare = d.Size-size, true
+		}
+		return dd
+	}
+
+	if view.Host != "" && u.seesHost(view.Host) {
+		if _, ok := c.hosts[view.Host]; ok {
+			doc, err := c.latestReport(view.Host)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			dirs, top := hostTree(doc, u)
+			children := top
+			if view.Path != "" {
+				children = nil
+				for p, d := range dirs {
+					if filepath.Dir(p) == view.Path && p != view.Path {
+						children = append(children, d)
+					}
+				}
+				for p := view.Path; ; p = filepath.Dir(p) {
+					d, ok := dirs[p]
+					if !ok {
+						break
+					}
+					view.Crumbs = append([]dashboardDir{row(d)}, view.Crumbs...)
+					if filepath.Dir(p) == p {
+						break
+					}
+				}
+			}
+			sort.Slice(children, func(i, j int) bool {
+				if children[i].Size != children[j].Size {
+					return children[i].Size > children[j].Size
+				}
+				return children[i].Path < children[j].Path
+			})
+			for _, d := range children {
+				if filter.keeps(d) {
+					view.Children = append(view.Children, row(d))
+				}
+			}
+			view.Tiles = dashboardTreemap(view.Children, 900, 360)
+		}
+	}
+	for _, d := range fleet {
+		if len(view.Dirs) == topN {
+			break
+		}
+		if filter.keeps(d) {
+			view.Dirs = append(view.Dirs, row(d))
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	dashboardTemplate.Execute(w, view)
+}
@@ -0,0 +1,202 @@
+//go:build !offline
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestCollector returns a collector with an empty store in a temporary directory
+func newTestCollector(t *testing.T, token string, users []*collectorUser) *collector {
+	return &collector{dir: t.TempDir(), token: token, users: users, hosts: make(map[string]*collectorHost),
+		uploads: make(chan struct{}, maxUploads), watchers: make(map[chan string]struct{})}
+}
+
+// testCollector serves a collector with an empty store
+func testCollector(t *testing.T, token string, users []*collectorUser) *httptest.Server {
+	c := newTestCollector(t, token, users)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ingest", c.handleIngest)
+	mux.HandleFunc("/api/hosts", c.handleHosts)
+	mux.HandleFunc("/api/history", c.handleHistory)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// collectorRequest sends a request with the token as bearer token, or as basic authentication
+// password if it starts with "basic:", and returns the status and body
+func collectorRequest(t *testing.T, srv *httptest.Server, method, path, token, body string) (int, string) {
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pass, ok := strings.CutPrefix(token, "basic:"); ok {
+		req.SetBasicAuth("browser", pass)
+	} else if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(data)
+}
+
+// testReport is an upload of a report of host started at the given minute
+func testReport(t *testing.T, host string, minute int) string {
+	doc := uploadDocument{
+		Summary:     runSummary{Host: host, Start: fmt.Sprintf("2026-01-02T03:%02d:00Z", minute), TotalSize: 100},
+		Directories: []dirEvent{},
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCollectorAuthorize(t *testing.T) {
+	srv := testCollector(t, "upload-secret", []*collectorUser{
+		{Name: "ops", Token: "admin-secret", Role: "admin"},
+		{Name: "web team", Token: "viewer-secret", Role: "viewer", Hosts: []string{"web*"}},
+		{Name: "web agent", Token: "uploader-secret", Role: "uploader", Hosts: []string{"web*"}},
+	})
+	for _, host := range []string{"web1", "db1"} {
+		if code, body := collectorRequest(t, srv, "POST", "/ingest", "admin-secret", testReport(t, host, 1)); code != http.StatusNoContent {
+			t.Fatalf("admin upload of %s: %d %s", host, code, body)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		method, path string
+		token, body  string
+		want         int
+	}{
+		{"read without token", "GET", "/api/hosts", "", "", http.StatusUnauthorized},
+		{"read with unknown token", "GET", "/api/hosts", "guess", "", http.StatusUnauthorized},
+		{"read with token prefix", "GET", "/api/hosts", "viewer-secre", "", http.StatusUnauthorized},
+		{"read with token suffix added", "GET", "/api/hosts", "viewer-secret2", "", http.StatusUnauthorized},
+		{"read with token of same length", "GET", "/api/hosts", "viewer-secreT", "", http.StatusUnauthorized},
+		{"read with upload token", "GET", "/api/hosts", "upload-secret", "", http.StatusUnauthorized},
+		{"admin reads", "GET", "/api/hosts", "admin-secret", "", http.StatusOK},
+		{"viewer reads", "GET", "/api/hosts", "viewer-secret", "", http.StatusOK},
+		{"viewer reads with basic auth", "GET", "/api/hosts", "basic:viewer-secret", "", http.StatusOK},
+		{"viewer reads own host", "GET", "/api/history?host=web1", "viewer-secret", "", http.StatusOK},
+		{"viewer reads other host", "GET", "/api/history?host=db1", "viewer-secret", "", http.StatusNotFound},
+		{"uploader reads", "GET", "/api/hosts", "uploader-secret", "", http.StatusForbidden},
+		{"viewer uploads", "POST", "/ingest", "viewer-secret", testReport(t, "web1", 2), http.StatusForbidden},
+		{"upload without token", "POST", "/ingest", "", testReport(t, "web1", 2), http.StatusUnauthorized},
+		{"upload with unknown token", "POST", "/ingest", "guess", testReport(t, "web1", 2), http.StatusUnauthorized},
+		{"uploader uploads own host", "POST", "/ingest", "uploader-secret", testReport(t, "web2", 2), http.StatusNoContent},
+		{"uploader uploads other host", "POST", "/ingest", "uploader-secret", testReport(t, "db1", 2), http.StatusForbidden},
+		{"upload token uploads any host", "POST", "/ingest", "upload-secret", testReport(t, "db1", 3), http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		code, body := collectorRequest(t, srv, tt.method, tt.path, tt.token, tt.body)
+		if code != tt.want {
+			t.Errorf("%s: got %d (%s), want %d", tt.name, code, strings.TrimSpace(body), tt.want)
+		}
+	}
+
+	// Host scoping of reads: the viewer sees only the web hosts
+	_, body := collectorRequest(t, srv, "GET", "/api/hosts", "viewer-secret", "")
+	var list []hostStatus
+	if err := json.Unmarshal([]byte(body), &list); err != nil {
+		t.Fatalf("/api/hosts: %v", err)
+	}
+	var hosts []string
+	for _, h := range list {
+		hosts = append(hosts, h.Host)
+	}
+	if strings.Join(hosts, ",") != "web1,web2" {
+		t.Errorf("viewer sees hosts %v, want web1 and web2", hosts)
+	}
+}
+
+func TestCollectorAuthorizeWithoutAccess(t *testing.T) {
+	srv := testCollector(t, "upload-secret", nil)
+	tests := []struct {
+		name         string
+		method, path string
+		token        string
+		want         int
+	}{
+		{"open read", "GET", "/api/hosts", "", http.StatusOK},
+		{"upload without token", "POST", "/ingest", "", http.StatusUnauthorized},
+		{"upload with wrong token", "POST", "/ingest", "upload-secreT", http.StatusUnauthorized},
+		{"upload with token", "POST", "/ingest", "upload-secret", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		if code, body := collectorRequest(t, srv, tt.method, tt.path, tt.token, testReport(t, "web1", 1)); code != tt.want {
+			t.Errorf("%s: got %d (%s), want %d", tt.name, code, strings.TrimSpace(body), tt.want)
+		}
+	}
+}
+
+func TestTokenEqual(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want bool
+	}{
+		{"secret", "secret", true},
+		{"secret", "secreT", false},
+		{"secret", "secre", false},
+		{"secret", "secrets", false},
+		{"", "secret", false},
+	} {
+		if got := tokenEqual(tt.a, tt.b); got != tt.want {
+			t.Errorf("tokenEqual(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCollectorStoreOrdersByTime(t *testing.T) {
+	c := newTestCollector(t, "", nil)
+	for _, s := range []struct {
+		start string
+		size  int64
+	}{
+		{"2026-01-02T09:00:00Z", 1},
+		{"2026-01-02T10:00:00+02:00", 2}, // 08:00 UTC, sorts after 09:00 as text
+		{"2026-01-02T08:30:00.250Z", 3},
+		{"2026-01-02T07:00:00-01:00", 4}, // 08:00 UTC again: replaces the report of size 2
+	} {
+		start, err := time.Parse(time.RFC3339, s.start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc := uploadDocument{Summary: runSummary{Host: "web1", Start: s.start, TotalSize: s.size}}
+		if err := c.store(doc, nil, start); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var sizes []int64
+	for _, sum := range c.hosts["web1"].Summaries {
+		sizes = append(sizes, sum.TotalSize)
+	}
+	if fmt.Sprint(sizes) != "[4 3 1]" {
+		t.Errorf("summaries ordered as sizes %v, want [4 3 1]", sizes)
+	}
+	if latest := c.hosts["web1"].latest; latest == nil || latest.Summary.TotalSize != 1 {
+		t.Errorf("latest report = %+v, want the one started at 09:00 UTC", latest)
+	}
+	names, _ := filepath.Glob(filepath.Join(c.dir, "web1", "*.summary.json"))
+	if len(names) != 3 {
+		t.Errorf("%d summary files stored, want 3", len(names))
+	}
+}
@@ -0,0 +1,1406 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// --- Export Formats ---
+
+// writeExport writes every listed directory, largest first, in the selected machine-readable format.
+// With --output dir:<dir> the rows are written below <dir> in Hive-style partition directories
+// (host=.../date=.../part-<time>.<ext>), so repeated scans accumulate instead of overwriting.
+func writeExport(list []*DirStat, startTime time.Time) error {
+	sorted := make([]*DirStat, len(list))
+	copy(sorted, list)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].TotalSize > sorted[j].TotalSize
+	})
+
+	baseDir, isDir := strings.CutPrefix(outputFile, "dir:")
+	if !isDir {
+		return writeExportFile(outputFile, sorted)
+	}
+
+	host, _ := os.Hostname()
+	partitionDir := func(s *DirStat) string {
+		dir := baseDir
+		for _, key := range partitionBy {
+			var value string
+			switch key {
+			case "host":
+				value = host
+			case "date":
+				value = startTime.UTC().Format("2006-01-02")
+			case "target":
+				if s == nil {
+					continue
+				}
+				value = shownPath(targetOf(s.Path))
+			}
+			dir = filepath.Join(dir, key+"="+escapePartitionValue(value))
+		}
+		return dir
+	}
+
+	parts := make(map[string][]*DirStat)
+	var order []string
+	for _, s := range sorted {
+		dir := partitionDir(s)
+		if _, ok := parts[dir]; !ok {
+			order = append(order, dir)
+		}
+		parts[dir] = append(parts[dir], s)
+	}
+	if len(order) == 0 {
+		// Still leave an (empty) file for this scan so the run is visible in the data set
+		order = append(order, partitionDir(nil))
+	}
+
+	name := fmt.Sprintf("part-%s-%s.%s", startTime.UTC().Format("20060102T150405Z"), randomHex(4), outputFormat)
+	for _, dir := range order {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		if err := writeExportFile(filepath.Join(dir, name), parts[dir]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// escapePartitionValue percent-encodes everything except [A-Za-z0-9._-] so a value (such as a
+// target path) is a single, portable directory name, as Hive-style readers expect.
+func escapePartitionValue(v string) string {
+	if v == "" {
+		return "__HIVE_DEFAULT_PARTITION__"
+	}
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// targetOf returns the target path that contains path
+func targetOf(path string) string {
+	normPath := normalizePath(path)
+	for _, root := range targetPaths {
+		if isPathEqualOrSubpath(normPath, normalizePath(root)) {
+			return root
+		}
+	}
+	return ""
+}
+
+func writeExportFile(name string, list []*DirStat) error {
+	out, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	switch outputFormat {
+	case "csv":
+		err = writeCSV(out, list)
+	default:
+		err = writeParquet(out, list)
+	}
+	if err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	signFile(name)
+	return nil
+}
+
+// writeCSV writes the export columns (same names and order as the Parquet schema) with a header
+// row; modification times are RFC 3339 (UTC) and empty when unknown.
+func writeCSV(w io.Writer, list []*DirStat) error {
+	owners := make(map[int64]string)
+	cw := csv.NewWriter(w)
+	header := []string{"path", "size", "files", "own_size", "own_files", "depth", "newest_mtime", "oldest_mtime", "owner_uid", "owner"}
+	if fingerprint {
+		header = append(header, "fingerprint")
+	}
+	if len(dirTags) > 0 {
+		header = append(header, "tags")
+	}
+	header = append(header, labelNames...)
+	for _, c := range addColumns {
+		header = append(header, c.Name)
+	}
+	cw.Write(header)
+	mtime := func(t int64) string {
+		if t == 0 {
+			return ""
+		}
+		return time.Unix(t, 0).UTC().Format(time.RFC3339)
+	}
+	for _, s := range list {
+		record := []string{
+			shownPath(s.Path),
+			strconv.FormatInt(s.TotalSize, 10),
+			strconv.FormatInt(s.FileCount, 10),
+			strconv.FormatInt(s.OwnSize, 10),
+			strconv.FormatInt(s.OwnFiles, 10),
+			strconv.Itoa(s.Depth),
+			mtime(s.NewestMtime),
+			mtime(s.OldestMtime),
+			strconv.FormatInt(s.Uid, 10),
+			ownerName(s.Uid, owners),
+		}
+		if fingerprint {
+			record = append(record, fingerprintHex(s))
+		}
+		if len(dirTags) > 0 {
+			record = append(record, tagsOf(s.Path))
+		}
+		labels := shownLabels(labelsOf(s.Path))
+		for _, name := range labelNames {
+			record = append(record, labels[name])
+		}
+		for _, c := range addColumns {
+			v := c.Eval(s)
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				record = append(record, "")
+			} else {
+				record = append(record, strconv.FormatFloat(v, 'g', -1, 64))
+			}
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ownerName resolves a uid to a user name (cached); unknown uids are returned as numbers.
+func ownerName(uid int64, cache map[int64]string) string {
+	if uid < 0 {
+		return ""
+	}
+	if name, ok := cache[uid]; ok {
+		return name
+	}
+	name := strconv.FormatInt(uid, 10)
+	if u, err := user.LookupId(name); err == nil {
+		name = u.Username
+	}
+	cache[uid] = name
+	return name
+}
+
+// dirEvent is the JSON message published per directory by --stream (and sent to --analyzer commands)
+type dirEvent struct {
+	Host        string            `json:"host"`
+	ScanTime    string            `json:"scan_time"`
+	Path        string            `json:"path"`
+	Size        int64             `json:"size"`
+	Files       int64             `json:"files"`
+	OwnSize     int64             `json:"own_size"`
+	OwnFiles    int64             `json:"own_files"`
+	Depth       int               `json:"depth"`
+	NewestMtime string            `json:"newest_mtime,omitempty"`
+	OldestMtime string            `json:"oldest_mtime,omitempty"`
+	OwnerUid    int64             `json:"owner_uid"`
+	Owner       string            `json:"owner,omitempty"`
+	Fingerprint string            `json:"fingerprint,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"` // --path-template
+	// Computed columns (--add-column); undefined results (e.g. division by zero) are null
+	Columns map[string]*float64 `json:"columns,omitempty"`
+}
+
+// newDirEvent builds the JSON message of a directory; owners caches uid lookups across calls.
+func newDirEvent(s *DirStat, host string, startTime time.Time, owners map[int64]string) dirEvent {
+	mtime := func(t int64) string {
+		if t == 0 {
+			return ""
+		}
+		return time.Unix(t, 0).UTC().Format(time.RFC3339)
+	}
+	event := dirEvent{
+		Host:        host,
+		ScanTime:    startTime.UTC().Format(time.RFC3339),
+		Path:        shownPath(s.Path),
+		Size:        s.TotalSize,
+		Files:       s.FileCount,
+		OwnSize:     s.OwnSize,
+		OwnFiles:    s.OwnFiles,
+		Depth:       s.Depth,
+		NewestMtime: mtime(s.NewestMtime),
+		OldestMtime: mtime(s.OldestMtime),
+		OwnerUid:    s.Uid,
+		Owner:       ownerName(s.Uid, owners),
+	}
+	if fingerprint {
+		event.Fingerprint = fingerprintHex(s)
+	}
+	event.Tags = dirTags[normalizePath(s.Path)]
+	event.Labels = shownLabels(labelsOf(s.Path))
+	if len(addColumns) > 0 {
+		event.Columns = make(map[string]*float64, len(addColumns))
+		for _, c := range addColumns {
+			if v := c.Eval(s); !math.IsNaN(v) && !math.IsInf(v, 0) {
+				event.Columns[c.Name] = &v
+			} else {
+				event.Columns[c.Name] = nil
+			}
+		}
+	}
+	return event
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// --- Parquet Export ---
+//
+// A minimal Parquet writer (no dependencies): one row group, REQUIRED columns only (so no
+// repetition/definition levels), PLAIN encoding and GZIP-compressed data pages. The footer is
+// encoded with the Thrift compact protocol by thriftWriter below.
+
+// Parquet physical types, converted types and enums used by the writer
+const (
+	parquetInt32       = 1
+	parquetInt64       = 2
+	parquetDouble      = 5
+	parquetByteArray   = 6
+	parquetUTF8        = 0
+	parquetTimestampMs = 9
+	parquetRequired    = 0
+	parquetPlain       = 0
+	parquetRLE         = 3
+	parquetGzip        = 2
+	parquetDataPage    = 0
+	parquetRowsPerPage = 65536
+	parquetCreatedBy   = "find_heavy_dirs"
+)
+
+// parquetColumn describes one column and how to PLAIN-encode its value for a directory
+type parquetColumn struct {
+	Name      string
+	Type      int32
+	Converted int32 // -1 for none
+	Encode    func(buf *bytes.Buffer, s *DirStat)
+}
+
+func writeParquet(w io.Writer, list []*DirStat) error {
+	owners := make(map[int64]string)
+	i64 := func(get func(*DirStat) int64) func(*bytes.Buffer, *DirStat) {
+		return func(buf *bytes.Buffer, s *DirStat) { binary.Write(buf, binary.LittleEndian, get(s)) }
+	}
+	str := func(get func(*DirStat) string) func(*bytes.Buffer, *DirStat) {
+		return func(buf *bytes.Buffer, s *DirStat) {
+			v := get(s)
+			binary.Write(buf, binary.LittleEndian, uint32(len(v)))
+			buf.WriteString(v)
+		}
+	}
+	columns := []parquetColumn{
+		{"path", parquetByteArray, parquetUTF8, str(func(s *DirStat) string { return shownPath(s.Path) })},
+		{"size", parquetInt64, -1, i64(func(s *DirStat) int64 { return s.TotalSize })},
+		{"files", parquetInt64, -1, i64(func(s *DirStat) int64 { return s.FileCount })},
+		{"own_size", parquetInt64, -1, i64(func(s *DirStat) int64 { return s.OwnSize })},
+		{"own_files", parquetInt64, -1, i64(func(s *DirStat) int64 { return s.OwnFiles })},
+		{"depth", parquetInt32, -1, func(buf *bytes.Buffer, s *DirStat) { binary.Write(buf, binary.LittleEndian, int32(s.Depth)) }},
+		{"newest_mtime", parquetInt64, parquetTimestampMs, i64(func(s *DirStat) int64 { return s.NewestMtime * 1000 })},
+		{"oldest_mtime", parquetInt64, parquetTimestampMs, i64(func(s *DirStat) int64 { return s.OldestMtime * 1000 })},
+		{"owner_uid", parquetInt64, -1, i64(func(s *DirStat) int64 { return s.Uid })},
+		{"owner", parquetByteArray, parquetUTF8, str(func(s *DirStat) string { return ownerName(s.Uid, owners) })},
+	}
+	if fingerprint {
+		columns = append(columns, parquetColumn{"fingerprint", parquetByteArray, parquetUTF8, str(fingerprintHex)})
+	}
+	if len(dirTags) > 0 {
+		columns = append(columns, parquetColumn{"tags", parquetByteArray, parquetUTF8, str(func(s *DirStat) string { return tagsOf(s.Path) })})
+	}
+	for _, name := range labelNames {
+		name := name
+		columns = append(columns, parquetColumn{name, parquetByteArray, parquetUTF8, str(func(s *DirStat) string {
+			return shownLabels(labelsOf(s.Path))[name]
+		})})
+	}
+	for _, c := range addColumns {
+		eval := c.Eval
+		columns = append(columns, parquetColumn{c.Name, parquetDouble, -1, func(buf *bytes.Buffer, s *DirStat) {
+			binary.Write(buf, binary.LittleEndian, eval(s))
+		}})
+	}
+
+	type chunkMeta struct {
+		offset, uncompressed, compressed int64
+	}
+	offset := int64(4)
+	if _, err := io.WriteString(w, "PAR1"); err != nil {
+		return err
+	}
+
+	var chunks []chunkMeta
+	var totalBytes int64
+	for _, col := range columns {
+		meta := chunkMeta{offset: offset}
+		for start := 0; start < len(list) || (start == 0 && len(list) == 0); start += parquetRowsPerPage {
+			end := start + parquetRowsPerPage
+			if end > len(list) {
+				end = len(list)
+			}
+			var raw bytes.Buffer
+			for _, s := range list[start:end] {
+				col.Encode(&raw, s)
+			}
+			var compressed bytes.Buffer
+			zw := gzip.NewWriter(&compressed)
+			zw.Write(raw.Bytes())
+			zw.Close()
+
+			var header thriftWriter
+			header.beginStruct()
+			header.i32Field(1, parquetDataPage)
+			header.i32Field(2, int32(raw.Len()))
+			header.i32Field(3, int32(compressed.Len()))
+			header.structField(5)
+			header.i32Field(1, int32(end-start))
+			header.i32Field(2, parquetPlain)
+			header.i32Field(3, parquetRLE)
+			header.i32Field(4, parquetRLE)
+			header.endStruct()
+			header.endStruct()
+
+			for _, part := range [][]byte{header.buf.Bytes(), compressed.Bytes()} {
+				if _, err := w.Write(part); err != nil {
+					return err
+				}
+			}
+			n := int64(header.buf.Len())
+			meta.uncompressed += n + int64(raw.Len())
+			meta.compressed += n + int64(compressed.Len())
+			offset += n + int64(compressed.Len())
+			if len(list) == 0 {
+				break
+			}
+		}
+		totalBytes += meta.uncompressed
+		chunks = append(chunks, meta)
+	}
+
+	// FileMetaData
+	var fm thriftWriter
+	fm.beginStruct()
+	fm.i32Field(1, 1)
+	fm.listField(2, thriftStruct, len(columns)+1)
+	fm.beginStruct()
+	fm.stringField(4, "schema")
+	fm.i32Field(5, int32(len(columns)))
+	fm.endStruct()
+	for _, col := range columns {
+		fm.beginStruct()
+		fm.i32Field(1, col.Type)
+		fm.i32Field(3, parquetRequired)
+		fm.stringField(4, col.Name)
+		if col.Converted >= 0 {
+			fm.i32Field(6, col.Converted)
+		}
+		fm.endStruct()
+	}
+	fm.i64Field(3, int64(len(list)))
+	fm.listField(4, thriftStruct, 1)
+	fm.beginStruct() // RowGroup
+	fm.listField(1, thriftStruct, len(columns))
+	for i, col := range columns {
+		fm.beginStruct() // ColumnChunk
+		fm.i64Field(2, chunks[i].offset)
+		fm.structField(3) // ColumnMetaData
+		fm.i32Field(1, col.Type)
+		fm.listField(2, thriftI32, 1)
+		fm.writeVarint(zigzag(parquetPlain))
+		fm.listField(3, thriftBinary, 1)
+		fm.writeString(col.Name)
+		fm.i32Field(4, parquetGzip)
+		fm.i64Field(5, int64(len(list)))
+		fm.i64Field(6, chunks[i].uncompressed)
+		fm.i64Field(7, chunks[i].compressed)
+		fm.i64Field(9, chunks[i].offset)
+		fm.endStruct()
+		fm.endStruct()
+	}
+	fm.i64Field(2, totalBytes)
+	fm.i64Field(3, int64(len(list)))
+	fm.endStruct()
+	fm.stringField(6, parquetCreatedBy+" ("+version+")")
+	fm.endStruct()
+
+	footer := fm.buf.Bytes()
+	if _, err := w.Write(footer); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(footer))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "PAR1")
+	return err
+}
+
+// Thrift compact protocol type ids
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs with the Thrift compact protocol (only what Parquet metadata needs)
+type thriftWriter struct {
+	buf     bytes.Buffer
+	lastID  int16
+	idStack []int16
+}
+
+func (t *thriftWriter) beginStruct() {
+	t.idStack = append(t.idStack, t.lastID)
+	t.lastID = 0
+}
+
+func (t *thriftWriter) endStruct() {
+	t.buf.WriteByte(0) // STOP
+	t.lastID = t.idStack[len(t.idStack)-1]
+	t.idStack = t.idStack[:len(t.idStack)-1]
+}
+
+func (t *thriftWriter) fieldHeader(id int16, typ byte) {
+	if delta := id - t.lastID; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.writeVarint(zigzag(int64(id)))
+	}
+	t.lastID = id
+}
+
+func (t *thriftWriter) writeVarint(v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	t.buf.Write(tmp[:binary.PutUvarint(tmp[:], v)])
+}
+
+func (t *thriftWriter) writeString(s string) {
+	t.writeVarint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+func (t *thriftWriter) i32Field(id int16, v int32) {
+	t.fieldHeader(id, thriftI32)
+	t.writeVarint(zigzag(int64(v)))
+}
+
+func (t *thriftWriter) i64Field(id int16, v int64) {
+	t.fieldHeader(id, thriftI64)
+	t.writeVarint(zigzag(v))
+}
+
+func (t *thriftWriter) stringField(id int16, s string) {
+	t.fieldHeader(id, thriftBinary)
+	t.writeString(s)
+}
+
+// structField writes a field header and begins the nested struct; close it with endStruct.
+func (t *thriftWriter) structField(id int16) {
+	t.fieldHeader(id, thriftStruct)
+	t.beginStruct()
+}
+
+// listField writes a field header and list header; the caller writes size elements.
+func (t *thriftWriter) listField(id int16, elemType byte, size int) {
+	t.fieldHeader(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elemType)
+		return
+	}
+	t.buf.WriteByte(0xF0 | elemType)
+	t.writeVarint(uint64(size))
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
+
+// --- Report Templates ---
+
+// reportTemplate renders the report instead of the tables (--template): html/template for .html
+// and .htm files, which escapes the data for HTML, and text/template for anything else.
+var reportTemplate interface {
+	Execute(w io.Writer, data any) error
+}
+
+// templateData is the data a --template is executed with
+type templateData struct {
+	Summary     runSummary      // Totals, targets, violations, file systems, ... as in --summary-file
+	Generated   string          // Local time the report was rendered, RFC 3339
+	TopN        int             // --top
+	BySize      []dirEvent      // Top N directories by size
+	ByFiles     []dirEvent      // Top N directories by file count
+	Directories []dirEvent      // Every reported directory (after --where and --min-size), largest first
+	Projects    []*projectUsage // With --by-project
+	Labels      []*labelUsage   // With --path-template, by all labels
+}
+
+// templateFuncs are available in every --template
+var templateFuncs = map[string]any{
+	"bytes": formatBytes,
+	"exact": exactSize,
+	"percent": func(part, total int64) string {
+		if total <= 0 {
+			return "-"
+		}
+		return formatDecimal(float64(part)*100/float64(total), 1) + "%"
+	},
+	"cost": formatCost,
+}
+
+// loadReportTemplate parses the template file, so errors are reported before the scan
+func loadReportTemplate(name string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == ".html" || ext == ".htm" {
+		reportTemplate, err = template.New(filepath.Base(name)).Funcs(templateFuncs).Parse(string(data))
+	} else {
+		reportTemplate, err = texttemplate.New(filepath.Base(name)).Funcs(templateFuncs).Parse(string(data))
+	}
+	return err
+}
+
+// renderTemplate executes the --template with the reported directories, writing to --output or stdout
+func renderTemplate(list []*DirStat, startTime time.Time, totalFiles int) error {
+	host, _ := os.Hostname()
+	owners := make(map[int64]string)
+	events := func(dirs []*DirStat) []dirEvent {
+		out := make([]dirEvent, 0, len(dirs))
+		for _, s := range dirs {
+			out = append(out, newDirEvent(s, host, startTime, owners))
+		}
+		return out
+	}
+	sorted := make([]*DirStat, len(list))
+	copy(sorted, list)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].FileCount > sorted[j].FileCount })
+	data := templateData{
+		Generated: time.Now().Format(time.RFC3339),
+		TopN:      topN,
+		ByFiles:   events(sorted[:min(topN, len(sorted))]),
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].TotalSize > sorted[j].TotalSize })
+	data.Directories = events(sorted)
+	data.BySize = data.Directories[:min(topN, len(data.Directories))]
+	if byProject {
+		data.Projects = computeProjectUsage()
+	}
+	data.Summary = buildSummary(startTime, totalFiles, len(list))
+	data.Labels = data.Summary.Labels
+
+	var out bytes.Buffer
+	if err := reportTemplate.Execute(&out, data); err != nil {
+		return err
+	}
+	if outputFile == "" {
+		_, err := os.Stdout.Write(out.Bytes())
+		return err
+	}
+	if err := os.WriteFile(outputFile, out.Bytes(), 0o644); err != nil {
+		return err
+	}
+	signFile(outputFile)
+	return nil
+}
+
+// --- Charts ---
+//
+// --chart draws the directory tree weighted by size as a static SVG: a sunburst (rings around the
+// targets) or a flame graph (the targets at the bottom, subdirectories stacked above). Both carry a
+// tooltip with the path and size on every element. A flame chart written to any other extension is
+// in the collapsed stack format ("a;b;c bytes") that speedscope and flamegraph.pl load.
+
+type chartSpec struct {
+	Kind   string // sunburst or flame
+	File   string
+	Folded bool // flame chart as collapsed stacks instead of SVG
+}
+
+// parseChartSpec reads "[sunburst:|flame:]<file>"; without a prefix the kind comes from the file name
+func parseChartSpec(s string) (chartSpec, error) {
+	c := chartSpec{File: s}
+	if kind, file, ok := strings.Cut(s, ":"); ok && (kind == "sunburst" || kind == "flame") {
+		c.Kind, c.File = kind, file
+	} else {
+		base := strings.ToLower(filepath.Base(s))
+		switch {
+		case strings.Contains(base, "sunburst"):
+			c.Kind = "sunburst"
+		case strings.Contains(base, "flame"):
+			c.Kind = "flame"
+		default:
+			return c, fmt.Errorf("cannot tell the chart type from the name, use sunburst:%s or flame:%s", s, s)
+		}
+	}
+	if c.File == "" {
+		return c, errors.New("missing file name")
+	}
+	svg := strings.EqualFold(filepath.Ext(c.File), ".svg")
+	if c.Kind == "sunburst" && !svg {
+		return c, errors.New("a sunburst chart is written as .svg")
+	}
+	c.Folded = c.Kind == "flame" && !svg
+	return c, nil
+}
+
+type chartNode struct {
+	Name     string
+	Path     string
+	Size     int64
+	Own      int64
+	Children []*chartNode // Largest first
+}
+
+// chartTree returns the targets as a tree of the reported directories (--min-size prunes it). With
+// several targets the root is a node without a path above them.
+func chartTree() *chartNode {
+	children := make(map[string][]string)
+	for p, s := range dirStats {
+		if parent := filepath.Dir(p); parent != p && isUnderTargets(p) && !isExactTarget(p) && s.TotalSize >= minSize {
+			children[parent] = append(children[parent], p)
+		}
+	}
+	var build func(p string, name string) *chartNode
+	build = func(p string, name string) *chartNode {
+		s := dirStats[p]
+		n := &chartNode{Name: name, Path: shownPath(p), Size: s.TotalSize, Own: s.OwnSize}
+		for _, c := range children[p] {
+			n.Children = append(n.Children, build(c, filepath.Base(shownPath(c))))
+		}
+		sort.Slice(n.Children, func(i, j int) bool {
+			if n.Children[i].Size != n.Children[j].Size {
+				return n.Children[i].Size > n.Children[j].Size
+			}
+			return n.Children[i].Name < n.Children[j].Name
+		})
+		return n
+	}
+	root := &chartNode{Name: "all targets"}
+	for _, t := range targetPaths {
+		if _, ok := dirStats[t]; ok {
+			n := build(t, shownPath(t))
+			root.Children = append(root.Children, n)
+			root.Size += n.Size
+		}
+	}
+	if len(root.Children) == 1 {
+		return root.Children[0]
+	}
+	return root
+}
+
+func writeChart(c chartSpec) error {
+	root := chartTree()
+	var buf bytes.Buffer
+	switch {
+	case c.Folded:
+		writeFoldedStacks(&buf, root, nil)
+	case c.Kind == "sunburst":
+		writeSunburst(&buf, root)
+	default:
+		writeFlameGraph(&buf, root)
+	}
+	return writeFileAtomic(c.File, buf.Bytes())
+}
+
+// writeFoldedStacks writes one line per directory with files of its own, weighted by their size
+func writeFoldedStacks(w io.Writer, n *chartNode, stack []string) {
+	stack = append(stack, strings.ReplaceAll(n.Name, ";", "_"))
+	if n.Own > 0 {
+		fmt.Fprintf(w, "%s %d\n", strings.Join(stack, ";"), n.Own)
+	}
+	for _, c := range n.Children {
+		writeFoldedStacks(w, c, stack)
+	}
+}
+
+// chartTitle is the tooltip of a chart element
+func chartTitle(n *chartNode) string {
+	p := n.Path
+	if p == "" {
+		p = n.Name
+	}
+	return template.HTMLEscapeString(p + ": " + formatBytes(n.Size) + " (" + exactSize(n.Size) + ")")
+}
+
+// chartLabel cuts a label to about width pixels of 10px text
+func chartLabel(s string, width float64) string {
+	r := []rune(s)
+	n := int(width / 6.5)
+	if len(r) > n {
+		if n < 3 {
+			return ""
+		}
+		s = string(r[:n-2]) + ".."
+	}
+	return template.HTMLEscapeString(s)
+}
+
+// sunburstRings is the number of rings around the center; deeper directories are left out
+const sunburstRings = 8
+
+func writeSunburst(w io.Writer, root *chartNode) {
+	const size, center, inner = 820.0, 410.0, 70.0
+	depth := 0
+	var measure func(n *chartNode, d int)
+	measure = func(n *chartNode, d int) {
+		depth = max(depth, d)
+		for _, c := range n.Children {
+			if d < sunburstRings {
+				measure(c, d+1)
+			}
+		}
+	}
+	measure(root, 0)
+	ring := (center - 10 - inner) / float64(max(depth, 1))
+
+	fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%g\" height=\"%g\" viewBox=\"0 0 %g %g\" font-family=\"sans-serif\" font-size=\"10\">\n",
+		size, size, size, size)
+	fmt.Fprintf(w, "<circle cx=\"%g\" cy=\"%g\" r=\"%g\" fill=\"#eee\"><title>%s</title></circle>\n", center, center, inner, chartTitle(root))
+	fmt.Fprintf(w, "<text x=\"%g\" y=\"%g\" text-anchor=\"middle\" font-weight=\"bold\">%s</text>\n", center, center-2, chartLabel(filepath.Base(root.Name), 2*inner-10))
+	fmt.Fprintf(w, "<text x=\"%g\" y=\"%g\" text-anchor=\"middle\">%s</text>\n", center, center+12, formatBytes(root.Size))
+
+	point := func(r, a float64) (float64, float64) {
+		return center + r*math.Cos(a), center + r*math.Sin(a)
+	}
+	var draw func(n *chartNode, d int, a0, a1 float64, hue float64)
+	draw = func(n *chartNode, d int, a0, a1 float64, hue float64) {
+		span := min(a1-a0, 2*math.Pi-1e-4)
+		r0, r1 := inner+float64(d-1)*ring, inner+float64(d)*ring
+		if span*r1 < 0.5 {
+			return
+		}
+		large := 0
+		if span > math.Pi {
+			large = 1
+		}
+		x0, y0 := point(r1, a0)
+		x1, y1 := point(r1, a0+span)
+		x2, y2 := point(r0, a0+span)
+		x3, y3 := point(r0, a0)
+		fmt.Fprintf(w, "<path d=\"M%.2f %.2f A%.2f %.2f 0 %d 1 %.2f %.2f L%.2f %.2f A%.2f %.2f 0 %d 0 %.2f %.2f Z\" fill=\"hsl(%.0f,60%%,%d%%)\" stroke=\"#fff\" stroke-width=\"0.5\"><title>%s</title></path>\n",
+			x0, y0, r1, r1, large, x1, y1, x2, y2, r0, r0, large, x3, y3, hue, min(45+6*d, 90), chartTitle(n))
+		// Labels run along the radius where the ring segment is at least one line high
+		if mid := a0 + span/2; span*(r0+r1)/2 >= 12 {
+			deg := mid * 180 / math.Pi
+			x, y := point((r0+r1)/2, mid)
+			if math.Cos(mid) < 0 {
+				deg += 180
+			}
+			if label := chartLabel(n.Name, ring-6); label != "" {
+				fmt.Fprintf(w, "<text x=\"%.2f\" y=\"%.2f\" text-anchor=\"middle\" dominant-baseline=\"central\" transform=\"rotate(%.1f %.2f %.2f)\">%s</text>\n",
+					x, y, deg, x, y, label)
+			}
+		}
+		if d >= sunburstRings || n.Size == 0 {
+			return
+		}
+		a := a0
+		for _, c := range n.Children {
+			ca := (a1 - a0) * float64(c.Size) / float64(n.Size)
+			draw(c, d+1, a, a+ca, hue)
+			a += ca
+		}
+	}
+	// Each directory below the center gets its own hue, shared by its subdirectories
+	a := -math.Pi / 2
+	for i, c := range root.Children {
+		if root.Size == 0 {
+			break
+		}
+		ca := 2 * math.Pi * float64(c.Size) / float64(root.Size)
+		draw(c, 1, a, a+ca, float64(i*360/max(len(root.Children), 1)))
+		a += ca
+	}
+	fmt.Fprintln(w, "</svg>")
+}
+
+func writeFlameGraph(w io.Writer, root *chartNode) {
+	const width, row, pad = 1200.0, 18.0, 10.0
+	depth := 0
+	var measure func(n *chartNode, d int)
+	measure = func(n *chartNode, d int) {
+		depth = max(depth, d)
+		for _, c := range n.Children {
+			measure(c, d+1)
+		}
+	}
+	measure(root, 0)
+	height := float64(depth+1)*row + 2*pad + 20
+	scale := 0.0
+	if root.Size > 0 {
+		scale = (width - 2*pad) / float64(root.Size)
+	}
+
+	fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%g\" height=\"%g\" viewBox=\"0 0 %g %g\" font-family=\"sans-serif\" font-size=\"10\">\n",
+		width, height, width, height)
+	fmt.Fprintf(w, "<text x=\"%g\" y=\"%g\" text-anchor=\"middle\" font-size=\"14\">%s</text>\n",
+		width/2, pad+12, chartTitle(root))
+	var draw func(n *chartNode, d int, x float64)
+	draw = func(n *chartNode, d int, x float64) {
+		wd := float64(n.Size) * scale
+		if wd < 0.5 {
+			return
+		}
+		y := height - pad - float64(d+1)*row
+		// Warm colors as in flamegraph.pl, stable per name
+		h := fnv.New32a()
+		h.Write([]byte(n.Name))
+		v := h.Sum32()
+		fmt.Fprintf(w, "<g><title>%s</title><rect x=\"%.2f\" y=\"%.2f\" width=\"%.2f\" height=\"%g\" rx=\"2\" fill=\"rgb(%d,%d,%d)\"/>",
+			chartTitle(n), x, y, wd, row-1, 205+v%50, v/50%230, v/11500%55)
+		if label := chartLabel(n.Name, wd-6); label != "" {
+			fmt.Fprintf(w, "<text x=\"%.2f\" y=\"%.2f\">%s</text>", x+3, y+row-6, label)
+		}
+		fmt.Fprintln(w, "</g>")
+		for _, c := range n.Children {
+			draw(c, d+1, x)
+			x += float64(c.Size) * scale
+		}
+	}
+	draw(root, 0, pad)
+	fmt.Fprintln(w, "</svg>")
+}
+
+// --- Graphviz Export ---
+//
+// --format dot writes the heavy part of the tree (directories of at least --dot-min-size, by default
+// 1% of the total) as a Graphviz graph for architecture and capacity documents. Node area and color
+// follow the size; the children below the threshold are combined into one dashed node per parent.
+// Render it with e.g. `dot -Tsvg tree.dot -o tree.svg`.
+
+func writeDOT() error {
+	root := chartTree()
+	threshold := dotMinSize
+	if threshold < 0 {
+		threshold = root.Size / 100
+	}
+	var buf bytes.Buffer
+	buf.WriteString("digraph heavy_dirs {\n")
+	buf.WriteString("\trankdir=LR;\n")
+	buf.WriteString("\tnode [shape=box, style=\"rounded,filled\", fontname=\"Helvetica\"];\n")
+	buf.WriteString("\tedge [color=\"#999999\", arrowhead=none];\n")
+	ids := 0
+	node := func(name, tooltip string, size int64, attrs string) string {
+		id := fmt.Sprintf("n%d", ids)
+		ids++
+		share := 0.0
+		if root.Size > 0 {
+			share = float64(size) / float64(root.Size)
+		}
+		// Area proportional to the size; the color runs from pale yellow to red
+		scale := math.Sqrt(share)
+		label := fmt.Sprintf("%s\n%s (%s%%)", name, formatBytes(size), formatDecimal(share*100, 1))
+		fmt.Fprintf(&buf, "\t%s [label=%s, fontsize=%.0f, width=%.2f, height=%.2f, fillcolor=\"0.08 %.3f 1.000\", tooltip=%s%s];\n",
+			id, dotQuote(label), 10+14*scale, 1+4*scale, 0.4+1.6*scale, 0.1+0.9*scale, dotQuote(tooltip), attrs)
+		return id
+	}
+	var walk func(n *chartNode) string
+	walk = func(n *chartNode) string {
+		id := node(n.Name, cmp.Or(n.Path, n.Name)+"\n"+exactSize(n.Size), n.Size, "")
+		var rest, restCount int64
+		for _, c := range n.Children {
+			if c.Size < threshold {
+				rest += c.Size
+				restCount++
+				continue
+			}
+			fmt.Fprintf(&buf, "\t%s -> %s;\n", id, walk(c))
+		}
+		if restCount > 0 {
+			name := fmt.Sprintf("%d smaller directories", restCount)
+			if restCount == 1 {
+				name = "1 smaller directory"
+			}
+			other := node(name, name+"\n"+exactSize(rest), rest, ", style=\"rounded,dashed,filled\"")
+			fmt.Fprintf(&buf, "\t%s -> %s;\n", id, other)
+		}
+		return id
+	}
+	walk(root)
+	buf.WriteString("}\n")
+	if err := writeFileAtomic(outputFile, buf.Bytes()); err != nil {
+		return err
+	}
+	signFile(outputFile)
+	return nil
+}
+
+// dotQuote returns s as a DOT string literal. Backslashes are escaped, as DOT would read e.g. \N in
+// a Windows path as the node name; line breaks become \n.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// --- PDF Report ---
+//
+// --format pdf writes a paginated A4 report for readers without a terminal: the summary, a treemap
+// of the directories directly below the targets, both rankings and, with --store, the host's total
+// size over time. The PDF is generated directly with the standard Helvetica fonts, which every
+// viewer has, so no fonts or external tools are needed.
+
+const (
+	pdfWidth  = 595.0 // A4 in points
+	pdfHeight = 842.0
+	pdfMargin = 50.0
+)
+
+// pdfWriter collects the content streams of the pages; y is the baseline of the last line written
+type pdfWriter struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	y     float64
+}
+
+func (p *pdfWriter) newPage() {
+	p.page = &bytes.Buffer{}
+	p.pages = append(p.pages, p.page)
+	p.y = pdfHeight - pdfMargin
+}
+
+// need starts a new page unless h more points fit above the bottom margin (and its footer)
+func (p *pdfWriter) need(h float64) bool {
+	if p.page == nil || p.y-h < pdfMargin+20 {
+		p.newPage()
+		return true
+	}
+	return false
+}
+
+func (p *pdfWriter) text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(p.page, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfString(s))
+}
+
+// line writes a line of text below the previous one
+func (p *pdfWriter) line(x, size float64, bold bool, s string) {
+	p.need(size * 1.5)
+	p.y -= size * 1.5
+	p.text(x, p.y, size, bold, s)
+}
+
+func (p *pdfWriter) rect(x, y, w, h float64, fill [3]float64) {
+	fmt.Fprintf(p.page, "%.3f %.3f %.3f rg %.2f %.2f %.2f %.2f re f\n", fill[0], fill[1], fill[2], x, y, w, h)
+}
+
+func (p *pdfWriter) stroke(width float64, color [3]float64, points ...[2]float64) {
+	fmt.Fprintf(p.page, "%.2f w %.3f %.3f %.3f RG", width, color[0], color[1], color[2])
+	for i, pt := range points {
+		op := "l"
+		if i == 0 {
+			op = "m"
+		}
+		fmt.Fprintf(p.page, " %.2f %.2f %s", pt[0], pt[1], op)
+	}
+	p.page.WriteString(" S\n")
+}
+
+// table writes rows below a bold header, repeating the header on every new page. The columns
+// start at the given x positions; the last column is cut to the page width.
+func (p *pdfWriter) table(title string, header []string, cols []float64, rows [][]string) {
+	const size = 9.0
+	p.need(60)
+	p.y -= 16
+	p.text(pdfMargin, p.y, 13, true, title)
+	printHeader := func() {
+		p.y -= size * 2
+		for i, h := range header {
+			p.text(cols[i], p.y, size, true, h)
+		}
+		p.stroke(0.5, [3]float64{0.5, 0.5, 0.5}, [2]float64{pdfMargin, p.y - 4}, [2]float64{pdfWidth - pdfMargin, p.y - 4})
+		p.y -= 4
+	}
+	printHeader()
+	last := len(cols) - 1
+	for _, row := range rows {
+		if p.need(size * 1.5) {
+			printHeader()
+		}
+		p.y -= size * 1.5
+		for i, v := range row {
+			if i == last {
+				v = fitText(v, size, pdfWidth-pdfMargin-cols[i])
+			}
+			p.text(cols[i], p.y, size, false, v)
+		}
+	}
+	if len(rows) == 0 {
+		p.line(pdfMargin, size, false, "(none)")
+	}
+}
+
+// fitText shortens s from the left (paths keep their end) to roughly fit width points of Helvetica
+func fitText(s string, size, width float64) string {
+	r := []rune(s)
+	maxChars := int(width / (size * 0.55))
+	if len(r) <= maxChars || maxChars < 2 {
+		return s
+	}
+	return "…" + string(r[len(r)-maxChars+1:])
+}
+
+// pdfString escapes s for a PDF string in WinAnsiEncoding; characters it lacks become '?'
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r == '…':
+			b.WriteString("\\205")
+		case r == '–':
+			b.WriteString("\\226")
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// writeTo writes the document: catalog, page tree, the two fonts, the info dictionary, then a
+// page object and a compressed content stream per page, and the cross-reference table.
+func (p *pdfWriter) writeTo(w io.Writer, title string) error {
+	var buf bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	var kids []string
+	for i := range p.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 6+2*i))
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	obj(fmt.Sprintf("<< /Title (%s) /Producer (%s) /CreationDate (D:%s) >>", pdfString(title), pdfString(version),
+		time.Now().UTC().Format("20060102150405Z")))
+	for i, page := range p.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %g %g] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfWidth, pdfHeight, 7+2*i))
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(page.Bytes())
+		zw.Close()
+		obj(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", z.Len(), z.Bytes()))
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// treemapPalette colors the treemap tiles, light enough for black labels
+var treemapPalette = [][3]float64{
+	{0.65, 0.81, 0.89}, {0.70, 0.87, 0.54}, {0.99, 0.75, 0.44}, {0.79, 0.70, 0.84},
+	{0.98, 0.60, 0.60}, {1.00, 1.00, 0.60}, {0.80, 0.80, 0.80}, {0.55, 0.83, 0.78},
+}
+
+// squarify lays out areas (largest first, summing to w*h) as tiles of the rectangle at x,y with
+// aspect ratios close to 1 (Bruls, Huizing, van Wijk).
+func squarify(areas []float64, x, y, w, h float64) [][4]float64 {
+	worst := func(row []float64, side float64) float64 {
+		s, lo, hi := 0.0, math.Inf(1), 0.0
+		for _, a := range row {
+			s += a
+			lo = math.Min(lo, a)
+			hi = math.Max(hi, a)
+		}
+		return math.Max(side*side*hi/(s*s), s*s/(side*side*lo))
+	}
+	var tiles [][4]float64
+	for i := 0; i < len(areas); {
+		side := math.Min(w, h)
+		j := i + 1
+		for j < len(areas) && worst(areas[i:j+1], side) <= worst(areas[i:j], side) {
+			j++
+		}
+		s := 0.0
+		for _, a := range areas[i:j] {
+			s += a
+		}
+		if w >= h {
+			// A column on the left, filled from the top
+			cw, top := s/h, y+h
+			for _, a := range areas[i:j] {
+				top -= a / cw
+				tiles = append(tiles, [4]float64{x, top, cw, a / cw})
+			}
+			x, w = x+cw, w-cw
+		} else {
+			// A row at the top, filled from the left
+			rh, left := s/w, x
+			for _, a := range areas[i:j] {
+				tiles = append(tiles, [4]float64{left, y + h - rh, a / rh, rh})
+				left += a / rh
+			}
+			h -= rh
+		}
+		i = j
+	}
+	return tiles
+}
+
+// treemapItems is the maximum number of tiles; smaller directories are combined into one
+const treemapItems = 30
+
+func (p *pdfWriter) treemap(list []*DirStat) {
+	var dirs []*DirStat
+	for _, s := range list {
+		if s.Depth == 1 && s.TotalSize > 0 {
+			dirs = append(dirs, s)
+		}
+	}
+	if len(dirs) == 0 {
+		return
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].TotalSize > dirs[j].TotalSize })
+	labels := make([]string, 0, treemapItems)
+	sizes := make([]int64, 0, treemapItems)
+	for i, s := range dirs {
+		if i == treemapItems-1 && len(dirs) > treemapItems {
+			var rest int64
+			for _, r := range dirs[i:] {
+				rest += r.TotalSize
+			}
+			labels = append(labels, fmt.Sprintf("%d more", len(dirs)-i))
+			sizes = append(sizes, rest)
+			break
+		}
+		labels = append(labels, filepath.Base(displayPathOf(s)))
+		sizes = append(sizes, s.TotalSize)
+	}
+	// Tiles stay ordered largest first, except the combined rest, which may be larger than some
+	var total int64
+	for _, s := range sizes {
+		total += s
+	}
+	const h = 330.0
+	w := pdfWidth - 2*pdfMargin
+	p.need(h + 40)
+	p.y -= 22
+	p.text(pdfMargin, p.y, 13, true, "Directories Directly Below the Targets")
+	p.y -= 8 + h
+	areas := make([]float64, len(sizes))
+	for i, s := range sizes {
+		areas[i] = float64(s) / float64(total) * w * h
+	}
+	for i, t := range squarify(areas, pdfMargin, p.y, w, h) {
+		p.rect(t[0], t[1], t[2], t[3], treemapPalette[i%len(treemapPalette)])
+		fmt.Fprintf(p.page, "1 w 1 G %.2f %.2f %.2f %.2f re S\n", t[0], t[1], t[2], t[3])
+		if t[2] > 40 && t[3] > 24 {
+			p.text(t[0]+3, t[1]+t[3]-11, 8, true, fitText(labels[i], 8, t[2]-6))
+			p.text(t[0]+3, t[1]+t[3]-21, 8, false, formatBytes(sizes[i]))
+		}
+	}
+}
+
+// storeHistory returns the (start, total size) of the host's reports in the --store, oldest first
+func storeHistory(host string) ([]time.Time, []int64) {
+	names, _ := filepath.Glob(filepath.Join(collectorStore, host, "*.summary.json"))
+	sort.Strings(names)
+	var times []time.Time
+	var sizes []int64
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		var sum runSummary
+		if json.Unmarshal(data, &sum) != nil {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, sum.Start); err == nil {
+			times = append(times, t)
+			sizes = append(sizes, sum.TotalSize)
+		}
+	}
+	return times, sizes
+}
+
+// trendChart draws the total size over time as a line chart
+func (p *pdfWriter) trendChart(times []time.Time, sizes []int64) {
+	const h = 220.0
+	w := pdfWidth - 2*pdfMargin - 60
+	x0 := pdfMargin + 60
+	p.need(h + 70)
+	p.y -= 22
+	p.text(pdfMargin, p.y, 13, true, fmt.Sprintf("Total Size Over Time (%d scans)", len(times)))
+	p.y -= 14 + h
+	y0 := p.y
+	lo, hi := slices.Min(sizes), slices.Max(sizes)
+	if hi == lo {
+		lo, hi = max(lo-lo/10-1, 0), hi+hi/10+1
+	}
+	first, last := times[0], times[len(times)-1]
+	span := last.Sub(first).Seconds()
+	points := make([][2]float64, len(times))
+	for i := range times {
+		px := x0
+		if span > 0 {
+			px += times[i].Sub(first).Seconds() / span * w
+		}
+		points[i] = [2]float64{px, y0 + float64(sizes[i]-lo)/float64(hi-lo)*h}
+	}
+	p.stroke(0.5, [3]float64{0.6, 0.6, 0.6}, [2]float64{x0, y0 + h}, [2]float64{x0, y0}, [2]float64{x0 + w, y0})
+	p.stroke(0.3, [3]float64{0.85, 0.85, 0.85}, [2]float64{x0, y0 + h}, [2]float64{x0 + w, y0 + h})
+	p.stroke(1.5, [3]float64{0.2, 0.4, 0.7}, points...)
+	p.text(pdfMargin, y0+h-3, 8, false, formatBytes(hi))
+	p.text(pdfMargin, y0-3, 8, false, formatBytes(lo))
+	p.text(x0, y0-14, 8, false, first.Local().Format("2006-01-02"))
+	p.text(x0+w-45, y0-14, 8, false, last.Local().Format("2006-01-02"))
+	p.y -= 20
+}
+
+// writePDFReport writes the --format pdf report to --output
+func writePDFReport(list []*DirStat, startTime time.Time, totalFiles int) error {
+	sum := buildSummary(startTime, totalFiles, len(list))
+	p := &pdfWriter{}
+	p.newPage()
+	p.line(pdfMargin, 20, true, "Storage Report")
+	p.line(pdfMargin, 11, false, fmt.Sprintf("%s, scanned %s", sum.Host, startTime.Local().Format("2006-01-02 15:04 MST")))
+	p.y -= 8
+
+	var summary [][]string
+	for _, t := range sum.Targets {
+		summary = append(summary, []string{"Target", fmt.Sprintf("%s, %d files", formatBytes(t.Size), t.Files), t.Path})
+	}
+	summary = append(summary,
+		[]string{"Total", formatBytes(sum.TotalSize), fmt.Sprintf("%d files", sum.TotalFiles)},
+		[]string{"Directories", strconv.Itoa(sum.Directories), "reported"},
+		[]string{"Unreadable", strconv.FormatInt(sum.Inaccessible, 10), "entries"},
+		[]string{"Duration", (time.Duration(sum.DurationSeconds*1000) * time.Millisecond).String(), ""})
+	checks := make([]string, 0, len(sum.Violations))
+	for check, n := range sum.Violations {
+		if n > 0 {
+			checks = append(checks, check)
+		}
+	}
+	sort.Strings(checks)
+	for _, check := range checks {
+		summary = append(summary, []string{"Violations", strconv.FormatInt(sum.Violations[check], 10), check})
+	}
+	for _, c := range sum.Filesystems {
+		share := "-"
+		if c.Usable > 0 {
+			share = formatDecimal(float64(c.Used)*100/float64(c.Usable), 1) + "%"
+		}
+		summary = append(summary, []string{"File system", fmt.Sprintf("%s of %s used (%s)", formatBytes(c.Used), formatBytes(c.Usable), share),
+			c.MountPoint + " (" + c.Source + ")"})
+	}
+	p.table("Summary", []string{"", "Value", ""}, []float64{pdfMargin, pdfMargin + 80, pdfMargin + 260}, summary)
+
+	p.treemap(list)
+
+	rows := func(sorted []*DirStat, metric func(s *DirStat) string, value func(s *DirStat) int64, total int64) [][]string {
+		var out [][]string
+		for i, s := range sorted {
+			if i >= topN && !showAll {
+				break
+			}
+			share := "-"
+			if total > 0 {
+				share = formatDecimal(float64(value(s))*100/float64(total), 1) + "%"
+			}
+			out = append(out, []string{metric(s), share, displayPathOf(s)})
+		}
+		return out
+	}
+	sorted := make([]*DirStat, len(list))
+	copy(sorted, list)
+	cols := []float64{pdfMargin, pdfMargin + 75, pdfMargin + 125}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].TotalSize > sorted[j].TotalSize })
+	p.newPage()
+	p.table(fmt.Sprintf("Top %d Largest Subdirectories by Size", topN), []string{"Size", "Share", "Path"}, cols,
+		rows(sorted, func(s *DirStat) string { return formatBytes(s.TotalSize) }, func(s *DirStat) int64 { return s.TotalSize }, sum.TotalSize))
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].FileCount > sorted[j].FileCount })
+	p.y -= 10
+	p.table(fmt.Sprintf("Top %d Subdirectories by File Count", topN), []string{"Files", "Share", "Path"}, cols,
+		rows(sorted, func(s *DirStat) string { return strconv.FormatInt(s.FileCount, 10) }, func(s *DirStat) int64 { return s.FileCount }, sum.TotalFiles))
+
+	if collectorStore != "" {
+		times, sizes := storeHistory(sum.Host)
+		times = append(times, startTime)
+		sizes = append(sizes, sum.TotalSize)
+		if len(times) > 1 {
+			p.trendChart(times, sizes)
+		}
+	}
+
+	for i, page := range p.pages {
+		p.page = page
+		p.text(pdfMargin, pdfMargin-20, 8, false, fmt.Sprintf("%s – %s", sum.Host, version))
+		p.text(pdfWidth-pdfMargin-60, pdfMargin-20, 8, false, fmt.Sprintf("Page %d of %d", i+1, len(p.pages)))
+	}
+
+	out, err := os.Create(outputFile)
+	if err != nil {
+		return err
+	}
+	if err := p.writeTo(out, "Storage Report "+sum.Host); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	signFile(outputFile)
+	return nil
+}
@@ -10,26 +10,166 @@ Description:
 
 Usage:
     find_heavy_dirs [options]
+    find_heavy_dirs simulate-retention --rule <rule> [--rule <rule>...] [options]
+    find_heavy_dirs backup-gap --catalog <file> [--catalog-root <dir>] [options]
+    find_heavy_dirs plan-copy --shards <N> [--balance bytes|files] [--output <dir>] [options]
+    find_heavy_dirs heavy-files-by-type [options]
+    find_heavy_dirs logs [options]
+    find_heavy_dirs dev [--project-markers <list>] [options]
+    find_heavy_dirs git-repos [options]
+    find_heavy_dirs databases [options]
+    find_heavy_dirs mail [options]
+    find_heavy_dirs tag [<dir> [key=value | flag | -key ...]] [--tags <file>]
+    find_heavy_dirs collector --store <dir> [--listen <addr>] [--tls-cert <file> --tls-key <file>] [--access <file>] [--run-as <user>]
+    find_heavy_dirs verify-report --key <public key> <file>...
+    find_heavy_dirs history <prune|compact> --store <dir> [--keep-daily <N>] [--keep-weekly <N>] [--keep-monthly <N>] [--dry-run]
+    find_heavy_dirs check [--entry-limit <N>] [--path-lengths] [--symlinks] [--crash-dumps] [--temp-files <age>] [--permissions] [--budget <dir>=<size>] [--ticket <tracker>] [options]
+    find_heavy_dirs diff <old snapshot> <new snapshot> [--top <N>] [--all]
+    find_heavy_dirs watch [--interval <duration>] [--throttle <N> [--full-speed <ranges>]] [options]
+    find_heavy_dirs dupes [--fingerprint-content] [--min-size <size>] [options]
+    fs-analyzer scan|serve|check|diff|watch|dupes|history|<report> [options]
+
+    Installed as fs-analyzer (any name starting with it), the first argument must be a subcommand:
+    scan is the default report and serve the collector. Under any other name, such as find_heavy_dirs,
+    options without a subcommand run a scan and every option and subcommand keeps working.
 
 Options:
     --path <dir1> [dir2...]   Specify directories to scan. Default is current directory.
     --exclude <dir1> [dir2...] Exclude one or more subpaths from scanning and statistics.
     --size-mode <disk|apparent> Size metric mode. Default is disk (Windows falls back to apparent).
     --top <N>                 Display the top N entries. Default is 20.
+    --all                     List every directory in the size and file count rankings (paged on a terminal).
+    --precision <N>           Decimals of displayed sizes (0-6). Default is 1.
+    --round <up|down|nearest> Rounding of displayed sizes. Default is nearest.
+    --exact-bytes             Add the exact size in bytes to the size rankings and diff.
+    --locale <name|auto>      Thousands and decimal separators of the tables, e.g. en, de, fr_CH or auto (LANG).
+    --min-size <size>         Only report directories of at least <size>, e.g. 1G (with --all: every such directory).
+    --no-pager                Do not page --all output through $PAGER (default less -FRX) on a terminal.
     --maxdepth <N>            Maximum recursion depth. Default is 1000000.
+    --max-memory <size>       Soft memory limit: near it, deep directories are folded into their ancestors (e.g. 512M).
+    --throttle <N>            Walk at most N directory entries per second, to spare production I/O.
+    --full-speed <ranges>     Times of day (local) without --throttle, e.g. 01:00-05:00. Repeatable.
+    --resource-usage          Report the scanner's own peak RSS, CPU time, syscalls and GC pauses at the end.
+    --summary-fd <N>          Write a JSON summary (totals, duration, errors, threshold violations) to file descriptor N.
+    --summary-file <file>     Write the JSON summary to a file instead.
+    --upload <url>            POST the report (summary and directories as gzip-compressed JSON) to a collector.
+    --upload-header <h>       Extra request header for --upload, e.g. 'Authorization: Bearer ...'. Repeatable.
+    --upload-retries <N>      Retries of a failed upload (network errors, 429, 5xx). Default is 3.
+    --budget <dir>=<size>     Size a directory may grow to; over it, check fails (dirs_over_budget). Repeatable.
+    --ticket <tracker>        check: Open or update an issue per directory over budget: github:<owner>/<repo> or jira:<project>.
+    --ticket-api <url>        API base URL for --ticket (GitHub Enterprise, Jira). Default is https://api.github.com.
+    --ticket-header <h>       Extra request header for --ticket, e.g. 'Authorization: Basic ...'. Repeatable.
+    --ticket-template <file>  Go text template for the issue text (fields Path, Host, Size, Budget, Files, Children).
+    --store <dir>             collector, history: Directory of the received reports (created if missing); --format pdf: trend source.
+    --listen <addr>           collector: Address to listen on. Default is :8931 with TLS, 127.0.0.1:8931 without.
+    --tls-cert <file>         collector: TLS certificate (PEM); required to listen on other than a loopback address.
+    --tls-key <file>          collector: Private key (PEM) of --tls-cert.
+    --access <file>           collector: Users with tokens, roles (admin, viewer, uploader) and host/path scopes.
+    --run-as <user>           collector: Switch to this user after opening the listening socket (Unix).
+    --keep-daily <N>          history: Keep one report per day for the N most recent days with reports.
+    --keep-weekly <N>         history: Then one report per ISO week for N weeks.
+    --keep-monthly <N>        history: Then one report per month for N months; older reports are removed.
+    --interval <duration>     watch: Time between scans. Default is 10m.
+    --dry-run                 history: Only show what would be merged and removed.
+    --post-hook <cmd>         Run a command after the scan with the JSON summary on stdin and FS_ANALYZER_* variables. Repeatable.
+    --offline                 Refuse every network connection (upload, stream, metrics, traces, collector).
+    --strict-read-only        Refuse every option that writes files, run no pager, and read without updating access times (O_NOATIME, Linux).
+    --sign-key <file>         Sign the snapshot, summary file and exports with an Ed25519 key (PEM), writing <file>.sig.
+    --key <file>              verify-report: Ed25519 public key (PEM) to check the signatures with.
     --verbose                 Show detailed progress information. Default is false.
+    --progressive             Show first-level subdirectories within seconds, then update their sizes while scanning.
     --display-runtime         Show total execution time at the end. Default is false.
+    --collapse-chains         Merge single-child chains of near-identical size into one entry (a/…/d).
+    --unique-top              Replace ancestors that are >=95% one listed descendant by that descendant.
+    --sample <P>              Walk only a share P (e.g. 10% or 0.1) of the subtrees at depth 2 and extrapolate.
+    --metrics <url>           Push size/file-count gauges to graphite://host:port or statsd://host:port.
+    --metric-template <tpl>   Metric name template. Default is fs_analyzer.{host}.{path}.{metric}.
+    --metric-depth <N>        Only push directories up to N levels below the target. Default is 2.
+    --otlp-endpoint <url>     Export scan traces and metrics via OTLP/HTTP (JSON), e.g. http://localhost:4318.
+    --trace-min-duration <d>  Emit a span for every subtree that took at least this long. Default is 1s.
+    --skip-cross-os           Skip mounts of another OS's file systems (WSL /mnt/c drvfs, 9p, VM shared folders).
+    --btrfs-subvolumes        Detect btrfs subvolumes/snapshots and report them as separate roots.
+    --save <file>             Save the aggregated scan to a snapshot file (for --load).
+    --load <file>             Re-report from a snapshot saved with --save instead of scanning.
+    --tags <file>             Directory tags file (default <config dir>/fs-analyzer/tags.json), shown in reports.
+    --assume-immutable <dir>=<snapshot> Take a read-only subtree from a snapshot (--save) instead of walking it.
+    --from-listing <file>     Build the reports from a CSV/JSON listing (path,size,mtime,uid) instead of scanning.
+    --rewrite <re>=<path>     Rewrite leading path parts in reports and exports, e.g. '/mnt/data[0-9]+=/data'. Repeatable.
+    --anonymize               Replace path components by stable hashes (depth and extensions are kept).
+    --relative                Show the paths of the rankings relative to their scan root, named once in the header.
+    --only-mine [uid]         Count only files owned by the invoking user (or uid); skip unreadable directories of others.
+    --by-project              Report usage per project/owner (nearest .git, go.mod, package.json or .owner).
+    --project-markers <list>  Comma-separated marker names for --by-project and dev. Default is .git,go.mod,package.json,.owner.
+    --departments <file.csv>  Report the directories right below each path with their owner, size and last activity, and write them with per-owner totals to a CSV file.
+    --group-by-component <N>  Report usage per name of the Nth path component, e.g. 3 for /srv/tenants/<name>.
+    --path-template <tpl>     Extract labels from paths, e.g. '/data/{team}/{project}/**', and report usage per label. Repeatable.
+    --cost-per-gb <price>     Annotate sizes with a monthly cost estimate (price per GiB and month).
+    --currency <code>         Currency label for --cost-per-gb. Default is USD.
+    --format <table|parquet|csv|pdf|dot> Output format. Default is table; parquet/csv write every directory to --output, pdf a report, dot a Graphviz graph.
+    --dot-min-size <size>     Smallest directory in the --format dot graph. Default is 1% of the total.
+    --output <file|dir:dir>   Output file for non-table formats and --template, or dir:<dir> for a partitioned data set.
+    --template <file>         Render the report with a Go template instead of the tables (html/template for .html files).
+    --chart <file>            Also draw the tree as sunburst.svg, flame.svg or flame.folded (speedscope). Repeatable.
+    --where <cond>            Only report directories matching a condition, e.g. 'size > 10GB && path =~ "cache"'.
+    --add-column <name=expr>  Add a computed column, e.g. 'files_per_gb = files / (size/1e9)'. Repeatable.
+    --analyzer <cmd>          Run a report plugin: gets every directory as JSON lines, returns report sections. Repeatable.
+    --partition-by <keys>     Comma-separated partition keys for --output dir:<dir> (host, date, target).
+    --rule <rule>             simulate-retention: "delete <glob> [older than <age>]" or "keep <N> newest [<glob>] per directory".
+    --rules <file>            simulate-retention: Read rules from a file, one per line (# comments).
+    --catalog <file>          backup-gap: Backup listing (restic ls --json, borg list --json-lines or tar -tv output).
+    --catalog-root <dir>      backup-gap: Prefix for relative catalog paths (borg, tar). Default is /.
+    --shards <N>              plan-copy: Split the targets into N shards of about equal size.
+    --balance <bytes|files>   plan-copy: Balance shards by bytes or file count. Default is bytes.
+    --emit-exclude-file <fmt> Write an rsync, borg or restic exclude list (caches, temp dirs, thresholds) instead of the reports.
+    --exclude-older-than <age> --emit-exclude-file: Also exclude directories unchanged for <age> (e.g. 180d, 2y).
+    --exclude-larger-than <size> --emit-exclude-file: Also exclude directories of at least <size> (e.g. 50G).
+    --entry-limit <N>         Report directories with more than N direct entries. Default is 100000 (0 disables).
+    --regenerable             Report derived files (thumbnails, transcodes, .pyc, source maps, ...) whose source is next to them.
+    --versioned-files         Report families of versioned files (report_v1.docx ... report_v27_final.docx) and the space of all but the newest.
+    --temp-files <age>        Report temporary files (~, .swp, .tmp, .partial, tmp/ dirs, ...) older than <age> per directory.
+    --symlinks                Report symlinks by target and per directory, flagging broken links and links leaving the scanned roots.
+    --special-files           Report sockets, FIFOs and device nodes per directory (leftover runtime state).
+    --deleted-open            Linux: Report deleted files still held open (per process and original directory), the usual df/du gap.
+    --reconcile               Compare the scan with df per file system and itemize the gap (open deleted files, hard links, ...).
+    --crash-dumps             Report core dumps, minidumps, JVM crash logs and heap dumps with their ages.
+    --permissions             Report group/other-writable and setuid/setgid files and the widest modes per directory.
+    --slowest <N>             Report the N directories that took longest to scan per entry. Default is 0 (off).
+    --path-lengths            Report the deepest nesting levels and longest paths (MAX_PATH/PATH_MAX offenders).
+    --name-audit              Report names with invalid UTF-8, control characters, trailing space/dot, case collisions or Windows device names.
+    --target-fs <fs>          Report entries that would break on ntfs, exfat, fat32, apfs or ext4 (lengths, names, sizes, links, case).
+    --fingerprint             Compute a Merkle-style fingerprint per directory (names, sizes, mtimes) for exports.
+    --fingerprint-content     With --fingerprint, also hash file contents (reads every file).
+    --name-patterns           Report generated file name families (digits/dates/ids as *) by size and count.
+    --stream <url>            Publish every directory as a JSON message to nats://host:port/subject or kafka://broker:port/topic.
+    --zfs                     Reconcile scanned totals with ZFS dataset used/referenced/snapshot space.
+    --profile <name>          Apply a named profile (paths, excludes, options) from the config file.
+    --config <file>           Config file with profiles. Default is <user config dir>/fs-analyzer/profiles.conf.
+    --gogc <N|off>            Garbage collector target percentage (like GOGC). Default is the GOGC environment value or 100.
+    --memory-limit <size>     Soft memory limit for the Go runtime (like GOMEMLIMIT), e.g. 4G. Default is no limit.
     --version                 Show program version. Default is false.
     -h, --help                Show help message.
 */
 
 import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"math"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -39,18 +179,116 @@ import (
 // --- Configuration & Constants ---
 
 var (
-	version        = "find-heavy-dirs version 3.02.20260415b.go"
+	version        = "find-heavy-dirs version 3.03.20261017.go"
 	excludePaths   = []string{"/proc", "/dev", "/sys", "/run"}
 	excludeNormSet map[string]bool
 	targetPaths    []string
-	sizeMode       = "disk" // Default disk; on Windows falls back to apparent
+	sizeMode       = "disk"  // Default disk; on Windows falls back to apparent
 	maxDepth       = 1000000 // Default 1000000
 	topN           = 20      // Default 20
 	verbose        = false   // Default false
 	displayRuntime = false   // Default false
 	showVersion    = false   // Default false
+	collapseChains = false   // Default false
+	uniqueTop      = false   // Default false
+	sampleRate     = 1.0     // Default 1.0 (no sampling)
+	metricsURL     = ""      // Default empty (no metrics sink)
+	metricTemplate = "fs_analyzer.{host}.{path}.{metric}"
+	metricDepth    = 2  // Default 2
+	otlpEndpoint   = "" // Default empty (no tracing)
+	traceMinDur    = time.Second
+	btrfsSubvols   = false // Default false
+	zfsDatasets    = false // Default false
+	fromListing    = ""    // Default empty (scan the file system)
+	saveFile       = ""    // Default empty (no snapshot)
+	loadFile       = ""    // Default empty (scan the file system)
+	summaryFD      = -1    // Default -1 (no machine-readable summary)
+	skipCrossOS    = false
+	summaryFile    = ""
+	postHooks      []string
+	uploadURL      = ""
+	uploadHeaders  [][2]string // Extra request headers (--upload-header)
+	uploadRetries  = 3
+	collectorStore = ""
+	listenAddr     = ":8931"
+	accessFile     = ""
+	anonymize      = false // Default false
+	byProject      = false // Default false
+	projectMarkers = []string{".git", "go.mod", "package.json", ".owner"}
+	costPerGB      = 0.0     // Default 0 (no cost column)
+	currency       = "USD"   // Default USD
+	outputFormat   = "table" // Default table
+	outputFile     = ""      // Default empty (required for non-table formats)
+	partitionBy    []string
+	addColumns     []addedColumn // Computed columns (--add-column), in order
+	whereFilter    exprFunc      // Default nil (report all directories); --where
+	streamURL      = ""          // Default empty (no stream sink)
+	namePatterns   = false
+	command        = "" // Default empty (scan report); "simulate-retention", "backup-gap" or "plan-copy"
+	catalogFile    = ""
+	catalogRoot    = string(os.PathSeparator)
+	shardCount     = 0       // plan-copy: number of shards (required)
+	shardBalance   = "bytes" // plan-copy: balance shards by bytes or files
+	fingerprint    = false
+	hashContent    = false
+	entryLimit     = int64(100000) // Default 100000 (0 disables the report)
+	slowestN       = 0             // Default 0 (no scan duration report)
+	permReport     = false
+	crashDumps     = false
+	symlinkReport  = false
+	specialFiles   = false
+	deletedOpen    = false
+	reconcile      = false
+	tempReport     = false
+	regenerable    = false
+	onlyUid        = int64(-1) // Default -1 (all owners); --only-mine
+	gcPercent      = 0         // Default 0 (keep GOGC), -1 disables the garbage collector
+	memoryLimit    = int64(0)  // Default 0 (keep GOMEMLIMIT)
+	resourceUsage  = false
+	pathLengths    = false
+	nameAudit      = false
+	targetFS       = "" // Default empty; ntfs, exfat, fat32, apfs or ext4
+	emitExclude    = "" // Default empty; rsync, borg or restic
+	excludeAge     time.Duration
+	excludeSize    int64
+	showAll        = false
+	minSize        int64
+	usePager       = true
+	relativePaths  = false
+	groupLevel     = 0
+	offline        = offlineBuild == "true"
+	templateFile   = ""
+	charts         []chartSpec
+	dotMinSize     = int64(-1)
+	diffFiles      []string
+	watchArgs      []string
+	watchInterval  = 10 * time.Minute
+	checksFailed   = false
+	numFormat      = numberFormat{Decimal: "."}
+	sizePrecision  = 1
+	sizeRounding   = "nearest"
+	exactBytes     = false
+	hashMtimes     = true
+	versionedFiles = false
+	departmentCSV  = ""
+	strictReadOnly = false
+	tlsCert        = "" // collector: --tls-cert
+	tlsKey         = "" // collector: --tls-key
+	runAs          = "" // collector: --run-as, the user to switch to after listening
 )
 
+// chainSimilarity is the minimum child/parent ratio (size and file count) for a
+// single-child directory to be merged into its parent's chain.
+const chainSimilarity = 0.99
+
+// dominantShare is the share of an ancestor's value that a single listed descendant
+// must account for before the ancestor is suppressed (--unique-top).
+const dominantShare = 0.95
+
+// sampleDepth is the depth (relative to each root) at which subtrees are sampled (--sample).
+// Everything above it is always walked, everything inside a sampled subtree is walked completely.
+const sampleDepth = 2
+
 // --- Data Structures ---
 
 type DirStat struct {
@@ -58,11 +296,68 @@ type DirStat struct {
 	TotalSize int64
 	FileCount int64
 	Depth     int
+	ChainTail string // Deepest directory of a collapsed single-child chain (--collapse-chains)
+
+	// Sampling estimate (--sample): set on directories whose totals were extrapolated
+	Estimated     bool
+	SizeVariance  float64
+	CountVariance float64
+
+	// Number of directories/files in this subtree that could not be read (totals are too small)
+	Inaccessible int64
+
+	// Size and count of the files directly in this directory (TotalSize/FileCount include subdirectories)
+	OwnSize  int64
+	OwnFiles int64
+
+	// Newest and oldest file modification time in this subtree (Unix seconds, 0 if unknown)
+	NewestMtime int64
+	OldestMtime int64
+	// Owner (uid) of the directory itself, -1 if unknown or not supported by the platform
+	Uid int64
+
+	// Number of direct entries (files, subdirectories, links, ...) of this directory, not aggregated
+	Entries int64
+	// Wall time spent in this directory itself, excluding its subdirectories (--slowest), not aggregated
+	ScanTime time.Duration
+
+	// Merkle-style hash of the subtree's names, sizes and mtimes (--fingerprint), final after aggregation
+	Fingerprint [32]byte
+	// Order-independent sum of the entry digests, finalized into Fingerprint
+	fingerprintSum [4]uint64
+
+	// Size and count of files in this subtree missing from (or newer than) the backup catalog (backup-gap)
+	Unprotected      int64
+	UnprotectedFiles int64
+
+	// Permission summary of this subtree (--permissions): writable-by-others files, setuid/setgid
+	// files, world-writable directories without the sticky bit, and the union of all modes seen
+	GroupWritable int64
+	OtherWritable int64
+	SetID         int64
+	OpenDirs      int64
+	ModeUnion     fs.FileMode
 }
 
 // Map to store scan results, Key is the absolute path of the directory
 var dirStats = make(map[string]*DirStat)
 
+// Device number per directory and detected btrfs subvolume roots (--btrfs-subvolumes)
+var (
+	dirDevices      = make(map[string]int64)
+	btrfsSubvolumes []string
+)
+
+// Project roots found by marker files (--by-project): directory -> group label
+var projectRoots = make(map[string]string)
+
+// Sampled and skipped subtree roots (--sample), and the number of candidate subtrees seen per scan root
+var (
+	sampledRoots     = make(map[string]bool)
+	skippedRoots     = make(map[string]bool)
+	sampleCandidates = make(map[string]int)
+)
+
 // --- Main Program ---
 
 func main() {
@@ -71,6 +366,77 @@ func main() {
 	// Parse arguments
 	parseArgs()
 
+	// Editing tags does not scan anything, and the collector only serves what others scanned
+	if command == "tag" {
+		runTagCommand()
+		return
+	}
+	if command == "collector" {
+		runCollector()
+		return
+	}
+	if command == "verify-report" {
+		runVerifyReport()
+		return
+	}
+	if command == "history" {
+		runHistory()
+		return
+	}
+	if command == "diff" {
+		runDiff()
+		return
+	}
+	if command == "watch" {
+		if err := runWatch(); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	// check fails the run only after the summary, upload and post hooks (deferred later) are done
+	if command == "check" {
+		defer func() {
+			if checksFailed {
+				os.Exit(1)
+			}
+		}()
+	}
+
+	// Giant scans keep millions of DirStat entries alive: let the user trade memory for fewer GC cycles
+	if gcPercent != 0 {
+		debug.SetGCPercent(gcPercent)
+	}
+	if memoryLimit > 0 {
+		debug.SetMemoryLimit(memoryLimit)
+	} else if maxMemory > 0 {
+		// Let the GC work harder near the limit before directories have to be folded
+		debug.SetMemoryLimit(maxMemory)
+	}
+
+	// Deferred first so it runs last and measures the whole run, whichever report returns early
+	if resourceUsage {
+		defer printResourceUsage(startTime)
+	}
+
+	// Compare paths case-insensitively below the targets whose file system is case-insensitive
+	if fromListing == "" && loadFile == "" {
+		detectCaseRoots(targetPaths)
+	}
+
+	// Tags are triage notes and may name people or customers: not for anonymized reports
+	if !anonymize {
+		if err := loadTags(); err != nil {
+			fmt.Printf("Error reading tags: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Host file systems mounted into Linux (WSL drvfs, 9p, VM shared folders) need special handling
+	if runtime.GOOS == "linux" && fromListing == "" && loadFile == "" {
+		crossOSMounts = readCrossOSMounts("/proc/self/mountinfo")
+	}
+
 	// Windows currently supports apparent mode only.
 	if runtime.GOOS == "windows" && sizeMode == "disk" {
 		fmt.Println("Warning: Windows currently supports apparent mode only. Falling back to --size-mode apparent.")
@@ -93,51 +459,403 @@ func main() {
 	if verbose {
 		fmt.Printf("Starting scan (Ver: %s)...\n", version)
 		fmt.Printf("Targets: %v\n", targetPaths)
+		for _, r := range caseRoots {
+			fmt.Printf("Case-insensitive path matching below %s: %v\n", r.Path, r.Fold)
+		}
 		if maxDepth > -1 {
 			fmt.Printf("Max Depth: %d\n", maxDepth)
 		}
 	}
 
+	if command == "backup-gap" {
+		if err := loadCatalog(catalogFile); err != nil {
+			fmt.Printf("Error reading backup catalog %s: %v\n", catalogFile, err)
+			os.Exit(1)
+		}
+		if verbose {
+			fmt.Printf("Backup catalog: %d files\n", len(backupCatalog))
+		}
+	}
+
 	// Execute scan
 	totalFiles := 0
+	if loadFile != "" {
+		n, err := loadSnapshot(loadFile)
+		if err != nil {
+			fmt.Printf("Error reading snapshot %s: %v\n", loadFile, err)
+			os.Exit(1)
+		}
+		totalFiles = n
+	}
+	if fromListing != "" {
+		n, err := loadListing(fromListing)
+		if err != nil {
+			fmt.Printf("Error reading listing %s: %v\n", fromListing, err)
+			os.Exit(1)
+		}
+		totalFiles = n
+		if verbose {
+			fmt.Printf("Loaded %d files from %s (targets: %v)\n", n, fromListing, targetPaths)
+		}
+	}
+	if progressive {
+		quickEstimate()
+	}
 	for _, root := range targetPaths {
+		if fromListing != "" || loadFile != "" {
+			break
+		}
 		absRoot, err := filepath.Abs(root)
 		if err != nil {
 			fmt.Printf("Error resolving path %s: %v\n", root, err)
 			continue
 		}
+		rootStart := time.Now()
 		n := scanDirectory(absRoot)
 		totalFiles += n
+		rootTimings = append(rootTimings, walkTiming{Path: absRoot, Start: rootStart, End: time.Now()})
+	}
+	if progressive {
+		finishProgress()
+	}
+
+	if verbose && sampleRate < 1 {
+		fmt.Printf("Sampling: walked %d subtree(s) at depth %d (rate %.4g).\n", len(sampledRoots), sampleDepth, sampleRate)
 	}
 
 	if verbose {
 		fmt.Printf("Scan complete. Found %d files. Aggregating data...\n", totalFiles)
 	}
 
-	// Data Aggregation (Bottom-Up calculation)
-	aggregateStats()
+	// Data Aggregation (Bottom-Up calculation); a snapshot is stored already aggregated
+	if loadFile == "" {
+		aggregateStats()
+		mergeImmutableDirs()
+	}
+
+	if saveFile != "" {
+		if err := saveSnapshot(saveFile, startTime); err != nil {
+			fmt.Printf("Error writing snapshot %s: %v\n", saveFile, err)
+			os.Exit(1)
+		}
+		signFile(saveFile)
+		if verbose {
+			fmt.Printf("Saved %d directories to %s\n", len(dirStats), saveFile)
+		}
+	}
 
 	// Output results
 	// Convert Map to Slice for sorting
 	var statsList []*DirStat
 	for _, s := range dirStats {
 		// Filter out results not under the search root paths (due to bottom-up aggregation, parent of roots might be included, need to exclude)
-		if isUnderTargets(s.Path) && !isExactTarget(s.Path) {
+		if isUnderTargets(s.Path) && !isExactTarget(s.Path) && s.TotalSize >= minSize && (whereFilter == nil || whereFilter(s) != 0) {
 			statsList = append(statsList, s)
 		}
 	}
 
+	// Written last (also after subcommands and exports), so the duration covers the whole run
+	if summaryFD >= 0 || summaryFile != "" || len(postHooks) > 0 || uploadURL != "" {
+		reported := statsList
+		defer func() {
+			sum := buildSummary(startTime, totalFiles, len(reported))
+			if summaryFD >= 0 || summaryFile != "" {
+				writeSummary(sum)
+			}
+			if uploadURL != "" {
+				if err := uploadReport(sum, reported, startTime); err != nil {
+					fmt.Printf("Warning: Could not upload the report: %v\n", err)
+				}
+			}
+			if len(postHooks) > 0 {
+				runPostHooks(sum)
+			}
+		}()
+	}
+
+	if otlpEndpoint != "" {
+		if err := exportTelemetry(startTime, totalFiles); err != nil {
+			fmt.Printf("Warning: Could not export telemetry to %s: %v\n", otlpEndpoint, err)
+		} else if verbose {
+			fmt.Printf("Telemetry exported to %s\n", otlpEndpoint)
+		}
+	}
+
+	if metricsURL != "" {
+		if err := pushMetrics(statsList); err != nil {
+			fmt.Printf("Warning: Could not push metrics to %s: %v\n", metricsURL, err)
+		} else if verbose {
+			fmt.Printf("Metrics pushed to %s\n", metricsURL)
+		}
+	}
+
+	if streamURL != "" {
+		if err := publishStream(statsList, startTime); err != nil {
+			fmt.Printf("Warning: Could not publish to %s: %v\n", streamURL, err)
+		} else if verbose {
+			fmt.Printf("Published %d directories to %s\n", len(statsList), streamURL)
+		}
+	}
+
+	if departmentCSV != "" {
+		if err := writeDepartmentCSV(departmentCSV); err != nil {
+			fmt.Printf("Error writing department report %s: %v\n", departmentCSV, err)
+			os.Exit(1)
+		}
+		if verbose {
+			fmt.Printf("Wrote department report to %s\n", departmentCSV)
+		}
+	}
+
+	for _, c := range charts {
+		if err := writeChart(c); err != nil {
+			fmt.Printf("Error writing chart %s: %v\n", c.File, err)
+			os.Exit(1)
+		}
+		if verbose {
+			fmt.Printf("Wrote %s chart to %s\n", c.Kind, c.File)
+		}
+	}
+
+	// Subcommands replace the rankings with their own report
+	if command != "" {
+		switch command {
+		case "backup-gap":
+			printBackupGap(statsList)
+		case "simulate-retention":
+			printRetentionSimulation(startTime)
+		case "plan-copy":
+			if err := planCopy(); err != nil {
+				fmt.Printf("Error writing copy plan: %v\n", err)
+				os.Exit(1)
+			}
+		case "heavy-files-by-type":
+			printMediaReport()
+		case "logs":
+			printLogReport()
+		case "dev":
+			printDevReport()
+		case "git-repos":
+			printGitReport()
+		case "databases":
+			printDatabaseReport()
+		case "mail":
+			printMailReport()
+		case "dupes":
+			printDuplicateTrees()
+			printArchivePairs()
+		case "check":
+			sum := buildSummary(startTime, totalFiles, len(statsList))
+			checksFailed = !printChecks(sum)
+			breaches := findBudgetBreaches(sum)
+			for _, b := range breaches {
+				fmt.Printf("  over budget: %s: %s of %s\n", b.Path, formatBytes(b.Size), formatBytes(b.Budget))
+			}
+			if ticketTarget != "" && len(breaches) > 0 {
+				fileTickets(breaches)
+			}
+		}
+		if displayRuntime {
+			fmt.Printf("\nProcessed in %.2f second(s)\n", time.Since(startTime).Seconds())
+		}
+		return
+	}
+
+	if emitExclude != "" {
+		if err := writeExcludeFile(statsList); err != nil {
+			fmt.Printf("Error writing exclude file: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if reportTemplate != nil {
+		if err := renderTemplate(statsList, startTime, totalFiles); err != nil {
+			fmt.Printf("Error rendering %s: %v\n", templateFile, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if outputFormat != "table" {
+		var err error
+		switch outputFormat {
+		case "pdf":
+			err = writePDFReport(statsList, startTime, totalFiles)
+		case "dot":
+			err = writeDOT()
+		default:
+			err = writeExport(statsList, startTime)
+		}
+		if err != nil {
+			fmt.Printf("Error writing %s output to %s: %v\n", outputFormat, outputFile, err)
+			os.Exit(1)
+		}
+		if verbose {
+			fmt.Printf("Wrote %d directories to %s (%s)\n", len(statsList), outputFile, outputFormat)
+		}
+		if displayRuntime {
+			fmt.Printf("\nProcessed in %.2f second(s)\n", time.Since(startTime).Seconds())
+		}
+		return
+	}
+
+	if collapseChains {
+		statsList = collapseSingleChildChains(statsList)
+	}
+
+	// Listing every directory easily fills thousands of lines: page them on a terminal
+	if showAll && usePager {
+		startPager()
+		defer stopPager()
+	}
+
 	// Sort by size Top N
 	sort.Slice(statsList, func(i, j int) bool {
 		return statsList[i].TotalSize > statsList[j].TotalSize
 	})
-	printTable(fmt.Sprintf("Top %d Largest Subdirectories by Size", topN), statsList, true)
+	sizeList := statsList
+	if uniqueTop {
+		sizeList = suppressDominatedAncestors(statsList, func(s *DirStat) int64 { return s.TotalSize })
+	}
+	sizeTitle := fmt.Sprintf("Top %d Largest Subdirectories by Size", topN)
+	if showAll {
+		sizeTitle = "All Subdirectories by Size"
+	}
+	printTable(sizeTitle, sizeList, true)
 
 	// Sort by file count Top N
 	sort.Slice(statsList, func(i, j int) bool {
 		return statsList[i].FileCount > statsList[j].FileCount
 	})
-	printTable(fmt.Sprintf("Top %d Subdirectories by File Count", topN), statsList, false)
+	countList := statsList
+	if uniqueTop {
+		countList = suppressDominatedAncestors(statsList, func(s *DirStat) int64 { return s.FileCount })
+	}
+	countTitle := fmt.Sprintf("Top %d Subdirectories by File Count", topN)
+	if showAll {
+		countTitle = "All Subdirectories by File Count"
+	}
+	printTable(countTitle, countList, false)
+
+	if sampleRate < 1 {
+		printSampleSummary()
+	}
+
+	if btrfsSubvols {
+		printBtrfsSubvolumes()
+	}
+
+	if zfsDatasets {
+		printZFSDatasets()
+	}
+
+	if byProject {
+		printProjectUsage()
+	}
+
+	if departmentCSV != "" {
+		printDepartments()
+	}
+
+	if groupLevel > 0 {
+		printComponentGroups()
+	}
+
+	if len(pathTemplates) > 0 {
+		printLabelPivots()
+	}
+
+	if namePatterns {
+		printNamePatterns()
+	}
+
+	if entryLimit > 0 {
+		printLargeDirectories()
+	}
+
+	if slowestN > 0 {
+		printSlowestDirectories()
+	}
+
+	if permReport {
+		printPermissions()
+	}
+
+	if crashDumps {
+		printCrashArtifacts()
+	}
+
+	if symlinkReport {
+		printSymlinkReport()
+	}
+
+	if specialFiles {
+		printSpecialFiles()
+	}
+
+	if deletedOpen {
+		printDeletedOpen()
+	}
+
+	if reconcile {
+		printReconciliation()
+	}
+
+	if tempReport {
+		printTempReport()
+	}
+
+	if regenerable {
+		printDerivedReport()
+	}
+
+	if versionedFiles {
+		printVersionReport()
+	}
+
+	if pathLengths {
+		printPathLengths()
+	}
+
+	if nameAudit {
+		printNameAudit()
+	}
+
+	if targetFS != "" {
+		printTargetFSReport()
+	}
+
+	if costPerGB > 0 {
+		printCostSummary()
+	}
+
+	if len(analyzers) > 0 {
+		printAnalyzerReports(statsList, startTime)
+	}
+
+	if len(crossOSSkipped) > 0 {
+		fmt.Printf("\nNote: Skipped %d mount(s) of another OS's file system: %s\n", len(crossOSSkipped), strings.Join(crossOSSkipped, ", "))
+	} else if len(crossOSScanned) > 0 {
+		fmt.Printf("\nNote: Scanned %d mount(s) of another OS's file system with apparent sizes (use --skip-cross-os to skip them): %s\n",
+			len(crossOSScanned), strings.Join(crossOSScanned, ", "))
+	}
+
+	if foldDepth >= 0 {
+		printFoldedNote()
+	}
+
+	if len(immutableAreas) > 0 {
+		printImmutableNote()
+	}
+
+	if onlyUid >= 0 && otherFiles+otherDirs > 0 {
+		fmt.Printf("\nNote: --only-mine skipped %d file(s) (%s) owned by other users, and %d unreadable director(ies) of other users.\n", otherFiles, formatBytes(otherSize), otherDirs)
+	}
+
+	if n := countInaccessible(); n > 0 {
+		fmt.Printf("\nNote: %d director(ies)/file(s) could not be read. Entries marked [incomplete] report too-small totals (use --verbose for details).\n", n)
+	}
 
 	// End statistics
 	if displayRuntime {
@@ -146,29 +864,199 @@ func main() {
 	}
 }
 
+// --- Offline Mode ---
+//
+// --offline refuses every network connection. Binaries built with -tags offline leave the network
+// code out (sinks_offline.go stands in for sinks.go and collector.go) and are always offline.
+
+// errOffline is returned for every connection attempt in offline mode
+var errOffline = errors.New("network access is disabled (offline mode)")
+
+// --- Strict Read-Only Mode ---
+
+// oNoatime is O_NOATIME of Linux, which the syscall package only defines when building for it
+const oNoatime = 0x40000
+
+// openScanned opens a file or directory of the scanned trees for reading. With
+// --strict-read-only it asks Linux not to update the access time (O_NOATIME), which is only
+// permitted to the owner of the file or with CAP_FOWNER; otherwise it falls back to a plain open.
+func openScanned(name string) (*os.File, error) {
+	if strictReadOnly && runtime.GOOS == "linux" {
+		f, err := os.OpenFile(name, os.O_RDONLY|oNoatime, 0)
+		if !errors.Is(err, fs.ErrPermission) {
+			return f, err
+		}
+	}
+	return os.Open(name)
+}
+
+// errNotRegular is returned by openScannedFile for FIFOs, sockets, devices and symbolic links
+var errNotRegular = errors.New("not a regular file")
+
+// openScannedFile opens a regular file of the scanned trees (see openScanned) to read its content.
+// Other entries are refused without opening them: opening a FIFO blocks until a writer appears, and
+// a symbolic link may lead out of the tree or to a device such as /dev/zero.
+func openScannedFile(name string) (*os.File, error) {
+	info, err := os.Lstat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, errNotRegular
+	}
+	f, err := openScanned(name)
+	if err != nil {
+		return nil, err
+	}
+	// The entry may have been replaced between Lstat and open
+	if opened, err := f.Stat(); err != nil || !os.SameFile(info, opened) {
+		f.Close()
+		return nil, errNotRegular
+	}
+	return f, nil
+}
+
+// markerFileLimit is the most read of a marker file such as .owner, which holds a name or two
+const markerFileLimit = 4 << 10
+
+// readMarkerFile reads a small marker file of the scanned trees, such as .owner: a regular file
+// (see openScannedFile), of which at most markerFileLimit bytes are read
+func readMarkerFile(name string) ([]byte, error) {
+	f, err := openScannedFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, markerFileLimit))
+}
+
+// scannedFS is os.DirFS for a scanned tree, with directories and files opened by openScanned so
+// that reading them does not change their access times in strict read-only mode
+type scannedFS string
+
+func (root scannedFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	f, err := openScanned(filepath.Join(string(root), filepath.FromSlash(name)))
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
 // --- Core Logic ---
 
 // scanDirectory traverses the directory tree, recording only file sizes and counts directly belonging to that directory
 func scanDirectory(root string) int {
+	if strictReadOnly {
+		return scanFS(scannedFS(root), root)
+	}
+	return scanFS(os.DirFS(root), root)
+}
+
+// scanFS walks fsys as if it were mounted at root; all statistics use root-based OS paths. Any
+// fs.FS works (fstest.MapFS in tests, archives, remote listings): sizes and owners come from
+// fs.FileInfo, using Sys() for allocated blocks/uid where the source provides it, and fs.StatFS
+// is used for the root when implemented.
+func scanFS(fsys fs.FS, root string) int {
 	count := 0
-	rootDepth := strings.Count(root, string(os.PathSeparator))
 
-	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+	// Paths from WalkDir are already clean: concatenate instead of filepath.Join, which re-cleans
+	// every path (one of the larger CPU costs per entry on big trees)
+	root = filepath.Clean(root)
+	prefix := root
+	if !strings.HasSuffix(prefix, string(os.PathSeparator)) {
+		prefix += string(os.PathSeparator)
+	}
+
+	err := fs.WalkDir(fsys, ".", func(rel string, d fs.DirEntry, err error) error {
+		path, currentDepth := root, 0
+		if rel != "." {
+			path = prefix + filepath.FromSlash(rel)
+			currentDepth = strings.Count(rel, "/") + 1
+		}
 		if err != nil {
+			if pe, ok := err.(*fs.PathError); ok {
+				pe.Path = path // Report the OS path, not the path inside fsys
+			}
+			// Other users' directories are expected to be unreadable: not an error with --only-mine
+			if onlyUid >= 0 && d != nil && d.IsDir() && ownedByOther(d) {
+				otherDirs++
+				return nil
+			}
 			// Ignore permission errors, continue scanning
 			if verbose {
 				fmt.Printf("Warning: Access denied or error at %s: %v\n", path, err)
 			}
+			// The directory could not be listed: its totals (and those of its ancestors) are incomplete
+			if d != nil && d.IsDir() {
+				if s, ok := dirStats[foldedPath(path, prefix, currentDepth)]; ok {
+					s.Inaccessible++
+				}
+			}
 			return nil
 		}
 
+		if maxMemory > 0 {
+			checkMemory()
+		}
+		if throttleRate > 0 {
+			throttleEntry()
+		}
+
+		// Count every direct entry (including excluded or too deep ones) for the entry-count report
+		if rel != "." && (foldDepth < 0 || currentDepth <= foldDepth) {
+			getDirStat(filepath.Dir(path)).Entries++
+		}
+		if pathLengths {
+			notePathLength(path)
+		}
+		if nameAudit || targetFS != "" {
+			if collision, isRoot := noteCaseName(path, d.IsDir()); !isRoot {
+				if nameAudit {
+					auditName(path, collision)
+				}
+				if targetFS != "" {
+					checkTargetFS(path, rel, d, collision)
+				}
+			}
+		}
+
 		// Check exclude paths (Prune)
 		if d.IsDir() && isExcluded(path) {
 			return filepath.SkipDir
 		}
 
+		// Read-only areas are taken from their snapshot instead of being walked
+		if d.IsDir() && len(immutableAreas) > 0 {
+			if a := immutableAreaAt(path); a != nil {
+				n, err := mergeImmutable(a, currentDepth)
+				if err != nil {
+					fmt.Printf("Error: --assume-immutable %s: %v\n", a.Dir, err)
+					os.Exit(1)
+				}
+				count += int(n)
+				return filepath.SkipDir
+			}
+		}
+
+		// Leaving or entering a mount of another OS's file system
+		if crossOSMount != "" && !hasPathPrefix(path, crossOSMount) {
+			crossOSMount = ""
+		}
+		if d.IsDir() && len(crossOSMounts) > 0 {
+			if fsType, ok := crossOSMounts[path]; ok && rel != "." {
+				if skipCrossOS {
+					crossOSSkipped = append(crossOSSkipped, path+" ("+fsType+")")
+					return filepath.SkipDir
+				}
+				crossOSMount = path
+				crossOSScanned = append(crossOSScanned, path+" ("+fsType+")")
+			}
+		}
+
 		// Check depth
-		currentDepth := strings.Count(path, string(os.PathSeparator)) - rootDepth
 		if maxDepth != -1 && currentDepth > maxDepth {
 			if d.IsDir() {
 				return filepath.SkipDir
@@ -176,20 +1064,134 @@ func scanDirectory(root string) int {
 			return nil
 		}
 
+		// Sampling: keep only a deterministic share of the subtrees at sampleDepth
+		if sampleRate < 1 && d.IsDir() && currentDepth == sampleDepth {
+			sampleCandidates[root]++
+			if !isSampled(path) {
+				skippedRoots[path] = true
+				return filepath.SkipDir
+			}
+			sampledRoots[path] = true
+		}
+
+		if otlpEndpoint != "" || slowestN > 0 {
+			trackWalk(path, d.IsDir())
+		}
+
+		if byProject || command == "dev" {
+			noteProjectMarker(path)
+		}
+		if command == "dev" && d.IsDir() {
+			noteDevDir(path)
+		}
+		if command == "git-repos" && d.IsDir() {
+			noteGitDir(path)
+		}
+
 		// Statistics logic
 		if !d.IsDir() {
+			if symlinkReport && d.Type()&fs.ModeSymlink != 0 {
+				noteSymlink(path)
+			}
 			// It's a file: get size and record to its parent directory
 			info, err := d.Info()
 			if err == nil {
-				dirPath := filepath.Dir(path)
-				s := getDirStat(dirPath)
-				s.TotalSize += getFileSize(info)
-				s.FileCount++ // Record direct file count
+				size, mtime := getFileSize(info), info.ModTime().Unix()
+				if crossOSMount != "" {
+					size = info.Size() // Block counts of host file systems do not reflect allocation
+				}
+				if onlyUid >= 0 {
+					if uid, ok := statField(info, "Uid"); ok && uid != onlyUid {
+						otherFiles++
+						otherSize += size
+						return nil
+					}
+				}
+				dir := foldedPath(filepath.Dir(path), prefix, currentDepth-1)
+				recordFile(dir, size, mtime)
+				if progressive {
+					noteProgress(root, prefix, rel, size)
+				}
+				if fingerprint {
+					fingerprintFile(path, dir, info)
+				}
+				if command == "dupes" {
+					noteArchive(path, size)
+				}
+				if namePatterns {
+					recordNamePattern(d.Name(), size)
+				}
+				if len(retentionRules) > 0 {
+					noteRetentionFile(path, size, mtime)
+				}
+				if backupCatalog != nil {
+					noteBackupGap(path, size, info.Size(), mtime)
+				}
+				if command == "heavy-files-by-type" {
+					noteMediaFile(path, size, mtime, true)
+				}
+				if command == "logs" {
+					noteLogFile(path, size, mtime)
+				}
+				if command == "git-repos" {
+					noteGitObject(path, size, mtime)
+				}
+				if command == "databases" {
+					noteDatabaseFile(path, size, true)
+				}
+				if command == "mail" {
+					noteMailFile(path, size, mtime)
+				}
+				if crashDumps {
+					noteCrashFile(path, size, mtime, true)
+				}
+				if specialFiles {
+					noteSpecialFile(path, info.Mode(), mtime)
+				}
+				if reconcile {
+					noteReconcileFile(info, size)
+				}
+				if tempReport {
+					noteTempFile(path, size, mtime)
+				}
+				if regenerable {
+					noteDerivedFile(path, size, mtime)
+				}
+				if versionedFiles {
+					noteVersionedFile(path, size, mtime)
+				}
+				if permReport {
+					notePermissions(getDirStat(foldedPath(filepath.Dir(path), prefix, currentDepth-1)), info.Mode(), false)
+				}
 				count++
+			} else {
+				getDirStat(foldedPath(filepath.Dir(path), prefix, currentDepth-1)).Inaccessible++
 			}
 		} else {
 			// It's a directory: ensure it exists in Map (even empty directories need to be recorded)
-			getDirStat(path)
+			statPath := foldedPath(path, prefix, currentDepth)
+			s := getDirStat(statPath)
+			if statPath == path {
+				s.Depth = currentDepth
+			}
+			if (outputFormat != "table" || streamURL != "" || saveFile != "" || departmentCSV != "") && statPath == path {
+				if info, err := d.Info(); err == nil {
+					if uid, ok := statField(info, "Uid"); ok {
+						s.Uid = uid
+					}
+				}
+			}
+			if btrfsSubvols {
+				detectBtrfsSubvolume(path, d)
+			}
+			if reconcile {
+				noteReconcileDir(path, d)
+			}
+			if permReport {
+				if info, err := d.Info(); err == nil {
+					notePermissions(s, info.Mode(), true)
+				}
+			}
 		}
 		return nil
 	})
@@ -197,6 +1199,7 @@ func scanDirectory(root string) int {
 	if err != nil {
 		fmt.Printf("Error walking path %s: %v\n", root, err)
 	}
+	finishWalk()
 	return count
 }
 
@@ -220,6 +1223,11 @@ func aggregateStats() {
 	for _, p := range paths {
 		parent := filepath.Dir(p)
 
+		// All children of p have been processed (they have longer paths): its fingerprint is complete
+		if fingerprint {
+			finalizeFingerprint(dirStats[p])
+		}
+
 		// Prevent self-aggregation (root directory's parent is itself in some OS/cases)
 		if parent == p {
 			continue
@@ -229,201 +1237,1242 @@ func aggregateStats() {
 		// Note: Check if parent is already initialized
 		if parentStat, ok := dirStats[parent]; ok {
 			childStat := dirStats[p]
+			if fingerprint {
+				addDigest(parentStat, "d", filepath.Base(p), string(childStat.Fingerprint[:]))
+			}
+			mergeCounts(parentStat, childStat)
+			if sampledRoots[p] {
+				// Horvitz-Thompson extrapolation of a sampled subtree (variances: addSampleVariance)
+				parentStat.TotalSize += int64(math.Round(float64(childStat.TotalSize) / sampleRate))
+				parentStat.FileCount += int64(math.Round(float64(childStat.FileCount) / sampleRate))
+				continue
+			}
 			parentStat.TotalSize += childStat.TotalSize
 			parentStat.FileCount += childStat.FileCount
 		}
 	}
+	if sampleRate < 1 {
+		addSampleVariance()
+	}
+}
+
+// sampleRootOf returns the scan root of a candidate subtree of sampling
+func sampleRootOf(path string) string {
+	for range sampleDepth {
+		path = filepath.Dir(path)
+	}
+	return path
+}
+
+// addSampleVariance marks every directory above a candidate subtree of sampling as estimated,
+// whether the subtree was walked or skipped, and adds the candidate's variance term to it. A
+// skipped subtree contributes nothing to the Horvitz-Thompson totals, so a directory whose
+// candidates were all skipped would otherwise print its undercount as exact. The variance term of
+// a candidate, (1-p)/p times its squared total, uses the mean squared total of the sampled
+// subtrees of its root, as the totals of skipped subtrees are unknown.
+func addSampleVariance() {
+	type moments struct{ n, size2, count2 float64 }
+	byRoot := make(map[string]*moments)
+	for p := range sampledRoots {
+		s, ok := dirStats[p]
+		if !ok {
+			continue
+		}
+		m := byRoot[sampleRootOf(p)]
+		if m == nil {
+			m = &moments{}
+			byRoot[sampleRootOf(p)] = m
+		}
+		m.n++
+		m.size2 += float64(s.TotalSize) * float64(s.TotalSize)
+		m.count2 += float64(s.FileCount) * float64(s.FileCount)
+	}
+	weight := (1 - sampleRate) / sampleRate
+	addCandidate := func(p string) {
+		root := sampleRootOf(p)
+		m := byRoot[root]
+		for dir := filepath.Dir(p); ; dir = filepath.Dir(dir) {
+			if s, ok := dirStats[dir]; ok {
+				s.Estimated = true
+				if m != nil {
+					s.SizeVariance += weight * m.size2 / m.n
+					s.CountVariance += weight * m.count2 / m.n
+				}
+			}
+			if dir == root || filepath.Dir(dir) == dir {
+				break
+			}
+		}
+	}
+	for p := range sampledRoots {
+		addCandidate(p)
+	}
+	for p := range skippedRoots {
+		addCandidate(p)
+	}
+}
+
+// btrfsSubvolumeIno is the inode number of every btrfs subvolume (and snapshot) root directory.
+const btrfsSubvolumeIno = 256
+
+// detectBtrfsSubvolume records path as a subvolume if it is a btrfs subvolume root: inode 256 on a
+// device number different from its parent (each subvolume has its own anonymous device).
+func detectBtrfsSubvolume(path string, d fs.DirEntry) {
+	info, err := d.Info()
+	if err != nil {
+		return
+	}
+	dev, ok := statField(info, "Dev")
+	if !ok {
+		return
+	}
+	dirDevices[path] = dev
+	parentDev, hasParent := dirDevices[filepath.Dir(path)]
+	if ino, ok := statField(info, "Ino"); ok && ino == btrfsSubvolumeIno && hasParent && parentDev != dev {
+		btrfsSubvolumes = append(btrfsSubvolumes, path)
+	}
+}
+
+// printBtrfsSubvolumes lists detected subvolumes/snapshots with their totals, largest first.
+func printBtrfsSubvolumes() {
+	var list []*DirStat
+	for _, p := range btrfsSubvolumes {
+		if s, ok := dirStats[p]; ok {
+			list = append(list, s)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].TotalSize > list[j].TotalSize
+	})
+	fmt.Printf("\n--- Btrfs Subvolumes/Snapshots (%d found) ---\n", len(list))
+	fmt.Printf("%-15s | %-15s | %-50s\n", "Size", "Files", "Path")
+	fmt.Println(strings.Repeat("-", 70))
+	for _, s := range list {
+		fmt.Printf("%-15s | %-15s | %s\n", formatBytes(s.TotalSize), formatFiles(s.FileCount), shownPath(s.Path))
+	}
+	if len(list) > 1 {
+		fmt.Println("Note: Snapshots share extents with their source; their sizes are referenced, not unique, bytes.")
+	}
+}
+
+// zfsDataset holds the space accounting of one mounted ZFS file system (zfs list -p)
+type zfsDataset struct {
+	Name          string
+	Mountpoint    string
+	Used          int64
+	Referenced    int64
+	UsedBySnaps   int64
+	CompressRatio string
+}
+
+// listZFSDatasets runs "zfs list" and returns the mounted file systems.
+func listZFSDatasets() ([]zfsDataset, error) {
+	out, err := exec.Command("zfs", "list", "-H", "-p", "-t", "filesystem",
+		"-o", "name,mountpoint,used,referenced,usedbysnapshots,compressratio").Output()
+	if err != nil {
+		return nil, err
+	}
+	var datasets []zfsDataset
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 6 || !filepath.IsAbs(fields[1]) {
+			continue // "none", "legacy" or "-" mountpoints
+		}
+		ds := zfsDataset{Name: fields[0], Mountpoint: filepath.Clean(fields[1]), CompressRatio: strings.TrimSuffix(fields[5], "x") + "x"}
+		ds.Used, _ = strconv.ParseInt(fields[2], 10, 64)
+		ds.Referenced, _ = strconv.ParseInt(fields[3], 10, 64)
+		ds.UsedBySnaps, _ = strconv.ParseInt(fields[4], 10, 64)
+		datasets = append(datasets, ds)
+	}
+	return datasets, nil
+}
+
+// printZFSDatasets compares the scanned total at each dataset mountpoint inside the targets with
+// the dataset's own accounting, separating space held by snapshots from space held by live files.
+func printZFSDatasets() {
+	datasets, err := listZFSDatasets()
+	if err != nil {
+		fmt.Printf("\nWarning: Could not list ZFS datasets (zfs list): %v\n", err)
+		return
+	}
+	fmt.Println("\n--- ZFS Datasets ---")
+	fmt.Printf("%-12s | %-12s | %-12s | %-12s | %-6s | %s\n", "Scanned", "Referenced", "Snapshots", "Used", "Ratio", "Dataset (Mountpoint)")
+	fmt.Println(strings.Repeat("-", 70))
+	for _, ds := range datasets {
+		if !isUnderTargets(ds.Mountpoint) {
+			continue
+		}
+		scanned := "-"
+		if s, ok := dirStats[ds.Mountpoint]; ok {
+			scanned = formatBytes(s.TotalSize)
+		}
+		fmt.Printf("%-12s | %-12s | %-12s | %-12s | %-6s | %s (%s)\n", scanned, formatBytes(ds.Referenced),
+			formatBytes(ds.UsedBySnaps), formatBytes(ds.Used), ds.CompressRatio, shownPath(ds.Name), shownPath(ds.Mountpoint))
+	}
+	fmt.Println("Note: Referenced is live data of the dataset itself (compressed), Snapshots is space freed only by destroying snapshots; Scanned includes child datasets mounted below.")
+}
+
+// recordFile adds a file's size to its direct parent directory
+func recordFile(dirPath string, size int64, mtime int64) {
+	s := getDirStat(dirPath)
+	s.TotalSize += size
+	s.FileCount++ // Record direct file count
+	s.OwnSize += size
+	s.OwnFiles++
+	mergeMtimes(s, mtime, mtime)
+}
+
+// mergeCounts adds the subtree counters (all but sizes and file counts) of src to dst
+func mergeCounts(dst, src *DirStat) {
+	dst.Inaccessible += src.Inaccessible
+	dst.Unprotected += src.Unprotected
+	dst.UnprotectedFiles += src.UnprotectedFiles
+	dst.GroupWritable += src.GroupWritable
+	dst.OtherWritable += src.OtherWritable
+	dst.SetID += src.SetID
+	dst.OpenDirs += src.OpenDirs
+	dst.ModeUnion |= src.ModeUnion
+	mergeMtimes(dst, src.NewestMtime, src.OldestMtime)
+}
+
+// mergeMtimes widens the newest/oldest modification time range of s (0 means unknown)
+func mergeMtimes(s *DirStat, newest, oldest int64) {
+	if newest > s.NewestMtime {
+		s.NewestMtime = newest
+	}
+	if oldest > 0 && (s.OldestMtime == 0 || oldest < s.OldestMtime) {
+		s.OldestMtime = oldest
+	}
+}
+
+// --- Entry Count ---
+
+// printLargeDirectories lists directories (targets included) with more than entryLimit direct
+// entries. Huge flat directories slow down lookups and listings on ext4 (htree), NFS (READDIR)
+// and backup tools regardless of their size in bytes. Nothing is printed if there are none.
+func printLargeDirectories() {
+	var list []*DirStat
+	for _, s := range dirStats {
+		if s.Entries > entryLimit && isUnderTargets(s.Path) {
+			list = append(list, s)
+		}
+	}
+	if len(list) == 0 {
+		return
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Entries != list[j].Entries {
+			return list[i].Entries > list[j].Entries
+		}
+		return list[i].Path < list[j].Path
+	})
+	fmt.Printf("\n--- Directories with More Than %d Direct Entries ---\n", entryLimit)
+	fmt.Printf("%-15s | %-15s | %-50s\n", "Entries", "Size", "Path")
+	fmt.Println(strings.Repeat("-", 70))
+	for i, s := range list {
+		if i >= topN {
+			break
+		}
+		fmt.Printf("%-15s | %-15s | %s\n", strconv.FormatInt(s.Entries, 10), formatBytes(s.OwnSize), shownPath(s.Path))
+	}
+	fmt.Println("Note: Size is the size of the files directly in the directory. Consider sharding such directories into subdirectories.")
+}
+
+// --- Cross-OS Mounts ---
+
+// crossOSTypes are file system types that expose another operating system's storage to Linux:
+// WSL1 drvfs, 9p (WSL2 /mnt/c and \\wsl$ plumbing, QEMU shares), and VirtualBox, VMware and
+// Parallels shared folders. Walking them is slow (every stat crosses the VM boundary) and their
+// block counts are synthesized, so --size-mode disk would be wrong there.
+var crossOSTypes = map[string]bool{
+	"drvfs": true, "9p": true, "vboxsf": true, "vmhgfs": true, "fuse.vmhgfs-fuse": true, "prl_fs": true,
+}
+
+var (
+	crossOSMounts  map[string]string // Mount point -> file system type, from /proc/self/mountinfo
+	crossOSMount   string            // Cross-OS mount the walk is currently inside, if any
+	crossOSScanned []string
+	crossOSSkipped []string
+)
+
+// readCrossOSMounts returns the mount points of cross-OS file systems listed in a mountinfo file
+// ("id parent dev root mountpoint options [optional...] - fstype source superoptions").
+func readCrossOSMounts(name string) map[string]string {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil
+	}
+	mounts := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		sep := slices.Index(fields, "-")
+		if sep < 5 || sep+1 >= len(fields) || !crossOSTypes[fields[sep+1]] {
+			continue
+		}
+		// Spaces and other special characters in mount points are octal-escaped (\040)
+		mountPoint := fields[4]
+		if unquoted, err := strconv.Unquote(`"` + strings.ReplaceAll(mountPoint, `"`, `\"`) + `"`); err == nil {
+			mountPoint = unquoted
+		}
+		mounts[mountPoint] = fields[sep+1]
+	}
+	return mounts
+}
+
+// --- Owner Filter ---
+
+// Files and unreadable directories left out because they belong to other users (--only-mine)
+var (
+	otherFiles int64
+	otherSize  int64
+	otherDirs  int64
+)
+
+// ownedByOther reports whether the entry's owner is known and is not onlyUid.
+func ownedByOther(d fs.DirEntry) bool {
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	uid, ok := statField(info, "Uid")
+	return ok && uid != onlyUid
+}
+
+// --- Exit Summary ---
+
+// runSummary is the machine-readable summary of a run (--summary-fd, --summary-file), so wrappers
+// can react to totals, errors and threshold violations without parsing the human report.
+type runSummary struct {
+	Version         string           `json:"version"`
+	Host            string           `json:"host"`
+	Source          string           `json:"source"` // scan, listing or snapshot
+	Start           string           `json:"start"`
+	DurationSeconds float64          `json:"duration_seconds"`
+	Targets         []targetSummary  `json:"targets"`
+	TotalSize       int64            `json:"total_size"`
+	TotalFiles      int64            `json:"total_files"`
+	Directories     int              `json:"directories"` // Reported directories (after --where)
+	Inaccessible    int64            `json:"inaccessible"`
+	Violations      map[string]int64 `json:"violations"`
+	Resources       *resourceStats   `json:"resources,omitempty"` // --resource-usage
+	Filesystems     []fsCapacity     `json:"filesystems,omitempty"`
+	Labels          []*labelUsage    `json:"labels,omitempty"`    // --path-template, by all labels
+	Compacted       *compactInfo     `json:"compacted,omitempty"` // Merged reports (history compact)
+}
+
+type targetSummary struct {
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	Files int64  `json:"files"`
+}
+
+// buildSummary collects the summary of the run. Violations has a key per enabled check, 0 if it passed.
+func buildSummary(startTime time.Time, totalFiles, reported int) runSummary {
+	sum := runSummary{
+		Version:         version,
+		Source:          "scan",
+		Start:           startTime.UTC().Format(time.RFC3339),
+		DurationSeconds: math.Round(time.Since(startTime).Seconds()*1000) / 1000,
+		TotalFiles:      int64(totalFiles),
+		Directories:     reported,
+		Inaccessible:    countInaccessible(),
+		Violations:      make(map[string]int64),
+	}
+	sum.Host, _ = os.Hostname()
+	if resourceUsage {
+		r := readResourceUsage()
+		sum.Resources = &r
+	}
+	if fromListing != "" {
+		sum.Source = "listing"
+	} else if loadFile != "" {
+		sum.Source = "snapshot"
+	} else if runtime.GOOS != "windows" && !strictReadOnly {
+		// targetCapacities runs df, which --strict-read-only does not allow
+		sum.Filesystems = targetCapacities()
+	}
+	if len(pathTemplates) > 0 {
+		sum.Labels = computeLabelUsage(labelNames)
+	}
+	sum.Targets = []targetSummary{}
+	for _, root := range targetPaths {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		if s, ok := dirStats[abs]; ok {
+			sum.Targets = append(sum.Targets, targetSummary{shownPath(abs), s.TotalSize, s.FileCount})
+			sum.TotalSize += s.TotalSize
+		}
+	}
+
+	if entryLimit > 0 {
+		var n int64
+		for _, s := range dirStats {
+			if s.Entries > entryLimit && isUnderTargets(s.Path) {
+				n++
+			}
+		}
+		sum.Violations["dirs_over_entry_limit"] = n
+	}
+	if pathLengths {
+		sum.Violations["paths_over_windows_max_path"] = overWindowsMaxPath
+		sum.Violations["paths_over_linux_path_max"] = overLinuxPathMax
+		sum.Violations["names_over_name_max"] = overNameMax
+	}
+	if symlinkReport {
+		sum.Violations["broken_symlinks"] = linkTotals.Broken
+	}
+	if crashDumps {
+		var n int64
+		for _, t := range crashByKind {
+			n += t.Files
+		}
+		sum.Violations["crash_artifacts"] = n
+	}
+	if tempReport {
+		var n int64
+		for _, t := range tempByKind {
+			n += t.Files
+		}
+		sum.Violations["old_temp_files"] = n
+	}
+	if len(budgets) > 0 {
+		var n int64
+		for _, b := range budgets {
+			if s, ok := dirStats[b.Dir]; ok && s.TotalSize > b.Size {
+				n++
+			}
+		}
+		sum.Violations["dirs_over_budget"] = n
+	}
+	if permReport {
+		var other, open int64
+		for _, root := range targetPaths {
+			if abs, err := filepath.Abs(root); err == nil {
+				if s, ok := dirStats[abs]; ok {
+					other += s.OtherWritable
+					open += s.OpenDirs
+				}
+			}
+		}
+		sum.Violations["other_writable_files"] = other
+		sum.Violations["open_dirs_without_sticky_bit"] = open
+	}
+	return sum
+}
+
+// printChecks prints the result of every enabled check and reports whether all of them passed
+func printChecks(sum runSummary) bool {
+	checks := make([]string, 0, len(sum.Violations))
+	for check := range sum.Violations {
+		checks = append(checks, check)
+	}
+	sort.Strings(checks)
+	failed := 0
+	for _, check := range checks {
+		if n := sum.Violations[check]; n > 0 {
+			fmt.Printf("FAILED %s: %d\n", check, n)
+			failed++
+		} else {
+			fmt.Printf("OK     %s\n", check)
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("\n%d of %d checks failed.\n", failed, len(checks))
+	}
+	return failed == 0
+}
+
+// writeSummary writes the summary as one line of JSON to --summary-file or --summary-fd
+func writeSummary(sum runSummary) {
+	data, err := json.Marshal(sum)
+	if err != nil {
+		fmt.Printf("Warning: Could not encode the summary: %v\n", err)
+		return
+	}
+	data = append(data, '\n')
+	if summaryFile != "" {
+		if err = os.WriteFile(summaryFile, data, 0o644); err == nil {
+			signFile(summaryFile)
+		}
+	} else {
+		// Not closed: the descriptor belongs to the caller (e.g. 3>summary.json)
+		_, err = os.NewFile(uintptr(summaryFD), "summary").Write(data)
+	}
+	if err != nil {
+		fmt.Printf("Warning: Could not write the summary: %v\n", err)
+	}
+}
+
+// runPostHooks runs the --post-hook commands one after another, with the JSON summary on stdin and
+// the main figures in FS_ANALYZER_* environment variables (one FS_ANALYZER_VIOLATION_<CHECK> per
+// enabled check). A failing hook is reported but does not stop the others.
+func runPostHooks(sum runSummary) {
+	data, err := json.Marshal(sum)
+	if err != nil {
+		fmt.Printf("Warning: Could not encode the summary: %v\n", err)
+		return
+	}
+	data = append(data, '\n')
+
+	var targets []string
+	for _, t := range sum.Targets {
+		targets = append(targets, t.Path)
+	}
+	env := append(os.Environ(),
+		"FS_ANALYZER_VERSION="+version,
+		"FS_ANALYZER_SOURCE="+sum.Source,
+		"FS_ANALYZER_TARGETS="+strings.Join(targets, string(os.PathListSeparator)),
+		"FS_ANALYZER_TOTAL_SIZE="+strconv.FormatInt(sum.TotalSize, 10),
+		"FS_ANALYZER_TOTAL_FILES="+strconv.FormatInt(sum.TotalFiles, 10),
+		"FS_ANALYZER_DIRECTORIES="+strconv.Itoa(sum.Directories),
+		"FS_ANALYZER_INACCESSIBLE="+strconv.FormatInt(sum.Inaccessible, 10),
+		"FS_ANALYZER_DURATION="+strconv.FormatFloat(sum.DurationSeconds, 'f', -1, 64),
+		"FS_ANALYZER_SNAPSHOT="+saveFile,
+		"FS_ANALYZER_OUTPUT="+outputFile)
+	var violations int64
+	for check, n := range sum.Violations {
+		violations += n
+		env = append(env, "FS_ANALYZER_VIOLATION_"+strings.ToUpper(check)+"="+strconv.FormatInt(n, 10))
+	}
+	env = append(env, "FS_ANALYZER_VIOLATIONS="+strconv.FormatInt(violations, 10))
+
+	for _, hook := range postHooks {
+		cmd := shellCommand(hook)
+		cmd.Stdin = bytes.NewReader(data)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = env
+		if err := cmd.Run(); err != nil {
+			fmt.Printf("Warning: Post-hook %s failed: %v\n", hook, err)
+		} else if verbose {
+			fmt.Printf("Post-hook %s finished\n", hook)
+		}
+	}
+}
+
+// --- Resource Usage ---
+
+// resourceStats is the scanner's own resource consumption (--resource-usage). The kernel figures
+// come from /proc on Linux; elsewhere CPU time is the Go runtime's estimate and peak RSS unknown.
+type resourceStats struct {
+	PeakRSS       int64   `json:"peak_rss_bytes,omitempty"`
+	GoSys         uint64  `json:"go_sys_bytes"` // Memory obtained from the OS by the Go runtime
+	CPUUser       float64 `json:"cpu_user_seconds"`
+	CPUSystem     float64 `json:"cpu_system_seconds"`
+	CPUEstimated  bool    `json:"cpu_estimated,omitempty"`
+	ReadSyscalls  int64   `json:"read_syscalls,omitempty"`
+	WriteSyscalls int64   `json:"write_syscalls,omitempty"`
+	GCCycles      uint32  `json:"gc_cycles"`
+	GCPause       float64 `json:"gc_pause_seconds"`
+	GCPauseMax    float64 `json:"gc_pause_max_seconds"`
+}
+
+// procFields reads "Key: value ..." lines of a /proc file and returns the first number of each
+func procFields(path string) map[string]int64 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	fields := make(map[string]int64)
+	for _, line := range strings.Split(string(data), "\n") {
+		key, rest, ok := strings.Cut(line, ":")
+		if f := strings.Fields(rest); ok && len(f) > 0 {
+			if n, err := strconv.ParseInt(f[0], 10, 64); err == nil {
+				fields[key] = n
+			}
+		}
+	}
+	return fields
+}
+
+func readResourceUsage() resourceStats {
+	var r resourceStats
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	r.GoSys, r.GCCycles = ms.Sys, ms.NumGC
+	r.GCPause = float64(ms.PauseTotalNs) / 1e9
+	for i := 0; i < int(min(ms.NumGC, uint32(len(ms.PauseNs)))); i++ {
+		r.GCPauseMax = max(r.GCPauseMax, float64(ms.PauseNs[i])/1e9)
+	}
+
+	if status := procFields("/proc/self/status"); status != nil {
+		r.PeakRSS = status["VmHWM"] * 1024 // kB
+	}
+	if pio := procFields("/proc/self/io"); pio != nil {
+		r.ReadSyscalls, r.WriteSyscalls = pio["syscr"], pio["syscw"]
+	}
+	// utime and stime are fields 14 and 15 of /proc/self/stat, in clock ticks (USER_HZ, 100 on Linux)
+	if data, err := os.ReadFile("/proc/self/stat"); err == nil {
+		if i := bytes.LastIndexByte(data, ')'); i >= 0 {
+			if f := strings.Fields(string(data[i+1:])); len(f) > 12 {
+				utime, err1 := strconv.ParseInt(f[11], 10, 64)
+				stime, err2 := strconv.ParseInt(f[12], 10, 64)
+				if err1 == nil && err2 == nil {
+					r.CPUUser, r.CPUSystem = float64(utime)/100, float64(stime)/100
+					return r
+				}
+			}
+		}
+	}
+
+	samples := []metrics.Sample{{Name: "/cpu/classes/total:cpu-seconds"}, {Name: "/cpu/classes/idle:cpu-seconds"}}
+	metrics.Read(samples)
+	if samples[0].Value.Kind() == metrics.KindFloat64 && samples[1].Value.Kind() == metrics.KindFloat64 {
+		r.CPUUser, r.CPUEstimated = samples[0].Value.Float64()-samples[1].Value.Float64(), true
+	}
+	return r
+}
+
+func printResourceUsage(startTime time.Time) {
+	r := readResourceUsage()
+	wall := time.Since(startTime).Seconds()
+	fmt.Println("\n--- Resource Usage ---")
+	if r.PeakRSS > 0 {
+		fmt.Printf("Peak RSS:     %s (Go runtime: %s from the OS)\n", formatBytes(r.PeakRSS), formatBytes(int64(r.GoSys)))
+	} else {
+		fmt.Printf("Memory:       %s from the OS (Go runtime; peak RSS not available on this platform)\n", formatBytes(int64(r.GoSys)))
+	}
+	if r.CPUEstimated {
+		fmt.Printf("CPU time:     %.2fs (estimated by the Go runtime)", r.CPUUser)
+	} else {
+		fmt.Printf("CPU time:     %.2fs user, %.2fs system", r.CPUUser, r.CPUSystem)
+	}
+	if wall > 0 {
+		fmt.Printf(", %.1f cores on average over %.2fs", (r.CPUUser+r.CPUSystem)/wall, wall)
+	}
+	fmt.Println()
+	if r.ReadSyscalls > 0 {
+		fmt.Printf("Syscalls:     %d read, %d write\n", r.ReadSyscalls, r.WriteSyscalls)
+	}
+	fmt.Printf("GC:           %d cycles, %.1fms total pause, %.1fms longest\n", r.GCCycles, r.GCPause*1000, r.GCPauseMax*1000)
+}
+
+// --- Progressive Output ---
+
+// progressRow is a first-level subdirectory (or the files directly in a target) in the --progressive table
+type progressRow struct {
+	Path    string
+	Entries int   // Direct entries, from the quick pass
+	Size    int64 // Scanned so far
+	Files   int64
+	Done    bool
+}
+
+var (
+	progressive   = false
+	progressTTY   = false // Redraw the table in place; otherwise it is only printed twice
+	progressRows  = make(map[string]*progressRow)
+	progressCur   *progressRow // Subtree being walked
+	progressLines = 0          // Lines of the last drawing, to move the cursor back over them
+	progressDrawn time.Time
+)
+
+// quickEstimate is the first pass of --progressive: it only reads the targets and their direct
+// subdirectories (one directory read each, no stat calls), which takes seconds even on huge trees,
+// and shows how many entries each first-level subdirectory holds.
+func quickEstimate() {
+	// Other output (--verbose warnings) would end up inside the redrawn lines
+	if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 && !verbose {
+		progressTTY = true
+	}
+	for _, root := range targetPaths {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		entries, err := fs.ReadDir(scannedFS(absRoot), ".")
+		if err != nil {
+			continue
+		}
+		files := &progressRow{Path: absRoot}
+		for _, e := range entries {
+			p := filepath.Join(absRoot, e.Name())
+			if !e.IsDir() {
+				files.Entries++
+				continue
+			}
+			if isExcluded(p) {
+				continue
+			}
+			row := &progressRow{Path: p}
+			if f, err := openScanned(p); err == nil {
+				names, _ := f.Readdirnames(-1)
+				row.Entries = len(names)
+				f.Close()
+			}
+			progressRows[p] = row
+		}
+		if files.Entries > 0 {
+			progressRows[absRoot] = files
+		}
+	}
+	drawProgress(true)
+}
+
+// noteProgress adds a scanned file to its first-level subtree (rel is the path below the target)
+func noteProgress(root, prefix, rel string, size int64) {
+	first, _, isNested := strings.Cut(rel, "/")
+	key := root
+	if isNested {
+		key = prefix + first
+	}
+	row := progressRows[key]
+	if row == nil {
+		row = &progressRow{Path: key}
+		progressRows[key] = row
+	}
+	row.Size += size
+	row.Files++
+	if isNested && row != progressCur {
+		// WalkDir finishes a subtree before the next: the previous one is complete
+		if progressCur != nil {
+			progressCur.Done = true
+		}
+		progressCur = row
+	}
+	if time.Since(progressDrawn) >= 250*time.Millisecond {
+		drawProgress(false)
+	}
 }
 
-// getDirStat safely retrieves or initializes Map entry
-func getDirStat(path string) *DirStat {
-	if _, ok := dirStats[path]; !ok {
-		dirStats[path] = &DirStat{Path: path}
+// finishProgress marks everything as scanned and draws the final state of the table
+func finishProgress() {
+	for _, row := range progressRows {
+		row.Done = true
 	}
-	return dirStats[path]
+	drawProgress(true)
 }
 
-// isUnderTargets checks if the path is under the user-specified search paths
-func isUnderTargets(path string) bool {
-	normPath := normalizePath(path)
-	for _, root := range targetPaths {
-		normRoot := normalizePath(root)
-		if isPathEqualOrSubpath(normPath, normRoot) {
-			return true
+// drawProgress prints the top N first-level subtrees by size scanned so far, over the previous
+// drawing on a terminal. Without a terminal only the quick pass and the final state are printed.
+func drawProgress(force bool) {
+	if !progressTTY && !force {
+		return
+	}
+	progressDrawn = time.Now()
+	rows := make([]*progressRow, 0, len(progressRows))
+	var done int
+	var size, files int64
+	for _, r := range progressRows {
+		rows = append(rows, r)
+		size += r.Size
+		files += r.Files
+		if r.Done {
+			done++
 		}
 	}
-	return false
-}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Size != rows[j].Size {
+			return rows[i].Size > rows[j].Size
+		}
+		if rows[i].Files != rows[j].Files {
+			return rows[i].Files > rows[j].Files
+		}
+		if rows[i].Entries != rows[j].Entries {
+			return rows[i].Entries > rows[j].Entries
+		}
+		return rows[i].Path < rows[j].Path
+	})
 
-// isExactTarget checks whether path exactly matches one of user input roots.
-func isExactTarget(path string) bool {
-	normPath := normalizePath(path)
-	for _, root := range targetPaths {
-		if normPath == normalizePath(root) {
-			return true
+	var b strings.Builder
+	if progressTTY && progressLines > 0 {
+		fmt.Fprintf(&b, "\033[%dA\033[J", progressLines) // Cursor up, clear to the end of the screen
+	}
+	fmt.Fprintf(&b, "\n--- First-Level Subdirectories (%d of %d scanned, %s in %d files so far) ---\n", done, len(rows), formatBytes(size), files)
+	fmt.Fprintf(&b, "%-15s | %-15s | %-10s | %-8s | %-50s\n", "Size", "Files", "Entries", "Status", "Path")
+	b.WriteString(strings.Repeat("-", 80) + "\n")
+	for i, r := range rows {
+		if i >= topN {
+			break
+		}
+		status := "pending"
+		if r.Done {
+			status = "done"
+		} else if r == progressCur {
+			status = "scanning"
 		}
+		fmt.Fprintf(&b, "%-15s | %-15s | %-10d | %-8s | %s\n", formatBytes(r.Size), formatFiles(r.Files), r.Entries, status, shownPath(r.Path))
 	}
-	return false
+	out := b.String()
+	progressLines = strings.Count(out, "\n")
+	fmt.Print(out)
 }
 
-// removeSubdirectories cleans up the target list by removing subdirectories that are already covered by parent directories in the list
-func removeSubdirectories(paths []string) []string {
-	if len(paths) == 0 {
-		return paths
-	}
+// --- Memory Limit ---
 
-	// Convert to absolute paths
-	absPaths := make([]string, 0, len(paths))
-	for _, p := range paths {
-		abs, err := filepath.Abs(p)
-		if err != nil {
-			fmt.Printf("Warning: Could not resolve path %s: %v\n", p, err)
-			continue
+// Degradation steps of --max-memory: once the process uses this share of the limit, the deepest
+// levels of the tree are folded into their ancestors
+const foldThreshold = 0.8
+
+var (
+	maxMemory  = int64(0)              // --max-memory, 0 = unlimited
+	foldDepth  = -1                    // Directories deeper than this below their target are folded, -1 = none
+	foldedDirs = make(map[string]bool) // Directories at foldDepth that hold the totals of deeper ones
+	memChecks  = 0                     // Walk entries since the last memory check
+	memWarned  = false
+)
+
+// processMemory is the memory the process holds from the OS (mapped minus returned heap pages)
+func processMemory() int64 {
+	samples := []metrics.Sample{{Name: "/memory/classes/total:bytes"}, {Name: "/memory/classes/heap/released:bytes"}}
+	metrics.Read(samples)
+	return int64(samples[0].Value.Uint64() - samples[1].Value.Uint64())
+}
+
+// checkMemory is called during the walk; near the --max-memory limit it folds the deepest
+// directories into their ancestors (keeping all totals correct, but not their breakdown) instead of
+// letting the process be OOM-killed. Every step halves the number of directory entries.
+func checkMemory() {
+	if memChecks++; memChecks < 4096 {
+		return
+	}
+	memChecks = 0
+	if float64(processMemory()) < foldThreshold*float64(maxMemory) {
+		return
+	}
+	if foldDepth == 1 {
+		if !memWarned {
+			fmt.Printf("Warning: Memory use is near --max-memory (%s) although directories are already folded at depth 1\n", formatBytes(maxMemory))
+			memWarned = true
 		}
-		absPaths = append(absPaths, abs)
+		return
 	}
 
-	// Sort paths to ensure parents come before children
-	sort.Strings(absPaths)
+	// Deepest level that keeps at most half of the entries
+	perDepth := make(map[int]int)
+	maxD := 0
+	for _, s := range dirStats {
+		perDepth[s.Depth]++
+		maxD = max(maxD, s.Depth)
+	}
+	depth, kept := 0, 0
+	for d := 0; d <= maxD; d++ {
+		if kept+perDepth[d] > len(dirStats)/2 {
+			break
+		}
+		kept += perDepth[d]
+		depth = d
+	}
+	depth = max(depth, 1)
+	if foldDepth >= 0 && depth >= foldDepth {
+		depth = foldDepth - 1
+	}
+	foldDirs(depth)
+	if verbose {
+		fmt.Printf("Memory use near --max-memory: folded directories deeper than %d level(s), %d entries left\n", depth, len(dirStats))
+	}
+}
 
-	var clean []string
-	for _, p := range absPaths {
-		if len(clean) == 0 {
-			clean = append(clean, p)
+// foldDirs merges every directory deeper than depth into its ancestor at depth and releases the
+// memory of the merged entries
+func foldDirs(depth int) {
+	foldDepth = depth
+	for p, s := range dirStats {
+		if s.Depth <= depth {
 			continue
 		}
+		anc := p
+		for i := s.Depth; i > depth; i-- {
+			anc = filepath.Dir(anc)
+		}
+		a := getDirStat(anc)
+		a.TotalSize += s.TotalSize
+		a.FileCount += s.FileCount
+		a.OwnSize += s.OwnSize
+		a.OwnFiles += s.OwnFiles
+		mergeCounts(a, s)
+		foldedDirs[anc] = true
+		delete(dirStats, p)
+		delete(foldedDirs, p)
+	}
+	// Maps do not shrink when entries are deleted
+	compact := make(map[string]*DirStat, len(dirStats))
+	for p, s := range dirStats {
+		compact[p] = s
+	}
+	dirStats = compact
+	debug.FreeOSMemory()
+}
 
-		last := clean[len(clean)-1]
-		// Check if p is a subdirectory of last
-		// Must handle case where p is "/tmp/foo" and last is "/tmp"
-		// Also handle "/tmp" and "/tmp" (duplicates)
-		// And "/tmp" vs "/tmp2" (not subdirectory)
+// foldedPath returns where the statistics of directory p (at depth below its target, whose path
+// ends in prefix) are recorded: p itself, or its ancestor at foldDepth once deep levels are folded
+func foldedPath(p, prefix string, depth int) string {
+	if foldDepth < 0 || depth <= foldDepth {
+		return p
+	}
+	rest, i := p[len(prefix):], 0
+	for range foldDepth {
+		i += strings.IndexByte(rest[i:], os.PathSeparator) + 1
+	}
+	anc := prefix + rest[:i-1]
+	foldedDirs[anc] = true
+	return anc
+}
 
-		if p == last {
-			continue // Duplicate
+// printFoldedNote lists the subtrees whose breakdown was lost to --max-memory
+func printFoldedNote() {
+	var list []*DirStat
+	for p := range foldedDirs {
+		if s, ok := dirStats[p]; ok {
+			list = append(list, s)
 		}
-
-		if !isPathEqualOrSubpath(normalizePath(p), normalizePath(last)) {
-			clean = append(clean, p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].TotalSize != list[j].TotalSize {
+			return list[i].TotalSize > list[j].TotalSize
 		}
+		return list[i].Path < list[j].Path
+	})
+	fmt.Printf("\nNote: Memory use reached %.0f%% of --max-memory (%s), so the directories deeper than %d level(s) below the targets were folded into their ancestors. "+
+		"Totals are complete, but %d subtree(s) have no breakdown below that depth, the largest being:\n", foldThreshold*100, formatBytes(maxMemory), foldDepth, len(list))
+	for i, s := range list {
+		if i >= topN {
+			break
+		}
+		fmt.Printf("  %-15s %s\n", formatBytes(s.TotalSize), shownPath(s.Path))
 	}
-	return clean
 }
 
-// --- Argument Parsing ---
+// --- Throttling ---
+//
+// --throttle paces the walk to a number of directory entries per second, so a scan (or every round
+// of watch) does not compete with production I/O; --full-speed lists the times of day (local time)
+// when it runs unthrottled, e.g. --throttle 500 --full-speed 01:00-05:00.
 
-func parseArgs() {
-	args := os.Args[1:]
-	// If no arguments provided, defaults will be used (targetPaths handled below)
+var (
+	throttleRate  = 0         // --throttle: entries per second, 0 = unlimited
+	fullSpeed     []dayWindow // --full-speed
+	throttleStart time.Time   // Start of the current throttled stretch, zero at full speed
+	throttleCount = 0         // Entries walked since throttleStart
+)
 
-	for i := 0; i < len(args); i++ {
-		arg := args[i]
-		switch arg {
-		case "--path":
-			// Read all subsequent non-option arguments as paths
-			for i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
-				targetPaths = append(targetPaths, args[i+1])
-				i++
-			}
-		case "--maxdepth":
-			if i+1 < len(args) {
-				val, err := strconv.Atoi(args[i+1])
-				if err != nil {
-					fmt.Println("Error: --maxdepth requires a numeric value")
-					os.Exit(1)
-				}
-				maxDepth = val
-				i++
+// dayWindow is a time of day range in minutes after midnight; End < Start wraps past midnight
+type dayWindow struct {
+	Start, End int
+}
+
+// parseDayWindows parses comma-separated HH:MM-HH:MM ranges
+func parseDayWindows(s string) ([]dayWindow, error) {
+	var windows []dayWindow
+	for _, part := range strings.Split(s, ",") {
+		from, to, ok := strings.Cut(strings.TrimSpace(part), "-")
+		if !ok {
+			return nil, fmt.Errorf("%q is not a range such as 01:00-05:00", part)
+		}
+		var w dayWindow
+		for i, hm := range []string{from, to} {
+			t, err := time.Parse("15:04", strings.TrimSpace(hm))
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a time such as 01:00", hm)
 			}
-		case "--top":
-			if i+1 < len(args) {
-				val, err := strconv.Atoi(args[i+1])
-				if err != nil {
-					fmt.Println("Error: --top requires a numeric value")
-					os.Exit(1)
-				}
-				topN = val
-				i++
-			}
-		case "--size-mode":
-			if i+1 < len(args) {
-				mode := strings.ToLower(args[i+1])
-				if mode != "disk" && mode != "apparent" {
-					fmt.Println("Error: --size-mode must be one of: disk, apparent")
-					os.Exit(1)
-				}
-				sizeMode = mode
-				i++
+			if i == 0 {
+				w.Start = t.Hour()*60 + t.Minute()
 			} else {
-				fmt.Println("Error: --size-mode requires a value: disk or apparent")
-				os.Exit(1)
+				w.End = t.Hour()*60 + t.Minute()
 			}
-		case "--exclude":
-			// Read all subsequent non-option arguments as exclude paths
-			for i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
-				excludePaths = append(excludePaths, args[i+1])
-				i++
-			}
-		case "--verbose":
-			verbose = true
-		case "--display-runtime":
-			displayRuntime = true
-		case "--version":
-			fmt.Printf("%s (%s/%s)\n", version, runtime.GOOS, runtime.GOARCH)
-			os.Exit(0)
-		case "-h", "--help":
-			printUsage()
-			os.Exit(0)
-		default:
-			fmt.Printf("Unknown option: %s\n", arg)
-			printUsage()
-			os.Exit(1)
 		}
+		if w.Start == w.End {
+			return nil, fmt.Errorf("%q is an empty range", part)
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+func inDayWindows(windows []dayWindow, t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	for _, w := range windows {
+		if w.Start < w.End && m >= w.Start && m < w.End || w.Start > w.End && (m >= w.Start || m < w.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// throttleEntry is called for every entry of the walk. It looks at the clock once per 1/20 s worth
+// of entries and sleeps until the entries walked so far are due at the --throttle rate.
+func throttleEntry() {
+	throttleCount++
+	if throttleCount%max(throttleRate/20, 1) != 0 {
+		return
+	}
+	now := time.Now()
+	if inDayWindows(fullSpeed, now) {
+		throttleStart, throttleCount = time.Time{}, 0
+		return
+	}
+	if throttleStart.IsZero() {
+		throttleStart, throttleCount = now, 0
+		return
+	}
+	due := throttleStart.Add(time.Duration(throttleCount) * time.Second / time.Duration(throttleRate))
+	if d := due.Sub(now); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// --- Walk Timing ---
+
+// walkTiming records when the walk entered and left a directory subtree
+type walkTiming struct {
+	Path     string
+	Start    time.Time
+	End      time.Time
+	Children time.Duration // Time spent in finished subdirectory subtrees
+}
+
+var (
+	walkStack    []walkTiming // Subtrees currently being walked (WalkDir is depth-first)
+	slowSubtrees []walkTiming // Finished subtrees that took at least traceMinDur
+	rootTimings  []walkTiming // One entry per scanned target
+)
+
+// trackWalk closes every open subtree that the walk has left and opens a new one for directories.
+func trackWalk(path string, isDir bool) {
+	now := time.Now()
+	parent := filepath.Dir(path)
+	for len(walkStack) > 0 {
+		top := walkStack[len(walkStack)-1]
+		if path != top.Path && hasPathPrefix(parent, top.Path) {
+			break
+		}
+		popWalk(now)
+	}
+	if isDir {
+		walkStack = append(walkStack, walkTiming{Path: path, Start: now})
+	}
+}
+
+// finishWalk closes all subtrees still open at the end of a root's walk.
+func finishWalk() {
+	now := time.Now()
+	for len(walkStack) > 0 {
+		popWalk(now)
+	}
+}
+
+func popWalk(now time.Time) {
+	top := walkStack[len(walkStack)-1]
+	walkStack = walkStack[:len(walkStack)-1]
+	top.End = now
+	elapsed := top.End.Sub(top.Start)
+	if len(walkStack) > 0 {
+		walkStack[len(walkStack)-1].Children += elapsed
+	}
+	if slowestN > 0 {
+		getDirStat(top.Path).ScanTime = elapsed - top.Children
 	}
+	if otlpEndpoint != "" && elapsed >= traceMinDur {
+		slowSubtrees = append(slowSubtrees, top)
+	}
+}
 
-	if len(targetPaths) == 0 {
-		// Default to current directory if no path specified
-		targetPaths = append(targetPaths, ".")
+// hasPathPrefix reports whether path is dir or lies below it, without the cost of filepath.Rel.
+func hasPathPrefix(path, dir string) bool {
+	if !strings.HasPrefix(path, dir) {
+		return false
 	}
+	return len(path) == len(dir) || strings.HasSuffix(dir, string(os.PathSeparator)) || path[len(dir)] == os.PathSeparator
 }
 
-func printUsage() {
-	fmt.Println("Usage: find_heavy_dirs [--path <path1> path2...] [--exclude <path1> path2...] [--size-mode <disk|apparent>] [--maxdepth <N>] [--top <N>] [--verbose] [--display-runtime] [--version]")
-	fmt.Println("Options:")
-	fmt.Println("  --path <path...>: One or more paths to search. Default is current directory.")
-	fmt.Println("  --exclude <path...>: One or more subpaths to exclude from scanning and statistics.")
-	fmt.Println("  --size-mode <disk|apparent>: Size metric mode. Default is disk (Windows falls back to apparent).")
-	fmt.Println("  --maxdepth <N>:   Limit the search to N levels deep. Default is 1000000.")
-	fmt.Println("  --top <N>:        Display the top N entries. Default is 20.")
-	fmt.Println("  --verbose:        Show detailed progress information.")
-	fmt.Println("  --display-runtime:Show total execution time.")
-	fmt.Println("  --version:        Show program version.")
-	fmt.Println("  -h, --help:       Show this help message.")
+// --- Scan Duration ---
+
+// printSlowestDirectories lists the slowestN directories with the highest wall time per direct
+// entry. Only the time spent in the directory itself counts (reading it and stat-ing its entries),
+// so a slow subdirectory does not make its ancestors look slow. Directories that are slow per entry
+// point at failing disks, overloaded NFS exports or on-access virus scanners rather than at size.
+func printSlowestDirectories() {
+	var list []*DirStat
+	for _, s := range dirStats {
+		if s.ScanTime > 0 && isUnderTargets(s.Path) {
+			list = append(list, s)
+		}
+	}
+	if len(list) == 0 {
+		return
+	}
+	perEntry := func(s *DirStat) time.Duration {
+		return s.ScanTime / time.Duration(max(s.Entries, 1))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if a, b := perEntry(list[i]), perEntry(list[j]); a != b {
+			return a > b
+		}
+		return list[i].Path < list[j].Path
+	})
+	fmt.Printf("\n--- Top %d Slowest Directories (Scan Time per Entry) ---\n", slowestN)
+	fmt.Printf("%-15s | %-15s | %-15s | %-50s\n", "Time", "Entries", "Per Entry", "Path")
+	fmt.Println(strings.Repeat("-", 90))
+	for i, s := range list {
+		if i >= slowestN {
+			break
+		}
+		fmt.Printf("%-15s | %-15s | %-15s | %s\n", s.ScanTime.Round(time.Microsecond), strconv.FormatInt(s.Entries, 10), perEntry(s).Round(time.Microsecond), shownPath(s.Path))
+	}
+	fmt.Println("Note: Time excludes subdirectories. Compare the per-entry time of directories on the same device; outliers often mean failing disks, slow network exports or antivirus scanning.")
 }
 
 // --- Formatting Tools ---
 
+// parseSize parses sizes such as 500M, 10G or 1.5TiB (binary units, like formatBytes) or plain bytes
+func parseSize(s string) (int64, error) {
+	v := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B"), "I")
+	mult := int64(1)
+	if n := len(v); n > 0 {
+		if i := strings.IndexByte("KMGTPE", v[n-1]); i >= 0 {
+			mult = int64(1) << (10 * (i + 1))
+			v = v[:n-1]
+		}
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid size %q (use e.g. 500M, 10G)", s)
+	}
+	return int64(f * float64(mult)), nil
+}
+
 func formatBytes(b int64) string {
 	const unit = 1024
 	if b < unit {
-		return fmt.Sprintf("%d B", b)
+		return formatCount(b) + " B"
 	}
 	div, exp := int64(unit), 0
 	for n := b / unit; n >= unit; n /= unit {
 		div *= unit
 		exp++
 	}
-	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "KMGTPE"[exp])
+	v := float64(b) / float64(div)
+	// --round up/down; the tolerance absorbs float error in sizes that are exact at this precision
+	scale := math.Pow10(sizePrecision)
+	switch sizeRounding {
+	case "up":
+		v = math.Ceil(v*scale-1e-6) / scale
+	case "down":
+		v = math.Floor(v*scale+1e-6) / scale
+	}
+	return fmt.Sprintf("%s %cB", formatDecimal(v, sizePrecision), "KMGTPE"[exp])
+}
+
+// exactSize is a size in bytes with thousands separators, for the --exact-bytes columns and tooltips
+func exactSize(b int64) string {
+	return formatCount(b) + " bytes"
+}
+
+// numberFormat holds the separators of human-readable numbers (--locale). Machine formats (CSV,
+// Parquet, JSON, metrics, environment variables) always use plain digits and a decimal point.
+type numberFormat struct {
+	Group   string // Thousands separator, empty for none
+	Decimal string
+}
+
+// numberFormats are the separators by language, or language_REGION where it differs. Where the
+// locale groups with a (narrow) no-break space, a plain space keeps the table columns aligned.
+var numberFormats = map[string]numberFormat{
+	"c": {"", "."}, "posix": {"", "."},
+	"en": {",", "."}, "ja": {",", "."}, "zh": {",", "."}, "ko": {",", "."}, "he": {",", "."}, "th": {",", "."}, "hi": {",", "."},
+	"de": {".", ","}, "nl": {".", ","}, "it": {".", ","}, "es": {".", ","}, "pt": {".", ","}, "da": {".", ","},
+	"id": {".", ","}, "tr": {".", ","}, "el": {".", ","}, "ro": {".", ","}, "hr": {".", ","}, "sl": {".", ","},
+	"fr": {" ", ","}, "ru": {" ", ","}, "uk": {" ", ","}, "pl": {" ", ","}, "cs": {" ", ","}, "sk": {" ", ","},
+	"sv": {" ", ","}, "nb": {" ", ","}, "no": {" ", ","}, "fi": {" ", ","}, "hu": {" ", ","}, "bg": {" ", ","},
+	"et": {" ", ","}, "lt": {" ", ","}, "lv": {" ", ","}, "pt_pt": {" ", ","},
+	"de_ch": {"'", "."}, "it_ch": {"'", "."}, "de_li": {"'", "."}, "es_mx": {",", "."}, "es_us": {",", "."},
+}
+
+// parseLocale finds the number format of a locale such as de, de-CH or de_CH.UTF-8. "auto" takes
+// it from LC_ALL, LC_NUMERIC or LANG, and keeps the default when they are unset or unknown.
+func parseLocale(name string) (numberFormat, error) {
+	auto := name == "auto"
+	if auto {
+		name = cmp.Or(os.Getenv("LC_ALL"), os.Getenv("LC_NUMERIC"), os.Getenv("LANG"))
+	}
+	tag := strings.ToLower(strings.ReplaceAll(name, "-", "_"))
+	if i := strings.IndexAny(tag, ".@"); i >= 0 {
+		tag = tag[:i]
+	}
+	if f, ok := numberFormats[tag]; ok {
+		return f, nil
+	}
+	lang, _, _ := strings.Cut(tag, "_")
+	if f, ok := numberFormats[lang]; ok {
+		return f, nil
+	}
+	if auto {
+		return numFormat, nil
+	}
+	return numFormat, fmt.Errorf("unknown locale %s", name)
+}
+
+// formatCount formats an integer with the thousands separator of --locale
+func formatCount(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	if numFormat.Group == "" {
+		return s
+	}
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+	var b strings.Builder
+	for i, d := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteString(numFormat.Group)
+		}
+		b.WriteRune(d)
+	}
+	return sign + b.String()
+}
+
+// formatDecimal formats f with prec decimals and the separators of --locale
+func formatDecimal(f float64, prec int) string {
+	s := strconv.FormatFloat(f, 'f', prec, 64)
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if n, err := strconv.ParseInt(whole, 10, 64); err == nil {
+		whole = formatCount(n)
+		if n == 0 && strings.HasPrefix(s, "-") {
+			whole = "-0"
+		}
+	}
+	if !hasFrac {
+		return whole
+	}
+	return whole + numFormat.Decimal + frac
+}
+
+func formatFiles(n int64) string {
+	return formatCount(n) + " Files"
 }
 
 func printTable(title string, list []*DirStat, isSize bool) {
+	if relativePaths {
+		title += " under " + relativeRoots()
+	}
 	fmt.Println("\n--- " + title + " ---")
+	showCost := isSize && costPerGB > 0
+	// Exact bytes (--exact-bytes) and computed columns (--add-column) go between the metric and the path
+	showExact := isSize && exactBytes
+	extraHeader := ""
+	if showExact {
+		extraHeader += fmt.Sprintf("%-19s | ", "Bytes")
+	}
+	for _, c := range addColumns {
+		extraHeader += fmt.Sprintf("%-15s | ", c.Name)
+	}
 	// Simple table header
-	fmt.Printf("%-15s | %-50s\n", "Metric", "Path")
-	fmt.Println(strings.Repeat("-", 70))
+	if showCost {
+		fmt.Printf("%-15s | %-16s | %s%-50s\n", "Metric", "Cost/Month", extraHeader, "Path")
+	} else {
+		fmt.Printf("%-15s | %s%-50s\n", "Metric", extraHeader, "Path")
+	}
+	separator := 70 + 18*len(addColumns)
+	if showExact {
+		separator += 22
+	}
+	fmt.Println(strings.Repeat("-", separator))
 
 	limit := topN
-	if len(list) < limit {
+	if len(list) < limit || showAll {
 		limit = len(list)
 	}
 
@@ -433,17 +2482,238 @@ func printTable(title string, list []*DirStat, isSize bool) {
 		if isSize {
 			valStr = formatBytes(s.TotalSize)
 		} else {
-			valStr = fmt.Sprintf("%d Files", s.FileCount)
+			valStr = formatFiles(s.FileCount)
+		}
+		if s.Estimated {
+			valStr = "~" + valStr
 		}
 
 		// Simple truncated path display to prevent ugly wrapping
-		displayPath := s.Path
+		displayPath := displayPathOf(s)
 		if len(displayPath) > 80 {
 			displayPath = "..." + displayPath[len(displayPath)-77:]
 		}
+		if s.Inaccessible > 0 {
+			displayPath += fmt.Sprintf(" [incomplete: %d inaccessible]", s.Inaccessible)
+		}
+		if tags := tagsOf(s.Path); tags != "" {
+			displayPath += " [" + tags + "]"
+		}
+
+		extra := ""
+		if showExact {
+			extra += fmt.Sprintf("%-19s | ", formatCount(s.TotalSize))
+		}
+		for _, c := range addColumns {
+			extra += fmt.Sprintf("%-15s | ", formatColumnValue(c.Eval(s)))
+		}
+		if showCost {
+			fmt.Printf("%-15s | %-16s | %s%s\n", valStr, formatCost(s.TotalSize), extra, displayPath)
+			continue
+		}
+		fmt.Printf("%-15s | %s%s\n", valStr, extra, displayPath)
+	}
+}
+
+// --- Pager ---
+
+var (
+	pagerCmd    *exec.Cmd
+	pagerStdout *os.File // The real stdout while the pager runs
+)
+
+// startPager sends everything printed from now on through $PAGER (default less -FRX, which exits
+// right away if the output fits on the screen) when stdout is a terminal. PAGER= or PAGER=cat
+// turn it off.
+func startPager() {
+	if fi, err := os.Stdout.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return
+	}
+	pager, ok := os.LookupEnv("PAGER")
+	if !ok {
+		if _, err := exec.LookPath("less"); err != nil {
+			return
+		}
+		pager = "less -FRX"
+	}
+	if pager == "" || pager == "cat" {
+		return
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	cmd := shellCommand(pager)
+	cmd.Stdin = r
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		r.Close()
+		w.Close()
+		return
+	}
+	r.Close()
+	pagerCmd, pagerStdout = cmd, os.Stdout
+	// If the pager is quit early, further writes fail quietly (no SIGPIPE: not file descriptor 1)
+	os.Stdout = w
+}
+
+// stopPager closes the pager's input and waits until the user has quit it
+func stopPager() {
+	if pagerCmd == nil {
+		return
+	}
+	os.Stdout.Close()
+	os.Stdout = pagerStdout
+	pagerCmd.Wait()
+	pagerCmd = nil
+}
+
+// formatCost returns the monthly cost of storing b bytes at costPerGB per GiB.
+func formatCost(b int64) string {
+	return formatDecimal(float64(b)/(1<<30)*costPerGB, 2) + " " + currency
+}
+
+// printCostSummary prints the total size and monthly cost of every target and overall.
+func printCostSummary() {
+	fmt.Printf("\n--- Cost Summary (%.4g %s per GiB and month) ---\n", costPerGB, currency)
+	fmt.Printf("%-15s | %-16s | %-50s\n", "Size", "Cost/Month", "Target")
+	fmt.Println(strings.Repeat("-", 70))
+	var total int64
+	for _, root := range targetPaths {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		if s, ok := dirStats[absRoot]; ok {
+			total += s.TotalSize
+			fmt.Printf("%-15s | %-16s | %s\n", formatBytes(s.TotalSize), formatCost(s.TotalSize), shownPath(absRoot))
+		}
+	}
+	fmt.Printf("%-15s | %-16s | %s\n", formatBytes(total), formatCost(total), "Total")
+}
+
+// displayPathOf returns the path shown for an entry; collapsed chains are shown as a/…/d.
+func displayPathOf(s *DirStat) string {
+	show := shownPath
+	if relativePaths {
+		show = relativePath
+	}
+	if s.ChainTail == "" {
+		return show(s.Path)
+	}
+	if filepath.Dir(s.ChainTail) == s.Path {
+		return show(s.ChainTail)
+	}
+	return filepath.Join(show(s.Path), "…", shownPath(filepath.Base(s.ChainTail)))
+}
+
+// relativePath returns p relative to the (innermost) scan root containing it (--relative). With
+// several roots the path is prefixed by the root's number, as listed by relativeRoots.
+func relativePath(p string) string {
+	best, bestRoot := -1, ""
+	for i, root := range targetPaths {
+		absRoot, err := filepath.Abs(root)
+		if err != nil || !isPathEqualOrSubpath(p, absRoot) || len(absRoot) <= len(bestRoot) {
+			continue
+		}
+		best, bestRoot = i, absRoot
+	}
+	if best < 0 {
+		return shownPath(p)
+	}
+	rel, err := filepath.Rel(bestRoot, p)
+	if err != nil {
+		return shownPath(p)
+	}
+	if anonymize {
+		rel = anonymizePath(rel)
+	}
+	if len(targetPaths) > 1 {
+		return fmt.Sprintf("[%d] %s", best+1, rel)
+	}
+	return rel
+}
+
+// relativeRoots lists the scan roots for the section header of --relative tables
+func relativeRoots() string {
+	var roots []string
+	for i, root := range targetPaths {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			absRoot = root
+		}
+		if len(targetPaths) == 1 {
+			return shownPath(absRoot)
+		}
+		roots = append(roots, fmt.Sprintf("[%d] %s", i+1, shownPath(absRoot)))
+	}
+	return strings.Join(roots, ", ")
+}
+
+// shownPath returns the path as it may appear in reports and exports (rewritten with --rewrite,
+// then anonymized with --anonymize).
+func shownPath(p string) string {
+	p = rewritePath(p)
+	if !anonymize {
+		return p
+	}
+	return anonymizePath(p)
+}
+
+// pathRewrite replaces a leading part of paths (--rewrite), e.g. /mnt/data[0-9]+ by /data
+type pathRewrite struct {
+	re   *regexp.Regexp // Anchored at the start of the path
+	repl string         // May refer to groups ($1, ${name})
+}
+
+// Path rewrite rules (--rewrite), the first matching rule applies
+var pathRewrites []pathRewrite
+
+// parseRewrite parses "<regexp>=<replacement>", splitting at the last '='
+func parseRewrite(rule string) (pathRewrite, error) {
+	i := strings.LastIndex(rule, "=")
+	if i <= 0 {
+		return pathRewrite{}, fmt.Errorf("expected <regexp>=<replacement>, e.g. '/mnt/data[0-9]+=/data'")
+	}
+	re, err := regexp.Compile("^(?:" + rule[:i] + ")")
+	if err != nil {
+		return pathRewrite{}, err
+	}
+	return pathRewrite{re: re, repl: rule[i+1:]}, nil
+}
+
+// rewritePath applies the first rule whose match ends at a path component boundary, so that
+// /mnt/data[0-9]+ rewrites /mnt/data2/x but leaves /mnt/data2-old alone
+func rewritePath(p string) string {
+	for _, rw := range pathRewrites {
+		m := rw.re.FindStringSubmatchIndex(p)
+		if m == nil || m[1] < len(p) && p[m[1]] != os.PathSeparator && m[1] > 0 && p[m[1]-1] != os.PathSeparator {
+			continue
+		}
+		return string(rw.re.ExpandString(nil, rw.repl, p, m)) + p[m[1]:]
+	}
+	return p
+}
 
-		fmt.Printf("%-15s | %s\n", valStr, displayPath)
+// anonymizePath replaces every path component by a short hash of its name, keeping the volume
+// name, the depth and a short file extension. The mapping is stable across runs, so anonymized
+// reports can still be compared with each other.
+func anonymizePath(p string) string {
+	volume := filepath.VolumeName(p)
+	parts := strings.Split(p[len(volume):], string(os.PathSeparator))
+	for i, c := range parts {
+		if c == "" || c == "." || c == ".." {
+			continue
+		}
+		ext := filepath.Ext(c)
+		if ext == c || len(ext) > 8 {
+			ext = "" // Dot files and long "extensions" are part of the name
+		}
+		sum := sha256.Sum256([]byte(strings.TrimSuffix(c, ext)))
+		parts[i] = hex.EncodeToString(sum[:5]) + ext
 	}
+	return volume + strings.Join(parts, string(os.PathSeparator))
 }
 
 func getFileSize(info fs.FileInfo) int64 {
@@ -453,30 +2723,86 @@ func getFileSize(info fs.FileInfo) int64 {
 	}
 
 	// disk mode on Unix-like systems uses allocated blocks (du-like behavior).
-	// Use reflection to keep this source file cross-platform compilable.
-	stat := info.Sys()
-	if stat != nil {
-		v := reflect.ValueOf(stat)
-		if v.Kind() == reflect.Ptr && !v.IsNil() {
-			v = v.Elem()
-		}
-		if v.IsValid() && v.Kind() == reflect.Struct {
-			blocks := v.FieldByName("Blocks")
-			if blocks.IsValid() {
-				switch blocks.Kind() {
-				case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-					return blocks.Int() * 512
-				case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-					return int64(blocks.Uint()) * 512
-				}
-			}
-		}
+	if blocks, ok := statField(info, "Blocks"); ok {
+		return blocks * 512
 	}
 
 	// Fallback for platforms/filesystems without block info.
 	return info.Size()
 }
 
+// statFieldIndex caches the field index per stat type and field name (-1 if missing): it is looked
+// up for every file, and FieldByName is a linear search by name.
+var statFieldIndex = make(map[statFieldKey]int)
+
+type statFieldKey struct {
+	Type reflect.Type
+	Name string
+}
+
+// statField reads an integer field (e.g. Blocks, Ino, Dev, Uid) of the platform stat structure.
+// Use reflection to keep this source file cross-platform compilable.
+func statField(info fs.FileInfo, name string) (int64, bool) {
+	stat := info.Sys()
+	if stat == nil {
+		return 0, false
+	}
+	v := reflect.ValueOf(stat)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.Kind() != reflect.Struct {
+		return 0, false
+	}
+	key := statFieldKey{v.Type(), name}
+	idx, ok := statFieldIndex[key]
+	if !ok {
+		idx = -1
+		if sf, found := v.Type().FieldByName(name); found && len(sf.Index) == 1 {
+			idx = sf.Index[0]
+		}
+		statFieldIndex[key] = idx
+	}
+	if idx < 0 {
+		return 0, false
+	}
+	field := v.Field(idx)
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return field.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int64(field.Uint()), true
+	}
+	return 0, false
+}
+
+// caseInsensitivePaths makes normalizePath fold case of paths outside the caseRoots
+var caseInsensitivePaths = runtime.GOOS == "windows" || runtime.GOOS == "darwin"
+
+// caseRoot records whether the file system of a target root compares names case-insensitively
+type caseRoot struct {
+	Path string // Absolute and clean
+	Fold bool
+}
+
+// caseRoots are the target roots with their case sensitivity, longest path first; probed at
+// startup by detectCaseRoots or restored from a snapshot
+var caseRoots []caseRoot
+
+// foldsCase reports whether the absolute, clean path p lies on a case-insensitive file system
+func foldsCase(p string) bool {
+	for _, r := range caseRoots {
+		q, root := p, r.Path
+		if r.Fold {
+			q, root = strings.ToLower(q), strings.ToLower(root)
+		}
+		if q == root || strings.HasPrefix(q, root) && (os.IsPathSeparator(root[len(root)-1]) || os.IsPathSeparator(q[len(root)])) {
+			return r.Fold
+		}
+	}
+	return caseInsensitivePaths
+}
+
 func normalizePath(p string) string {
 	if p == "" {
 		return ""
@@ -486,7 +2812,7 @@ func normalizePath(p string) string {
 		abs = p
 	}
 	cleaned := filepath.Clean(abs)
-	if runtime.GOOS == "windows" {
+	if foldsCase(cleaned) {
 		cleaned = strings.ToLower(cleaned)
 	}
 	return cleaned
@@ -538,6 +2864,104 @@ func uniqueStrings(input []string) []string {
 
 /*
 Change History:
+2026-10-17:
+ - Added --collapse-chains to merge single-child directory chains of near-identical size into one displayed entry (a/…/d).
+ - Added --unique-top to suppress ancestors whose size (or file count) is >=95% attributable to a single listed descendant.
+ - Added --metrics (graphite:// or statsd://) with --metric-template and --metric-depth to push per-directory size/file-count gauges.
+ - Added --otlp-endpoint to export OpenTelemetry traces (scan, target and slow subtree spans) and gauges via OTLP/HTTP JSON, with --trace-min-duration.
+ - Added --profile and --config to apply named presets (paths, excludes, thresholds, output options) from an INI-style config file.
+ - Directories that could not be (fully) read are now marked "[incomplete: N inaccessible]" in the rankings, including their ancestors, with a summary note.
+ - Path comparisons (exclude matching, target de-duplication, target scope) are now case-insensitive when the file system of the first target is, detected by probing (Windows always, macOS by default).
+ - Fixed target de-duplication when a sibling such as "/tmp-x" sorts between "/tmp" and "/tmp/foo".
+ - Added --btrfs-subvolumes to detect btrfs subvolume/snapshot roots (inode 256 on a new device number) and list them as separate roots.
+ - Added --zfs to list ZFS datasets mounted inside the targets with scanned vs. referenced, snapshot and used space and compression ratio.
+ - Added --from-listing to build the reports from a CSV or JSON listing (path,size,mtime,uid) without touching the file system.
+ - Added --anonymize to replace path components by stable hashes (keeping depth and extensions) in reports, metrics and traces.
+ - Added --by-project (with --project-markers) to attribute usage to the nearest project marker (.git, go.mod, package.json) or .owner file.
+ - Added --cost-per-gb and --currency to annotate the size and project rankings with monthly cost estimates and print a cost summary.
+ - Added --format parquet with --output to export every directory (path, size, files, depth, mtimes, owner) as a Parquet file, written without external dependencies.
+ - Added --format csv and --output dir:<dir> with --partition-by host,date,target to write Hive-style partitioned Parquet/CSV data sets that accumulate across scans.
+ - Added --stream to publish one JSON message per directory to a NATS subject or Kafka topic (keyed by path).
+ - Case sensitivity is probed for every target instead of the first only, and snapshots record it per target.
+ - The collector dashboard drills down through directories with a treemap, sorts its tables, filters by size and age, and compares with an earlier report of a host.
+ - Added GET /api/events to the collector, server-sent events announcing every stored report; the dashboard reloads on them.
+ - The collector reloads renewed --tls-cert/--tls-key files (for example from an ACME client) without a restart.
+ - The collector patches the latest report of a host with a rescan of some of its directories (POST /ingest?patch=1), to refresh one directory without a full scan.
+ - Added --run-as to the collector, which switches to an unprivileged user once it listens and has read its TLS key, so it can be started as root to bind a port below 1024.
+ - Added the offline build tag (go build -tags offline .), which leaves the upload, sink, trace, ticket and collector code out of the binary; the report store and history moved to history.go.
+ - Split the source into files of package main (arguments, reports, subcommands, exports, sinks, collector, snapshots); build the directory (go build .) instead of find_heavy_dirs.go.
+ - Added --budget <dir>=<size> (dirs_over_budget) and, for check, --ticket github:<owner>/<repo> or jira:<project> to open an issue per directory over budget, or comment on its open issue, with the largest subdirectories.
+ - Added --throttle <N> (entries per second) with --full-speed <HH:MM-HH:MM> windows, so scans and watch rounds only run at full speed at night.
+ - diff (and watch) lists moved or renamed directories, matched by totals and modification times or by fingerprint, instead of as removed and new.
+ - --strict-read-only also rejects --zfs and --reconcile and leaves the df capacities out of the JSON summary, since they run zfs and df.
+ - The collector compares tokens in constant time and only accepts uploads within the paths of a user scoped with "paths".
+ - The collector sets read timeouts, takes --tls-cert/--tls-key for https and without them only listens on a loopback address; uploads are decoded while they are received, with limits on the compressed and decompressed size and on the number of concurrent uploads.
+ - Added --strict-read-only, which rejects every option and subcommand that writes files or runs other programs, disables the pager and opens the scanned directories and files with O_NOATIME on Linux where permitted.
+ - Added --departments <file.csv>, a report of the directories right below each path (departments of a shared drive) with their owner from .owner, an owner tag or the directory owner, their size and last activity, written to a CSV file with per-owner totals.
+ - Added --versioned-files, a report of file families that differ only by version markers (v3, final, copy, (1), years and dates) with the space held by all but the newest version.
+ - dupes also lists archives kept next to their extraction (foo.tar.gz and foo/ of matching content size).
+ - Added the dupes subcommand, listing duplicated directory trees with the space reclaimable by keeping one copy.
+ - Added --precision, --round and --exact-bytes for displayed sizes; chart and graph tooltips show the exact size.
+ - Added --locale for thousands and decimal separators in the human-readable output.
+ - Added the fs-analyzer subcommands (scan, serve, check, diff, watch); find_heavy_dirs keeps its options and subcommands as before.
+ - Added --format dot, the heavy part of the tree as a Graphviz graph (pruned with --dot-min-size).
+ - Added --chart, drawing the directory tree as an SVG sunburst or flame graph, or as collapsed stacks for speedscope.
+ - Added --format pdf, a paginated report with the summary, a treemap, both rankings and (with --store) a trend chart.
+ - Added --template to render the report through a Go text or HTML template with the summary, rankings and every reported directory.
+ - Added the history subcommand (prune, compact) to thin out a collector store by day, week and month.
+ - Added --offline and offline builds (-X main.offlineBuild=true) that refuse every network connection, for air-gapped hosts.
+ - Added --sign-key to sign snapshots, summary files and exports (Ed25519, detached .sig files) and the verify-report subcommand to check them.
+ - Added --path-template to extract labels (team, project, ...) from paths, with usage per label and label combination and label columns in the exports.
+ - Added --group-by-component <N> to report usage per name of the Nth path component (e.g. per tenant).
+ - Added --relative to show the paths of the rankings relative to their scan root.
+ - Added --all to list every directory in the rankings, --min-size to leave out small directories, and paging of --all output through $PAGER on a terminal (--no-pager).
+ - Added file system capacities to the JSON summary (df size, used, available, reserved blocks and percentage, metadata overhead against the device size, usable space), also shown by --reconcile.
+ - Added --reconcile, which compares the scanned space of every file system with df and itemizes the difference (directories, hard links, deleted open files, unscanned or excluded areas, reserved blocks).
+ - Added --deleted-open (Linux), which finds deleted files still held open through /proc/<pid>/fd and reports their space per process, original directory and file.
+ - Added --special-files, a report of sockets, FIFOs and device nodes per directory with their newest modification times.
+ - Added --symlinks, a report of symbolic links grouped by target and counted per directory, flagging broken links and links pointing outside the scanned roots.
+ - Added --rewrite '<regexp>=<path>' rules that rename leading path parts (e.g. numbered mount points) in all reports, exports, streams and uploads, so scans of equivalent mounts line up.
+ - Added --access to the collector: per-team tokens with admin, viewer or uploader roles, limited to host name patterns and path prefixes in queries and the dashboard.
+ - Added the collector subcommand, which receives --upload reports into a directory store and serves fleet-wide JSON queries (hosts, history, largest directories) and an HTML dashboard.
+ - Added --upload (with --upload-header and --upload-retries) to POST each scan's summary and directories as gzip-compressed JSON to a central collector, retrying with backoff.
+ - Added --post-hook to run site automation after a scan, with the JSON summary on stdin and totals, violations, snapshot and output file in FS_ANALYZER_* variables.
+ - Added --analyzer to plug in site-specific reports: a command gets every directory as JSON lines and returns named report sections (lines or tables) printed after the built-in reports.
+ - Added directory tags (tag subcommand, --tags): owner, ticket, do-not-delete and notes kept in a sidecar file, shown in reports and exports and saved in snapshots.
+ - Added --assume-immutable <dir>=<snapshot>, which takes read-only areas (WORM archives) from a saved snapshot instead of walking them.
+ - Added --progressive, which lists the first-level subdirectories with their entry counts right away and updates their sizes in place while the scan runs.
+ - Added --max-memory, a soft limit near which the deepest directories are folded into their ancestors (with a note listing the affected subtrees) instead of risking the OOM killer.
+ - Added --resource-usage, which reports the scanner's peak RSS, CPU time, read/write syscalls and GC pauses (also in the --summary-fd JSON).
+ - Added --regenerable, a report of derived files (thumbnails, transcodes, bytecode, source maps, object files, minified and precompressed copies) whose source is in the same tree.
+ - Added the mail subcommand for Maildir and mbox trees: mailbox sizes, message and unread counts, attachments by extension and the oldest unread mail.
+ - Added the databases subcommand, which recognizes PostgreSQL, MySQL/InnoDB, MongoDB, RocksDB/LevelDB and SQLite databases and splits out their WAL/log and temporary space.
+ - Added the git-repos subcommand, which compares .git and checkout sizes, lists the largest pack files and flags candidates for git gc or shallow clones.
+ - Added the dev subcommand, which totals build artifacts (target/, build/, dist/, node_modules, .gradle, DerivedData, Python venvs, Go caches) per category and per repository.
+ - Added --temp-files <age>, a report of old editor backups, swap files, partial downloads and temp/upload-chunk directories per directory with a reclaim estimate.
+ - Added --crash-dumps, a report of core dumps (ELF-verified), minidumps, JVM crash logs and heap dumps with totals per kind, ages and the largest files.
+ - Added the logs subcommand: groups rotated log families (app.log, app.log.1, app.log.2.gz, dated copies), flags unrotated, uncompressed and long-kept logs and estimates the space compression would reclaim.
+ - Added the heavy-files-by-type subcommand: video/image/audio files by category and format (extension or magic bytes), the largest media files and the directories holding the most media.
+ - Added detection of cross-OS mounts (WSL drvfs/9p, VM shared folders): they are scanned with apparent sizes and can be skipped with --skip-cross-os.
+ - Added --summary-fd <N> and --summary-file <file> for a one-line JSON summary (totals, duration, unreadable entries, threshold violations) for wrapper scripts.
+ - Added --save <file> and --load <file> to keep the aggregated scan in a snapshot and re-render reports from it (other top N, --where, formats) without rescanning.
+ - Added --where <cond> to filter the reported directories with comparisons, &&/||/!, size literals (10GB) and regular expression matches on path and owner.
+ - Added --add-column 'name = expr' for computed columns (arithmetic over the export fields) in the tables, CSV/Parquet exports and stream messages.
+ - Added --permissions, a report of group/other-writable and setuid/setgid files, world-writable directories without sticky bit and the widest mode per directory.
+ - Added --only-mine [uid] to count only the files of the invoking user (or uid) and skip other users' unreadable directories quietly.
+ - Added --gogc and --memory-limit to tune the garbage collector on giant scans, and removed per-file overhead from the walk (path re-cleaning, reflective stat field lookups, repeated size computation).
+ - Added --slowest <N>, a report of the directories with the highest scan time per entry (excluding subdirectories), to spot failing disks, slow NFS exports and antivirus interference.
+ - Added --fingerprint (and --fingerprint-content) to compute a Merkle-style hash per directory, included in the Parquet/CSV exports and stream messages, so moved or renamed subtrees can be recognized.
+ - Added the plan-copy subcommand to split the targets into N shards of about equal bytes or file count, with a path list per shard for parallel copy workers.
+ - Added --target-fs ntfs|exfat|fat32|apfs|ext4 to report, per directory, entries that would break on the target file system before a migration.
+ - Added --name-audit to count problematic names per directory (invalid UTF-8, control characters, trailing space/dot, Windows device names, case collisions) before migrations.
+ - Added --path-lengths to report the deepest nesting levels and the longest paths, with counts over MAX_PATH, PATH_MAX and NAME_MAX.
+ - Added a report of directories with more than --entry-limit direct entries (default 100000), which degrade ext4/NFS performance regardless of their size.
+ - The scanner now walks an fs.FS (os.DirFS for targets), so it can run over in-memory trees and other virtual sources; a target that is a symbolic link to a directory is now scanned instead of being counted as one entry.
+ - Added the backup-gap subcommand to rank local directories by bytes missing from (or changed since) a restic, borg or tar backup listing.
+ - Added --emit-exclude-file rsync|borg|restic (with --exclude-older-than and --exclude-larger-than) to generate backup exclude lists from the scan.
+ - Added the simulate-retention subcommand to report the space "delete <glob> older than <age>" and "keep <N> newest per directory" rules would reclaim, without deleting anything.
+ - Added --name-patterns to rank generated file name families (numbers, dates and ids replaced by *) by size and count.
+ - Added --sample to walk a deterministic share of the subtrees at depth 2 and extrapolate totals with 95% confidence intervals.
+
 2026-04-15:
  - Added --size-mode (disk|apparent). Default is disk, with Windows currently falling back to apparent.
  - disk mode now uses allocated blocks (Stat_t.Blocks * 512) to better align with du output on Unix-like systems.
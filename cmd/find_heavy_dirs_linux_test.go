@@ -0,0 +1,161 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func atime(t *testing.T, name string) time.Time {
+	t.Helper()
+	var st syscall.Stat_t
+	if err := syscall.Stat(name, &st); err != nil {
+		t.Fatal(err)
+	}
+	return time.Unix(st.Atim.Unix())
+}
+
+// Under --strict-read-only listing the tree, reading a file and reading the zip directory of an
+// archive (dupes) leave the access times alone
+func TestStrictReadOnlyKeepsAccessTimes(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "docs")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, ".owner")
+	if err := os.WriteFile(file, []byte("records\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(root, "docs.zip")
+	out, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(out)
+	if w, err := zw.Create(".owner"); err != nil {
+		t.Fatal(err)
+	} else {
+		w.Write([]byte("records\n"))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+
+	// Access times two days back are updated by any read, even under relatime
+	old := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	setOld := func() {
+		for _, name := range []string{dir, file, archive} {
+			if err := os.Chtimes(name, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	setOld()
+	if _, err := os.ReadFile(file); err != nil {
+		t.Fatal(err)
+	}
+	if atime(t, file).Equal(old) {
+		t.Skip("the file system does not record access times (noatime)")
+	}
+	setOld()
+
+	oldStrict := strictReadOnly
+	t.Cleanup(func() { strictReadOnly = oldStrict })
+	strictReadOnly = true
+	resetScan(t)
+	scanDirectory(root)
+	if data, err := readMarkerFile(file); err != nil || string(data) != "records\n" {
+		t.Fatalf("readMarkerFile: %q, %v", data, err)
+	}
+	if size, files, _, ok := archiveContent(archiveFile{Path: archive, Ext: ".zip"}); !ok || size != 8 || files != 1 {
+		t.Fatalf("archiveContent: %d bytes in %d files (ok %v), want 8 in 1", size, files, ok)
+	}
+
+	for _, name := range []string{dir, file, archive} {
+		if got := atime(t, name); !got.Equal(old) {
+			t.Errorf("%s: access time changed to %v", name, got)
+		}
+	}
+}
+
+// Content is only read from regular files: a FIFO would block the scan until a writer appears,
+// and a symbolic link may lead to a device that never ends
+func TestOpenScannedFileRefusesSpecialFiles(t *testing.T) {
+	dir := t.TempDir()
+	fifo := filepath.Join(dir, "mbox")
+	if err := syscall.Mkfifo(fifo, 0o644); err != nil {
+		t.Skip("cannot create a FIFO:", err)
+	}
+	link := filepath.Join(dir, "zero")
+	if err := os.Symlink("/dev/zero", link); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, []byte("From "), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, name := range []string{fifo, link} {
+			if f, err := openScannedFile(name); err != errNotRegular {
+				if f != nil {
+					f.Close()
+				}
+				t.Errorf("%s: error %v, want errNotRegular", name, err)
+			}
+		}
+		if f, err := openScannedFile(file); err != nil {
+			t.Errorf("regular file: %v", err)
+		} else {
+			f.Close()
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("openScannedFile blocked on a special file")
+	}
+}
+
+func TestCaseRootsPerTarget(t *testing.T) {
+	oldFold, oldRoots := caseInsensitivePaths, caseRoots
+	t.Cleanup(func() { caseInsensitivePaths, caseRoots = oldFold, oldRoots })
+
+	// Both targets are probed: a case-sensitive temporary directory first, then /
+	dir := t.TempDir()
+	caseInsensitivePaths = true
+	detectCaseRoots([]string{dir, "/"})
+	if len(caseRoots) != 2 || caseRoots[0].Path != dir || caseRoots[0].Fold {
+		t.Fatalf("caseRoots = %+v, want %s first and case-sensitive", caseRoots, dir)
+	}
+
+	// A mounted case-insensitive volume next to case-sensitive targets
+	caseInsensitivePaths = false
+	caseRoots = []caseRoot{{"/mnt/Win", true}, {"/home", false}}
+	for p, want := range map[string]string{
+		"/mnt/Win/Temp":  "/mnt/win/temp",
+		"/MNT/win/temp":  "/mnt/win/temp",
+		"/mnt/Win":       "/mnt/win",
+		"/mnt/Windows/X": "/mnt/Windows/X", // Not below /mnt/Win
+		"/home/Bob":      "/home/Bob",
+		"/srv/Data":      "/srv/Data", // Outside the targets: the default
+	} {
+		if got := normalizePath(p); got != want {
+			t.Errorf("normalizePath(%q) = %q, want %q", p, got, want)
+		}
+	}
+
+	oldExcludes := excludePaths
+	t.Cleanup(func() { excludePaths = oldExcludes })
+	excludePaths = []string{"/mnt/win/TEMP", "/home/bob"}
+	if !isExcluded("/mnt/WIN/temp/a") || isExcluded("/home/Bob/a") {
+		t.Errorf("exclusions fold case below the case-insensitive target only")
+	}
+}
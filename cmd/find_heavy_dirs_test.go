@@ -0,0 +1,724 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// resetScan starts a test with no statistics in apparent size mode and restores the mode after it
+func resetScan(t *testing.T) {
+	oldMode := sizeMode
+	t.Cleanup(func() {
+		sizeMode = oldMode
+		dirStats = make(map[string]*DirStat)
+	})
+	sizeMode = "apparent"
+	dirStats = make(map[string]*DirStat)
+}
+
+// scanTestFS scans fsys as root and aggregates the totals
+func scanTestFS(t *testing.T, fsys fstest.MapFS, root string) {
+	resetScan(t)
+	scanFS(fsys, root)
+	aggregateStats()
+}
+
+func TestScanFSAggregates(t *testing.T) {
+	root := filepath.FromSlash("/srv/data")
+	scanTestFS(t, fstest.MapFS{
+		"a.txt":             {Data: make([]byte, 100)},
+		"logs/app.log":      {Data: make([]byte, 1000)},
+		"logs/old/app.log":  {Data: make([]byte, 2000)},
+		"logs/old/app.log1": {Data: make([]byte, 3000)},
+		"media/clip.mp4":    {Data: make([]byte, 50000)},
+		"empty":             {Mode: fs.ModeDir},
+	}, root)
+
+	tests := []struct {
+		dir             string
+		size, files     int64
+		ownSize, ownCnt int64
+	}{
+		{"", 56100, 5, 100, 1},
+		{"logs", 6000, 3, 1000, 1},
+		{"logs/old", 5000, 2, 5000, 2},
+		{"media", 50000, 1, 50000, 1},
+		{"empty", 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(root, filepath.FromSlash(tt.dir))
+		s, ok := dirStats[path]
+		if !ok {
+			t.Errorf("%s: not recorded", path)
+			continue
+		}
+		if s.TotalSize != tt.size || s.FileCount != tt.files {
+			t.Errorf("%s: size %d, files %d; want %d, %d", path, s.TotalSize, s.FileCount, tt.size, tt.files)
+		}
+		if s.OwnSize != tt.ownSize || s.OwnFiles != tt.ownCnt {
+			t.Errorf("%s: own size %d, own files %d; want %d, %d", path, s.OwnSize, s.OwnFiles, tt.ownSize, tt.ownCnt)
+		}
+	}
+	if s := dirStats[filepath.Join(root, "logs", "old")]; s != nil && s.Depth != 2 {
+		t.Errorf("logs/old: depth %d, want 2", s.Depth)
+	}
+}
+
+func TestScanFSExclude(t *testing.T) {
+	root := filepath.FromSlash("/srv/data")
+	old := excludePaths
+	t.Cleanup(func() { excludePaths = old })
+	excludePaths = []string{filepath.Join(root, "cache")}
+	scanTestFS(t, fstest.MapFS{
+		"keep/a":  {Data: make([]byte, 10)},
+		"cache/b": {Data: make([]byte, 20)},
+	}, root)
+
+	if s := dirStats[root]; s == nil || s.TotalSize != 10 || s.FileCount != 1 {
+		t.Errorf("root: %+v, want 10 bytes in 1 file", s)
+	}
+	if _, ok := dirStats[filepath.Join(root, "cache")]; ok {
+		t.Error("excluded directory was recorded")
+	}
+}
+
+// A node_modules-style tree whose paths pass MAX_PATH (260 characters) is walked completely; on
+// Windows this relies on the \\?\ prefix the os package adds to long absolute paths.
+func TestScanDirectoryDeepTree(t *testing.T) {
+	root := t.TempDir()
+	dir := root
+	for i := 0; i < 12; i++ {
+		dir = filepath.Join(dir, "node_modules", fmt.Sprintf("package-with-a-long-name-%02d", i))
+	}
+	if len(dir) < 300 {
+		t.Fatalf("test tree too shallow: %d characters", len(dir))
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.js"), make([]byte, 1234), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "package.json"), make([]byte, 100), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	resetScan(t)
+	scanDirectory(root)
+	aggregateStats()
+
+	s := dirStats[filepath.Clean(root)]
+	if s == nil || s.TotalSize != 1334 || s.FileCount != 2 || s.Inaccessible != 0 {
+		t.Fatalf("root: %+v, want 1334 bytes in 2 files and nothing inaccessible", s)
+	}
+	if d := dirStats[dir]; d == nil || d.OwnSize != 1234 || d.Depth != 24 {
+		t.Errorf("deepest directory: %+v, want 1234 bytes at depth 24", d)
+	}
+}
+
+func TestFindMoves(t *testing.T) {
+	dir := func(path string, size, files, own, ownFiles int64) *DirStat {
+		return &DirStat{Path: filepath.FromSlash(path), TotalSize: size, FileCount: files, OwnSize: own, OwnFiles: ownFiles, NewestMtime: 1700000000 + size, OldestMtime: 1600000000}
+	}
+	oldSnap := &snapshot{Dirs: []*DirStat{
+		dir("/data", 3500, 5, 0, 0),
+		dir("/data/proj", 3000, 3, 0, 0),
+		dir("/data/proj/src", 3000, 3, 3000, 3),
+		dir("/data/gone", 500, 2, 500, 2),
+	}}
+	newSnap := &snapshot{Dirs: []*DirStat{
+		dir("/data", 3000, 3, 0, 0),
+		dir("/data/archive", 3000, 3, 0, 0),
+		dir("/data/archive/proj-2025", 3000, 3, 0, 0),
+		dir("/data/archive/proj-2025/src", 3000, 3, 3000, 3),
+	}}
+	under := func(string) bool { return true }
+
+	moves := findMoves(oldSnap, newSnap, under)
+	if len(moves) != 1 {
+		t.Fatalf("got %d moves, want 1: %+v", len(moves), moves)
+	}
+	if m := moves[0]; m.From != filepath.FromSlash("/data/proj") || m.To != filepath.FromSlash("/data/archive/proj-2025") || m.Size != 3000 || m.Files != 3 {
+		t.Errorf("move: %+v", m)
+	}
+}
+
+func TestDayWindows(t *testing.T) {
+	windows, err := parseDayWindows("01:00-05:00, 22:30-00:15")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		at   string
+		full bool
+	}{
+		{"00:59", false}, {"01:00", true}, {"04:59", true}, {"05:00", false},
+		{"12:00", false}, {"22:30", true}, {"23:59", true}, {"00:10", true}, {"00:15", false},
+	} {
+		at, _ := time.Parse("15:04", tt.at)
+		if got := inDayWindows(windows, at); got != tt.full {
+			t.Errorf("%s: full speed %v, want %v", tt.at, got, tt.full)
+		}
+	}
+	for _, bad := range []string{"01:00", "01:00-01:00", "1h-2h"} {
+		if _, err := parseDayWindows(bad); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+}
+
+func TestSampleExtrapolation(t *testing.T) {
+	root := filepath.FromSlash("/srv/data")
+	oldRate := sampleRate
+	t.Cleanup(func() {
+		sampleRate = oldRate
+		sampledRoots = make(map[string]bool)
+		skippedRoots = make(map[string]bool)
+		sampleCandidates = make(map[string]int)
+	})
+	sampleRate = 0.5
+	sampledRoots = make(map[string]bool)
+	skippedRoots = make(map[string]bool)
+	sampleCandidates = make(map[string]int)
+
+	// Candidate subtrees (depth 2): "deep" only gets skipped ones, "wide" a mix
+	fsys := fstest.MapFS{"deep/own.txt": {Data: make([]byte, 7)}}
+	var wideSampled, wideSkipped, deepSkipped int
+	for i := 0; wideSampled < 3 || wideSkipped < 3 || deepSkipped < 2; i++ {
+		name := fmt.Sprintf("s%03d", i)
+		if isSampled(filepath.Join(root, "wide", name)) {
+			if wideSampled < 3 {
+				fsys["wide/"+name+"/f"] = &fstest.MapFile{Data: make([]byte, 100)}
+				wideSampled++
+			}
+		} else if wideSkipped < 3 {
+			fsys["wide/"+name+"/f"] = &fstest.MapFile{Data: make([]byte, 100)}
+			wideSkipped++
+		}
+		if !isSampled(filepath.Join(root, "deep", name)) && deepSkipped < 2 {
+			fsys["deep/"+name+"/f"] = &fstest.MapFile{Data: make([]byte, 100)}
+			deepSkipped++
+		}
+	}
+	scanTestFS(t, fsys, root)
+
+	// Each sampled subtree (100 bytes, 1 file) stands for 1/0.5 = 2 subtrees
+	wide := dirStats[filepath.Join(root, "wide")]
+	if wide == nil || !wide.Estimated || wide.TotalSize != 600 || wide.FileCount != 6 {
+		t.Fatalf("wide: %+v, want an estimate of 600 bytes in 6 files", wide)
+	}
+	// (1-p)/p times the mean squared total, for each of the 6 candidates
+	if wide.SizeVariance != 6*100*100 || wide.CountVariance != 6 {
+		t.Errorf("wide: variances %v, %v; want %v, %v", wide.SizeVariance, wide.CountVariance, 6*100*100, 6)
+	}
+	deep := dirStats[filepath.Join(root, "deep")]
+	if deep == nil || !deep.Estimated || deep.TotalSize != 7 || deep.SizeVariance == 0 {
+		t.Errorf("deep: %+v, want an estimate of 7 bytes with a variance (all subtrees skipped)", deep)
+	}
+	top := dirStats[root]
+	if top == nil || !top.Estimated || top.TotalSize != 607 || top.FileCount != 7 {
+		t.Errorf("root: %+v, want an estimate of 607 bytes in 7 files", top)
+	}
+	if n := sampleCandidates[root]; n != 8 {
+		t.Errorf("%d candidates, want 8", n)
+	}
+}
+
+func TestCompileExpr(t *testing.T) {
+	// String matches see the path as a plain string, so the test path needs no conversion
+	dir := &DirStat{Path: "/srv/data/logs", TotalSize: 3 << 30, FileCount: 40, OwnSize: 1024, OwnFiles: 4, Depth: 2}
+	tests := []struct {
+		src  string
+		want float64
+	}{
+		// Precedence: * / % before + -, before comparisons, before !, &&, ||
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"2 * 3 % 4", 2},
+		{"-2 * -3", 6},
+		{"1 + 2 < 4", 1},
+		{"1 || 0 && 0", 1},
+		{"(1 || 0) && 0", 0},
+		{"!0 && !1", 0},
+		{"!(1 > 2)", 1},
+		{"files / own_files", 10},
+		{"size > 2GB && depth == 2", 1},
+		// Numbers and unit suffixes (binary, like formatBytes)
+		{"1e3", 1000},
+		{"1.5K", 1536},
+		{"10KB", 10240},
+		{"2KiB", 2048},
+		{"3G == size", 1},
+		{"own_size == 1k", 1},
+		// String matches on the path
+		{`path == "/srv/data/logs"`, 1},
+		{`path != '/srv/data/logs'`, 0},
+		{`path =~ "logs$"`, 1},
+		{`path =~ '^/srv/(data|www)/'`, 1},
+		{`path !~ "tmp"`, 1},
+		{`PATH =~ "data" && files >= 40`, 1},
+	}
+	for _, tt := range tests {
+		eval, err := compileExpr(tt.src)
+		if err != nil {
+			t.Errorf("%q: %v", tt.src, err)
+			continue
+		}
+		if got := eval(dir); got != tt.want {
+			t.Errorf("%q = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+
+	if eval, err := compileExpr("own_size / 0"); err != nil || !math.IsInf(eval(dir), 1) {
+		t.Errorf("own_size / 0: %v, want +Inf", err)
+	}
+	for _, src := range []string{
+		"", "   ", "1 +", "* 2", "(1 + 2", "1 + 2)", "()", "size >", "size > > 1",
+		"unknown_field > 1", "10XB", "1.2.3", "size $ 2", `"text"`, `'unterminated`, `path`,
+		`path > "a"`, `path == size`, `path =~ "("`, `owner ==`, "!", "size files",
+		"1 < 2 == 1", // Comparisons do not chain
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%q: panic %v", src, r)
+				}
+			}()
+			if _, err := compileExpr(src); err == nil {
+				t.Errorf("%q: no error", src)
+			}
+		}()
+	}
+}
+
+func TestParseAddColumn(t *testing.T) {
+	c, err := parseAddColumn("avg_file = size / files")
+	if err != nil || c.Name != "avg_file" {
+		t.Fatalf("parseAddColumn: %+v, %v", c, err)
+	}
+	if got := c.Eval(&DirStat{TotalSize: 100, FileCount: 4}); got != 25 {
+		t.Errorf("avg_file = %v, want 25", got)
+	}
+	for _, def := range []string{"size = 1", "path = 1", "1x = 2", "= size", "no_expression =", "no_equals"} {
+		if _, err := parseAddColumn(def); err == nil {
+			t.Errorf("%q: no error", def)
+		}
+	}
+}
+
+// thriftReader decodes Thrift compact protocol values into maps keyed by field id, enough to check Parquet metadata
+type thriftReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (t *thriftReader) varint() int64 {
+	v, err := binary.ReadUvarint(t.r)
+	if err != nil && t.err == nil {
+		t.err = err
+	}
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (t *thriftReader) value(typ byte) any {
+	switch typ {
+	case 1, 2:
+		return typ == 1
+	case 3:
+		b, err := t.r.ReadByte()
+		if err != nil && t.err == nil {
+			t.err = err
+		}
+		return int64(b)
+	case 4, thriftI32, thriftI64:
+		return t.varint()
+	case 7:
+		var f float64
+		if err := binary.Read(t.r, binary.LittleEndian, &f); err != nil && t.err == nil {
+			t.err = err
+		}
+		return f
+	case thriftBinary:
+		n, err := binary.ReadUvarint(t.r)
+		if err != nil || n > uint64(t.r.Len()) {
+			if t.err == nil {
+				t.err = fmt.Errorf("bad binary length %d", n)
+			}
+			return nil
+		}
+		b := make([]byte, n)
+		t.r.Read(b)
+		return b
+	case thriftList:
+		h, err := t.r.ReadByte()
+		if err != nil {
+			t.err = err
+			return nil
+		}
+		size := int(h >> 4)
+		if size == 15 {
+			n, _ := binary.ReadUvarint(t.r)
+			size = int(n)
+		}
+		var list []any
+		for i := 0; i < size && t.err == nil; i++ {
+			list = append(list, t.value(h&0x0f))
+		}
+		return list
+	case thriftStruct:
+		return t.readStruct()
+	}
+	if t.err == nil {
+		t.err = fmt.Errorf("unknown thrift type %d", typ)
+	}
+	return nil
+}
+
+func (t *thriftReader) readStruct() map[int16]any {
+	fields := make(map[int16]any)
+	var lastID int16
+	for t.err == nil {
+		h, err := t.r.ReadByte()
+		if err != nil {
+			t.err = err
+			break
+		}
+		if h == 0 {
+			break
+		}
+		id := lastID + int16(h>>4)
+		if h>>4 == 0 {
+			id = int16(t.varint())
+		}
+		fields[id] = t.value(h & 0x0f)
+		lastID = id
+	}
+	return fields
+}
+
+func TestWriteParquetStructure(t *testing.T) {
+	for _, rows := range []int{0, 3} {
+		var list []*DirStat
+		for i := 0; i < rows; i++ {
+			list = append(list, &DirStat{Path: fmt.Sprintf("/srv/dir%d", i), TotalSize: int64(1000 * (i + 1)), FileCount: int64(i), Depth: 1})
+		}
+		var buf bytes.Buffer
+		if err := writeParquet(&buf, list); err != nil {
+			t.Fatalf("%d rows: %v", rows, err)
+		}
+		data := buf.Bytes()
+		if len(data) < 12 || string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+			t.Fatalf("%d rows: missing PAR1 magic", rows)
+		}
+		footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+		footerStart := len(data) - 8 - footerLen
+		if footerStart < 4 {
+			t.Fatalf("%d rows: footer length %d larger than the file", rows, footerLen)
+		}
+		tr := &thriftReader{r: bytes.NewReader(data[footerStart : len(data)-8])}
+		fm := tr.readStruct()
+		if tr.err != nil || tr.r.Len() != 0 {
+			t.Fatalf("%d rows: footer does not decode to its length: %v, %d bytes left", rows, tr.err, tr.r.Len())
+		}
+		if fm[3] != int64(rows) {
+			t.Errorf("%d rows: footer num_rows = %v", rows, fm[3])
+		}
+		schema, _ := fm[2].([]any)
+		groups, _ := fm[4].([]any)
+		if len(groups) != 1 {
+			t.Fatalf("%d rows: %d row groups", rows, len(groups))
+		}
+		group := groups[0].(map[int16]any)
+		chunks, _ := group[1].([]any)
+		if group[3] != int64(rows) || len(chunks) != len(schema)-1 || len(chunks) == 0 {
+			t.Fatalf("%d rows: row group has %v rows and %d chunks for %d schema elements", rows, group[3], len(chunks), len(schema))
+		}
+		next, uncompressed := int64(4), int64(0)
+		for i, c := range chunks {
+			chunk := c.(map[int16]any)
+			meta := chunk[3].(map[int16]any)
+			offset, size := chunk[2].(int64), meta[7].(int64)
+			if offset != next || meta[9] != offset || offset+size > int64(footerStart) {
+				t.Fatalf("%d rows: chunk %d at %d+%d, want %d and inside %d", rows, i, offset, size, next, footerStart)
+			}
+			if meta[5] != int64(rows) {
+				t.Errorf("%d rows: chunk %d has %v values", rows, i, meta[5])
+			}
+			page := &thriftReader{r: bytes.NewReader(data[offset : offset+size])}
+			header := page.readStruct()
+			if page.err != nil || int64(page.r.Len()) != header[3] {
+				t.Errorf("%d rows: chunk %d page header %v does not match the page (%v)", rows, i, header, page.err)
+			} else if dp := header[5].(map[int16]any); dp[1] != int64(rows) {
+				t.Errorf("%d rows: chunk %d page has %v values", rows, i, dp[1])
+			}
+			next = offset + size
+			uncompressed += meta[6].(int64)
+		}
+		if next != int64(footerStart) || group[2] != uncompressed {
+			t.Errorf("%d rows: chunks end at %d, footer at %d; total size %v, want %d", rows, next, footerStart, group[2], uncompressed)
+		}
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+
+	// Keys as written by openssl genpkey and openssl pkey -pubout
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "key.pem")
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+	der, err = x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubFile := filepath.Join(dir, "pub.pem")
+	os.WriteFile(pubFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o644)
+	loaded, err := loadSigningKey(keyFile)
+	if err != nil || !loaded.Equal(priv) {
+		t.Fatalf("loadSigningKey: %v", err)
+	}
+	for _, name := range []string{keyFile, pubFile} {
+		if key, err := loadVerifyKey(name); err != nil || !key.Equal(pub) {
+			t.Fatalf("loadVerifyKey(%s): %v", name, err)
+		}
+	}
+
+	oldKey := signKey
+	t.Cleanup(func() { signKey = oldKey })
+	signKey = loaded
+	report := filepath.Join(dir, "report.json")
+	content := []byte(`{"directories": []}`)
+	os.WriteFile(report, content, 0o644)
+	signFile(report)
+	sigData, err := os.ReadFile(report + ".sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := verifyFile(report, pub)
+	if err != nil {
+		t.Fatalf("verifyFile: %v", err)
+	}
+	if sig.KeyID != keyID(pub) || sig.Size != int64(len(content)) {
+		t.Errorf("signature = %+v", sig)
+	}
+
+	if _, err := verifyFile(report, otherPub); err == nil || !strings.Contains(err.Error(), "another key") {
+		t.Errorf("verifyFile with the wrong key: %v", err)
+	}
+
+	// One changed byte of the file
+	tampered := append([]byte(nil), content...)
+	tampered[2] ^= 1
+	os.WriteFile(report, tampered, 0o644)
+	if _, err := verifyFile(report, pub); err == nil || !strings.Contains(err.Error(), "modified") {
+		t.Errorf("verifyFile of a changed file: %v", err)
+	}
+	os.WriteFile(report, content, 0o644)
+
+	// One changed byte of the signature, and a changed signed field
+	var s signature
+	json.Unmarshal(sigData, &s)
+	raw, _ := base64.StdEncoding.DecodeString(s.Signature)
+	raw[0] ^= 1
+	s.Signature = base64.StdEncoding.EncodeToString(raw)
+	data, _ := json.Marshal(s)
+	os.WriteFile(report+".sig", data, 0o644)
+	if _, err := verifyFile(report, pub); err == nil || !strings.Contains(err.Error(), "altered") {
+		t.Errorf("verifyFile with a changed signature: %v", err)
+	}
+	json.Unmarshal(sigData, &s)
+	s.Host += "x"
+	data, _ = json.Marshal(s)
+	os.WriteFile(report+".sig", data, 0o644)
+	if _, err := verifyFile(report, pub); err == nil || !strings.Contains(err.Error(), "altered") {
+		t.Errorf("verifyFile with a changed host: %v", err)
+	}
+
+	os.WriteFile(report+".sig", sigData, 0o644)
+	if _, err := verifyFile(report, pub); err != nil {
+		t.Errorf("verifyFile after restoring the file and signature: %v", err)
+	}
+}
+
+// sortedStats returns the recorded directories sorted by path
+func sortedStats() []*DirStat {
+	list := make([]*DirStat, 0, len(dirStats))
+	for _, s := range dirStats {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return list
+}
+
+// relPath returns p relative to root with slashes, "." for root itself
+func relPath(root, p string) string {
+	rel, _ := filepath.Rel(root, p)
+	return filepath.ToSlash(rel)
+}
+
+func TestCollapseSingleChildChains(t *testing.T) {
+	root := filepath.FromSlash("/srv/data")
+	scanTestFS(t, fstest.MapFS{
+		"a/b/c/d/big.bin": {Data: make([]byte, 10000)},
+		"x/y/f":           {Data: make([]byte, 5000)},
+		"x/y/z/g":         {Data: make([]byte, 5000)},
+		"p/q1/f":          {Data: make([]byte, 3000)},
+		"p/q2/f":          {Data: make([]byte, 3000)},
+		"s/own":           {Data: make([]byte, 900)},
+		"s/t/f":           {Data: make([]byte, 100)},
+	}, root)
+
+	// Tails of the listed entries, "" for entries that are not a chain head
+	collapsed := collapseSingleChildChains(sortedStats())
+	got := make(map[string]string)
+	for _, s := range collapsed {
+		got[relPath(root, s.Path)] = ""
+		if s.ChainTail != "" {
+			got[relPath(root, s.Path)] = relPath(root, s.ChainTail)
+		}
+		if orig := dirStats[s.Path]; s.TotalSize != orig.TotalSize || s.FileCount != orig.FileCount {
+			t.Errorf("%s: totals %d/%d, want those of the chain head %d/%d", s.Path, s.TotalSize, s.FileCount, orig.TotalSize, orig.FileCount)
+		}
+	}
+	want := map[string]string{
+		".":     "",
+		"a":     "a/b/c/d", // Every level holds the same single file
+		"x":     "x/y",     // x/y/z holds only half of x/y
+		"x/y/z": "",
+		"p":     "", // Two subdirectories
+		"p/q1":  "",
+		"p/q2":  "",
+		"s":     "", // s/t holds a tenth of s
+		"s/t":   "",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("collapsed to %v, want %v", got, want)
+	}
+	for p, s := range dirStats {
+		if s.ChainTail != "" {
+			t.Errorf("%s: chain tail %s set on the recorded statistics", p, s.ChainTail)
+		}
+	}
+
+	// A chain whose head is filtered out starts at its first listed member
+	list := []*DirStat{dirStats[filepath.Join(root, "a", "b", "c")], dirStats[filepath.Join(root, "a", "b", "c", "d")]}
+	collapsed = collapseSingleChildChains(list)
+	if len(collapsed) != 1 || relPath(root, collapsed[0].ChainTail) != "a/b/c/d" {
+		t.Errorf("partial chain collapsed to %v", collapsed)
+	}
+}
+
+func TestSuppressDominatedAncestors(t *testing.T) {
+	oldTop := topN
+	t.Cleanup(func() { topN = oldTop })
+	topN = 4
+	root := filepath.FromSlash("/srv/data")
+	scanTestFS(t, fstest.MapFS{
+		"big/inner/huge.bin": {Data: make([]byte, 96000)},
+		"big/other.bin":      {Data: make([]byte, 4000)},
+		"logs/a.log":         {Data: make([]byte, 30000)},
+		"logs/b/x.log":       {Data: make([]byte, 20000)},
+		"media/m.bin":        {Data: make([]byte, 40000)},
+		"tmp/t":              {Data: make([]byte, 1000)},
+	}, root)
+
+	size := func(s *DirStat) int64 { return s.TotalSize }
+	list := sortedStats()
+	sort.SliceStable(list, func(i, j int) bool { return list[i].TotalSize > list[j].TotalSize })
+	var got []string
+	for _, s := range suppressDominatedAncestors(list, size) {
+		got = append(got, relPath(root, s.Path))
+	}
+	// big/inner holds 96% of big and replaces it; logs/b holds only 40% of logs
+	if want := ". big/inner logs media"; strings.Join(got, " ") != want {
+		t.Errorf("picked %v, want %s", got, want)
+	}
+
+	// Equal values may sort an ancestor after its descendant: only the descendant is picked
+	dup := []*DirStat{{Path: filepath.FromSlash("/d/sub"), TotalSize: 5000}, {Path: filepath.FromSlash("/d"), TotalSize: 5000}}
+	if picked := suppressDominatedAncestors(dup, size); len(picked) != 1 || picked[0] != dup[0] {
+		t.Errorf("equal ancestor: picked %v", picked)
+	}
+}
+
+func TestIsLogName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"app.log":               true,
+		"APP.LOG":               true,
+		"app.log.1":             true,
+		"app.log.12.gz":         true,
+		"app.log.gz":            true,
+		"app-2026-10-17.log":    true,
+		"app.log.2026-10-17":    true,
+		"messages-20261017":     true,
+		"syslog-20261017.gz":    true,
+		"access_2026-10-17_03":  true,
+		"messages":              false,
+		"syslog.1":              false,
+		"data.db":               false,
+		"backup.tar.gz":         false,
+		"report-2026-10-17.pdf": false,
+		"catalog.1":             false,
+		"logfile":               false,
+	} {
+		if got := isLogName(name); got != want {
+			t.Errorf("isLogName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestFingerprintFoldedDirs(t *testing.T) {
+	oldFingerprint, oldFold := fingerprint, foldDepth
+	t.Cleanup(func() { fingerprint, foldDepth, foldedDirs = oldFingerprint, oldFold, make(map[string]bool) })
+	fingerprint, foldDepth = true, 1
+	root := filepath.FromSlash("/srv/data")
+	fsys := fstest.MapFS{
+		"a/b/c/f": {Data: make([]byte, 100)},
+		"a/g":     {Data: make([]byte, 10)},
+	}
+	scanTestFS(t, fsys, root)
+	for _, dir := range []string{"a/b", "a/b/c"} {
+		if _, ok := dirStats[filepath.Join(root, filepath.FromSlash(dir))]; ok {
+			t.Errorf("%s: recorded although folded into a", dir)
+		}
+	}
+	a := dirStats[filepath.Join(root, "a")]
+	if a == nil || a.TotalSize != 110 {
+		t.Fatalf("a = %+v, want the 110 bytes of its subtree", a)
+	}
+
+	// The folded file still counts towards the fingerprint of a
+	before := a.Fingerprint
+	fsys["a/b/c/f"] = &fstest.MapFile{Data: make([]byte, 101)}
+	scanTestFS(t, fsys, root)
+	if dirStats[filepath.Join(root, "a")].Fingerprint == before {
+		t.Errorf("fingerprint of a unchanged after a folded file changed size")
+	}
+}
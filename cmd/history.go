@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// --- Report Store ---
+//
+// Reports of --upload are stored by the collector and maintained by the history subcommand, which
+// needs no network access.
+
+// uploadDocument is the body of an --upload request: the run summary and every reported directory
+// in the format of the stream messages
+type uploadDocument struct {
+	Summary     runSummary `json:"summary"`
+	Directories []dirEvent `json:"directories"`
+}
+
+// collectorHostRe matches the host names the store keeps a directory for
+var collectorHostRe = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+// readStoredReport reads a gzip-compressed report of the store
+func readStoredReport(name string) (*uploadDocument, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	var doc uploadDocument
+	if err := json.NewDecoder(zr).Decode(&doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// writeFileAtomic writes data to a temporary file next to name and renames it into place
+func writeFileAtomic(name string, data []byte) error {
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// --- History ---
+//
+// The history subcommand bounds the size of a collector store. Going back from each host's newest
+// report, the reports are grouped by day for the --keep-daily most recent days with reports, then
+// by ISO week for the --keep-weekly weeks before, then by month for the --keep-monthly months
+// before that; older reports are removed. "prune" keeps the newest report of each group, "compact"
+// merges each group into its newest report, which records the period it stands for.
+
+var (
+	historyArgs []string // prune or compact
+	keepDaily   = 0
+	keepWeekly  = 0
+	keepMonthly = 0
+	dryRun      = false
+)
+
+// storedReport is a report of the store, named by the start time of its scan
+type storedReport struct {
+	Base  string // Path without the .json.gz / .summary.json suffix
+	Start time.Time
+}
+
+// historyBucket is a day, week or month of a host's reports, newest first
+type historyBucket struct {
+	Period  string // 2026-10-17, 2026-W42 or 2026-10
+	Reports []storedReport
+}
+
+// compactInfo describes the scans merged into a compacted report
+type compactInfo struct {
+	Period       string `json:"period"`
+	From         string `json:"from"` // Start of the oldest merged scan
+	Scans        int    `json:"scans"`
+	MinTotalSize int64  `json:"min_total_size"`
+	MaxTotalSize int64  `json:"max_total_size"`
+}
+
+// historyBuckets groups a host's reports (newest first) by the keep rules and returns the
+// reports outside all of them.
+func historyBuckets(reports []storedReport) ([]historyBucket, []storedReport) {
+	rules := []struct {
+		keep   int
+		period func(t time.Time) string
+	}{
+		{keepDaily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{keepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{keepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	var buckets []historyBucket
+	i := 0
+	for _, rule := range rules {
+		n := 0
+		for i < len(reports) {
+			period := rule.period(reports[i].Start)
+			// The period formats differ, so a bucket of the previous rule never matches
+			if len(buckets) == 0 || buckets[len(buckets)-1].Period != period {
+				if n == rule.keep {
+					break
+				}
+				buckets = append(buckets, historyBucket{Period: period})
+				n++
+			}
+			buckets[len(buckets)-1].Reports = append(buckets[len(buckets)-1].Reports, reports[i])
+			i++
+		}
+	}
+	return buckets, reports[i:]
+}
+
+// mergeReports replaces the newest report of a bucket by the aggregate of all its reports: the
+// directories of the newest scan, and the range of total sizes and number of scans of the period.
+// With --maxdepth, deeper directories are dropped as well.
+func mergeReports(b historyBucket) error {
+	var merged *uploadDocument
+	info := compactInfo{Period: b.Period, MinTotalSize: math.MaxInt64}
+	for _, r := range b.Reports {
+		doc, err := readStoredReport(r.Base + ".json.gz")
+		if err != nil {
+			return fmt.Errorf("%s: %v", r.Base+".json.gz", err)
+		}
+		if merged == nil {
+			merged = doc
+		}
+		from, scans, minSize, maxSize := doc.Summary.Start, 1, doc.Summary.TotalSize, doc.Summary.TotalSize
+		if c := doc.Summary.Compacted; c != nil {
+			from, scans, minSize, maxSize = c.From, c.Scans, c.MinTotalSize, c.MaxTotalSize
+		}
+		info.From = from // Reports are newest first
+		info.Scans += scans
+		info.MinTotalSize = min(info.MinTotalSize, minSize)
+		info.MaxTotalSize = max(info.MaxTotalSize, maxSize)
+	}
+	merged.Summary.Compacted = &info
+	if maxDepth < 1000000 {
+		dirs := merged.Directories[:0]
+		for _, d := range merged.Directories {
+			if d.Depth <= maxDepth {
+				dirs = append(dirs, d)
+			}
+		}
+		merged.Directories = dirs
+	}
+
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	if err := json.NewEncoder(zw).Encode(merged); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	sumData, err := json.Marshal(merged.Summary)
+	if err != nil {
+		return err
+	}
+	base := b.Reports[0].Base
+	if err := writeFileAtomic(base+".json.gz", body.Bytes()); err != nil {
+		return err
+	}
+	return writeFileAtomic(base+".summary.json", sumData)
+}
+
+// runHistory implements "history prune|compact --store <dir>" for every host of the store
+func runHistory() {
+	action := historyArgs[0]
+	hostDirs, err := os.ReadDir(collectorStore)
+	if err != nil {
+		fmt.Printf("Error reading store %s: %v\n", collectorStore, err)
+		os.Exit(1)
+	}
+	var totalRemoved, totalMerged int
+	var totalFreed int64
+	for _, hd := range hostDirs {
+		if !hd.IsDir() || !collectorHostRe.MatchString(hd.Name()) {
+			continue
+		}
+		names, err := filepath.Glob(filepath.Join(collectorStore, hd.Name(), "*.summary.json"))
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		var reports []storedReport
+		for _, name := range names {
+			base := strings.TrimSuffix(name, ".summary.json")
+			start, err := time.Parse("20060102T150405Z", filepath.Base(base))
+			if err != nil {
+				continue // Not written by the collector
+			}
+			reports = append(reports, storedReport{base, start})
+		}
+		sort.Slice(reports, func(i, j int) bool { return reports[i].Start.After(reports[j].Start) })
+
+		buckets, remove := historyBuckets(reports)
+		merged := 0
+		for _, b := range buckets {
+			if len(b.Reports) == 1 {
+				continue
+			}
+			if action == "compact" {
+				if !dryRun {
+					if err := mergeReports(b); err != nil {
+						fmt.Printf("Warning: %s: could not compact %s: %v\n", hd.Name(), b.Period, err)
+						continue
+					}
+				}
+				merged += len(b.Reports) - 1
+				if verbose {
+					fmt.Printf("%s: %s: merged %d reports into %s\n", hd.Name(), b.Period, len(b.Reports), filepath.Base(b.Reports[0].Base))
+				}
+			}
+			remove = append(remove, b.Reports[1:]...)
+		}
+		var freed int64
+		for _, r := range remove {
+			for _, name := range []string{r.Base + ".json.gz", r.Base + ".summary.json"} {
+				if info, err := os.Stat(name); err == nil {
+					freed += info.Size()
+				}
+				if !dryRun {
+					if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+						fmt.Printf("Warning: %v\n", err)
+					}
+				}
+			}
+			if verbose {
+				fmt.Printf("%s: removed %s\n", hd.Name(), filepath.Base(r.Base))
+			}
+		}
+		fmt.Printf("%s: %d reports, %d kept (%d merged into them), %d removed, %s freed\n",
+			hd.Name(), len(reports), len(buckets), merged, len(remove)-merged, formatBytes(freed))
+		totalRemoved += len(remove) - merged
+		totalMerged += merged
+		totalFreed += freed
+	}
+	verb := "freed"
+	if dryRun {
+		verb = "would be freed (dry run, nothing was changed)"
+	}
+	fmt.Printf("\nTotal: %d reports merged, %d removed, %s %s.\n", totalMerged, totalRemoved, formatBytes(totalFreed), verb)
+	if !dryRun && totalRemoved+totalMerged > 0 {
+		fmt.Println("Note: Restart a running collector to reload the store.")
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// dropPrivileges is not available without Unix user IDs; run the collector as a service account
+func dropPrivileges(name string) error {
+	return fmt.Errorf("--run-as is not supported on %s", runtime.GOOS)
+}
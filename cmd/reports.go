@@ -0,0 +1,3385 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// --- Backup Exclude Files ---
+
+// cacheDirNames are directory names (lower case) that hold caches or temporary files only
+var cacheDirNames = map[string]bool{
+	".cache": true, "cache": true, "caches": true, "__pycache__": true, ".pytest_cache": true,
+	".mypy_cache": true, ".npm": true, ".gradle": true, "tmp": true, "temp": true, ".tmp": true,
+	".thumbnails": true, "thumbs": true,
+}
+
+// excludeReason tells why a directory belongs in the exclude list, or returns "" if it does not.
+// Caches and temp dirs match by name; --exclude-older-than and --exclude-larger-than must both
+// hold when both are given.
+func excludeReason(s *DirStat, now time.Time) string {
+	if cacheDirNames[strings.ToLower(filepath.Base(s.Path))] {
+		return "cache/temp directory, " + formatBytes(s.TotalSize)
+	}
+	if excludeAge == 0 && excludeSize == 0 {
+		return ""
+	}
+	if excludeAge > 0 && (s.NewestMtime == 0 || now.Sub(time.Unix(s.NewestMtime, 0)) < excludeAge) {
+		return ""
+	}
+	if excludeSize > 0 && s.TotalSize < excludeSize {
+		return ""
+	}
+	reason := formatBytes(s.TotalSize)
+	if excludeAge > 0 {
+		reason += ", unchanged since " + time.Unix(s.NewestMtime, 0).Format("2006-01-02")
+	}
+	return reason
+}
+
+// writeExcludeFile writes the directories matched by excludeReason as an rsync, borg or restic
+// exclude file to --output (or stdout). Nested matches are dropped, except that with only
+// --exclude-larger-than the deepest large directories are kept (every ancestor is larger too).
+func writeExcludeFile(list []*DirStat) error {
+	now := time.Now()
+	reasons := make(map[string]string)
+	for _, s := range list {
+		if r := excludeReason(s, now); r != "" {
+			reasons[s.Path] = r
+		}
+	}
+	sizeOnly := excludeSize > 0 && excludeAge == 0
+
+	var paths []string
+	for p := range reasons {
+		nested := false
+		for child, dir := p, filepath.Dir(p); dir != child && isUnderTargets(dir); child, dir = dir, filepath.Dir(dir) {
+			if _, ok := reasons[dir]; ok && !(sizeOnly && !cacheDirNames[strings.ToLower(filepath.Base(dir))]) {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			paths = append(paths, p)
+		}
+	}
+	if sizeOnly {
+		// Keep a large directory only if none of its subdirectories is large as well
+		var deepest []string
+		for _, p := range paths {
+			covered := false
+			for _, q := range paths {
+				if q != p && isPathEqualOrSubpath(normalizePath(q), normalizePath(p)) {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				deepest = append(deepest, p)
+			}
+		}
+		paths = deepest
+	}
+	sort.Strings(paths)
+
+	var out io.Writer = os.Stdout
+	if outputFile != "" {
+		file, err := os.Create(outputFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, "# %s exclude file generated by %s on %s\n", emitExclude, version, now.Format("2006-01-02 15:04"))
+	if emitExclude == "rsync" {
+		fmt.Fprintln(w, "# Patterns are anchored to the transfer root; use with --exclude-from and the target as source (with a trailing slash).")
+	}
+	lastTarget := ""
+	for _, p := range paths {
+		target := targetOf(p)
+		if emitExclude == "rsync" && target != lastTarget {
+			fmt.Fprintf(w, "\n# Target: %s\n", target)
+			lastTarget = target
+		}
+		fmt.Fprintf(w, "# %s\n", reasons[p])
+		switch emitExclude {
+		case "rsync":
+			rel, _ := filepath.Rel(target, p)
+			fmt.Fprintf(w, "/%s/\n", filepath.ToSlash(rel))
+		case "borg":
+			fmt.Fprintf(w, "pp:%s\n", p)
+		default:
+			fmt.Fprintln(w, p)
+		}
+	}
+	return w.Flush()
+}
+
+// --- Per-Directory File Tallies ---
+
+// fileTally counts a class of files directly in one directory (or, after rollUpTallies, below it)
+type fileTally struct {
+	Size   int64
+	Files  int64
+	Newest int64 // Newest modification time (Unix seconds)
+}
+
+func (t *fileTally) add(size, mtime int64) {
+	t.Size += size
+	t.Files++
+	if mtime > t.Newest {
+		t.Newest = mtime
+	}
+}
+
+// rollUpTallies adds every directory's own tally to all its ancestors up to the targets, like
+// aggregateStats does for sizes, so a report can rank whole subtrees.
+func rollUpTallies(own map[string]*fileTally) map[string]*fileTally {
+	total := make(map[string]*fileTally, len(own))
+	for dir, t := range own {
+		for p := dir; isUnderTargets(p); p = filepath.Dir(p) {
+			sum, ok := total[p]
+			if !ok {
+				sum = &fileTally{}
+				total[p] = sum
+			}
+			sum.Size += t.Size
+			sum.Files += t.Files
+			if t.Newest > sum.Newest {
+				sum.Newest = t.Newest
+			}
+			if filepath.Dir(p) == p {
+				break
+			}
+		}
+	}
+	return total
+}
+
+// printTallyDirectories prints the top N directories of a rolled-up tally, largest first. The
+// targets themselves are left out, as in the main rankings.
+func printTallyDirectories(title string, tallies map[string]*fileTally) {
+	type row struct {
+		Path string
+		*fileTally
+	}
+	var rows []row
+	for p, t := range tallies {
+		if !isExactTarget(p) {
+			rows = append(rows, row{p, t})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Size != rows[j].Size {
+			return rows[i].Size > rows[j].Size
+		}
+		return rows[i].Path < rows[j].Path
+	})
+	fmt.Printf("\n--- %s ---\n", title)
+	fmt.Printf("%-15s | %-15s | %-12s | %-50s\n", "Size", "Files", "Newest", "Path")
+	fmt.Println(strings.Repeat("-", 80))
+	for i, r := range rows {
+		if i >= topN {
+			break
+		}
+		fmt.Printf("%-15s | %-15s | %-12s | %s\n", formatBytes(r.Size), formatFiles(r.Files), formatDate(r.Newest), shownPath(r.Path))
+	}
+}
+
+// rankedFile is one of the largest files of a report
+type rankedFile struct {
+	Path  string
+	Size  int64
+	Mtime int64
+	Kind  string // Format or category shown next to the file
+}
+
+// topFiles keeps the N (--top) largest files, largest first
+type topFiles []rankedFile
+
+// add inserts f if it is among the N largest (insertion into a short sorted slice)
+func (t *topFiles) add(f rankedFile) {
+	list := *t
+	if len(list) >= topN && f.Size <= list[len(list)-1].Size {
+		return
+	}
+	i := sort.Search(len(list), func(i int) bool { return list[i].Size < f.Size })
+	list = slices.Insert(list, i, f)
+	if len(list) > topN {
+		list = list[:topN]
+	}
+	*t = list
+}
+
+// formatDate formats Unix seconds as a local date, "-" if unknown
+func formatDate(t int64) string {
+	if t <= 0 {
+		return "-"
+	}
+	return time.Unix(t, 0).Format("2006-01-02")
+}
+
+// --- Crash Artifacts ---
+
+// crashPatterns recognize crash artifacts by name; "core" files are confirmed by their ELF header
+// because the name alone (core.js, core.py) is ambiguous
+var crashPatterns = []struct {
+	Kind string
+	Re   *regexp.Regexp
+}{
+	{"JVM heap dump", regexp.MustCompile(`\.hprof$`)},
+	{"JVM crash log", regexp.MustCompile(`^(hs_err|replay)_pid\d+\.log$`)},
+	{"minidump", regexp.MustCompile(`(?i)\.(dmp|mdmp)$`)},
+	{"crash report", regexp.MustCompile(`\.(crash|ips)$`)},
+	{"core dump", regexp.MustCompile(`^core\.[^.]+\.\d+\.[0-9a-f]{32}\.\d+\.\d+(\.(zst|lz4|xz))?$|\.core$`)}, // systemd-coredump, BSD
+	{"core dump?", regexp.MustCompile(`^core(\.\d+)?$`)},                                                     // Linux kernel.core_pattern defaults, checked below
+}
+
+var (
+	crashByKind  = make(map[string]*fileTally)
+	crashOldest  = make(map[string]int64)
+	crashLargest topFiles
+)
+
+// noteCrashFile checks whether a file is a crash artifact (--crash-dumps). Plain "core" files are
+// only counted if they are ELF core files (or unreadable, e.g. root-owned 0600 cores).
+func noteCrashFile(path string, size, mtime int64, canRead bool) {
+	name := filepath.Base(path)
+	kind := ""
+	for _, p := range crashPatterns {
+		if p.Re.MatchString(name) {
+			kind = p.Kind
+			break
+		}
+	}
+	if kind == "core dump?" {
+		if canRead && !isELFCore(path) {
+			return
+		}
+		kind = "core dump"
+	}
+	if kind == "" {
+		return
+	}
+	if crashByKind[kind] == nil {
+		crashByKind[kind] = &fileTally{}
+	}
+	crashByKind[kind].add(size, mtime)
+	if old, ok := crashOldest[kind]; !ok || mtime < old {
+		crashOldest[kind] = mtime
+	}
+	crashLargest.add(rankedFile{path, size, mtime, kind})
+}
+
+// isELFCore reports whether the file is an ELF file of type ET_CORE. It returns true if the
+// file cannot be read, since cores are usually written with mode 0600, and false for anything
+// but a regular file (a FIFO named core would block the scan).
+func isELFCore(path string) bool {
+	f, err := openScannedFile(path)
+	if errors.Is(err, errNotRegular) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	defer f.Close()
+	var h [18]byte
+	if _, err := io.ReadFull(f, h[:]); err != nil || string(h[:4]) != "\x7fELF" {
+		return false
+	}
+	var etype uint16
+	if h[5] == 2 { // EI_DATA: big endian
+		etype = binary.BigEndian.Uint16(h[16:])
+	} else {
+		etype = binary.LittleEndian.Uint16(h[16:])
+	}
+	return etype == 4 // ET_CORE
+}
+
+// printCrashArtifacts lists crash artifacts by kind and the largest of them with their age. They
+// are always safe to clean up once the crash has been looked at.
+func printCrashArtifacts() {
+	host, _ := os.Hostname()
+	if len(crashByKind) == 0 {
+		fmt.Printf("\nNo crash artifacts (core dumps, minidumps, JVM crash logs or heap dumps) found on %s.\n", host)
+		return
+	}
+	kinds := make([]string, 0, len(crashByKind))
+	var total fileTally
+	for k, t := range crashByKind {
+		kinds = append(kinds, k)
+		total.Size += t.Size
+		total.Files += t.Files
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		return crashByKind[kinds[i]].Size > crashByKind[kinds[j]].Size
+	})
+
+	fmt.Println("\n--- Crash Artifacts ---")
+	fmt.Printf("%-14s | %-15s | %-15s | %-12s | %-12s\n", "Kind", "Size", "Files", "Newest", "Oldest")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, k := range kinds {
+		t := crashByKind[k]
+		fmt.Printf("%-14s | %-15s | %-15s | %-12s | %-12s\n", k, formatBytes(t.Size), formatFiles(t.Files), formatDate(t.Newest), formatDate(crashOldest[k]))
+	}
+
+	fmt.Printf("\n--- Top %d Largest Crash Artifacts ---\n", topN)
+	fmt.Printf("%-15s | %-14s | %-8s | %-50s\n", "Size", "Kind", "Age", "Path")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, f := range crashLargest {
+		fmt.Printf("%-15s | %-14s | %-8s | %s\n", formatBytes(f.Size), f.Kind, formatAgeDays(f.Mtime), shownPath(f.Path))
+	}
+	fmt.Printf("\nCrash artifacts on %s: %s in %d files\n", host, formatBytes(total.Size), total.Files)
+}
+
+// formatAgeDays formats the time since mtime in days, "-" if unknown
+func formatAgeDays(mtime int64) string {
+	if mtime <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%dd", int(retentionNow.Sub(time.Unix(mtime, 0)).Hours()/24))
+}
+
+// --- Symbolic Links ---
+//
+// Symlink farms (stow, alternatives, deployment "current" links) and link sprawl left behind by
+// migrations: links are grouped by their target, which is resolved relative to the link and
+// checked once. Links are never followed by the scan itself.
+
+// linkTarget is a symlink target with the number of links pointing to it
+type linkTarget struct {
+	Links   int64
+	Broken  bool // The target (or a link in its chain) does not exist, or the chain loops
+	Outside bool // The target is not below the scanned roots
+}
+
+// linkDir counts the links directly in a directory
+type linkDir struct {
+	Links, Broken, Outside int64
+}
+
+var (
+	linksByTarget = make(map[string]*linkTarget) // Cleaned absolute target -> links
+	linksByDir    = make(map[string]*linkDir)
+	linkTotals    linkDir
+)
+
+// noteSymlink records the symlink at path
+func noteSymlink(path string) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	target = filepath.Clean(target)
+	t, ok := linksByTarget[target]
+	if !ok {
+		t = &linkTarget{Outside: !isUnderTargets(target)}
+		// Unreadable targets are not known to be broken
+		if _, err := os.Stat(path); err != nil && !errors.Is(err, fs.ErrPermission) {
+			t.Broken = true
+		}
+		linksByTarget[target] = t
+	}
+	t.Links++
+
+	dir := filepath.Dir(path)
+	ld := linksByDir[dir]
+	if ld == nil {
+		ld = &linkDir{}
+		linksByDir[dir] = ld
+	}
+	for _, c := range []*linkDir{ld, &linkTotals} {
+		c.Links++
+		if t.Broken {
+			c.Broken++
+		}
+		if t.Outside {
+			c.Outside++
+		}
+	}
+}
+
+func linkStatus(t *linkTarget) string {
+	switch {
+	case t.Broken && t.Outside:
+		return "broken, outside"
+	case t.Broken:
+		return "broken"
+	case t.Outside:
+		return "outside"
+	}
+	return "ok"
+}
+
+func printSymlinkReport() {
+	if linkTotals.Links == 0 {
+		fmt.Println("\nNo symbolic links found.")
+		return
+	}
+	targets := make([]string, 0, len(linksByTarget))
+	for t := range linksByTarget {
+		targets = append(targets, t)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		a, b := linksByTarget[targets[i]], linksByTarget[targets[j]]
+		if a.Links != b.Links {
+			return a.Links > b.Links
+		}
+		return targets[i] < targets[j]
+	})
+	fmt.Printf("\n--- Top %d Symlink Targets ---\n", topN)
+	fmt.Printf("%-10s | %-15s | %-50s\n", "Links", "Status", "Target")
+	fmt.Println(strings.Repeat("-", 80))
+	for i, target := range targets {
+		if i >= topN {
+			break
+		}
+		t := linksByTarget[target]
+		fmt.Printf("%-10d | %-15s | %s\n", t.Links, linkStatus(t), shownPath(target))
+	}
+
+	dirs := make([]string, 0, len(linksByDir))
+	for d := range linksByDir {
+		dirs = append(dirs, d)
+	}
+	// Broken links are the cleanup work: directories with the most of them first
+	sort.Slice(dirs, func(i, j int) bool {
+		a, b := linksByDir[dirs[i]], linksByDir[dirs[j]]
+		if a.Broken != b.Broken {
+			return a.Broken > b.Broken
+		}
+		if a.Links != b.Links {
+			return a.Links > b.Links
+		}
+		return dirs[i] < dirs[j]
+	})
+	fmt.Printf("\n--- Top %d Directories by Broken and Total Symlinks ---\n", topN)
+	fmt.Printf("%-10s | %-10s | %-10s | %-50s\n", "Links", "Broken", "Outside", "Path")
+	fmt.Println(strings.Repeat("-", 80))
+	for i, d := range dirs {
+		if i >= topN {
+			break
+		}
+		ld := linksByDir[d]
+		fmt.Printf("%-10d | %-10d | %-10d | %s\n", ld.Links, ld.Broken, ld.Outside, shownPath(d))
+	}
+	fmt.Printf("\nSymlinks: %d link(s) to %d target(s), %d broken, %d pointing outside the scanned roots\n",
+		linkTotals.Links, len(linksByTarget), linkTotals.Broken, linkTotals.Outside)
+}
+
+// --- Special Files ---
+//
+// Sockets, FIFOs and device nodes have no size, so they never show up in the rankings, but outside
+// /dev and /run they are usually state left behind by services, containers or chroots.
+
+// specialCounts counts the special files directly in a directory
+type specialCounts struct {
+	Sockets, FIFOs, Devices int64
+	Newest                  int64 // Newest modification time (Unix seconds)
+}
+
+func (c *specialCounts) total() int64 {
+	return c.Sockets + c.FIFOs + c.Devices
+}
+
+var (
+	specialByDir  = make(map[string]*specialCounts)
+	specialTotals specialCounts
+	specialBlock  int64 // Block devices among specialTotals.Devices
+	specialOldest int64 // Oldest modification time of all special files
+)
+
+// noteSpecialFile records path if mode is a socket, FIFO or device node
+func noteSpecialFile(path string, mode fs.FileMode, mtime int64) {
+	if mode&(fs.ModeSocket|fs.ModeNamedPipe|fs.ModeDevice|fs.ModeCharDevice) == 0 {
+		return
+	}
+	dir := filepath.Dir(path)
+	c := specialByDir[dir]
+	if c == nil {
+		c = &specialCounts{}
+		specialByDir[dir] = c
+	}
+	for _, sc := range []*specialCounts{c, &specialTotals} {
+		switch {
+		case mode&fs.ModeSocket != 0:
+			sc.Sockets++
+		case mode&fs.ModeNamedPipe != 0:
+			sc.FIFOs++
+		default:
+			sc.Devices++
+		}
+		sc.Newest = max(sc.Newest, mtime)
+	}
+	if mode&fs.ModeDevice != 0 && mode&fs.ModeCharDevice == 0 {
+		specialBlock++
+	}
+	if mtime > 0 && (specialOldest == 0 || mtime < specialOldest) {
+		specialOldest = mtime
+	}
+}
+
+func printSpecialFiles() {
+	if specialTotals.total() == 0 {
+		fmt.Println("\nNo special files (sockets, FIFOs, device nodes) found.")
+		return
+	}
+	dirs := make([]string, 0, len(specialByDir))
+	for d := range specialByDir {
+		dirs = append(dirs, d)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		a, b := specialByDir[dirs[i]].total(), specialByDir[dirs[j]].total()
+		if a != b {
+			return a > b
+		}
+		return dirs[i] < dirs[j]
+	})
+	fmt.Printf("\n--- Top %d Directories by Special Files ---\n", topN)
+	fmt.Printf("%-10s | %-10s | %-10s | %-12s | %-50s\n", "Sockets", "FIFOs", "Devices", "Newest", "Path")
+	fmt.Println(strings.Repeat("-", 80))
+	for i, d := range dirs {
+		if i >= topN {
+			break
+		}
+		c := specialByDir[d]
+		fmt.Printf("%-10d | %-10d | %-10d | %-12s | %s\n", c.Sockets, c.FIFOs, c.Devices, formatDate(c.Newest), shownPath(d))
+	}
+	fmt.Printf("\nSpecial files: %d socket(s), %d FIFO(s), %d device node(s) (%d block, %d character) in %d director(ies), oldest from %s\n",
+		specialTotals.Sockets, specialTotals.FIFOs, specialTotals.Devices, specialBlock, specialTotals.Devices-specialBlock,
+		len(specialByDir), formatDate(specialOldest))
+}
+
+// --- Deleted but Open Files ---
+//
+// A deleted file keeps its blocks until the last process closes it: df counts them, a scan cannot
+// see them. On Linux they are found through the /proc/<pid>/fd links of all processes, which end in
+// " (deleted)". Other users' processes can only be inspected as root.
+
+// openDeleted is a deleted file that is still held open
+type openDeleted struct {
+	Path    string // Path at the time it was deleted
+	Size    int64
+	Dev     int64 // Device of the file system holding it
+	Holders []int // PIDs with an open descriptor
+}
+
+var (
+	deletedFiles   []*openDeleted
+	deletedProcs   = make(map[int]string) // PID -> command name, for holders
+	deletedSkipped int                    // Processes whose descriptors could not be read
+	deletedScanned bool
+)
+
+// scanDeletedOpen collects the deleted but open regular files of all processes. A file held by
+// several descriptors or processes is counted once.
+func scanDeletedOpen() error {
+	if deletedScanned {
+		return nil
+	}
+	deletedScanned = true
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return err
+	}
+	byInode := make(map[[2]int64]*openDeleted)
+	for _, p := range procs {
+		pid, err := strconv.Atoi(p.Name())
+		if err != nil {
+			continue
+		}
+		fdDir := filepath.Join("/proc", p.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			if !os.IsNotExist(err) { // The process may have exited meanwhile
+				deletedSkipped++
+			}
+			continue
+		}
+		for _, fd := range fds {
+			fdPath := filepath.Join(fdDir, fd.Name())
+			link, err := os.Readlink(fdPath)
+			if err != nil || !strings.HasPrefix(link, "/") || !strings.HasSuffix(link, " (deleted)") {
+				continue
+			}
+			info, err := os.Stat(fdPath)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			// A file that is really named "... (deleted)" still has links
+			if nlink, ok := statField(info, "Nlink"); ok && nlink > 0 {
+				continue
+			}
+			dev, _ := statField(info, "Dev")
+			ino, _ := statField(info, "Ino")
+			f := byInode[[2]int64{dev, ino}]
+			if f == nil {
+				f = &openDeleted{Path: strings.TrimSuffix(link, " (deleted)"), Size: getFileSize(info), Dev: dev}
+				byInode[[2]int64{dev, ino}] = f
+				deletedFiles = append(deletedFiles, f)
+			}
+			if !slices.Contains(f.Holders, pid) {
+				f.Holders = append(f.Holders, pid)
+			}
+			if _, ok := deletedProcs[pid]; !ok {
+				comm, _ := os.ReadFile(filepath.Join("/proc", p.Name(), "comm"))
+				deletedProcs[pid] = strings.TrimSpace(string(comm))
+			}
+		}
+	}
+	return nil
+}
+
+// deletedOn returns the deleted but open files on the given devices, and their total size
+func deletedOn(devices map[int64]bool) ([]*openDeleted, int64) {
+	var list []*openDeleted
+	var total int64
+	for _, f := range deletedFiles {
+		if devices[f.Dev] {
+			list = append(list, f)
+			total += f.Size
+		}
+	}
+	return list, total
+}
+
+// printDeletedOpen reports the deleted but open files on the file systems of the targets
+func printDeletedOpen() {
+	if err := scanDeletedOpen(); err != nil {
+		fmt.Printf("\nWarning: Could not inspect open files: %v\n", err)
+		return
+	}
+	devices := make(map[int64]bool)
+	for _, root := range targetPaths {
+		if info, err := os.Stat(root); err == nil {
+			if dev, ok := statField(info, "Dev"); ok {
+				devices[dev] = true
+			}
+		}
+	}
+	files, total := deletedOn(devices)
+	var skippedNote string
+	if deletedSkipped > 0 {
+		skippedNote = fmt.Sprintf(" (%d process(es) could not be inspected, run as root to include them)", deletedSkipped)
+	}
+	if len(files) == 0 {
+		fmt.Printf("\nNo deleted files are held open on the scanned file systems%s.\n", skippedNote)
+		return
+	}
+
+	byProc := make(map[int]*fileTally)
+	byDir := make(map[string]*fileTally)
+	for _, f := range files {
+		for _, pid := range f.Holders {
+			if byProc[pid] == nil {
+				byProc[pid] = &fileTally{}
+			}
+			byProc[pid].add(f.Size, 0)
+		}
+		dir := filepath.Dir(f.Path)
+		if byDir[dir] == nil {
+			byDir[dir] = &fileTally{}
+		}
+		byDir[dir].add(f.Size, 0)
+	}
+
+	pids := make([]int, 0, len(byProc))
+	for pid := range byProc {
+		pids = append(pids, pid)
+	}
+	sort.Slice(pids, func(i, j int) bool {
+		if byProc[pids[i]].Size != byProc[pids[j]].Size {
+			return byProc[pids[i]].Size > byProc[pids[j]].Size
+		}
+		return pids[i] < pids[j]
+	})
+	fmt.Printf("\n--- Top %d Processes Holding Deleted Files ---\n", topN)
+	fmt.Printf("%-15s | %-10s | %-10s | %-30s\n", "Size", "Files", "PID", "Command")
+	fmt.Println(strings.Repeat("-", 80))
+	for i, pid := range pids {
+		if i >= topN {
+			break
+		}
+		fmt.Printf("%-15s | %-10d | %-10d | %s\n", formatBytes(byProc[pid].Size), byProc[pid].Files, pid, deletedProcs[pid])
+	}
+
+	dirs := make([]string, 0, len(byDir))
+	for d := range byDir {
+		dirs = append(dirs, d)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if byDir[dirs[i]].Size != byDir[dirs[j]].Size {
+			return byDir[dirs[i]].Size > byDir[dirs[j]].Size
+		}
+		return dirs[i] < dirs[j]
+	})
+	fmt.Printf("\n--- Top %d Directories of Deleted Open Files ---\n", topN)
+	fmt.Printf("%-15s | %-10s | %-50s\n", "Size", "Files", "Original Directory")
+	fmt.Println(strings.Repeat("-", 80))
+	for i, d := range dirs {
+		if i >= topN {
+			break
+		}
+		fmt.Printf("%-15s | %-10d | %s\n", formatBytes(byDir[d].Size), byDir[d].Files, shownPath(d))
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Size != files[j].Size {
+			return files[i].Size > files[j].Size
+		}
+		return files[i].Path < files[j].Path
+	})
+	fmt.Printf("\n--- Top %d Largest Deleted Open Files ---\n", topN)
+	fmt.Printf("%-15s | %-30s | %-50s\n", "Size", "Held by", "Original Path")
+	fmt.Println(strings.Repeat("-", 80))
+	for i, f := range files {
+		if i >= topN {
+			break
+		}
+		var holders []string
+		for _, pid := range f.Holders {
+			holders = append(holders, fmt.Sprintf("%s[%d]", deletedProcs[pid], pid))
+		}
+		fmt.Printf("%-15s | %-30s | %s\n", formatBytes(f.Size), strings.Join(holders, ", "), shownPath(f.Path))
+	}
+	fmt.Printf("\nDeleted but open: %s in %d file(s) held by %d process(es)%s. The space is freed when they close the files or exit.\n",
+		formatBytes(total), len(files), len(byProc), skippedNote)
+}
+
+// --- Reconciliation with df ---
+//
+// "du says 400G, df says 600G": --reconcile compares the scanned space per file system with the
+// used space df reports and itemizes the difference as far as it can be measured. Directories
+// take space of their own (not in the directory totals, which count files), hard links are only
+// allocated once, and deleted files held open are invisible to a scan. What remains is space
+// outside the scanned paths, excluded or unreadable, or file system metadata.
+
+// fsUsage is what the scan saw of one file system (device)
+type fsUsage struct {
+	Files      int64  // Space of the scanned files, every hard link counted
+	Dirs       int64  // Space of the directories themselves
+	HardLinked int64  // Space of hard links seen before (included in Files)
+	Sample     string // A scanned directory on the file system, for df
+}
+
+var (
+	reconcileUsage  = make(map[int64]*fsUsage)
+	reconcileInodes = make(map[[2]int64]bool) // Hard-linked files seen (device, inode)
+)
+
+func reconcileFS(info fs.FileInfo) *fsUsage {
+	dev, ok := statField(info, "Dev")
+	if !ok {
+		return nil
+	}
+	u := reconcileUsage[dev]
+	if u == nil {
+		u = &fsUsage{}
+		reconcileUsage[dev] = u
+	}
+	return u
+}
+
+// noteReconcileDir adds the space of a directory itself
+func noteReconcileDir(path string, d fs.DirEntry) {
+	info, err := d.Info()
+	if err != nil {
+		return
+	}
+	if u := reconcileFS(info); u != nil {
+		u.Dirs += getFileSize(info)
+		if u.Sample == "" {
+			u.Sample = path
+		}
+	}
+}
+
+// noteReconcileFile adds the space of a file as counted by the scan
+func noteReconcileFile(info fs.FileInfo, size int64) {
+	u := reconcileFS(info)
+	if u == nil {
+		return
+	}
+	u.Files += size
+	if nlink, ok := statField(info, "Nlink"); ok && nlink > 1 {
+		dev, _ := statField(info, "Dev")
+		ino, _ := statField(info, "Ino")
+		if reconcileInodes[[2]int64{dev, ino}] {
+			u.HardLinked += size
+		} else {
+			reconcileInodes[[2]int64{dev, ino}] = true
+		}
+	}
+}
+
+// dfUsage is a line of df -P -k
+type dfUsage struct {
+	Source, MountPoint     string
+	Total, Used, Available int64 // Bytes
+}
+
+func runDF(path string) (dfUsage, error) {
+	out, err := exec.Command("df", "-P", "-k", path).Output()
+	if err != nil {
+		return dfUsage{}, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(lines) < 2 || len(fields) < 6 {
+		return dfUsage{}, fmt.Errorf("unexpected df output %q", lines[len(lines)-1])
+	}
+	var kb [3]int64
+	for i := range kb {
+		if kb[i], err = strconv.ParseInt(fields[i+1], 10, 64); err != nil {
+			return dfUsage{}, fmt.Errorf("unexpected df output %q", lines[len(lines)-1])
+		}
+	}
+	// The mount point is last and may contain spaces
+	return dfUsage{Source: fields[0], MountPoint: strings.Join(fields[5:], " "),
+		Total: kb[0] * 1024, Used: kb[1] * 1024, Available: kb[2] * 1024}, nil
+}
+
+// fsCapacity is the capacity of a file system as planning needs it: the raw device size, what the
+// file system keeps for its metadata, the reserve and what users can actually fill
+type fsCapacity struct {
+	MountPoint      string  `json:"mount_point"`
+	Source          string  `json:"source"`
+	DeviceSize      int64   `json:"device_size,omitempty"` // Size of the block device (Linux), 0 if not a local device
+	Size            int64   `json:"size"`                  // Size according to df
+	Used            int64   `json:"used"`
+	Available       int64   `json:"available"`
+	Reserved        int64   `json:"reserved"` // Neither used nor available (root reserve)
+	ReservedPercent float64 `json:"reserved_percent"`
+	Overhead        int64   `json:"overhead,omitempty"` // Device size not in df's size (inode tables, journal, ...)
+	OverheadPercent float64 `json:"overhead_percent,omitempty"`
+	Usable          int64   `json:"usable"` // Used + available: what unprivileged users can fill
+}
+
+func capacityOf(df dfUsage) fsCapacity {
+	c := fsCapacity{MountPoint: shownPath(df.MountPoint), Source: df.Source, Size: df.Total, Used: df.Used,
+		Available: df.Available, Usable: df.Used + df.Available}
+	c.Reserved = max(df.Total-df.Used-df.Available, 0)
+	if df.Total > 0 {
+		c.ReservedPercent = math.Round(float64(c.Reserved)*10000/float64(df.Total)) / 100
+	}
+	if c.DeviceSize = blockDeviceSize(df.Source); c.DeviceSize > df.Total {
+		c.Overhead = c.DeviceSize - df.Total
+		c.OverheadPercent = math.Round(float64(c.Overhead)*10000/float64(c.DeviceSize)) / 100
+	}
+	return c
+}
+
+// blockDeviceSize returns the size of a block device from /sys/class/block (Linux), 0 otherwise.
+// Device mapper and other symlinked names are resolved first (/dev/mapper/vg-root -> dm-0).
+func blockDeviceSize(source string) int64 {
+	if runtime.GOOS != "linux" || !strings.HasPrefix(source, "/dev/") {
+		return 0
+	}
+	if real, err := filepath.EvalSymlinks(source); err == nil {
+		source = real
+	}
+	data, err := os.ReadFile(filepath.Join("/sys/class/block", filepath.Base(source), "size"))
+	if err != nil {
+		return 0
+	}
+	sectors, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return sectors * 512 // Always in 512-byte units
+}
+
+// targetCapacities returns the capacity of the file systems holding the targets, once each
+func targetCapacities() []fsCapacity {
+	var list []fsCapacity
+	seen := make(map[string]bool)
+	for _, root := range targetPaths {
+		df, err := runDF(root)
+		if err != nil || seen[df.Source+"\x00"+df.MountPoint] {
+			continue
+		}
+		seen[df.Source+"\x00"+df.MountPoint] = true
+		list = append(list, capacityOf(df))
+	}
+	return list
+}
+
+func printReconciliation() {
+	// Devices of one file system (btrfs subvolumes) share a df line
+	type fsGroup struct {
+		df      dfUsage
+		devices map[int64]bool
+		usage   fsUsage
+	}
+	var groups []*fsGroup
+	byMount := make(map[string]*fsGroup)
+	for dev, u := range reconcileUsage {
+		df, err := runDF(u.Sample)
+		if err != nil {
+			fmt.Printf("\nWarning: Could not run df for %s: %v\n", u.Sample, err)
+			continue
+		}
+		g := byMount[df.Source+"\x00"+df.MountPoint]
+		if g == nil {
+			g = &fsGroup{df: df, devices: make(map[int64]bool)}
+			byMount[df.Source+"\x00"+df.MountPoint] = g
+			groups = append(groups, g)
+		}
+		g.devices[dev] = true
+		g.usage.Files += u.Files
+		g.usage.Dirs += u.Dirs
+		g.usage.HardLinked += u.HardLinked
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].df.MountPoint < groups[j].df.MountPoint })
+
+	deletedKnown := runtime.GOOS == "linux"
+	if deletedKnown {
+		if err := scanDeletedOpen(); err != nil {
+			fmt.Printf("\nWarning: Could not inspect open files: %v\n", err)
+			deletedKnown = false
+		}
+	}
+	row := func(label string, v int64, note string) {
+		fmt.Println(strings.TrimRight(fmt.Sprintf("  %-34s %15s  %s", label, formatBytes(v), note), " "))
+	}
+	for _, g := range groups {
+		fmt.Printf("\n--- Reconciliation of %s (%s) with df ---\n", shownPath(g.df.MountPoint), g.df.Source)
+		scanned := g.usage.Files - g.usage.HardLinked
+		row("Used according to df", g.df.Used, "")
+		linkNote := ""
+		if g.usage.HardLinked > 0 {
+			linkNote = fmt.Sprintf("(hard-linked files counted once, %s of further links left out)", formatBytes(g.usage.HardLinked))
+		}
+		row("Scanned files", scanned, linkNote)
+		row("Directories themselves", g.usage.Dirs, "")
+		gap := g.df.Used - scanned - g.usage.Dirs
+		if deletedKnown {
+			_, held := deletedOn(g.devices)
+			note := "(see --deleted-open)"
+			if deletedSkipped > 0 {
+				note = fmt.Sprintf("(%d process(es) not inspected, run as root)", deletedSkipped)
+			}
+			row("Deleted but still open", held, note)
+			gap -= held
+		}
+
+		if gap >= 0 {
+			row("Not explained by the scan", gap, "")
+			var causes []string
+			if !isUnderTargets(g.df.MountPoint) {
+				var inside []string
+				for _, root := range targetPaths {
+					if abs, err := filepath.Abs(root); err == nil && isPathEqualOrSubpath(abs, g.df.MountPoint) {
+						inside = append(inside, shownPath(abs))
+					}
+				}
+				causes = append(causes, fmt.Sprintf("only %s of %s was scanned", strings.Join(inside, ", "), shownPath(g.df.MountPoint)))
+			}
+			for _, p := range excludePaths {
+				// Excluded mounts (/proc, /sys, ...) are other file systems
+				if info, err := os.Stat(p); err == nil && isUnderTargets(p) {
+					if dev, ok := statField(info, "Dev"); ok && g.devices[dev] {
+						causes = append(causes, "excluded "+shownPath(p))
+					}
+				}
+			}
+			if n := countInaccessible(); n > 0 {
+				causes = append(causes, fmt.Sprintf("%d unreadable entries (all targets)", n))
+			}
+			if maxDepth != 1000000 {
+				causes = append(causes, fmt.Sprintf("--maxdepth %d", maxDepth))
+			}
+			causes = append(causes, "file system metadata (journal, inode tables, allocation overhead), snapshots, mounts hidden under other mounts")
+			fmt.Printf("  Possible causes: %s\n", strings.Join(causes, "; "))
+		} else {
+			row("Scanned more than df reports", -gap, "(compression, deduplication, reflinks or shared extents)")
+		}
+		c := capacityOf(g.df)
+		if c.Reserved > 0 {
+			row("Reserved (neither used nor free)", c.Reserved, fmt.Sprintf("(%.2f%% of the size, root reserve, not in the used space)", c.ReservedPercent))
+		}
+		if c.Overhead > 0 {
+			row("Metadata overhead", c.Overhead, fmt.Sprintf("(%.2f%% of the %s device, not in df's size)", c.OverheadPercent, formatBytes(c.DeviceSize)))
+		}
+		row("Usable (used + available)", c.Usable, "")
+	}
+}
+
+// --- Temporary Files ---
+
+// tempNames recognize leftover temporary files by name: editor backups and swap files, partial
+// downloads and generic .tmp files
+var tempNames = []struct {
+	Kind string
+	Re   *regexp.Regexp
+}{
+	{"editor backup", regexp.MustCompile(`~$|^#.+#$`)},
+	{"swap file", regexp.MustCompile(`^\..+\.sw[a-p]$`)},
+	{"partial download", regexp.MustCompile(`(?i)\.(partial|part|crdownload|download|filepart|opdownload)$`)},
+	{"temp file", regexp.MustCompile(`(?i)\.(tmp|temp)$|^~\$`)},
+}
+
+// tempDirRe matches temporary directories and chunked-upload staging directories (Nextcloud,
+// ownCloud, tus); files anywhere below them are counted for the outermost such directory
+var tempDirRe = regexp.MustCompile(`(?i)^(\.?te?mp|web-file-upload-.+|chunking-.+|.+\.chunks|\.tus)$`)
+
+var (
+	tempAge    time.Duration // --temp-files: only files older than this are reclaimable
+	tempAgeArg string        // The age as given, for the report
+	tempByKind = make(map[string]*fileTally)
+	tempByDir  = make(map[string]*fileTally) // Directory holding the files -> reclaimable files
+	tempRecent fileTally                     // Temporary files too new to be reclaimed
+)
+
+// noteTempFile checks whether a file is a leftover temporary file (--temp-files) and counts it for
+// the directory it accumulates in
+func noteTempFile(path string, size, mtime int64) {
+	dir := filepath.Dir(path)
+	kind := ""
+	for _, p := range tempNames {
+		if p.Re.MatchString(filepath.Base(path)) {
+			kind = p.Kind
+			break
+		}
+	}
+	for p := dir; isUnderTargets(p); p = filepath.Dir(p) {
+		if tempDirRe.MatchString(filepath.Base(p)) {
+			dir, kind = p, "temp directory"
+		}
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+	if kind == "" {
+		return
+	}
+	if retentionNow.Sub(time.Unix(mtime, 0)) < tempAge {
+		tempRecent.add(size, mtime)
+		return
+	}
+	if tempByKind[kind] == nil {
+		tempByKind[kind] = &fileTally{}
+	}
+	tempByKind[kind].add(size, mtime)
+	if tempByDir[dir] == nil {
+		tempByDir[dir] = &fileTally{}
+	}
+	tempByDir[dir].add(size, mtime)
+}
+
+// printTempReport lists the directories where old temporary files accumulate and what deleting
+// them would reclaim
+func printTempReport() {
+	var total fileTally
+	for _, t := range tempByKind {
+		total.Size += t.Size
+		total.Files += t.Files
+	}
+	if total.Files == 0 {
+		fmt.Printf("\nNo temporary files older than %s found.\n", tempAgeArg)
+		return
+	}
+
+	kinds := make([]string, 0, len(tempByKind))
+	for k := range tempByKind {
+		kinds = append(kinds, k)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if tempByKind[kinds[i]].Size != tempByKind[kinds[j]].Size {
+			return tempByKind[kinds[i]].Size > tempByKind[kinds[j]].Size
+		}
+		return kinds[i] < kinds[j]
+	})
+	fmt.Printf("\n--- Temporary Files Older Than %s ---\n", tempAgeArg)
+	fmt.Printf("%-16s | %-15s | %-15s | %-12s\n", "Kind", "Size", "Files", "Newest")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, k := range kinds {
+		t := tempByKind[k]
+		fmt.Printf("%-16s | %-15s | %-15s | %-12s\n", k, formatBytes(t.Size), formatFiles(t.Files), formatDate(t.Newest))
+	}
+
+	dirs := make([]string, 0, len(tempByDir))
+	for d := range tempByDir {
+		dirs = append(dirs, d)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if tempByDir[dirs[i]].Size != tempByDir[dirs[j]].Size {
+			return tempByDir[dirs[i]].Size > tempByDir[dirs[j]].Size
+		}
+		return dirs[i] < dirs[j]
+	})
+	fmt.Printf("\n--- Top %d Directories by Temporary Files ---\n", topN)
+	fmt.Printf("%-15s | %-15s | %-12s | %-50s\n", "Size", "Files", "Newest", "Path")
+	fmt.Println(strings.Repeat("-", 80))
+	for i, d := range dirs {
+		if i >= topN {
+			break
+		}
+		t := tempByDir[d]
+		fmt.Printf("%-15s | %-15s | %-12s | %s\n", formatBytes(t.Size), formatFiles(t.Files), formatDate(t.Newest), shownPath(d))
+	}
+
+	fmt.Printf("\nReclaimable: %s in %d temporary files across %d directories", formatBytes(total.Size), total.Files, len(tempByDir))
+	if tempRecent.Files > 0 {
+		fmt.Printf(" (%s in %d newer files not counted)", formatBytes(tempRecent.Size), tempRecent.Files)
+	}
+	fmt.Println()
+}
+
+// --- Regenerable Files ---
+
+// Directories whose contents are generated previews that applications recreate on demand
+var thumbnailDirs = []string{".thumbnails", "thumbnails", ".thumbs", "@eaDir", ".sm", ".picasaoriginals"}
+
+var (
+	derivedResized   = regexp.MustCompile(`^(.+?)(-\d+x\d+|[._-]thumb(nail)?|[._-]small|[._-]preview)(\.[A-Za-z]+)$`)
+	derivedTranscode = regexp.MustCompile(`^(.+?)[._-](240p|360p|480p|720p|1080p|2160p|4k|low|mobile|proxy)\.(mp4|webm|m4v|mkv)$`)
+	derivedByKind    = make(map[string]*fileTally)
+	derivedOwn       = make(map[string]*fileTally) // Directory -> regenerable files directly in it
+)
+
+// derivedKind tells whether a file was generated from a source next to it (--regenerable), and
+// what kind of derived file it is. The source must exist, so a lone .pyc or .map is not counted.
+func derivedKind(path string) string {
+	dir, name := filepath.Split(path)
+	exists := func(dir, name string) bool {
+		_, err := os.Lstat(filepath.Join(dir, name))
+		return err == nil
+	}
+	existsAny := func(stem string, exts ...string) bool {
+		for _, ext := range exts {
+			if exists(dir, stem+ext) {
+				return true
+			}
+		}
+		return false
+	}
+	sep := string(os.PathSeparator)
+	for _, d := range thumbnailDirs {
+		if strings.Contains(dir, sep+d+sep) {
+			return "thumbnail"
+		}
+	}
+
+	ext := strings.ToLower(filepath.Ext(name))
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	switch ext {
+	case ".pyc", ".pyo":
+		// __pycache__/mod.cpython-312.pyc belongs to ../mod.py, a legacy mod.pyc to mod.py
+		if filepath.Base(dir) == "__pycache__" {
+			if mod, _, ok := strings.Cut(stem, "."); ok && exists(filepath.Dir(filepath.Clean(dir)), mod+".py") {
+				return "Python bytecode"
+			}
+		} else if exists(dir, stem+".py") {
+			return "Python bytecode"
+		}
+		return ""
+	case ".map":
+		if exists(dir, stem) {
+			return "source map"
+		}
+		return ""
+	case ".o", ".obj":
+		if existsAny(stem, ".c", ".cc", ".cpp", ".cxx", ".s", ".S", ".m") {
+			return "object file"
+		}
+		return ""
+	case ".gz", ".br", ".zst":
+		if filepath.Ext(stem) != "" && exists(dir, stem) {
+			return "precompressed"
+		}
+		return ""
+	case ".js", ".css":
+		if before, ok := strings.CutSuffix(stem, ".min"); ok && exists(dir, before+ext) {
+			return "minified"
+		}
+		return ""
+	case ".webp", ".avif":
+		if existsAny(stem, ".jpg", ".jpeg", ".png", ".JPG", ".JPEG", ".PNG") {
+			return "transcode"
+		}
+	}
+	if m := derivedTranscode.FindStringSubmatch(name); m != nil && existsAny(m[1], ".mp4", ".mov", ".mkv", ".MP4", ".MOV") {
+		return "transcode"
+	}
+	if m := derivedResized.FindStringSubmatch(name); m != nil && exists(dir, m[1]+m[4]) {
+		return "thumbnail"
+	}
+	return ""
+}
+
+// noteDerivedFile counts a file for --regenerable if it can be regenerated from its source
+func noteDerivedFile(path string, size, mtime int64) {
+	kind := derivedKind(path)
+	if kind == "" {
+		return
+	}
+	if derivedByKind[kind] == nil {
+		derivedByKind[kind] = &fileTally{}
+	}
+	derivedByKind[kind].add(size, mtime)
+	dir := filepath.Dir(path)
+	if derivedOwn[dir] == nil {
+		derivedOwn[dir] = &fileTally{}
+	}
+	derivedOwn[dir].add(size, mtime)
+}
+
+// printDerivedReport shows the regenerable space per kind and the directories that hold most of it
+func printDerivedReport() {
+	var total fileTally
+	kinds := make([]string, 0, len(derivedByKind))
+	for k, t := range derivedByKind {
+		kinds = append(kinds, k)
+		total.Size += t.Size
+		total.Files += t.Files
+	}
+	if total.Files == 0 {
+		fmt.Println("\nNo regenerable files (thumbnails, transcodes, bytecode, source maps, ...) found.")
+		return
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if derivedByKind[kinds[i]].Size != derivedByKind[kinds[j]].Size {
+			return derivedByKind[kinds[i]].Size > derivedByKind[kinds[j]].Size
+		}
+		return kinds[i] < kinds[j]
+	})
+	fmt.Println("\n--- Regenerable Files by Kind ---")
+	fmt.Printf("%-16s | %-15s | %-15s | %-12s\n", "Kind", "Size", "Files", "Newest")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, k := range kinds {
+		t := derivedByKind[k]
+		fmt.Printf("%-16s | %-15s | %-15s | %-12s\n", k, formatBytes(t.Size), formatFiles(t.Files), formatDate(t.Newest))
+	}
+	printTallyDirectories(fmt.Sprintf("Top %d Directories by Regenerable Size", topN), rollUpTallies(derivedOwn))
+	fmt.Printf("\nRegenerable: %s in %d files\n", formatBytes(total.Size), total.Files)
+}
+
+// --- Versioned Files ---
+
+var (
+	// versionSuffix matches one version marker at the end of a file stem: v3, _rev2, (1), _final,
+	// " - Copy", a year or a date. Markers need a separator so "renew" or "dev2" are left alone.
+	versionSuffix = regexp.MustCompile(`(?i)(?:[ _.-]+(?:v|ver|version|rev)[ _.-]?\d+(?:[._]\d+)*|[ _.-]*\(\d+\)|[ _.-]+(?:final|draft|old|new|latest|copy|backup|bak|edited|updated|revised|orig|original)|[ _.-]+(?:19|20)\d{2}(?:[-_.]?[01]\d(?:[-_.]?[0-3]\d)?)?)$`)
+	// versionPrefix matches a leading date (2024-05-01_report.docx)
+	versionPrefix   = regexp.MustCompile(`^(?:19|20)\d{2}(?:[-_.]?[01]\d(?:[-_.]?[0-3]\d)?)?[ _.-]+`)
+	versionFamilies = make(map[string]*versionFamily) // Directory + family name -> versions
+	versionLogExts  = map[string]bool{".log": true, ".gz": true, ".bz2": true, ".xz": true, ".zst": true}
+)
+
+// versionFile is one version of a versioned file family
+type versionFile struct {
+	Name        string
+	Size, Mtime int64
+}
+
+// versionFamily is a set of files in one directory that only differ by version markers
+// (report_v1.docx, report_v2_final.docx, report (1).docx)
+type versionFamily struct {
+	Dir, Base, Ext string
+	Versions       []versionFile
+}
+
+// versionFamilyName strips the version markers from a file name. ok is false when the name has
+// none, or nothing would be left of it.
+func versionFamilyName(name string) (base, ext string, ok bool) {
+	ext = filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	if len(ext) > 6 || versionLogExts[strings.ToLower(ext)] {
+		return "", "", false
+	}
+	base = versionPrefix.ReplaceAllString(stem, "")
+	for {
+		loc := versionSuffix.FindStringIndex(base)
+		if loc == nil || loc[0] == 0 {
+			break
+		}
+		base = base[:loc[0]]
+	}
+	base = strings.TrimRight(base, " _.-")
+	if base == "" || base == stem {
+		return "", "", false
+	}
+	return base, ext, true
+}
+
+// noteVersionedFile adds a file with a version marker in its name to its family (--versioned-files).
+// The unversioned name (report.docx next to report_v2.docx) joins the family when it is created,
+// since the walk may pass it before or after its versions.
+func noteVersionedFile(path string, size, mtime int64) {
+	dir, name := filepath.Split(path)
+	base, ext, ok := versionFamilyName(name)
+	if !ok {
+		return
+	}
+	key := filepath.Join(dir, strings.ToLower(base+ext))
+	fam := versionFamilies[key]
+	if fam == nil {
+		fam = &versionFamily{Dir: filepath.Clean(dir), Base: base, Ext: ext}
+		versionFamilies[key] = fam
+		if info, err := os.Lstat(filepath.Join(fam.Dir, base+ext)); err == nil && info.Mode().IsRegular() {
+			fam.Versions = append(fam.Versions, versionFile{info.Name(), getFileSize(info), info.ModTime().Unix()})
+		}
+	}
+	fam.Versions = append(fam.Versions, versionFile{name, size, mtime})
+}
+
+// newest returns the version that is kept: the most recently modified one, or the longest and
+// then highest name (report_v2_final over report_v2, dataset_2025 over dataset_2021) when they
+// were saved at the same time
+func (fam *versionFamily) newest() versionFile {
+	best := fam.Versions[0]
+	for _, v := range fam.Versions[1:] {
+		if cmp.Or(cmp.Compare(v.Mtime, best.Mtime), cmp.Compare(len(v.Name), len(best.Name)), strings.Compare(v.Name, best.Name)) > 0 {
+			best = v
+		}
+	}
+	return best
+}
+
+// Older returns the size of all versions but the newest
+func (fam *versionFamily) Older() int64 {
+	var size int64
+	for _, v := range fam.Versions {
+		size += v.Size
+	}
+	return size - fam.newest().Size
+}
+
+// printVersionReport lists the families of versioned files by the space their older versions take
+func printVersionReport() {
+	var list []*versionFamily
+	var older, files int64
+	for _, fam := range versionFamilies {
+		if len(fam.Versions) < 2 {
+			continue
+		}
+		list = append(list, fam)
+		older += fam.Older()
+		files += int64(len(fam.Versions) - 1)
+	}
+	if len(list) == 0 {
+		fmt.Println("\nNo versioned file families (report_v1.docx, report_v2_final.docx, ...) found.")
+		return
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if a, b := list[i].Older(), list[j].Older(); a != b {
+			return a > b
+		}
+		return list[i].Dir+list[i].Base < list[j].Dir+list[j].Base
+	})
+	title := fmt.Sprintf("Top %d Versioned File Families by Size of Older Versions", topN)
+	if showAll {
+		title = "All Versioned File Families by Size of Older Versions"
+	}
+	fmt.Printf("\n--- %s ---\n", title)
+	fmt.Printf("%-15s | %-8s | %-12s | %-50s\n", "Older Versions", "Versions", "Newest", "Newest File")
+	fmt.Println(strings.Repeat("-", 80))
+	for i, fam := range list {
+		if i >= topN && !showAll {
+			break
+		}
+		newest := fam.newest()
+		fmt.Printf("%-15s | %-8s | %-12s | %s\n", formatBytes(fam.Older()), formatCount(int64(len(fam.Versions))), formatDate(newest.Mtime), shownPath(filepath.Join(fam.Dir, newest.Name)))
+	}
+	fmt.Printf("\nOlder versions: %s in %s files of %s families (keeping the newest of each)\n", formatBytes(older), formatCount(files), formatCount(int64(len(list))))
+}
+
+// --- Department Report ---
+
+// department is a directory right below a target (a shared drive), with the owner it is
+// reported to (--departments)
+type department struct {
+	Path          string
+	Owner, Source string // Source is ".owner", "tag" or "uid"
+	Size, Files   int64
+	Newest        int64
+}
+
+// departmentOwner names the owner of a department directory: the first line of its .owner file,
+// its owner tag (--tags), or else the user owning the directory. SMB and NFS mounts often show
+// every directory as owned by the mounting user, so the first two are the reliable ones.
+func departmentOwner(s *DirStat, owners map[int64]string) (owner, source string) {
+	if data, err := readMarkerFile(filepath.Join(s.Path, ".owner")); err == nil {
+		if line, _, _ := strings.Cut(strings.TrimSpace(string(data)), "\n"); strings.TrimSpace(line) != "" {
+			return strings.TrimSpace(line), ".owner"
+		}
+	}
+	if tag := dirTags[normalizePath(s.Path)]["owner"]; tag != "" {
+		return tag, "tag"
+	}
+	if name := ownerName(s.Uid, owners); name != "" {
+		return name, "uid"
+	}
+	return "(unknown)", ""
+}
+
+// collectDepartments returns the directories right below the targets, largest first
+func collectDepartments() []*department {
+	owners := make(map[int64]string)
+	var list []*department
+	for p, s := range dirStats {
+		if parent := filepath.Dir(p); parent == p || !isExactTarget(parent) {
+			continue
+		}
+		owner, source := departmentOwner(s, owners)
+		list = append(list, &department{Path: p, Owner: owner, Source: source, Size: s.TotalSize, Files: s.FileCount, Newest: s.NewestMtime})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Size != list[j].Size {
+			return list[i].Size > list[j].Size
+		}
+		return list[i].Path < list[j].Path
+	})
+	return list
+}
+
+// departmentsByOwner groups the departments per owner, owners with the most space first. The
+// returned department holds the owner's grand total (Files, Size and the latest activity).
+func departmentsByOwner(list []*department) ([]*department, map[string][]*department) {
+	groups := make(map[string][]*department)
+	var totals []*department
+	for _, d := range list {
+		if groups[d.Owner] == nil {
+			totals = append(totals, &department{Owner: d.Owner})
+		}
+		groups[d.Owner] = append(groups[d.Owner], d)
+	}
+	for _, t := range totals {
+		for _, d := range groups[t.Owner] {
+			t.Size += d.Size
+			t.Files += d.Files
+			t.Newest = max(t.Newest, d.Newest)
+		}
+	}
+	sort.SliceStable(totals, func(i, j int) bool {
+		if totals[i].Size != totals[j].Size {
+			return totals[i].Size > totals[j].Size
+		}
+		return totals[i].Owner < totals[j].Owner
+	})
+	return totals, groups
+}
+
+// writeDepartmentCSV writes the departments of every owner followed by the owner's total row, so
+// each owner's block can be cut out and mailed on its own. Sizes are given formatted (for
+// reading) and in bytes (for sorting in a spreadsheet).
+func writeDepartmentCSV(name string) error {
+	totals, groups := departmentsByOwner(collectDepartments())
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	cw.Write([]string{"owner", "department", "path", "owner_source", "size", "size_bytes", "files", "last_activity", "days_inactive"})
+	row := func(d *department, dept, path string) {
+		days := ""
+		if d.Newest > 0 {
+			days = strconv.Itoa(int(retentionNow.Sub(time.Unix(d.Newest, 0)).Hours() / 24))
+		}
+		cw.Write([]string{d.Owner, dept, path, d.Source, formatBytes(d.Size), strconv.FormatInt(d.Size, 10), strconv.FormatInt(d.Files, 10), formatDate(d.Newest), days})
+	}
+	for _, t := range totals {
+		for _, d := range groups[t.Owner] {
+			row(d, filepath.Base(d.Path), shownPath(d.Path))
+		}
+		label := fmt.Sprintf("Total (%d departments)", len(groups[t.Owner]))
+		if len(groups[t.Owner]) == 1 {
+			label = "Total (1 department)"
+		}
+		row(t, label, "")
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(name, buf.Bytes()); err != nil {
+		return err
+	}
+	signFile(name)
+	return nil
+}
+
+// printDepartments shows the largest departments and the owners' totals
+func printDepartments() {
+	list := collectDepartments()
+	if len(list) == 0 {
+		fmt.Println("\nNo departments (directories right below the scanned paths) found.")
+		return
+	}
+	fmt.Printf("\n--- Top %d Departments by Size ---\n", topN)
+	fmt.Printf("%-15s | %-15s | %-13s | %-20s | %s\n", "Size", "Files", "Last Activity", "Owner", "Department")
+	fmt.Println(strings.Repeat("-", 90))
+	for i, d := range list {
+		if i >= topN {
+			break
+		}
+		fmt.Printf("%-15s | %-15s | %-13s | %-20s | %s\n", formatBytes(d.Size), formatFiles(d.Files), formatDate(d.Newest), d.Owner, shownPath(d.Path))
+	}
+	totals, groups := departmentsByOwner(list)
+	fmt.Printf("\n--- Top %d Department Owners by Size ---\n", topN)
+	fmt.Printf("%-15s | %-15s | %-13s | %-11s | %s\n", "Size", "Files", "Last Activity", "Departments", "Owner")
+	fmt.Println(strings.Repeat("-", 90))
+	for i, t := range totals {
+		if i >= topN {
+			break
+		}
+		fmt.Printf("%-15s | %-15s | %-13s | %-11s | %s\n", formatBytes(t.Size), formatFiles(t.Files), formatDate(t.Newest), formatCount(int64(len(groups[t.Owner]))), t.Owner)
+	}
+}
+
+// --- Permissions ---
+
+// notePermissions adds a file's (or the directory's own) mode to the permission summary of s.
+func notePermissions(s *DirStat, mode fs.FileMode, isDir bool) {
+	s.ModeUnion |= mode & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+	if isDir {
+		if mode&0o002 != 0 && mode&fs.ModeSticky == 0 {
+			s.OpenDirs++ // Anyone can delete or replace anyone's files in it
+		}
+		return
+	}
+	if !mode.IsRegular() {
+		return // Symlink modes are always 0777 and meaningless
+	}
+	if mode&0o020 != 0 {
+		s.GroupWritable++
+	}
+	if mode&0o002 != 0 {
+		s.OtherWritable++
+	}
+	if mode&(fs.ModeSetuid|fs.ModeSetgid) != 0 {
+		s.SetID++
+	}
+}
+
+// modeOctal formats permission and special bits the way chmod takes them, e.g. 4755 or 1777.
+func modeOctal(m fs.FileMode) string {
+	v := uint32(m.Perm())
+	if m&fs.ModeSetuid != 0 {
+		v |= 0o4000
+	}
+	if m&fs.ModeSetgid != 0 {
+		v |= 0o2000
+	}
+	if m&fs.ModeSticky != 0 {
+		v |= 0o1000
+	}
+	return fmt.Sprintf("%04o", v)
+}
+
+// printPermissions ranks directories by the files others can modify, so a storage review doubles as
+// a permission audit without a separate find -perm run. Like the size rankings, totals include
+// subdirectories; Widest is the union of all modes in the subtree (e.g. 6777 means that somewhere
+// below there is a setuid, a setgid and a world-writable entry).
+func printPermissions() {
+	var ranked []*DirStat
+	for _, s := range dirStats {
+		if s.OtherWritable+s.GroupWritable+s.SetID+s.OpenDirs > 0 && isUnderTargets(s.Path) {
+			ranked = append(ranked, s)
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.OtherWritable+a.OpenDirs != b.OtherWritable+b.OpenDirs {
+			return a.OtherWritable+a.OpenDirs > b.OtherWritable+b.OpenDirs
+		}
+		if a.GroupWritable+a.SetID != b.GroupWritable+b.SetID {
+			return a.GroupWritable+a.SetID > b.GroupWritable+b.SetID
+		}
+		return a.Path < b.Path
+	})
+
+	fmt.Printf("\n--- Top %d Directories by Files Writable by Others ---\n", topN)
+	fmt.Printf("%-12s | %-12s | %-12s | %-12s | %-6s | %-50s\n", "Other-Writ.", "Group-Writ.", "Setuid/gid", "Open Dirs", "Widest", "Path")
+	fmt.Println(strings.Repeat("-", 90))
+	for i, s := range ranked {
+		if i >= topN {
+			break
+		}
+		fmt.Printf("%-12d | %-12d | %-12d | %-12d | %-6s | %s\n", s.OtherWritable, s.GroupWritable, s.SetID, s.OpenDirs, modeOctal(s.ModeUnion), shownPath(s.Path))
+	}
+
+	var other, group, setID, open int64
+	for _, root := range targetPaths {
+		if s, ok := dirStats[root]; ok {
+			other += s.OtherWritable
+			group += s.GroupWritable
+			setID += s.SetID
+			open += s.OpenDirs
+		}
+	}
+	fmt.Printf("\nPermissions: %d other-writable file(s), %d group-writable file(s), %d setuid/setgid file(s), %d world-writable director(ies) without sticky bit\n",
+		other, group, setID, open)
+}
+
+// --- Analyzers ---
+//
+// Site-specific reports are added without changing this program: an analyzer receives the scanned
+// tree and returns named report sections, which are printed after the built-in reports. External
+// analyzers (--analyzer) are commands speaking a JSON protocol on stdin/stdout:
+//
+//	stdin:  one JSON object per line, a dirEvent (as published by --stream) for every reported
+//	        directory, largest first
+//	stdout: {"sections": [{"title": "...", "lines": ["..."]},
+//	                      {"title": "...", "columns": ["..."], "rows": [["..."]]}]}
+//
+// Their stderr is passed through; FS_ANALYZER_PROTOCOL, FS_ANALYZER_VERSION, FS_ANALYZER_TARGETS
+// (separated by the OS path list separator) and FS_ANALYZER_SIZE_MODE are set in their environment.
+
+// analyzerProtocol is bumped on incompatible changes of the analyzer protocol
+const analyzerProtocol = 1
+
+// reportSection is a named block of an analyzer's report: free text lines, a table, or both
+type reportSection struct {
+	Title   string     `json:"title"`
+	Lines   []string   `json:"lines,omitempty"`
+	Columns []string   `json:"columns,omitempty"`
+	Rows    [][]string `json:"rows,omitempty"`
+}
+
+// analyzer is implemented by report generators that work on the aggregated directories
+type analyzer interface {
+	Name() string
+	Analyze(list []*DirStat, startTime time.Time) ([]reportSection, error)
+}
+
+// Registered analyzers, run in order of registration
+var analyzers []analyzer
+
+func registerAnalyzer(a analyzer) {
+	analyzers = append(analyzers, a)
+}
+
+// commandAnalyzer runs an external command (through the shell, so pipes and arguments work)
+type commandAnalyzer struct {
+	Command string
+}
+
+func (a *commandAnalyzer) Name() string { return a.Command }
+
+func (a *commandAnalyzer) Analyze(list []*DirStat, startTime time.Time) ([]reportSection, error) {
+	host, _ := os.Hostname()
+	owners := make(map[int64]string)
+	var input bytes.Buffer
+	enc := json.NewEncoder(&input)
+	for _, s := range list {
+		if err := enc.Encode(newDirEvent(s, host, startTime, owners)); err != nil {
+			return nil, err
+		}
+	}
+
+	var targets []string
+	for _, root := range targetPaths {
+		if abs, err := filepath.Abs(root); err == nil {
+			targets = append(targets, shownPath(abs))
+		}
+	}
+	cmd := shellCommand(a.Command)
+	cmd.Stdin = &input
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"FS_ANALYZER_PROTOCOL="+strconv.Itoa(analyzerProtocol),
+		"FS_ANALYZER_VERSION="+version,
+		"FS_ANALYZER_TARGETS="+strings.Join(targets, string(os.PathListSeparator)),
+		"FS_ANALYZER_SIZE_MODE="+sizeMode)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Sections []reportSection `json:"sections"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, fmt.Errorf("invalid output (expected {\"sections\": [...]}): %v", err)
+	}
+	return result.Sections, nil
+}
+
+// shellCommand runs cmdline with the platform's shell
+func shellCommand(cmdline string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", cmdline)
+	}
+	return exec.Command("/bin/sh", "-c", cmdline)
+}
+
+// printAnalyzerReports runs every registered analyzer on the reported directories, largest first.
+// A failing analyzer only costs its own sections.
+func printAnalyzerReports(list []*DirStat, startTime time.Time) {
+	sorted := slices.Clone(list)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].TotalSize != sorted[j].TotalSize {
+			return sorted[i].TotalSize > sorted[j].TotalSize
+		}
+		return sorted[i].Path < sorted[j].Path
+	})
+	for _, a := range analyzers {
+		sections, err := a.Analyze(sorted, startTime)
+		if err != nil {
+			fmt.Printf("\nWarning: Analyzer %s failed: %v\n", a.Name(), err)
+			continue
+		}
+		for _, sec := range sections {
+			printReportSection(sec)
+		}
+	}
+}
+
+// printReportSection prints a section in the style of the built-in reports
+func printReportSection(sec reportSection) {
+	fmt.Printf("\n--- %s ---\n", sec.Title)
+	for _, line := range sec.Lines {
+		fmt.Println(line)
+	}
+	if len(sec.Columns) == 0 {
+		return
+	}
+	widths := make([]int, len(sec.Columns))
+	for i, c := range sec.Columns {
+		widths[i] = utf8.RuneCountInString(c)
+	}
+	for _, row := range sec.Rows {
+		for i := 0; i < len(row) && i < len(widths); i++ {
+			widths[i] = max(widths[i], utf8.RuneCountInString(row[i]))
+		}
+	}
+	printRow := func(cells []string) {
+		parts := make([]string, len(widths))
+		for i := range widths {
+			cell := ""
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			if i < len(widths)-1 {
+				cell += strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			}
+			parts[i] = cell
+		}
+		fmt.Println(strings.Join(parts, " | "))
+	}
+	printRow(sec.Columns)
+	total := 3 * (len(widths) - 1)
+	for _, w := range widths {
+		total += w
+	}
+	fmt.Println(strings.Repeat("-", min(total, 120)))
+	for _, row := range sec.Rows {
+		printRow(row)
+	}
+}
+
+// --- Budgets ---
+//
+// --budget <dir>=<size> is the size a directory may grow to; the directories over their budget are
+// counted as dirs_over_budget, and check lists them (and files tickets for them with --ticket).
+
+// dirBudget is the size a directory may grow to (--budget)
+type dirBudget struct {
+	Dir  string // Absolute path
+	Size int64
+}
+
+var budgets []dirBudget // --budget
+
+var (
+	ticketTarget  = ""        // --ticket github:<owner>/<repo> or jira:<project key>
+	ticketAPI     = ""        // --ticket-api, default https://api.github.com for GitHub
+	ticketHeaders [][2]string // --ticket-header
+	ticketBody    = texttemplate.Must(texttemplate.New("ticket").Funcs(templateFuncs).Parse(defaultTicketBody))
+)
+
+// defaultTicketBody is the issue text unless --ticket-template is given
+const defaultTicketBody = `{{.Path}} on {{.Host}} holds {{bytes .Size}} in {{.Files}} files, over its budget of {{bytes .Budget}} (scan of {{.Scanned}}).
+
+Largest subdirectories:
+{{range .Children}}- {{.Path}}: {{bytes .Size}} in {{.Files}} files
+{{else}}- (no subdirectories)
+{{end}}`
+
+// budgetBreach is a directory over its budget, as passed to the ticket template
+type budgetBreach struct {
+	Host     string
+	Path     string
+	Size     int64
+	Budget   int64
+	Files    int64
+	Scanned  string
+	Children []targetSummary // Largest subdirectories, up to --top
+}
+
+// Title is the issue title, also used to find the open issue of an earlier run
+func (b budgetBreach) Title() string {
+	return fmt.Sprintf("Disk budget exceeded: %s on %s", b.Path, b.Host)
+}
+
+// findBudgetBreaches returns the directories over their --budget
+func findBudgetBreaches(sum runSummary) []budgetBreach {
+	var breaches []budgetBreach
+	for _, b := range budgets {
+		s, ok := dirStats[b.Dir]
+		if !ok || s.TotalSize <= b.Size {
+			continue
+		}
+		var children []*DirStat
+		for p, c := range dirStats {
+			if filepath.Dir(p) == b.Dir && p != b.Dir {
+				children = append(children, c)
+			}
+		}
+		sort.Slice(children, func(i, j int) bool {
+			if children[i].TotalSize != children[j].TotalSize {
+				return children[i].TotalSize > children[j].TotalSize
+			}
+			return children[i].Path < children[j].Path
+		})
+		breach := budgetBreach{Host: sum.Host, Path: shownPath(b.Dir), Size: s.TotalSize, Budget: b.Size, Files: s.FileCount, Scanned: sum.Start}
+		for i, c := range children {
+			if i >= topN {
+				break
+			}
+			breach.Children = append(breach.Children, targetSummary{shownPath(c.Path), c.TotalSize, c.FileCount})
+		}
+		breaches = append(breaches, breach)
+	}
+	return breaches
+}
+
+// --- Path Lengths ---
+
+// Path limits that downstream tools commonly hit
+const (
+	windowsMaxPath = 260  // MAX_PATH, in UTF-16 code units (including the drive, e.g. C:\)
+	linuxPathMax   = 4096 // PATH_MAX, in bytes
+	nameMax        = 255  // NAME_MAX, bytes per component on most Unix file systems
+)
+
+var (
+	longestPaths       []string // Top N paths by length in bytes, longest first
+	depthCounts        = make(map[int]int64)
+	depthExamples      = make(map[int]string)
+	overWindowsMaxPath int64
+	overLinuxPathMax   int64
+	overNameMax        int64
+)
+
+// utf16Len returns the length of s in UTF-16 code units, as Windows counts path lengths
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n++
+		}
+		n++
+	}
+	return n
+}
+
+// notePathLength records the length and nesting depth (components of the absolute path) of an entry
+func notePathLength(path string) {
+	depth := strings.Count(strings.TrimSuffix(path, string(os.PathSeparator)), string(os.PathSeparator))
+	if depthCounts[depth] == 0 {
+		depthExamples[depth] = path
+	}
+	depthCounts[depth]++
+
+	if utf16Len(path) >= windowsMaxPath {
+		overWindowsMaxPath++
+	}
+	if len(path) >= linuxPathMax {
+		overLinuxPathMax++
+	}
+	if len(filepath.Base(path)) > nameMax {
+		overNameMax++
+	}
+
+	if len(longestPaths) >= topN && len(path) <= len(longestPaths[len(longestPaths)-1]) {
+		return
+	}
+	i := sort.Search(len(longestPaths), func(i int) bool { return len(longestPaths[i]) < len(path) })
+	longestPaths = append(longestPaths, "")
+	copy(longestPaths[i+1:], longestPaths[i:])
+	longestPaths[i] = path
+	if len(longestPaths) > topN {
+		longestPaths = longestPaths[:topN]
+	}
+}
+
+func printPathLengths() {
+	var depths []int
+	for d := range depthCounts {
+		depths = append(depths, d)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(depths)))
+	fmt.Println("\n--- Deepest Nesting Levels ---")
+	fmt.Printf("%-15s | %-15s | %-50s\n", "Depth", "Entries", "Example")
+	fmt.Println(strings.Repeat("-", 70))
+	for i, d := range depths {
+		if i >= 5 {
+			break
+		}
+		fmt.Printf("%-15d | %-15d | %s\n", d, depthCounts[d], shownPath(depthExamples[d]))
+	}
+
+	fmt.Printf("\n--- Top %d Longest Paths ---\n", topN)
+	fmt.Printf("%-7s | %-7s | %-50s\n", "Bytes", "Chars", "Path")
+	fmt.Println(strings.Repeat("-", 70))
+	for _, p := range longestPaths {
+		fmt.Printf("%-7d | %-7d | %s\n", len(p), utf16Len(p), shownPath(p))
+	}
+	fmt.Printf("Paths of %d+ characters (Windows MAX_PATH): %d, of %d+ bytes (Linux PATH_MAX): %d, names over %d bytes: %d\n",
+		windowsMaxPath, overWindowsMaxPath, linuxPathMax, overLinuxPathMax, nameMax, overNameMax)
+}
+
+// --- Name Audit ---
+
+// nameIssues counts problematic names directly inside one directory (--name-audit)
+type nameIssues struct {
+	Dir           string
+	InvalidUTF8   int64
+	Control       int64
+	Trailing      int64 // Trailing space or dot, dropped by Windows
+	Reserved      int64 // Windows device names such as CON, NUL.txt, COM1
+	CaseCollision int64 // Names equal to a sibling except for case
+	Example       string
+}
+
+func (n *nameIssues) total() int64 {
+	return n.InvalidUTF8 + n.Control + n.Trailing + n.Reserved + n.CaseCollision
+}
+
+var nameAuditStats = make(map[string]*nameIssues)
+
+// auditFrame holds the lower-cased names seen in one directory that is still being walked
+type auditFrame struct {
+	dir   string
+	names map[string]bool
+}
+
+// Directories on the current walk path; a directory's frame is dropped once the walk leaves it,
+// so case collisions are found without keeping every name of the tree in memory.
+var auditStack []auditFrame
+
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// noteCaseName records an entry's name in its directory and reports whether a sibling differing
+// only in case was seen before. isRoot is true for target roots, whose names are not checked.
+func noteCaseName(path string, isDir bool) (collision, isRoot bool) {
+	dir, name := filepath.Dir(path), filepath.Base(path)
+	for len(auditStack) > 0 && auditStack[len(auditStack)-1].dir != dir {
+		auditStack = auditStack[:len(auditStack)-1]
+	}
+	if len(auditStack) == 0 {
+		auditStack = append(auditStack, auditFrame{dir: path, names: make(map[string]bool)})
+		return false, true
+	}
+	frame := auditStack[len(auditStack)-1]
+	lower := strings.ToLower(name)
+	collision = frame.names[lower]
+	frame.names[lower] = true
+	if isDir {
+		auditStack = append(auditStack, auditFrame{dir: path, names: make(map[string]bool)})
+	}
+	return collision, false
+}
+
+func auditName(path string, collision bool) {
+	dir, name := filepath.Dir(path), filepath.Base(path)
+	issues := nameIssues{}
+	if !utf8.ValidString(name) {
+		issues.InvalidUTF8 = 1
+	}
+	if strings.IndexFunc(name, func(r rune) bool { return r < 0x20 || r == 0x7f }) >= 0 {
+		issues.Control = 1
+	}
+	if strings.HasSuffix(name, " ") || strings.HasSuffix(name, ".") {
+		issues.Trailing = 1
+	}
+	stem := strings.TrimRight(strings.SplitN(name, ".", 2)[0], " ")
+	if windowsReservedNames[strings.ToUpper(stem)] {
+		issues.Reserved = 1
+	}
+	if collision {
+		issues.CaseCollision = 1
+	}
+
+	if issues.total() == 0 {
+		return
+	}
+	s, ok := nameAuditStats[dir]
+	if !ok {
+		s = &nameIssues{Dir: dir, Example: name}
+		nameAuditStats[dir] = s
+	}
+	s.InvalidUTF8 += issues.InvalidUTF8
+	s.Control += issues.Control
+	s.Trailing += issues.Trailing
+	s.Reserved += issues.Reserved
+	s.CaseCollision += issues.CaseCollision
+}
+
+// printableName quotes names with invalid UTF-8 or control characters so they are safe to print
+func printableName(s string) string {
+	if utf8.ValidString(s) && strings.IndexFunc(s, unicode.IsControl) < 0 {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+func printNameAudit() {
+	var list []*nameIssues
+	var sum nameIssues
+	for _, s := range nameAuditStats {
+		list = append(list, s)
+		sum.InvalidUTF8 += s.InvalidUTF8
+		sum.Control += s.Control
+		sum.Trailing += s.Trailing
+		sum.Reserved += s.Reserved
+		sum.CaseCollision += s.CaseCollision
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].total() != list[j].total() {
+			return list[i].total() > list[j].total()
+		}
+		return list[i].Dir < list[j].Dir
+	})
+
+	fmt.Printf("\n--- Name Audit: Top %d Directories by Problematic Names ---\n", topN)
+	fmt.Printf("%-6s | %-6s | %-6s | %-6s | %-6s | %-6s | %s\n", "Total", "UTF-8", "Ctrl", "Trail", "Rsvd", "Case", "Directory (Example)")
+	fmt.Println(strings.Repeat("-", 70))
+	for i, s := range list {
+		if i >= topN {
+			break
+		}
+		fmt.Printf("%-6d | %-6d | %-6d | %-6d | %-6d | %-6d | %s (%s)\n", s.total(), s.InvalidUTF8, s.Control, s.Trailing, s.Reserved, s.CaseCollision,
+			printableName(shownPath(s.Dir)), printableName(shownPath(s.Example)))
+	}
+	fmt.Printf("Total: %d invalid UTF-8, %d with control characters, %d with trailing space/dot, %d reserved device names, %d case collisions\n",
+		sum.InvalidUTF8, sum.Control, sum.Trailing, sum.Reserved, sum.CaseCollision)
+}
+
+// --- Target File System Compatibility ---
+
+// fsLimits describes what a target file system (as used by its usual OS) cannot store
+type fsLimits struct {
+	MaxName         int    // Longest name
+	MaxPath         int    // Longest path below the target root, 0 for no practical limit
+	UTF16           bool   // Lengths count UTF-16 code units instead of bytes
+	InvalidChars    string // Characters not allowed in names (besides / and NUL)
+	NoControl       bool   // Control characters 0x01-0x1F are not allowed
+	NoTrailing      bool   // Trailing spaces/dots are dropped (Windows)
+	NoReserved      bool   // Windows device names are not allowed
+	RequireUTF8     bool   // Names must be valid UTF-8 (or are converted to UTF-16)
+	MaxFileSize     int64  // 0 for no practical limit
+	Symlinks        bool
+	Hardlinks       bool
+	CaseInsensitive bool
+}
+
+var targetFSLimits = map[string]fsLimits{
+	// MAX_PATH (260 including the NUL) still applies to most Windows applications
+	"ntfs":  {MaxName: 255, MaxPath: 259, UTF16: true, InvalidChars: `<>:"\|?*`, NoControl: true, NoTrailing: true, NoReserved: true, RequireUTF8: true, Symlinks: true, Hardlinks: true, CaseInsensitive: true},
+	"exfat": {MaxName: 255, UTF16: true, InvalidChars: `<>:"\|?*`, NoControl: true, NoTrailing: true, NoReserved: true, RequireUTF8: true, CaseInsensitive: true},
+	"fat32": {MaxName: 255, UTF16: true, InvalidChars: `<>:"\|?*`, NoControl: true, NoTrailing: true, NoReserved: true, RequireUTF8: true, MaxFileSize: 1<<32 - 1, CaseInsensitive: true},
+	// APFS stores UTF-8 names and is case-insensitive by default
+	"apfs": {MaxName: 255, RequireUTF8: true, Symlinks: true, Hardlinks: true, CaseInsensitive: true},
+	// PATH_MAX (4096 including the NUL) limits the path in system calls
+	"ext4": {MaxName: 255, MaxPath: 4095, Symlinks: true, Hardlinks: true},
+}
+
+// fsIssues counts entries directly inside one directory that would break on the target
+type fsIssues struct {
+	Dir     string
+	Length  int64 // Name or path too long
+	Chars   int64 // Invalid characters, encoding, trailing space/dot or device name
+	Size    int64 // File too large
+	Links   int64 // Symlink or hard link not supported
+	Case    int64 // Collides with a sibling on a case-insensitive target
+	Example string
+}
+
+func (n *fsIssues) total() int64 {
+	return n.Length + n.Chars + n.Size + n.Links + n.Case
+}
+
+var targetFSStats = make(map[string]*fsIssues)
+
+// checkTargetFS checks one entry (rel is its slash-separated path below the target) against the
+// limits of --target-fs.
+func checkTargetFS(path, rel string, d fs.DirEntry, collision bool) {
+	limits := targetFSLimits[targetFS]
+	name := d.Name()
+	length := func(s string) int {
+		if limits.UTF16 {
+			return utf16Len(s)
+		}
+		return len(s)
+	}
+
+	var issues fsIssues
+	if length(name) > limits.MaxName || limits.MaxPath > 0 && length(rel) > limits.MaxPath {
+		issues.Length = 1
+	}
+	badChar := func(r rune) bool {
+		return strings.ContainsRune(limits.InvalidChars, r) || limits.NoControl && r < 0x20
+	}
+	stem := strings.TrimRight(strings.SplitN(name, ".", 2)[0], " ")
+	if strings.IndexFunc(name, badChar) >= 0 ||
+		limits.RequireUTF8 && !utf8.ValidString(name) ||
+		limits.NoTrailing && (strings.HasSuffix(name, " ") || strings.HasSuffix(name, ".")) ||
+		limits.NoReserved && windowsReservedNames[strings.ToUpper(stem)] {
+		issues.Chars = 1
+	}
+	if limits.CaseInsensitive && collision {
+		issues.Case = 1
+	}
+	if d.Type()&fs.ModeSymlink != 0 {
+		if !limits.Symlinks {
+			issues.Links = 1
+		}
+	} else if !d.IsDir() && (limits.MaxFileSize > 0 || !limits.Hardlinks) {
+		if info, err := d.Info(); err == nil {
+			if limits.MaxFileSize > 0 && info.Size() > limits.MaxFileSize {
+				issues.Size = 1
+			}
+			if nlink, ok := statField(info, "Nlink"); ok && nlink > 1 && !limits.Hardlinks {
+				issues.Links = 1
+			}
+		}
+	}
+
+	if issues.total() == 0 {
+		return
+	}
+	dir := filepath.Dir(path)
+	s, ok := targetFSStats[dir]
+	if !ok {
+		s = &fsIssues{Dir: dir, Example: name}
+		targetFSStats[dir] = s
+	}
+	s.Length += issues.Length
+	s.Chars += issues.Chars
+	s.Size += issues.Size
+	s.Links += issues.Links
+	s.Case += issues.Case
+}
+
+func printTargetFSReport() {
+	var list []*fsIssues
+	var sum fsIssues
+	for _, s := range targetFSStats {
+		list = append(list, s)
+		sum.Length += s.Length
+		sum.Chars += s.Chars
+		sum.Size += s.Size
+		sum.Links += s.Links
+		sum.Case += s.Case
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].total() != list[j].total() {
+			return list[i].total() > list[j].total()
+		}
+		return list[i].Dir < list[j].Dir
+	})
+
+	fmt.Printf("\n--- Compatibility with %s: Top %d Directories by Incompatible Entries ---\n", targetFS, topN)
+	fmt.Printf("%-6s | %-6s | %-6s | %-6s | %-6s | %-6s | %s\n", "Total", "Length", "Chars", "Size", "Links", "Case", "Directory (Example)")
+	fmt.Println(strings.Repeat("-", 70))
+	for i, s := range list {
+		if i >= topN {
+			break
+		}
+		fmt.Printf("%-6d | %-6d | %-6d | %-6d | %-6d | %-6d | %s (%s)\n", s.total(), s.Length, s.Chars, s.Size, s.Links, s.Case,
+			printableName(shownPath(s.Dir)), printableName(shownPath(s.Example)))
+	}
+	fmt.Printf("Total: %d too long, %d invalid names, %d too large, %d unsupported links, %d case collisions\n",
+		sum.Length, sum.Chars, sum.Size, sum.Links, sum.Case)
+}
+
+// --- Name Patterns ---
+
+// patternStat is the usage of one family of generated file names (--name-patterns)
+type patternStat struct {
+	Pattern string
+	Example string
+	Size    int64
+	Files   int64
+}
+
+var namePatternStats = make(map[string]*patternStat)
+
+func recordNamePattern(name string, size int64) {
+	pattern := namePattern(name)
+	p, ok := namePatternStats[pattern]
+	if !ok {
+		p = &patternStat{Pattern: pattern, Example: name}
+		namePatternStats[pattern] = p
+	}
+	p.Size += size
+	p.Files++
+}
+
+// namePattern reduces a file name to its family by replacing the variable parts with "*":
+// runs of digits including date/time separators between them (app-2024-01-02.log, core.12345,
+// cache_0001.tmp) and hex ids/UUIDs of 8+ characters. A short extension with letters is kept.
+func namePattern(name string) string {
+	stem, ext := name, filepath.Ext(name)
+	if ext != name && len(ext) <= 6 && strings.IndexFunc(ext, unicode.IsLetter) >= 0 {
+		stem = strings.TrimSuffix(name, ext)
+	} else {
+		ext = ""
+	}
+
+	isAlnum := func(c byte) bool { return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+	isHex := func(c byte) bool { return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F' }
+
+	var b strings.Builder
+	for i := 0; i < len(stem); {
+		// Hex id or UUID as a whole word
+		if i == 0 || !isAlnum(stem[i-1]) {
+			j, hexChars, digits := i, 0, 0
+			for j < len(stem) && (isHex(stem[j]) || stem[j] == '-' && j > i) {
+				if stem[j] != '-' {
+					hexChars++
+				}
+				if isDigit(stem[j]) {
+					digits++
+				}
+				j++
+			}
+			if hexChars >= 8 && digits > 0 && digits < hexChars && (j == len(stem) || !isAlnum(stem[j])) {
+				b.WriteByte('*')
+				i = j
+				continue
+			}
+		}
+		// Numbers, including separators between digits (dates, times, versions)
+		if isDigit(stem[i]) {
+			j := i
+			for j < len(stem) && (isDigit(stem[j]) || strings.IndexByte("-_:.T", stem[j]) >= 0 && j+1 < len(stem) && isDigit(stem[j+1])) {
+				j++
+			}
+			b.WriteByte('*')
+			i = j
+			continue
+		}
+		b.WriteByte(stem[i])
+		i++
+	}
+	return b.String() + ext
+}
+
+// printNamePatterns lists the name families that use the most space; families with a single
+// file are left out, they are not generated names.
+func printNamePatterns() {
+	var list []*patternStat
+	for _, p := range namePatternStats {
+		if p.Files > 1 && p.Pattern != p.Example {
+			list = append(list, p)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Size != list[j].Size {
+			return list[i].Size > list[j].Size
+		}
+		return list[i].Pattern < list[j].Pattern
+	})
+	fmt.Printf("\n--- Top %d File Name Patterns by Size ---\n", topN)
+	fmt.Printf("%-15s | %-15s | %-50s\n", "Size", "Files", "Pattern (Example)")
+	fmt.Println(strings.Repeat("-", 70))
+	for i, p := range list {
+		if i >= topN {
+			break
+		}
+		fmt.Printf("%-15s | %-15s | %s (%s)\n", formatBytes(p.Size), formatFiles(p.Files), shownPath(p.Pattern), shownPath(p.Example))
+	}
+}
+
+// --- Project Attribution ---
+
+// noteProjectMarker marks the parent of a marker entry (e.g. .git, go.mod) as a project root.
+// A .owner file names the owner in its first line; projects with the same owner are grouped.
+// Markers inside node_modules are ignored, otherwise every npm package would become a project.
+func noteProjectMarker(path string) {
+	name := filepath.Base(path)
+	isMarker := false
+	for _, m := range projectMarkers {
+		if name == m {
+			isMarker = true
+			break
+		}
+	}
+	dir := filepath.Dir(path)
+	if !isMarker || strings.Contains(dir+string(os.PathSeparator), string(os.PathSeparator)+"node_modules"+string(os.PathSeparator)) {
+		return
+	}
+	if name == ".owner" {
+		if data, err := readMarkerFile(path); err == nil {
+			if owner, _, _ := strings.Cut(strings.TrimSpace(string(data)), "\n"); strings.TrimSpace(owner) != "" {
+				projectRoots[dir] = "owner: " + strings.TrimSpace(owner)
+				return
+			}
+		}
+	}
+	if _, ok := projectRoots[dir]; !ok {
+		projectRoots[dir] = ""
+	}
+}
+
+// projectUsage is the aggregated usage of one project or owner
+type projectUsage struct {
+	Label string
+	Size  int64
+	Files int64
+}
+
+// projectOf returns the group label of the nearest project root at or above dir (within the
+// targets), caching the answer for every directory visited on the way up.
+func projectOf(dir string, cache map[string]string) string {
+	var visited []string
+	label := "(no project)"
+	for p := dir; ; p = filepath.Dir(p) {
+		if l, ok := cache[p]; ok {
+			label = l
+			break
+		}
+		visited = append(visited, p)
+		if l, ok := projectRoots[p]; ok {
+			label = l
+			if label == "" {
+				label = shownPath(p)
+			}
+			break
+		}
+		if isExactTarget(p) || filepath.Dir(p) == p {
+			break
+		}
+	}
+	for _, p := range visited {
+		cache[p] = label
+	}
+	return label
+}
+
+// computeProjectUsage attributes the files of every scanned directory to its nearest project.
+func computeProjectUsage() []*projectUsage {
+	cache := make(map[string]string)
+	groups := make(map[string]*projectUsage)
+	for p, s := range dirStats {
+		if s.OwnFiles == 0 || !isUnderTargets(p) {
+			continue
+		}
+		label := projectOf(p, cache)
+		g, ok := groups[label]
+		if !ok {
+			g = &projectUsage{Label: label}
+			groups[label] = g
+		}
+		g.Size += s.OwnSize
+		g.Files += s.OwnFiles
+	}
+	list := make([]*projectUsage, 0, len(groups))
+	for _, g := range groups {
+		list = append(list, g)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Size > list[j].Size
+	})
+	return list
+}
+
+// printProjectUsage prints the "storage by project" report.
+func printProjectUsage() {
+	list := computeProjectUsage()
+	fmt.Printf("\n--- Top %d Projects/Owners by Size ---\n", topN)
+	if costPerGB > 0 {
+		fmt.Printf("%-15s | %-15s | %-16s | %-50s\n", "Size", "Files", "Cost/Month", "Project")
+	} else {
+		fmt.Printf("%-15s | %-15s | %-50s\n", "Size", "Files", "Project")
+	}
+	fmt.Println(strings.Repeat("-", 70))
+	for i, g := range list {
+		if i >= topN {
+			break
+		}
+		if costPerGB > 0 {
+			fmt.Printf("%-15s | %-15s | %-16s | %s\n", formatBytes(g.Size), formatFiles(g.Files), formatCost(g.Size), g.Label)
+			continue
+		}
+		fmt.Printf("%-15s | %-15s | %s\n", formatBytes(g.Size), formatFiles(g.Files), g.Label)
+	}
+}
+
+// componentGroup sums everything below the directories sharing one name at component groupLevel
+type componentGroup struct {
+	Label string
+	Size  int64
+	Files int64
+	Dirs  map[string]bool // Distinct directories merged into the group
+}
+
+// componentAt returns the directory made of the first n components of an absolute path (the
+// volume does not count), or "" if the path is shallower.
+func componentAt(p string, n int) string {
+	volume := filepath.VolumeName(p)
+	rest := p[len(volume):]
+	end := 0
+	for ; n > 0; n-- {
+		for end < len(rest) && rest[end] == os.PathSeparator {
+			end++
+		}
+		if end == len(rest) {
+			return ""
+		}
+		next := strings.IndexRune(rest[end:], os.PathSeparator)
+		if next < 0 {
+			end = len(rest)
+		} else {
+			end += next
+		}
+	}
+	return volume + rest[:end]
+}
+
+// computeComponentGroups attributes the files of every scanned directory to the name of its
+// component at groupLevel (--group-by-component). Files above that level are reported as one
+// "(above component N)" group.
+func computeComponentGroups() []*componentGroup {
+	groups := make(map[string]*componentGroup)
+	for p, s := range dirStats {
+		if s.OwnFiles == 0 || !isUnderTargets(p) {
+			continue
+		}
+		dir := componentAt(p, groupLevel)
+		label := fmt.Sprintf("(above component %d)", groupLevel)
+		if dir != "" {
+			label = filepath.Base(dir)
+			if anonymize {
+				label = anonymizePath(label)
+			}
+		}
+		g, ok := groups[label]
+		if !ok {
+			g = &componentGroup{Label: label, Dirs: make(map[string]bool)}
+			groups[label] = g
+		}
+		g.Size += s.OwnSize
+		g.Files += s.OwnFiles
+		if dir != "" {
+			g.Dirs[dir] = true
+		}
+	}
+	list := make([]*componentGroup, 0, len(groups))
+	for _, g := range groups {
+		list = append(list, g)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Size != list[j].Size {
+			return list[i].Size > list[j].Size
+		}
+		return list[i].Label < list[j].Label
+	})
+	return list
+}
+
+// printComponentGroups prints one row per name at component groupLevel; a group made of a single
+// directory shows its path, otherwise the name and the number of directories merged.
+func printComponentGroups() {
+	list := computeComponentGroups()
+	fmt.Printf("\n--- Top %d Groups by Size (path component %d) ---\n", topN, groupLevel)
+	fmt.Printf("%-15s | %-15s | %-50s\n", "Size", "Files", "Group")
+	fmt.Println(strings.Repeat("-", 70))
+	for i, g := range list {
+		if i >= topN && !showAll {
+			break
+		}
+		label := g.Label
+		if len(g.Dirs) == 1 {
+			for d := range g.Dirs {
+				label = shownPath(d)
+			}
+		} else if len(g.Dirs) > 1 {
+			label = fmt.Sprintf("%s (%d directories)", g.Label, len(g.Dirs))
+		}
+		fmt.Printf("%-15s | %-15s | %s\n", formatBytes(g.Size), formatFiles(g.Files), label)
+	}
+	if len(list) == 0 {
+		fmt.Println("(no files found)")
+	}
+}
+
+// --- Path Templates ---
+
+// pathTemplate extracts named labels from directory paths (--path-template), e.g.
+// /data/{team}/{project}/** labels /data/ml/vision/raw with team=ml and project=vision.
+type pathTemplate struct {
+	parts   []string // One per component: {label}, a glob pattern or a plain name
+	anyRest bool     // Ends with **: the directories below inherit the labels
+}
+
+var (
+	pathTemplates []pathTemplate
+	labelNames    []string                             // Labels of all templates, in order of appearance
+	labelCache    = make(map[string]map[string]string) // Labels per directory (nil: no template matches)
+)
+
+// reservedColumns are the export columns a label may not be named after
+var reservedColumns = []string{"path", "size", "files", "own_size", "own_files", "depth", "newest_mtime",
+	"oldest_mtime", "owner_uid", "owner", "fingerprint", "tags"}
+
+// parsePathTemplate parses an absolute path template; labels are whole components in braces and
+// ** may only be the last component. New label names are added to labelNames.
+func parsePathTemplate(s string) (pathTemplate, error) {
+	var t pathTemplate
+	p := filepath.ToSlash(s[len(filepath.VolumeName(s)):])
+	if !strings.HasPrefix(p, "/") {
+		return t, fmt.Errorf("the template must be an absolute path")
+	}
+	var names []string
+	components := strings.Split(strings.Trim(p, "/"), "/")
+	for i, c := range components {
+		switch {
+		case c == "**":
+			if i != len(components)-1 {
+				return t, fmt.Errorf("** is only allowed as the last component")
+			}
+			t.anyRest = true
+			continue
+		case strings.HasPrefix(c, "{") && strings.HasSuffix(c, "}"):
+			name := c[1 : len(c)-1]
+			if name == "" || strings.ContainsAny(name, "{}*?[]\\") {
+				return t, fmt.Errorf("invalid label %s", c)
+			}
+			if slices.Contains(names, name) {
+				return t, fmt.Errorf("label %s is used twice", c)
+			}
+			if slices.Contains(reservedColumns, name) {
+				return t, fmt.Errorf("label %s would clash with the export column %s", c, name)
+			}
+			names = append(names, name)
+		case strings.ContainsAny(c, "{}"):
+			return t, fmt.Errorf("a label must be a whole component, not %s", c)
+		default:
+			if _, err := filepath.Match(c, ""); err != nil {
+				return t, fmt.Errorf("invalid pattern %s", c)
+			}
+		}
+		t.parts = append(t.parts, c)
+	}
+	if len(names) == 0 {
+		return t, fmt.Errorf("the template has no {label}")
+	}
+	for _, name := range names {
+		if !slices.Contains(labelNames, name) {
+			labelNames = append(labelNames, name)
+		}
+	}
+	return t, nil
+}
+
+// match returns the labels of a path given as components, or nil if it does not match
+func (t pathTemplate) match(components []string) map[string]string {
+	if len(components) < len(t.parts) || (len(components) > len(t.parts) && !t.anyRest) {
+		return nil
+	}
+	labels := make(map[string]string)
+	for i, part := range t.parts {
+		if strings.HasPrefix(part, "{") {
+			labels[part[1:len(part)-1]] = components[i]
+		} else if ok, _ := filepath.Match(part, components[i]); !ok {
+			return nil
+		}
+	}
+	return labels
+}
+
+// labelsOf returns the labels of the first template matching a directory. Templates are matched
+// against the path after --rewrite, so one template fits hosts that mount the data differently.
+func labelsOf(dir string) map[string]string {
+	if len(pathTemplates) == 0 {
+		return nil
+	}
+	if labels, ok := labelCache[dir]; ok {
+		return labels
+	}
+	p := rewritePath(dir)
+	p = filepath.ToSlash(p[len(filepath.VolumeName(p)):])
+	components := strings.Split(strings.Trim(p, "/"), "/")
+	var labels map[string]string
+	for _, t := range pathTemplates {
+		if labels = t.match(components); labels != nil {
+			break
+		}
+	}
+	labelCache[dir] = labels
+	return labels
+}
+
+// shownLabels returns the labels as they may appear in reports and exports (hashed with --anonymize)
+func shownLabels(labels map[string]string) map[string]string {
+	if !anonymize || labels == nil {
+		return labels
+	}
+	hashed := make(map[string]string, len(labels))
+	for name, value := range labels {
+		hashed[name] = anonymizePath(value)
+	}
+	return hashed
+}
+
+// labelUsage is the total of the files whose directory has the given label values; files that
+// match no template are summed in a group without labels.
+type labelUsage struct {
+	Labels map[string]string `json:"labels"`
+	Size   int64             `json:"size"`
+	Files  int64             `json:"files"`
+}
+
+// computeLabelUsage sums the files of every scanned directory by the values of the given labels
+func computeLabelUsage(names []string) []*labelUsage {
+	groups := make(map[string]*labelUsage)
+	for p, s := range dirStats {
+		if s.OwnFiles == 0 || !isUnderTargets(p) {
+			continue
+		}
+		labels := shownLabels(labelsOf(p))
+		key := "\x00" // No template matches
+		var values map[string]string
+		if labels != nil {
+			values = make(map[string]string, len(names))
+			key = ""
+			for _, name := range names {
+				values[name] = labels[name]
+				key += labels[name] + "\x00"
+			}
+		}
+		g, ok := groups[key]
+		if !ok {
+			g = &labelUsage{Labels: values}
+			groups[key] = g
+		}
+		g.Size += s.OwnSize
+		g.Files += s.OwnFiles
+	}
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if groups[keys[i]].Size != groups[keys[j]].Size {
+			return groups[keys[i]].Size > groups[keys[j]].Size
+		}
+		return keys[i] < keys[j]
+	})
+	list := make([]*labelUsage, 0, len(keys))
+	for _, key := range keys {
+		list = append(list, groups[key])
+	}
+	return list
+}
+
+// printLabelPivots prints the usage by each label and, with several labels, by all of them combined
+func printLabelPivots() {
+	pivots := make([][]string, 0, len(labelNames)+1)
+	for _, name := range labelNames {
+		pivots = append(pivots, []string{name})
+	}
+	if len(labelNames) > 1 {
+		pivots = append(pivots, labelNames)
+	}
+	for _, names := range pivots {
+		fmt.Printf("\n--- Top %d Usage by %s (path labels) ---\n", topN, strings.Join(names, " × "))
+		fmt.Printf("%-15s | %-15s | %s\n", "Size", "Files", labelColumns(names))
+		fmt.Println(strings.Repeat("-", 70))
+		for i, g := range computeLabelUsage(names) {
+			if i >= topN && !showAll {
+				break
+			}
+			label := "(no template matches)"
+			if g.Labels != nil {
+				values := make([]string, len(names))
+				for j, name := range names {
+					values[j] = g.Labels[name]
+					if values[j] == "" {
+						values[j] = "-"
+					}
+				}
+				label = labelColumns(values)
+			}
+			fmt.Printf("%-15s | %-15s | %s\n", formatBytes(g.Size), formatFiles(g.Files), label)
+		}
+	}
+}
+
+// labelColumns joins label names or values into columns of 20 characters
+func labelColumns(values []string) string {
+	var b strings.Builder
+	for i, v := range values {
+		if i < len(values)-1 {
+			fmt.Fprintf(&b, "%-20s | ", v)
+		} else {
+			b.WriteString(v)
+		}
+	}
+	return b.String()
+}
+
+// countInaccessible returns the number of unreadable entries below all targets.
+func countInaccessible() int64 {
+	var n int64
+	for _, root := range targetPaths {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		if s, ok := dirStats[absRoot]; ok {
+			n += s.Inaccessible
+		}
+	}
+	return n
+}
+
+// isSampled decides deterministically (by path hash) whether a subtree is walked in sampling mode,
+// so repeated runs pick the same subtrees.
+func isSampled(path string) bool {
+	h := fnv.New64a()
+	h.Write([]byte(path))
+	// FNV alone mixes the high bits poorly for paths sharing a long prefix; apply the splitmix64 finalizer
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return float64(x)/float64(math.MaxUint64) < sampleRate
+}
+
+// printSampleSummary prints the extrapolated totals of each root with 95% confidence intervals.
+func printSampleSummary() {
+	fmt.Printf("\n--- Sampling Estimate (%.4g%% of subtrees at depth %d) ---\n", sampleRate*100, sampleDepth)
+	fmt.Printf("%-15s | %-50s\n", "Metric", "Path")
+	fmt.Println(strings.Repeat("-", 70))
+	for _, root := range targetPaths {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		s, ok := dirStats[absRoot]
+		if !ok {
+			continue
+		}
+		sizeCI := int64(1.96 * math.Sqrt(s.SizeVariance))
+		countCI := int64(1.96 * math.Sqrt(s.CountVariance))
+		fmt.Printf("%-15s | %s (± %s, 95%% CI)\n", "~"+formatBytes(s.TotalSize), shownPath(absRoot), formatBytes(sizeCI))
+		fmt.Printf("%-15s | %s (± %s, 95%% CI)\n", "~"+formatFiles(s.FileCount), shownPath(absRoot), formatFiles(countCI))
+		fmt.Printf("%-15s | %s (%d of %d subtrees walked)\n", "Sampled", shownPath(absRoot), countSampledUnder(absRoot), sampleCandidates[absRoot])
+	}
+}
+
+// countSampledUnder returns the number of sampled subtrees below root.
+func countSampledUnder(root string) int {
+	n := 0
+	for p := range sampledRoots {
+		if isPathEqualOrSubpath(p, root) {
+			n++
+		}
+	}
+	return n
+}
+
+// collapseSingleChildChains merges chains like a/b/c/d, where every level has exactly one
+// subdirectory and essentially the same size and file count, into a single entry for a.
+// The merged entry keeps the totals of the chain head and remembers the chain tail for display.
+func collapseSingleChildChains(list []*DirStat) []*DirStat {
+	// Count subdirectories per directory, remembering the last child seen
+	childCount := make(map[string]int, len(dirStats))
+	lastChild := make(map[string]*DirStat, len(dirStats))
+	for p, s := range dirStats {
+		parent := filepath.Dir(p)
+		if parent == p {
+			continue
+		}
+		if _, ok := dirStats[parent]; ok {
+			childCount[parent]++
+			lastChild[parent] = s
+		}
+	}
+
+	// next returns the chain successor of s, or nil if the chain ends at s
+	next := func(s *DirStat) *DirStat {
+		if childCount[s.Path] != 1 {
+			return nil
+		}
+		c := lastChild[s.Path]
+		if float64(c.TotalSize) < float64(s.TotalSize)*chainSimilarity ||
+			float64(c.FileCount) < float64(s.FileCount)*chainSimilarity {
+			return nil
+		}
+		return c
+	}
+
+	inList := make(map[string]bool, len(list))
+	for _, s := range list {
+		inList[s.Path] = true
+	}
+
+	collapsed := make([]*DirStat, 0, len(list))
+	for _, s := range list {
+		// Skip chain members whose parent (also listed) already represents them
+		parent := filepath.Dir(s.Path)
+		if parent != s.Path && inList[parent] && next(dirStats[parent]) == s {
+			continue
+		}
+
+		tail := s
+		for c := next(tail); c != nil; c = next(tail) {
+			tail = c
+		}
+		if tail == s {
+			collapsed = append(collapsed, s)
+			continue
+		}
+		merged := *s
+		merged.ChainTail = tail.Path
+		collapsed = append(collapsed, &merged)
+	}
+	return collapsed
+}
+
+// suppressDominatedAncestors picks the top N entries from a list sorted by metric (descending),
+// replacing any picked ancestor by a descendant that accounts for at least dominantShare of
+// its value. The result lists N distinct consumers instead of one branch at every level.
+func suppressDominatedAncestors(sorted []*DirStat, metric func(*DirStat) int64) []*DirStat {
+	selected := make([]*DirStat, 0, topN)
+	for _, s := range sorted {
+		v := float64(metric(s))
+
+		replaced, dominated := false, false
+		smallest := v
+		for i, a := range selected {
+			av := float64(metric(a))
+			if !replaced && v >= av*dominantShare && isPathEqualOrSubpath(s.Path, a.Path) {
+				selected[i] = s
+				replaced = true
+			}
+			// Equal values may sort an ancestor after its descendant
+			if av >= v*dominantShare && isPathEqualOrSubpath(a.Path, s.Path) {
+				dominated = true
+			}
+			if av < smallest {
+				smallest = av
+			}
+		}
+		if replaced || dominated {
+			continue
+		}
+		if len(selected) < topN {
+			selected = append(selected, s)
+			continue
+		}
+		// Input is sorted, so no later entry can replace a picked ancestor anymore
+		if v < smallest*dominantShare {
+			break
+		}
+	}
+
+	sort.SliceStable(selected, func(i, j int) bool {
+		return metric(selected[i]) > metric(selected[j])
+	})
+	return selected
+}
+
+// --- Fingerprints ---
+//
+// A directory's fingerprint hashes the digests of its entries: name, size and mtime of every file
+// (plus a content hash with --fingerprint-content) and name and fingerprint of every subdirectory.
+// The digests are summed (order-independent), so they can be collected in walk order and combined
+// bottom-up during aggregation. Equal fingerprints mean equal subtrees, wherever they are.
+
+// addDigest adds the SHA-256 of the NUL-separated parts to the entry digest sum of s
+func addDigest(s *DirStat, parts ...string) {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	for i := range s.fingerprintSum {
+		s.fingerprintSum[i] += binary.BigEndian.Uint64(sum[i*8:])
+	}
+}
+
+func finalizeFingerprint(s *DirStat) {
+	var buf [32]byte
+	for i, v := range s.fingerprintSum {
+		binary.BigEndian.PutUint64(buf[i*8:], v)
+	}
+	s.Fingerprint = sha256.Sum256(buf[:])
+}
+
+// fingerprintFile adds the digest of a file to the directory that records it: its parent, or the
+// ancestor its parent is folded into by --max-memory
+func fingerprintFile(path, dir string, info fs.FileInfo) {
+	parts := []string{"f", info.Name(), strconv.FormatInt(info.Size(), 10), fingerprintMtime(info.ModTime().Unix())}
+	if hashContent && info.Mode().IsRegular() {
+		parts = append(parts, contentHash(path))
+	}
+	addDigest(getDirStat(dir), parts...)
+}
+
+// fingerprintMtime is the mtime part of a file digest; dupes leaves it out, as copies rarely keep it
+func fingerprintMtime(mtime int64) string {
+	if !hashMtimes {
+		return ""
+	}
+	return strconv.FormatInt(mtime, 10)
+}
+
+// contentHash returns the SHA-256 of a file's content, or a marker if it cannot be read
+func contentHash(path string) string {
+	f, err := openScannedFile(path)
+	if err != nil {
+		return "unreadable"
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "unreadable"
+	}
+	return string(h.Sum(nil))
+}
+
+// fingerprintHex is the fingerprint as shown in exports (128 bits are plenty to compare trees)
+func fingerprintHex(s *DirStat) string {
+	return hex.EncodeToString(s.Fingerprint[:16])
+}
+
+// --- Expressions ---
+//
+// A small expression language over the DirStat fields, used by --add-column and --where.
+// Expressions are compiled once into closures, so evaluating them per directory costs no parsing.
+// Comparisons and logical operators yield 1 (true) or 0 (false), like in C.
+
+// exprFunc evaluates a compiled expression for one directory
+type exprFunc func(s *DirStat) float64
+
+// exprFields are the identifiers an expression can use (same names as the export columns).
+// Modification times are Unix seconds.
+var exprFields = map[string]exprFunc{
+	"size":         func(s *DirStat) float64 { return float64(s.TotalSize) },
+	"files":        func(s *DirStat) float64 { return float64(s.FileCount) },
+	"own_size":     func(s *DirStat) float64 { return float64(s.OwnSize) },
+	"own_files":    func(s *DirStat) float64 { return float64(s.OwnFiles) },
+	"depth":        func(s *DirStat) float64 { return float64(s.Depth) },
+	"entries":      func(s *DirStat) float64 { return float64(s.Entries) },
+	"newest_mtime": func(s *DirStat) float64 { return float64(s.NewestMtime) },
+	"oldest_mtime": func(s *DirStat) float64 { return float64(s.OldestMtime) },
+	"owner_uid":    func(s *DirStat) float64 { return float64(s.Uid) },
+	"inaccessible": func(s *DirStat) float64 { return float64(s.Inaccessible) },
+}
+
+// addedColumn is a computed column (--add-column 'name = expr')
+type addedColumn struct {
+	Name string
+	Eval exprFunc
+}
+
+// parseAddColumn parses 'name = expr'. The name must be a new identifier so it cannot shadow an
+// export column.
+func parseAddColumn(def string) (addedColumn, error) {
+	name, src, ok := strings.Cut(def, "=")
+	name = strings.TrimSpace(name)
+	if !ok || !isExprIdent(name) {
+		return addedColumn{}, fmt.Errorf("expected 'name = expression', got %q", def)
+	}
+	if _, exists := exprFields[name]; exists || name == "path" || name == "owner" || name == "fingerprint" {
+		return addedColumn{}, fmt.Errorf("column %q already exists", name)
+	}
+	for _, c := range addColumns {
+		if c.Name == name {
+			return addedColumn{}, fmt.Errorf("column %q is defined twice", name)
+		}
+	}
+	eval, err := compileExpr(src)
+	if err != nil {
+		return addedColumn{}, err
+	}
+	return addedColumn{Name: name, Eval: eval}, nil
+}
+
+func isExprIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// exprParser is a recursive-descent parser over the tokens of one expression
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+// compileExpr parses src: || && ! (lowest to highest precedence), comparisons (== != < <= > >=),
+// + - * / %, unary minus, parentheses, numbers (1e9, or sizes such as 10GB = 10*1024^3), numeric
+// field names, and string matches on path and owner (== != =~ !~ with a quoted string or regexp).
+func compileExpr(src string) (exprFunc, error) {
+	tokens, err := tokenizeExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	p := &exprParser{tokens: tokens}
+	eval, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in %q", p.tokens[p.pos], strings.TrimSpace(src))
+	}
+	return eval, nil
+}
+
+func tokenizeExpr(src string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.' ||
+				(src[j] == 'e' || src[j] == 'E') ||
+				(src[j] == '+' || src[j] == '-') && (src[j-1] == 'e' || src[j-1] == 'E')) {
+				j++
+			}
+			// Size suffix (K, M, G, T, P, optionally followed by B or iB)
+			for j < len(src) && (src[j] >= 'a' && src[j] <= 'z' || src[j] >= 'A' && src[j] <= 'Z') {
+				j++
+			}
+			tokens = append(tokens, src[i:j])
+			i = j
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != c {
+				if src[j] == '\\' && c == '"' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string in %q", strings.TrimSpace(src))
+			}
+			tokens = append(tokens, src[i:j+1])
+			i = j + 1
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] >= 'a' && src[j] <= 'z' || src[j] >= 'A' && src[j] <= 'Z' || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, src[i:j])
+			i = j
+		case i+1 < len(src) && slices.Contains([]string{"==", "!=", "<=", ">=", "&&", "||", "=~", "!~"}, src[i:i+2]):
+			tokens = append(tokens, src[i:i+2])
+			i += 2
+		case strings.IndexByte("+-*/%()<>!", c) >= 0:
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q in %q", c, strings.TrimSpace(src))
+		}
+	}
+	return tokens, nil
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// truth converts a condition to the 1/0 result of a comparison or logical operator
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// or: and ('||' and)*
+func (p *exprParser) or() (exprFunc, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.pos++
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(s *DirStat) float64 { return truth(l(s) != 0 || right(s) != 0) }
+	}
+	return left, nil
+}
+
+// and: not ('&&' not)*
+func (p *exprParser) and() (exprFunc, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.pos++
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(s *DirStat) float64 { return truth(l(s) != 0 && right(s) != 0) }
+	}
+	return left, nil
+}
+
+// not: '!' not | comparison
+func (p *exprParser) not() (exprFunc, error) {
+	if p.peek() == "!" {
+		p.pos++
+		operand, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return func(s *DirStat) float64 { return truth(operand(s) == 0) }, nil
+	}
+	return p.comparison()
+}
+
+// comparison: stringField ('==' | '!=' | '=~' | '!~') string | additive (op additive)?
+func (p *exprParser) comparison() (exprFunc, error) {
+	if field := strings.ToLower(p.peek()); field == "path" || field == "owner" {
+		p.pos++
+		return p.stringMatch(field)
+	}
+	left, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	op := p.peek()
+	if op != "==" && op != "!=" && op != "<" && op != "<=" && op != ">" && op != ">=" {
+		return left, nil
+	}
+	p.pos++
+	right, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "==":
+		return func(s *DirStat) float64 { return truth(left(s) == right(s)) }, nil
+	case "!=":
+		return func(s *DirStat) float64 { return truth(left(s) != right(s)) }, nil
+	case "<":
+		return func(s *DirStat) float64 { return truth(left(s) < right(s)) }, nil
+	case "<=":
+		return func(s *DirStat) float64 { return truth(left(s) <= right(s)) }, nil
+	case ">":
+		return func(s *DirStat) float64 { return truth(left(s) > right(s)) }, nil
+	default:
+		return func(s *DirStat) float64 { return truth(left(s) >= right(s)) }, nil
+	}
+}
+
+// stringMatch compiles a comparison of the path (as scanned) or owner name with a string literal:
+// == and != compare exactly, =~ and !~ match a regular expression anywhere in the value.
+func (p *exprParser) stringMatch(field string) (exprFunc, error) {
+	op := p.peek()
+	if op != "==" && op != "!=" && op != "=~" && op != "!~" {
+		return nil, fmt.Errorf("%s can only be compared with ==, !=, =~ or !~", field)
+	}
+	p.pos++
+	lit := p.peek()
+	if lit == "" || lit[0] != '"' && lit[0] != '\'' {
+		return nil, fmt.Errorf("%s %s requires a quoted string", field, op)
+	}
+	p.pos++
+	value := lit[1 : len(lit)-1]
+	if lit[0] == '"' {
+		var err error
+		if value, err = strconv.Unquote(lit); err != nil {
+			return nil, fmt.Errorf("invalid string %s", lit)
+		}
+	}
+
+	owners := make(map[int64]string)
+	get := func(s *DirStat) string { return rewritePath(s.Path) }
+	if field == "owner" {
+		get = func(s *DirStat) string { return ownerName(s.Uid, owners) }
+	}
+	switch op {
+	case "==":
+		return func(s *DirStat) float64 { return truth(get(s) == value) }, nil
+	case "!=":
+		return func(s *DirStat) float64 { return truth(get(s) != value) }, nil
+	}
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression %q: %v", value, err)
+	}
+	if op == "!~" {
+		return func(s *DirStat) float64 { return truth(!re.MatchString(get(s))) }, nil
+	}
+	return func(s *DirStat) float64 { return truth(re.MatchString(get(s))) }, nil
+}
+
+// additive: term (('+' | '-') term)*
+func (p *exprParser) additive() (exprFunc, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == "+" || op == "-"; op = p.peek() {
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		if op == "+" {
+			left = func(s *DirStat) float64 { return l(s) + right(s) }
+		} else {
+			left = func(s *DirStat) float64 { return l(s) - right(s) }
+		}
+	}
+	return left, nil
+}
+
+// term: unary (('*' | '/' | '%') unary)*
+func (p *exprParser) term() (exprFunc, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == "*" || op == "/" || op == "%"; op = p.peek() {
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		switch op {
+		case "*":
+			left = func(s *DirStat) float64 { return l(s) * right(s) }
+		case "/":
+			left = func(s *DirStat) float64 { return l(s) / right(s) }
+		default:
+			left = func(s *DirStat) float64 { return math.Mod(l(s), right(s)) }
+		}
+	}
+	return left, nil
+}
+
+// unary: '-' unary | primary
+func (p *exprParser) unary() (exprFunc, error) {
+	if p.peek() == "-" {
+		p.pos++
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(s *DirStat) float64 { return -operand(s) }, nil
+	}
+	return p.primary()
+}
+
+// primary: number | size | field | '(' or ')'
+func (p *exprParser) primary() (exprFunc, error) {
+	tok := p.peek()
+	p.pos++
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case tok == "(":
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		p.pos++
+		return inner, nil
+	case tok[0] >= '0' && tok[0] <= '9' || tok[0] == '.':
+		v, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			size, sizeErr := parseSize(tok)
+			if sizeErr != nil {
+				return nil, fmt.Errorf("invalid number %q", tok)
+			}
+			v = float64(size)
+		}
+		return func(*DirStat) float64 { return v }, nil
+	case tok[0] == '"' || tok[0] == '\'':
+		return nil, fmt.Errorf("string %s can only be compared with path or owner", tok)
+	case strings.EqualFold(tok, "path") || strings.EqualFold(tok, "owner"):
+		return nil, fmt.Errorf("%s is a string and can only be compared with ==, !=, =~ or !~", tok)
+	case isExprIdent(tok):
+		field, ok := exprFields[strings.ToLower(tok)]
+		if !ok {
+			names := make([]string, 0, len(exprFields))
+			for name := range exprFields {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown field %q (use %s)", tok, strings.Join(names, ", "))
+		}
+		return field, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", tok)
+}
+
+// formatColumnValue formats a computed value for the tables (6 significant digits); division by
+// zero and other undefined results are shown as "-".
+func formatColumnValue(v float64) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "-"
+	}
+	return strconv.FormatFloat(v, 'g', 6, 64)
+}
@@ -0,0 +1,846 @@
+//go:build !offline
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Report Upload ---
+
+// outsidePaths checks that a user scoped to path prefixes only uploads targets and directories
+// below them, and otherwise returns the first path outside
+func (doc *uploadDocument) outsidePaths(u *collectorUser) (string, bool) {
+	for _, t := range doc.Summary.Targets {
+		if !u.seesPath(t.Path) {
+			return t.Path, false
+		}
+	}
+	for _, d := range doc.Directories {
+		if !u.seesPath(d.Path) {
+			return d.Path, false
+		}
+	}
+	return "", true
+}
+
+// uploadReport POSTs the gzip-compressed report to uploadURL. Network errors, 429 and 5xx answers
+// are retried with exponential backoff (or the server's Retry-After); other answers are final.
+func uploadReport(sum runSummary, list []*DirStat, startTime time.Time) error {
+	doc := uploadDocument{Summary: sum, Directories: make([]dirEvent, 0, len(list))}
+	owners := make(map[int64]string)
+	for _, s := range list {
+		doc.Directories = append(doc.Directories, newDirEvent(s, sum.Host, startTime, owners))
+	}
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	if err := json.NewEncoder(zw).Encode(doc); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	client := newHTTPClient(5 * time.Minute)
+	backoff := 2 * time.Second
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, uploadURL, bytes.NewReader(body.Bytes()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", "gzip")
+		req.Header.Set("User-Agent", "find_heavy_dirs/"+strings.TrimPrefix(version, "find-heavy-dirs version "))
+		if token := os.Getenv("FS_ANALYZER_UPLOAD_TOKEN"); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		for _, h := range uploadHeaders {
+			req.Header.Set(h[0], h[1])
+		}
+
+		resp, err := client.Do(req)
+		retry := err != nil
+		if err == nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+			switch {
+			case resp.StatusCode/100 == 2:
+				if verbose {
+					fmt.Printf("Uploaded %d directories (%s compressed) to %s\n", len(list), formatBytes(int64(body.Len())), uploadURL)
+				}
+				return nil
+			case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+				retry = true
+				if secs, perr := strconv.Atoi(resp.Header.Get("Retry-After")); perr == nil && secs > 0 {
+					backoff = time.Duration(secs) * time.Second
+				}
+			}
+			err = fmt.Errorf("%s returned %s", uploadURL, resp.Status)
+		}
+		if !retry || attempt >= uploadRetries {
+			return err
+		}
+		if verbose {
+			fmt.Printf("Warning: Upload attempt %d failed (%v), retrying in %s\n", attempt+1, err, backoff)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// --- Tickets ---
+//
+// With --ticket, check opens an issue for each directory over its budget on GitHub or Jira, with
+// the largest subdirectories, or comments on the issue of an earlier run while it is still open,
+// so a breach reaches someone who can act on it.
+
+// fileTickets opens an issue for every breach, or comments on its open issue. Failures are
+// reported but do not change the result of check.
+func fileTickets(breaches []budgetBreach) {
+	kind, ref, _ := strings.Cut(ticketTarget, ":")
+	client := newHTTPClient(time.Minute)
+	for _, b := range breaches {
+		var text strings.Builder
+		if err := ticketBody.Execute(&text, b); err != nil {
+			fmt.Printf("Warning: --ticket-template: %v\n", err)
+			return
+		}
+		var issue string
+		var updated bool
+		var err error
+		if kind == "github" {
+			issue, updated, err = fileGitHubIssue(client, ref, b.Title(), text.String())
+		} else {
+			issue, updated, err = fileJiraIssue(client, ref, b.Title(), text.String())
+		}
+		switch {
+		case err != nil:
+			fmt.Printf("Warning: Could not file a ticket for %s: %v\n", b.Path, err)
+		case updated:
+			fmt.Printf("Commented on %s for %s\n", issue, b.Path)
+		default:
+			fmt.Printf("Opened %s for %s\n", issue, b.Path)
+		}
+	}
+}
+
+// fileGitHubIssue comments on the open issue titled title in repo (owner/name), or opens one
+func fileGitHubIssue(client *http.Client, repo, title, body string) (issue string, updated bool, err error) {
+	api := strings.TrimSuffix(cmp.Or(ticketAPI, "https://api.github.com"), "/")
+	var found struct {
+		Items []struct {
+			Number int    `json:"number"`
+			Title  string `json:"title"`
+		} `json:"items"`
+	}
+	q := fmt.Sprintf(`repo:%s is:issue is:open in:title "%s"`, repo, strings.ReplaceAll(title, `"`, ""))
+	if err := ticketRequest(client, http.MethodGet, api+"/search/issues?q="+url.QueryEscape(q), nil, &found); err != nil {
+		return "", false, err
+	}
+	for _, it := range found.Items {
+		if it.Title == title {
+			issue = fmt.Sprintf("%s#%d", repo, it.Number)
+			err := ticketRequest(client, http.MethodPost, fmt.Sprintf("%s/repos/%s/issues/%d/comments", api, repo, it.Number), map[string]string{"body": body}, nil)
+			return issue, true, err
+		}
+	}
+	var created struct {
+		Number int `json:"number"`
+	}
+	if err := ticketRequest(client, http.MethodPost, api+"/repos/"+repo+"/issues", map[string]string{"title": title, "body": body}, &created); err != nil {
+		return "", false, err
+	}
+	return fmt.Sprintf("%s#%d", repo, created.Number), false, nil
+}
+
+// fileJiraIssue comments on the unresolved issue with summary title in project, or opens a task
+func fileJiraIssue(client *http.Client, project, title, body string) (issue string, updated bool, err error) {
+	api := strings.TrimSuffix(ticketAPI, "/")
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	jql := fmt.Sprintf(`project = "%s" AND summary ~ "\"%s\"" AND statusCategory != Done`, quote.Replace(project), quote.Replace(quote.Replace(title)))
+	var found struct {
+		Issues []struct {
+			Key    string `json:"key"`
+			Fields struct {
+				Summary string `json:"summary"`
+			} `json:"fields"`
+		} `json:"issues"`
+	}
+	if err := ticketRequest(client, http.MethodGet, api+"/rest/api/2/search?fields=summary&jql="+url.QueryEscape(jql), nil, &found); err != nil {
+		return "", false, err
+	}
+	for _, it := range found.Issues {
+		if it.Fields.Summary == title {
+			err := ticketRequest(client, http.MethodPost, api+"/rest/api/2/issue/"+it.Key+"/comment", map[string]string{"body": body}, nil)
+			return it.Key, true, err
+		}
+	}
+	fields := map[string]any{
+		"project":     map[string]string{"key": project},
+		"summary":     title,
+		"description": body,
+		"issuetype":   map[string]string{"name": "Task"},
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := ticketRequest(client, http.MethodPost, api+"/rest/api/2/issue", map[string]any{"fields": fields}, &created); err != nil {
+		return "", false, err
+	}
+	return created.Key, false, nil
+}
+
+// ticketRequest sends payload (if any) as JSON with the token of FS_ANALYZER_TICKET_TOKEN and the
+// --ticket-header headers, and decodes the JSON answer into result (if any)
+func ticketRequest(client *http.Client, method, target string, payload, result any) error {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "find_heavy_dirs/"+strings.TrimPrefix(version, "find-heavy-dirs version "))
+	if token := os.Getenv("FS_ANALYZER_TICKET_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for _, h := range ticketHeaders {
+		req.Header.Set(h[0], h[1])
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return fmt.Errorf("%s %s returned %s", method, strings.SplitN(target, "?", 2)[0], resp.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(result)
+}
+
+// --- Tracing ---
+
+// exportTelemetry sends one trace (scan -> target -> slow subtrees) and a few gauges per target
+// to an OTLP/HTTP collector using the JSON encoding, so no OpenTelemetry SDK is needed.
+func exportTelemetry(startTime time.Time, totalFiles int) error {
+	endTime := time.Now()
+	traceID := randomHex(16)
+	host, _ := os.Hostname()
+
+	type kv = map[string]any
+	strAttr := func(k, v string) kv { return kv{"key": k, "value": kv{"stringValue": v}} }
+	intAttr := func(k string, v int64) kv { return kv{"key": k, "value": kv{"intValue": strconv.FormatInt(v, 10)}} }
+	nanos := func(t time.Time) string { return strconv.FormatInt(t.UnixNano(), 10) }
+
+	span := func(id, parent, name string, t walkTiming) kv {
+		attrs := []kv{strAttr("fs.path", shownPath(t.Path))}
+		if s, ok := dirStats[t.Path]; ok {
+			attrs = append(attrs, intAttr("fs.bytes", s.TotalSize), intAttr("fs.files", s.FileCount))
+		}
+		sp := kv{"traceId": traceID, "spanId": id, "name": name, "kind": 1,
+			"startTimeUnixNano": nanos(t.Start), "endTimeUnixNano": nanos(t.End), "attributes": attrs}
+		if parent != "" {
+			sp["parentSpanId"] = parent
+		}
+		return sp
+	}
+
+	scanID := randomHex(8)
+	spans := []kv{span(scanID, "", "scan", walkTiming{Start: startTime, End: endTime})}
+	spans[0]["attributes"] = []kv{intAttr("fs.files", int64(totalFiles)), intAttr("fs.targets", int64(len(rootTimings)))}
+
+	spanIDs := make(map[string]string)
+	for _, t := range rootTimings {
+		spanIDs[t.Path] = randomHex(8)
+		spans = append(spans, span(spanIDs[t.Path], scanID, "scan.root", t))
+	}
+	// Parents finish after their children, so assign IDs first and resolve parents afterwards
+	for _, t := range slowSubtrees {
+		if _, ok := spanIDs[t.Path]; !ok {
+			spanIDs[t.Path] = randomHex(8)
+		}
+	}
+	for _, t := range slowSubtrees {
+		if isExactTarget(t.Path) {
+			continue
+		}
+		parent := scanID
+		for p := filepath.Dir(t.Path); ; p = filepath.Dir(p) {
+			if id, ok := spanIDs[p]; ok {
+				parent = id
+				break
+			}
+			if filepath.Dir(p) == p {
+				break
+			}
+		}
+		spans = append(spans, span(spanIDs[t.Path], parent, "scan.subtree", t))
+	}
+
+	resource := kv{"attributes": []kv{strAttr("service.name", "fs-analyzer"), strAttr("service.version", version), strAttr("host.name", host)}}
+	scope := kv{"name": "find_heavy_dirs"}
+	traces := kv{"resourceSpans": []kv{{"resource": resource, "scopeSpans": []kv{{"scope": scope, "spans": spans}}}}}
+
+	gauge := func(name, unit string, point func(t walkTiming) kv) kv {
+		var points []kv
+		for _, t := range rootTimings {
+			p := point(t)
+			p["timeUnixNano"] = nanos(endTime)
+			p["attributes"] = []kv{strAttr("fs.path", shownPath(t.Path))}
+			points = append(points, p)
+		}
+		return kv{"name": name, "unit": unit, "gauge": kv{"dataPoints": points}}
+	}
+	metrics := []kv{
+		gauge("fs_analyzer.scan.duration", "s", func(t walkTiming) kv { return kv{"asDouble": t.End.Sub(t.Start).Seconds()} }),
+		gauge("fs_analyzer.scan.bytes", "By", func(t walkTiming) kv {
+			if s, ok := dirStats[t.Path]; ok {
+				return kv{"asInt": strconv.FormatInt(s.TotalSize, 10)}
+			}
+			return kv{"asInt": "0"}
+		}),
+		gauge("fs_analyzer.scan.files", "{file}", func(t walkTiming) kv {
+			if s, ok := dirStats[t.Path]; ok {
+				return kv{"asInt": strconv.FormatInt(s.FileCount, 10)}
+			}
+			return kv{"asInt": "0"}
+		}),
+	}
+	metricsBody := kv{"resourceMetrics": []kv{{"resource": resource, "scopeMetrics": []kv{{"scope": scope, "metrics": metrics}}}}}
+
+	base := strings.TrimRight(otlpEndpoint, "/")
+	if err := postJSON(base+"/v1/traces", traces); err != nil {
+		return err
+	}
+	return postJSON(base+"/v1/metrics", metricsBody)
+}
+
+func postJSON(target string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	client := newHTTPClient(10 * time.Second)
+	resp, err := client.Post(target, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", target, resp.Status)
+	}
+	return nil
+}
+
+// --- Stream Sink ---
+
+// publishStream publishes one JSON message per directory to a NATS subject or Kafka topic
+// (the path of the --stream URL, default fs_analyzer.dirs). Kafka messages are keyed by path.
+func publishStream(list []*DirStat, startTime time.Time) error {
+	u, err := url.Parse(streamURL)
+	if err != nil {
+		return err
+	}
+	topic := strings.Trim(u.Path, "/")
+	if topic == "" {
+		topic = "fs_analyzer.dirs"
+	}
+
+	host, _ := os.Hostname()
+	owners := make(map[int64]string)
+	var keys, messages [][]byte
+	for _, s := range list {
+		msg, err := json.Marshal(newDirEvent(s, host, startTime, owners))
+		if err != nil {
+			return err
+		}
+		keys = append(keys, []byte(shownPath(s.Path)))
+		messages = append(messages, msg)
+	}
+
+	switch u.Scheme {
+	case "nats":
+		return publishNATS(u, topic, messages)
+	case "kafka":
+		return publishKafka(u.Host, topic, keys, messages)
+	}
+	return fmt.Errorf("unsupported scheme %q (use nats:// or kafka://)", u.Scheme)
+}
+
+// publishNATS sends the messages with the NATS text protocol and waits for the server to
+// acknowledge them with a PONG (user:password or token from the URL are sent on CONNECT).
+func publishNATS(u *url.URL, subject string, messages [][]byte) error {
+	conn, err := dialOut("tcp", u.Host, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Minute))
+	r := bufio.NewReader(conn)
+	if line, err := r.ReadString('\n'); err != nil {
+		return err
+	} else if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("unexpected greeting %q", strings.TrimSpace(line))
+	}
+
+	opts := map[string]interface{}{"verbose": false, "pedantic": false, "name": "find_heavy_dirs"}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			opts["user"], opts["pass"] = u.User.Username(), pass
+		} else {
+			opts["auth_token"] = u.User.Username()
+		}
+	}
+	connect, _ := json.Marshal(opts)
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "CONNECT %s\r\n", connect)
+	for _, msg := range messages {
+		fmt.Fprintf(w, "PUB %s %d\r\n", subject, len(msg))
+		w.Write(msg)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("PING\r\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			conn.Write([]byte("PONG\r\n"))
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("server error: %s", line)
+		}
+	}
+}
+
+// --- Kafka Producer ---
+//
+// Just enough of the Kafka protocol to produce: Metadata v1 to find the partition leaders and
+// Produce v3 (acks=1, uncompressed record batches v2, Kafka 0.11+). Messages are assigned to
+// partitions by a hash of their key.
+
+// kafkaMaxBatch keeps each record batch below the default broker message.max.bytes (1 MB)
+const kafkaMaxBatch = 900 * 1024
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+func publishKafka(bootstrap, topic string, keys, messages [][]byte) error {
+	brokers, leaders, err := kafkaMetadata(bootstrap, topic)
+	if err != nil {
+		return err
+	}
+
+	// Group the messages by partition, then the partitions by leader broker
+	byPartition := make(map[int32][]int)
+	for i, key := range keys {
+		h := fnv.New32a()
+		h.Write(key)
+		p := int32(h.Sum32() % uint32(len(leaders)))
+		byPartition[p] = append(byPartition[p], i)
+	}
+	byLeader := make(map[int32][]int32)
+	for p := range byPartition {
+		byLeader[leaders[p]] = append(byLeader[leaders[p]], p)
+	}
+
+	for leader, partitions := range byLeader {
+		addr, ok := brokers[leader]
+		if !ok {
+			return fmt.Errorf("no leader for topic %s", topic)
+		}
+		conn, err := dialOut("tcp", addr, 10*time.Second)
+		if err != nil {
+			return err
+		}
+		for _, p := range partitions {
+			idx := byPartition[p]
+			for len(idx) > 0 {
+				batch, n := kafkaRecordBatch(keys, messages, idx)
+				idx = idx[n:]
+				if err := kafkaProduce(conn, topic, p, batch); err != nil {
+					conn.Close()
+					return err
+				}
+			}
+		}
+		conn.Close()
+	}
+	return nil
+}
+
+// kafkaMetadata returns the broker addresses by node id and the leader of each partition of topic
+func kafkaMetadata(bootstrap, topic string) (map[int32]string, []int32, error) {
+	conn, err := dialOut("tcp", bootstrap, 10*time.Second)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+
+	var req kafkaBuf
+	req.i32(1)
+	req.str(topic)
+	resp, err := kafkaCall(conn, 3, 1, req.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	brokers := make(map[int32]string)
+	for n := resp.i32(); n > 0; n-- {
+		id, host, port := resp.i32(), resp.str(), resp.i32()
+		resp.str() // rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	resp.i32() // controller id
+	var leaders []int32
+	for n := resp.i32(); n > 0; n-- {
+		code := resp.i16()
+		name := resp.str()
+		resp.i8() // is_internal
+		for m := resp.i32(); m > 0; m-- {
+			resp.i16() // partition error
+			index, leader := resp.i32(), resp.i32()
+			resp.skipArray(4) // replicas
+			resp.skipArray(4) // isr
+			if name == topic {
+				for int(index) >= len(leaders) {
+					leaders = append(leaders, -1)
+				}
+				leaders[index] = leader
+			}
+		}
+		if name == topic && code != 0 {
+			return nil, nil, fmt.Errorf("metadata for topic %s: error code %d", topic, code)
+		}
+	}
+	if resp.err != nil {
+		return nil, nil, resp.err
+	}
+	if len(leaders) == 0 {
+		return nil, nil, fmt.Errorf("topic %s has no partitions", topic)
+	}
+	return brokers, leaders, nil
+}
+
+// kafkaRecordBatch encodes the messages at idx (as many as fit in kafkaMaxBatch, at least one)
+// as a v2 record batch and returns it with the number of messages it holds.
+func kafkaRecordBatch(keys, messages [][]byte, idx []int) ([]byte, int) {
+	now := time.Now().UnixMilli()
+	var records kafkaBuf
+	n := 0
+	for _, i := range idx {
+		var rec kafkaBuf
+		rec.i8(0)            // attributes
+		rec.varint(0)        // timestamp delta
+		rec.varint(int64(n)) // offset delta
+		rec.varint(int64(len(keys[i])))
+		rec.Write(keys[i])
+		rec.varint(int64(len(messages[i])))
+		rec.Write(messages[i])
+		rec.varint(0) // headers
+		if n > 0 && records.Len()+rec.Len()+binary.MaxVarintLen32 > kafkaMaxBatch {
+			break
+		}
+		records.varint(int64(rec.Len()))
+		records.Write(rec.Bytes())
+		n++
+	}
+
+	// Everything after the CRC field, which the CRC-32C covers
+	var body kafkaBuf
+	body.i16(0)            // attributes (no compression)
+	body.i32(int32(n - 1)) // last offset delta
+	body.i64(now)          // first timestamp
+	body.i64(now)          // max timestamp
+	body.i64(-1)           // producer id
+	body.i16(-1)           // producer epoch
+	body.i32(-1)           // base sequence
+	body.i32(int32(n))
+	body.Write(records.Bytes())
+
+	var batch kafkaBuf
+	batch.i64(0)                             // base offset
+	batch.i32(int32(4 + 1 + 4 + body.Len())) // batch length
+	batch.i32(-1)                            // partition leader epoch
+	batch.i8(2)                              // magic
+	batch.i32(int32(crc32.Checksum(body.Bytes(), crc32c)))
+	batch.Write(body.Bytes())
+	return batch.Bytes(), n
+}
+
+func kafkaProduce(conn net.Conn, topic string, partition int32, batch []byte) error {
+	var req kafkaBuf
+	req.i16(-1)    // transactional id (null)
+	req.i16(1)     // acks
+	req.i32(30000) // timeout ms
+	req.i32(1)
+	req.str(topic)
+	req.i32(1)
+	req.i32(partition)
+	req.i32(int32(len(batch)))
+	req.Write(batch)
+	resp, err := kafkaCall(conn, 0, 3, req.Bytes())
+	if err != nil {
+		return err
+	}
+	for n := resp.i32(); n > 0; n-- {
+		resp.str()
+		for m := resp.i32(); m > 0; m-- {
+			resp.i32()
+			if code := resp.i16(); code != 0 && resp.err == nil {
+				return fmt.Errorf("produce to %s/%d: error code %d", topic, partition, code)
+			}
+			resp.i64()
+			resp.i64()
+		}
+	}
+	return resp.err
+}
+
+// kafkaCall sends one request (header v1, client id find_heavy_dirs) and returns the response
+// body after the correlation id.
+func kafkaCall(conn net.Conn, apiKey, apiVersion int16, body []byte) (*kafkaReader, error) {
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	var req kafkaBuf
+	req.i16(apiKey)
+	req.i16(apiVersion)
+	req.i32(1) // correlation id, one request in flight
+	req.str("find_heavy_dirs")
+	req.Write(body)
+
+	frame := make([]byte, 4, 4+req.Len())
+	binary.BigEndian.PutUint32(frame, uint32(req.Len()))
+	if _, err := conn.Write(append(frame, req.Bytes()...)); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(conn, frame[:4]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint32(frame[:4]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	r := &kafkaReader{b: resp}
+	r.i32() // correlation id
+	return r, r.err
+}
+
+// kafkaBuf builds big-endian Kafka protocol fields
+type kafkaBuf struct{ bytes.Buffer }
+
+func (b *kafkaBuf) i8(v int8)   { b.WriteByte(byte(v)) }
+func (b *kafkaBuf) i16(v int16) { binary.Write(b, binary.BigEndian, v) }
+func (b *kafkaBuf) i32(v int32) { binary.Write(b, binary.BigEndian, v) }
+func (b *kafkaBuf) i64(v int64) { binary.Write(b, binary.BigEndian, v) }
+
+func (b *kafkaBuf) str(s string) {
+	b.i16(int16(len(s)))
+	b.WriteString(s)
+}
+
+func (b *kafkaBuf) varint(v int64) {
+	var tmp [binary.MaxVarintLen64]byte
+	b.Write(tmp[:binary.PutVarint(tmp[:], v)])
+}
+
+// kafkaReader decodes big-endian Kafka protocol fields; the first short read sets err
+type kafkaReader struct {
+	b   []byte
+	err error
+}
+
+func (r *kafkaReader) next(n int) []byte {
+	if r.err != nil || len(r.b) < n {
+		r.err = io.ErrUnexpectedEOF
+		return make([]byte, n)
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *kafkaReader) i8() int8   { return int8(r.next(1)[0]) }
+func (r *kafkaReader) i16() int16 { return int16(binary.BigEndian.Uint16(r.next(2))) }
+func (r *kafkaReader) i32() int32 { return int32(binary.BigEndian.Uint32(r.next(4))) }
+func (r *kafkaReader) i64() int64 { return int64(binary.BigEndian.Uint64(r.next(8))) }
+
+func (r *kafkaReader) str() string {
+	n := r.i16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.next(int(n)))
+}
+
+func (r *kafkaReader) skipArray(elemSize int) {
+	if n := r.i32(); n > 0 {
+		r.next(int(n) * elemSize)
+	}
+}
+
+// --- Metrics Sink ---
+
+// pushMetrics sends size and file-count gauges of the targets and of directories up to
+// metricDepth to Graphite (plaintext protocol over TCP) or StatsD (gauges over UDP).
+func pushMetrics(list []*DirStat) error {
+	u, err := url.Parse(metricsURL)
+	if err != nil {
+		return err
+	}
+
+	// The ranked list leaves out the targets, but their totals are what dashboards chart most
+	var dirs []*DirStat
+	for _, root := range targetPaths {
+		if abs, err := filepath.Abs(root); err == nil {
+			if s, ok := dirStats[abs]; ok {
+				dirs = append(dirs, s)
+			}
+		}
+	}
+	dirs = append(dirs, list...)
+
+	host, _ := os.Hostname()
+	now := time.Now().Unix()
+	var lines []string
+	for _, s := range dirs {
+		if s.Depth > metricDepth {
+			continue
+		}
+		for _, m := range []struct {
+			name  string
+			value int64
+		}{{"size_bytes", s.TotalSize}, {"files", s.FileCount}} {
+			name := strings.NewReplacer(
+				"{host}", sanitizeMetricComponent(host),
+				"{path}", metricPath(shownPath(s.Path)),
+				"{metric}", m.name,
+			).Replace(metricTemplate)
+			if u.Scheme == "statsd" {
+				lines = append(lines, fmt.Sprintf("%s:%d|g\n", name, m.value))
+			} else {
+				lines = append(lines, fmt.Sprintf("%s %d %d\n", name, m.value, now))
+			}
+		}
+	}
+
+	switch u.Scheme {
+	case "graphite":
+		conn, err := dialOut("tcp", u.Host, 10*time.Second)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_, err = conn.Write([]byte(strings.Join(lines, "")))
+		return err
+	case "statsd":
+		conn, err := dialOut("udp", u.Host, 10*time.Second)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		// Keep datagrams below a typical MTU
+		var packet strings.Builder
+		for _, line := range lines {
+			if packet.Len() > 0 && packet.Len()+len(line) > 1400 {
+				if _, err := conn.Write([]byte(packet.String())); err != nil {
+					return err
+				}
+				packet.Reset()
+			}
+			packet.WriteString(line)
+		}
+		if packet.Len() > 0 {
+			_, err = conn.Write([]byte(packet.String()))
+		}
+		return err
+	}
+	return fmt.Errorf("unsupported scheme %q (use graphite:// or statsd://)", u.Scheme)
+}
+
+// metricPath turns a directory path into dot-separated metric components, e.g. /var/log -> var.log
+func metricPath(path string) string {
+	var parts []string
+	for _, c := range strings.Split(filepath.ToSlash(path), "/") {
+		if c != "" {
+			parts = append(parts, sanitizeMetricComponent(c))
+		}
+	}
+	if len(parts) == 0 {
+		return "root"
+	}
+	return strings.Join(parts, ".")
+}
+
+func sanitizeMetricComponent(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// --- Network Access ---
+
+// offlineBuild makes offline mode permanent when set at build time with
+// -ldflags "-X main.offlineBuild=true", for binaries deployed to air-gapped hosts.
+var offlineBuild = ""
+
+// dialOut opens every outbound connection of the program (sinks, uploads, metrics, traces), so
+// that offline mode is enforced in one place even if an option check is missed.
+func dialOut(network, addr string, timeout time.Duration) (net.Conn, error) {
+	if offline {
+		return nil, errOffline
+	}
+	return net.DialTimeout(network, addr, timeout)
+}
+
+// newHTTPClient returns an HTTP client whose connections (including proxies) go through dialOut
+func newHTTPClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if offline {
+			return nil, errOffline
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
@@ -0,0 +1,42 @@
+//go:build offline
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// --- Network Access ---
+//
+// Built with -tags offline, the program contains no network code: offline mode is permanent, so
+// parseArgs rejects every option that would reach the functions below.
+
+// offlineBuild is always set in an offline build
+var offlineBuild = "true"
+
+func uploadReport(sum runSummary, list []*DirStat, startTime time.Time) error {
+	return errOffline
+}
+
+func exportTelemetry(startTime time.Time, totalFiles int) error {
+	return errOffline
+}
+
+func pushMetrics(list []*DirStat) error {
+	return errOffline
+}
+
+func publishStream(list []*DirStat, startTime time.Time) error {
+	return errOffline
+}
+
+func fileTickets(breaches []budgetBreach) {
+	fmt.Printf("Warning: --ticket: %v\n", errOffline)
+}
+
+func runCollector() {
+	fmt.Printf("Error: collector: %v\n", errOffline)
+	os.Exit(1)
+}
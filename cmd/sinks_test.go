@@ -0,0 +1,306 @@
+//go:build !offline
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// testListener listens on a free local port and runs serve for every connection
+func testListener(t *testing.T, serve func(net.Conn)) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestPublishNATS(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		reply  string // Sent after the client's PING
+		errMsg string
+	}{
+		{"acknowledged", "PONG\r\n", ""},
+		{"server ping first", "PING\r\nPONG\r\n", ""},
+		{"server error", "-ERR 'Authorization Violation'\r\n", "Authorization Violation"},
+	} {
+		received := make(chan string, 1)
+		addr := testListener(t, func(conn net.Conn) {
+			io.WriteString(conn, `INFO {"server_id":"test","max_payload":1048576}`+"\r\n")
+			var sent strings.Builder
+			r := bufio.NewReader(conn)
+			for {
+				line, err := r.ReadString('\n')
+				sent.WriteString(line)
+				if err != nil || line == "PING\r\n" {
+					break
+				}
+			}
+			io.WriteString(conn, tt.reply)
+			if strings.HasPrefix(tt.reply, "PING") {
+				line, _ := r.ReadString('\n')
+				sent.WriteString(line)
+			}
+			received <- sent.String()
+		})
+
+		u, _ := url.Parse("nats://alice:secret@" + addr + "/fs.dirs")
+		err := publishNATS(u, "fs.dirs", [][]byte{[]byte(`{"path":"/srv"}`), []byte(`{}`)})
+		if tt.errMsg == "" && err != nil || tt.errMsg != "" && (err == nil || !strings.Contains(err.Error(), tt.errMsg)) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.errMsg)
+		}
+		want := `CONNECT {"name":"find_heavy_dirs","pass":"secret","pedantic":false,"user":"alice","verbose":false}` + "\r\n" +
+			"PUB fs.dirs 15\r\n" + `{"path":"/srv"}` + "\r\n" +
+			"PUB fs.dirs 2\r\n{}\r\n" +
+			"PING\r\n"
+		if strings.HasPrefix(tt.reply, "PING") {
+			want += "PONG\r\n"
+		}
+		if got := <-received; got != want {
+			t.Errorf("%s: sent %q, want %q", tt.name, got, want)
+		}
+	}
+
+	// A token alone is sent as auth_token
+	received := make(chan string, 1)
+	addr := testListener(t, func(conn net.Conn) {
+		io.WriteString(conn, "INFO {}\r\n")
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		io.WriteString(conn, "PONG\r\n")
+		received <- line
+	})
+	u, _ := url.Parse("nats://s3cr3t@" + addr)
+	publishNATS(u, "fs.dirs", nil)
+	if got := <-received; !strings.Contains(got, `"auth_token":"s3cr3t"`) || strings.Contains(got, `"user"`) {
+		t.Errorf("token CONNECT = %q", got)
+	}
+}
+
+// kafkaRequest is a request received by the test broker
+type kafkaRequest struct {
+	apiKey, apiVersion int16
+	clientID           string
+	body               *kafkaReader
+}
+
+// readKafkaRequest reads one size-prefixed request with a v1 header
+func readKafkaRequest(conn net.Conn) (*kafkaRequest, int32, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, 0, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(conn, data); err != nil {
+		return nil, 0, err
+	}
+	r := &kafkaReader{b: data}
+	req := &kafkaRequest{apiKey: r.i16(), apiVersion: r.i16()}
+	correlation := r.i32()
+	req.clientID = r.str()
+	req.body = r
+	return req, correlation, r.err
+}
+
+func writeKafkaResponse(conn net.Conn, correlation int32, body []byte) {
+	var resp kafkaBuf
+	resp.i32(int32(4 + len(body)))
+	resp.i32(correlation)
+	resp.Write(body)
+	conn.Write(resp.Bytes())
+}
+
+// kafkaRecord is a record decoded from a produced batch
+type kafkaRecord struct {
+	partition  int32
+	key, value string
+}
+
+// decodeKafkaBatch checks the framing and CRC of a v2 record batch and returns its records
+func decodeKafkaBatch(t *testing.T, partition int32, batch []byte) []kafkaRecord {
+	r := &kafkaReader{b: batch}
+	if base := r.i64(); base != 0 {
+		t.Errorf("base offset %d", base)
+	}
+	if length := r.i32(); int(length) != len(batch)-12 {
+		t.Errorf("batch length %d, want %d", length, len(batch)-12)
+	}
+	r.i32() // partition leader epoch
+	if magic := r.i8(); magic != 2 {
+		t.Errorf("magic %d", magic)
+	}
+	crc := uint32(r.i32())
+	if want := crc32.Checksum(r.b, crc32.MakeTable(crc32.Castagnoli)); crc != want {
+		t.Errorf("CRC %08x, want %08x", crc, want)
+	}
+	if attrs := r.i16(); attrs != 0 {
+		t.Errorf("attributes %d", attrs)
+	}
+	lastDelta := r.i32()
+	r.i64() // first timestamp
+	r.i64() // max timestamp
+	if id, epoch, seq := r.i64(), r.i16(), r.i32(); id != -1 || epoch != -1 || seq != -1 {
+		t.Errorf("producer id %d, epoch %d, sequence %d", id, epoch, seq)
+	}
+	count := r.i32()
+	if lastDelta != count-1 {
+		t.Errorf("last offset delta %d for %d records", lastDelta, count)
+	}
+	in := bytes.NewReader(r.b)
+	varint := func() int64 {
+		v, err := binary.ReadVarint(in)
+		if err != nil {
+			t.Fatalf("record: %v", err)
+		}
+		return v
+	}
+	field := func() string {
+		b := make([]byte, varint())
+		io.ReadFull(in, b)
+		return string(b)
+	}
+	var records []kafkaRecord
+	for i := int32(0); i < count; i++ {
+		length := varint()
+		start := in.Len()
+		in.ReadByte() // attributes
+		varint()      // timestamp delta
+		if delta := varint(); delta != int64(i) {
+			t.Errorf("record %d: offset delta %d", i, delta)
+		}
+		rec := kafkaRecord{partition: partition, key: field(), value: field()}
+		if headers := varint(); headers != 0 {
+			t.Errorf("record %d: %d headers", i, headers)
+		}
+		if int64(start-in.Len()) != length {
+			t.Errorf("record %d: length %d, encoded in %d bytes", i, length, start-in.Len())
+		}
+		records = append(records, rec)
+	}
+	if in.Len() != 0 || r.err != nil {
+		t.Errorf("batch: %d bytes left, %v", in.Len(), r.err)
+	}
+	return records
+}
+
+func TestPublishKafka(t *testing.T) {
+	const topic = "fs_analyzer.dirs"
+	produced := make(chan []kafkaRecord, 10)
+	addr := testListener(t, func(conn net.Conn) {
+		for {
+			req, correlation, err := readKafkaRequest(conn)
+			if err != nil {
+				return
+			}
+			if req.clientID != "find_heavy_dirs" {
+				t.Errorf("client id %q", req.clientID)
+			}
+			var resp kafkaBuf
+			switch {
+			case req.apiKey == 3 && req.apiVersion == 1:
+				if n, name := req.body.i32(), req.body.str(); n != 1 || name != topic {
+					t.Errorf("metadata request for %d topics, %q", n, name)
+				}
+				resp.i32(1) // brokers
+				resp.i32(7)
+				resp.str("127.0.0.1")
+				resp.i32(int32(conn.LocalAddr().(*net.TCPAddr).Port))
+				resp.i16(-1) // rack
+				resp.i32(7)  // controller
+				resp.i32(1)  // topics
+				resp.i16(0)
+				resp.str(topic)
+				resp.i8(0)
+				resp.i32(2) // partitions, both led by broker 7
+				for p := int32(0); p < 2; p++ {
+					resp.i16(0)
+					resp.i32(p)
+					resp.i32(7)
+					resp.i32(1)
+					resp.i32(7) // replicas
+					resp.i32(1)
+					resp.i32(7) // isr
+				}
+			case req.apiKey == 0 && req.apiVersion == 3:
+				b := req.body
+				if txn, acks := b.i16(), b.i16(); txn != -1 || acks != 1 {
+					t.Errorf("transactional id length %d, acks %d", txn, acks)
+				}
+				b.i32() // timeout
+				if n, name := b.i32(), b.str(); n != 1 || name != topic {
+					t.Errorf("produce request for %d topics, %q", n, name)
+				}
+				if n := b.i32(); n != 1 {
+					t.Errorf("produce request for %d partitions", n)
+				}
+				partition := b.i32()
+				batch := b.next(int(b.i32()))
+				if b.err != nil || len(b.b) != 0 {
+					t.Errorf("produce request: %v, %d bytes left", b.err, len(b.b))
+				}
+				produced <- decodeKafkaBatch(t, partition, batch)
+				resp.i32(1)
+				resp.str(topic)
+				resp.i32(1)
+				resp.i32(partition)
+				resp.i16(0)  // error
+				resp.i64(0)  // base offset
+				resp.i64(-1) // log append time
+				resp.i32(0)  // throttle time
+			default:
+				t.Errorf("unexpected request %d v%d", req.apiKey, req.apiVersion)
+				return
+			}
+			writeKafkaResponse(conn, correlation, resp.Bytes())
+		}
+	})
+	var keys, messages [][]byte
+	for i := 0; i < 6; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("/srv/dir%d", i)))
+		messages = append(messages, []byte(fmt.Sprintf(`{"n":%d}`, i)))
+	}
+	if err := publishKafka(addr, topic, keys, messages); err != nil {
+		t.Fatal(err)
+	}
+	close(produced)
+	got := make(map[string]kafkaRecord)
+	for records := range produced {
+		for _, rec := range records {
+			got[rec.key] = rec
+		}
+	}
+	for i, key := range keys {
+		h := fnv.New32a()
+		h.Write(key)
+		want := kafkaRecord{partition: int32(h.Sum32() % 2), key: string(key), value: string(messages[i])}
+		if got[string(key)] != want {
+			t.Errorf("record %s = %+v, want %+v", key, got[string(key)], want)
+		}
+	}
+	if len(got) != len(keys) {
+		t.Errorf("%d records produced, want %d", len(got), len(keys))
+	}
+}
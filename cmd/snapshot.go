@@ -0,0 +1,811 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// --- Snapshots ---
+
+// snapshotVersion is bumped whenever the snapshot layout changes incompatibly
+const snapshotVersion = 1
+
+// snapshot is the aggregated result of a scan (--save), enough to re-render every directory
+// report without rescanning (--load). Reports that need individual files (name patterns, path
+// lengths, projects, subcommands, ...) cannot be built from it.
+type snapshot struct {
+	Version       int
+	Created       time.Time
+	Host          string
+	Targets       []string // Absolute target paths
+	SizeMode      string
+	CaseFold      bool       // Paths outside the CaseRoots were compared case-insensitively
+	CaseRoots     []caseRoot // Case sensitivity of each target root
+	Fingerprints  bool       // Scanned with --fingerprint
+	Permissions   bool       // Scanned with --permissions
+	ScanDurations bool       // Scanned with --slowest
+	Dirs          []*DirStat
+	Tags          map[string]map[string]string // Directory tags at the time of the scan (normalized paths)
+}
+
+// saveSnapshot writes every directory (after aggregation) as a gzip-compressed gob stream.
+func saveSnapshot(name string, startTime time.Time) error {
+	snap := snapshot{
+		Version:       snapshotVersion,
+		Created:       startTime.UTC(),
+		SizeMode:      sizeMode,
+		CaseFold:      caseInsensitivePaths,
+		CaseRoots:     caseRoots,
+		Fingerprints:  fingerprint,
+		Permissions:   permReport,
+		ScanDurations: slowestN > 0,
+		Dirs:          make([]*DirStat, 0, len(dirStats)),
+		Tags:          dirTags,
+	}
+	snap.Host, _ = os.Hostname()
+	for _, root := range targetPaths {
+		if abs, err := filepath.Abs(root); err == nil {
+			snap.Targets = append(snap.Targets, abs)
+		}
+	}
+	for _, s := range dirStats {
+		snap.Dirs = append(snap.Dirs, s)
+	}
+
+	out, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if err := gob.NewEncoder(zw).Encode(&snap); err != nil {
+		out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// readSnapshot decodes a snapshot file written by saveSnapshot
+func readSnapshot(name string) (*snapshot, error) {
+	in, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, fmt.Errorf("not a snapshot file: %v", err)
+	}
+	var snap snapshot
+	if err := gob.NewDecoder(zr).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("not a snapshot file: %v", err)
+	}
+	if snap.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d (expected %d)", snap.Version, snapshotVersion)
+	}
+	return &snap, nil
+}
+
+// loadSnapshot fills dirStats from a snapshot and returns the number of files it covers. Without
+// --path the snapshot's targets are used; with --path the reports are limited to those paths.
+func loadSnapshot(name string) (int, error) {
+	snap, err := readSnapshot(name)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case fingerprint && !snap.Fingerprints:
+		return 0, fmt.Errorf("--fingerprint requires a snapshot saved with --fingerprint")
+	case permReport && !snap.Permissions:
+		return 0, fmt.Errorf("--permissions requires a snapshot saved with --permissions")
+	case slowestN > 0 && !snap.ScanDurations:
+		return 0, fmt.Errorf("--slowest requires a snapshot saved with --slowest")
+	}
+
+	for _, s := range snap.Dirs {
+		dirStats[s.Path] = s
+	}
+	// Tags saved with the snapshot are kept unless the sidecar file has newer ones for the directory
+	if !anonymize {
+		for p, tags := range snap.Tags {
+			if _, ok := dirTags[p]; !ok {
+				dirTags[p] = tags
+			}
+		}
+	}
+	if len(targetPaths) == 0 {
+		targetPaths = snap.Targets
+	}
+	sizeMode = snap.SizeMode
+	caseInsensitivePaths, caseRoots = snap.CaseFold, snap.CaseRoots
+
+	files := 0
+	for _, root := range removeSubdirectories(snap.Targets) {
+		if s, ok := dirStats[root]; ok {
+			files += int(s.FileCount)
+		}
+	}
+	if verbose {
+		fmt.Printf("Loaded %d directories from %s (scanned %s on %s, targets: %v)\n",
+			len(snap.Dirs), name, snap.Created.Local().Format("2006-01-02 15:04"), snap.Host, snap.Targets)
+	}
+	return files, nil
+}
+
+// --- Immutable Areas ---
+
+// immutableArea is a read-only subtree (--assume-immutable) whose totals come from a snapshot
+type immutableArea struct {
+	Dir      string // Absolute path
+	Snapshot string
+	Merged   bool
+	Created  time.Time // Of the snapshot
+}
+
+var (
+	immutableAreas []*immutableArea
+	immutableDirs  []*DirStat // Stored subdirectories, added after aggregation
+	immutableSnaps = make(map[string]*snapshot)
+)
+
+// immutableAreaAt returns the --assume-immutable area rooted at path, if any
+func immutableAreaAt(path string) *immutableArea {
+	for _, a := range immutableAreas {
+		if normalizePath(a.Dir) == normalizePath(path) {
+			return a
+		}
+	}
+	return nil
+}
+
+// mergeImmutable takes an area's subtree from its snapshot instead of walking it and returns the
+// number of files it holds. The area's own entry keeps its stored (aggregated) totals and goes
+// through aggregateStats as a leaf; the stored subdirectories are added after aggregation, so
+// nothing is counted twice.
+func mergeImmutable(a *immutableArea, depth int) (int64, error) {
+	snap, ok := immutableSnaps[a.Snapshot]
+	if !ok {
+		var err error
+		if snap, err = readSnapshot(a.Snapshot); err != nil {
+			return 0, err
+		}
+		immutableSnaps[a.Snapshot] = snap
+	}
+	switch {
+	case snap.SizeMode != sizeMode:
+		return 0, fmt.Errorf("snapshot was saved with --size-mode %s, this scan uses %s", snap.SizeMode, sizeMode)
+	case permReport && !snap.Permissions:
+		return 0, fmt.Errorf("--permissions requires a snapshot saved with --permissions")
+	}
+
+	var root *DirStat
+	var subdirs []*DirStat
+	normDir := normalizePath(a.Dir)
+	for _, s := range snap.Dirs {
+		normPath := normalizePath(s.Path)
+		if normPath == normDir {
+			root = s
+		} else if isPathEqualOrSubpath(normPath, normDir) {
+			subdirs = append(subdirs, s)
+		}
+	}
+	if root == nil {
+		return 0, fmt.Errorf("the snapshot does not cover %s", a.Dir)
+	}
+	// Depths are relative to the targets of this scan, not of the scan that saved the snapshot
+	shift := depth - root.Depth
+	root.Depth = depth
+	for _, s := range subdirs {
+		s.Depth += shift
+	}
+	dirStats[a.Dir] = root
+	immutableDirs = append(immutableDirs, subdirs...)
+	a.Merged, a.Created = true, snap.Created
+	return root.FileCount, nil
+}
+
+// mergeImmutableDirs adds the stored subdirectories of the immutable areas after aggregation
+func mergeImmutableDirs() {
+	for _, s := range immutableDirs {
+		dirStats[s.Path] = s
+	}
+}
+
+// printImmutableNote lists the areas taken from snapshots, with the age of their data
+func printImmutableNote() {
+	var merged, missed []string
+	for _, a := range immutableAreas {
+		if a.Merged {
+			merged = append(merged, fmt.Sprintf("%s (from %s, %s)", shownPath(a.Dir), a.Snapshot, a.Created.Local().Format("2006-01-02")))
+		} else {
+			missed = append(missed, shownPath(a.Dir))
+		}
+	}
+	if len(merged) > 0 {
+		fmt.Printf("\nNote: Not scanned, taken from snapshots (--assume-immutable): %s. Per-file reports do not cover them.\n", strings.Join(merged, ", "))
+	}
+	if len(missed) > 0 {
+		fmt.Printf("\nWarning: --assume-immutable area(s) not reached by the scan: %s\n", strings.Join(missed, ", "))
+	}
+}
+
+// --- Listing Ingest ---
+
+// listingEntry is one file of a prior find/stat listing (--from-listing)
+type listingEntry struct {
+	Path  string
+	Size  int64
+	Mtime int64 // Unix seconds, 0 if unknown
+	Uid   int64 // -1 if unknown
+}
+
+// loadListing fills dirStats from a listing file instead of walking the file system. Without
+// --path, the deepest directory common to all listed paths becomes the target.
+func loadListing(file string) (int, error) {
+	entries, err := readListing(file)
+	if err != nil {
+		return 0, err
+	}
+	if len(targetPaths) == 0 {
+		targetPaths = []string{commonDir(entries)}
+	}
+	targetPaths = removeSubdirectories(targetPaths)
+
+	count := 0
+	for _, e := range entries {
+		root := ""
+		for _, t := range targetPaths {
+			if isPathEqualOrSubpath(e.Path, t) {
+				root = t
+				break
+			}
+		}
+		if root == "" || isExcluded(filepath.Dir(e.Path)) {
+			continue
+		}
+		if onlyUid >= 0 && e.Uid >= 0 && e.Uid != onlyUid {
+			otherFiles++
+			otherSize += e.Size
+			continue
+		}
+		depth := strings.Count(e.Path, string(os.PathSeparator)) - strings.Count(root, string(os.PathSeparator))
+		if maxDepth != -1 && depth > maxDepth {
+			continue
+		}
+
+		// Directories are implicit in a listing: create every ancestor so aggregation reaches the root
+		for dir, child := filepath.Dir(e.Path), ""; ; dir, child = filepath.Dir(dir), dir {
+			s, ok := dirStats[dir]
+			if !ok {
+				s = getDirStat(dir)
+				s.Depth = strings.Count(dir, string(os.PathSeparator)) - strings.Count(root, string(os.PathSeparator))
+			}
+			if child != "" {
+				s.Entries++ // child was created in the previous iteration
+			}
+			if ok || filepath.Dir(dir) == dir {
+				break
+			}
+		}
+		dirStats[filepath.Dir(e.Path)].Entries++
+		if pathLengths {
+			notePathLength(e.Path)
+		}
+		if byProject {
+			noteProjectMarker(e.Path)
+		}
+		recordFile(filepath.Dir(e.Path), e.Size, e.Mtime)
+		if fingerprint {
+			addDigest(dirStats[filepath.Dir(e.Path)], "f", filepath.Base(e.Path), strconv.FormatInt(e.Size, 10), fingerprintMtime(e.Mtime))
+		}
+		if command == "dupes" {
+			noteArchive(e.Path, e.Size)
+		}
+		if namePatterns {
+			recordNamePattern(filepath.Base(e.Path), e.Size)
+		}
+		if len(retentionRules) > 0 {
+			noteRetentionFile(e.Path, e.Size, e.Mtime)
+		}
+		if backupCatalog != nil {
+			noteBackupGap(e.Path, e.Size, e.Size, e.Mtime)
+		}
+		if command == "heavy-files-by-type" {
+			noteMediaFile(e.Path, e.Size, e.Mtime, false)
+		}
+		if command == "logs" {
+			noteLogFile(e.Path, e.Size, e.Mtime)
+		}
+		if command == "databases" {
+			noteDatabaseFile(e.Path, e.Size, false)
+		}
+		if crashDumps {
+			noteCrashFile(e.Path, e.Size, e.Mtime, false)
+		}
+		if tempReport {
+			noteTempFile(e.Path, e.Size, e.Mtime)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// readListing parses a CSV file (columns path,size,mtime,uid; a header row is optional and may
+// reorder them) or JSON (an array or one object per line with the same keys).
+func readListing(file string) ([]listingEntry, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return readJSONListing(trimmed)
+	}
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	columns := map[string]int{"path": 0, "size": 1, "mtime": 2, "uid": 3}
+	var entries []listingEntry
+	for line := 1; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && len(rec) > 1 {
+			if _, err := strconv.ParseInt(strings.TrimSpace(rec[1]), 10, 64); err != nil {
+				// Header row: map column names to positions
+				columns = make(map[string]int)
+				for i, name := range rec {
+					columns[strings.ToLower(strings.TrimSpace(name))] = i
+				}
+				if _, ok := columns["path"]; !ok {
+					return nil, fmt.Errorf("header has no path column")
+				}
+				continue
+			}
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		e := listingEntry{Path: field("path"), Uid: -1}
+		if e.Size, err = strconv.ParseInt(field("size"), 10, 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid size %q", line, field("size"))
+		}
+		if v := field("mtime"); v != "" {
+			e.Mtime = parseListingTime(v)
+		}
+		if v := field("uid"); v != "" {
+			if uid, err := strconv.ParseInt(v, 10, 64); err == nil {
+				e.Uid = uid
+			}
+		}
+		if e.Path != "" {
+			e.Path = filepath.Clean(filepath.FromSlash(e.Path))
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func readJSONListing(data []byte) ([]listingEntry, error) {
+	type jsonEntry struct {
+		Path  string          `json:"path"`
+		Size  int64           `json:"size"`
+		Mtime json.RawMessage `json:"mtime"`
+		Uid   *int64          `json:"uid"`
+	}
+	var raw []jsonEntry
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		for {
+			var e jsonEntry
+			if err := dec.Decode(&e); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			raw = append(raw, e)
+		}
+	}
+
+	entries := make([]listingEntry, 0, len(raw))
+	for _, r := range raw {
+		if r.Path == "" {
+			continue
+		}
+		e := listingEntry{Path: filepath.Clean(filepath.FromSlash(r.Path)), Size: r.Size, Uid: -1}
+		if r.Uid != nil {
+			e.Uid = *r.Uid
+		}
+		if len(r.Mtime) > 0 {
+			e.Mtime = parseListingTime(strings.Trim(string(r.Mtime), `"`))
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// parseListingTime accepts Unix seconds (as printed by find -printf %T@) or RFC 3339.
+func parseListingTime(v string) int64 {
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return int64(f)
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.Unix()
+	}
+	return 0
+}
+
+// commonDir returns the deepest directory containing every listed path.
+func commonDir(entries []listingEntry) string {
+	if len(entries) == 0 {
+		return string(os.PathSeparator)
+	}
+	common := filepath.Dir(entries[0].Path)
+	for _, e := range entries[1:] {
+		for !isPathEqualOrSubpath(e.Path, common) && filepath.Dir(common) != common {
+			common = filepath.Dir(common)
+		}
+	}
+	return common
+}
+
+// getDirStat safely retrieves or initializes Map entry
+func getDirStat(path string) *DirStat {
+	s, ok := dirStats[path]
+	if !ok {
+		s = &DirStat{Path: path, Uid: -1}
+		dirStats[path] = s
+	}
+	return s
+}
+
+// isUnderTargets checks if the path is under the user-specified search paths
+func isUnderTargets(path string) bool {
+	normPath := normalizePath(path)
+	for _, root := range targetPaths {
+		normRoot := normalizePath(root)
+		if isPathEqualOrSubpath(normPath, normRoot) {
+			return true
+		}
+	}
+	return false
+}
+
+// isExactTarget checks whether path exactly matches one of user input roots.
+func isExactTarget(path string) bool {
+	normPath := normalizePath(path)
+	for _, root := range targetPaths {
+		if normPath == normalizePath(root) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeSubdirectories cleans up the target list by removing subdirectories that are already covered by parent directories in the list
+func removeSubdirectories(paths []string) []string {
+	if len(paths) == 0 {
+		return paths
+	}
+
+	// Convert to absolute paths
+	absPaths := make([]string, 0, len(paths))
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			fmt.Printf("Warning: Could not resolve path %s: %v\n", p, err)
+			continue
+		}
+		absPaths = append(absPaths, abs)
+	}
+
+	// Sort paths (by normalized form, so "C:\Users" and "c:\users" compare equal) to ensure parents come before children
+	sort.SliceStable(absPaths, func(i, j int) bool {
+		return normalizePath(absPaths[i]) < normalizePath(absPaths[j])
+	})
+
+	var clean []string
+	for _, p := range absPaths {
+		// Check if p equals or is a subdirectory of any kept path
+		// Must handle case where p is "/tmp/foo" and last is "/tmp"
+		// Also handle "/tmp" and "/tmp" (duplicates, also differing only in case on case-insensitive file systems)
+		// And "/tmp" vs "/tmp2" or "/tmp-x" (not subdirectory, but may sort between "/tmp" and "/tmp/foo")
+		normP := normalizePath(p)
+		covered := false
+		for _, kept := range clean {
+			if isPathEqualOrSubpath(normP, normalizePath(kept)) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			clean = append(clean, p)
+		}
+	}
+	return clean
+}
+
+// detectCaseRoots probes each target root on its own, since the targets may lie on different
+// file systems (an ext4 home next to a mounted NTFS or exFAT volume)
+func detectCaseRoots(roots []string) {
+	caseRoots = nil
+	for _, root := range roots {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		caseRoots = append(caseRoots, caseRoot{Path: filepath.Clean(abs), Fold: detectCaseInsensitive(abs)})
+	}
+	sort.Slice(caseRoots, func(i, j int) bool { return len(caseRoots[i].Path) > len(caseRoots[j].Path) })
+}
+
+// detectCaseInsensitive reports whether the file system holding path compares names
+// case-insensitively, by looking up a path component with its case flipped. If the path has
+// no letters to flip (e.g. "/"), the platform default is kept (Windows and macOS: insensitive).
+func detectCaseInsensitive(path string) bool {
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return caseInsensitivePaths
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return caseInsensitivePaths
+	}
+	for p := abs; filepath.Dir(p) != p; p = filepath.Dir(p) {
+		base := filepath.Base(p)
+		flipped := strings.Map(func(r rune) rune {
+			if lower := unicode.ToLower(r); lower != r {
+				return lower
+			}
+			return unicode.ToUpper(r)
+		}, base)
+		if flipped == base {
+			continue
+		}
+		probe := filepath.Join(filepath.Dir(p), flipped) + strings.TrimPrefix(abs, p)
+		probeInfo, err := os.Stat(probe)
+		return err == nil && os.SameFile(info, probeInfo)
+	}
+	return caseInsensitivePaths
+}
+
+// --- Signing ---
+
+// signatureVersion is bumped whenever the layout of signature files changes incompatibly
+const signatureVersion = 1
+
+var (
+	signKey     ed25519.PrivateKey // --sign-key
+	verifyKey   = ""               // verify-report --key
+	verifyFiles []string
+)
+
+// signature is the detached signature of a snapshot, summary or export, written next to it as
+// <file>.sig. Ed25519 signs the JSON encoding of all other fields, so the time, host and version
+// of the scan cannot be changed without breaking it either.
+type signature struct {
+	Version   int    `json:"version"`
+	Algorithm string `json:"algorithm"`
+	File      string `json:"file"` // Base name at signing time; renaming the file is allowed
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	Signed    string `json:"signed"` // RFC 3339, UTC
+	Host      string `json:"host"`
+	Tool      string `json:"tool"`
+	KeyID     string `json:"key_id"`
+	Signature string `json:"signature,omitempty"` // Base64
+}
+
+// keyID identifies a public key by the first 8 bytes of its SHA-256
+func keyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// readPEM returns the first PEM block of a file
+func readPEM(name string) (*pem.Block, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	return block, nil
+}
+
+// loadSigningKey reads an Ed25519 private key in PKCS #8 PEM form, as written by
+// openssl genpkey -algorithm ed25519
+func loadSigningKey(name string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(name)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not an Ed25519 private key")
+	}
+	return priv, nil
+}
+
+// loadVerifyKey reads an Ed25519 public key in PKIX PEM form (openssl pkey -pubout); a private
+// key is accepted as well.
+func loadVerifyKey(name string) (ed25519.PublicKey, error) {
+	block, err := readPEM(name)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "PRIVATE KEY" {
+		priv, err := loadSigningKey(name)
+		if err != nil {
+			return nil, err
+		}
+		return priv.Public().(ed25519.PublicKey), nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("not an Ed25519 public key")
+	}
+	return pub, nil
+}
+
+// fileDigest returns the size and SHA-256 (hex) of a file
+func fileDigest(name string) (int64, string, error) {
+	in, err := os.Open(name)
+	if err != nil {
+		return 0, "", err
+	}
+	defer in.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, in)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// signFile writes <name>.sig with --sign-key. The file itself is already written, so a failure
+// is reported as a warning.
+func signFile(name string) {
+	if signKey == nil {
+		return
+	}
+	size, digest, err := fileDigest(name)
+	if err != nil {
+		fmt.Printf("Warning: Could not sign %s: %v\n", name, err)
+		return
+	}
+	sig := signature{
+		Version:   signatureVersion,
+		Algorithm: "ed25519",
+		File:      filepath.Base(name),
+		Size:      size,
+		SHA256:    digest,
+		Signed:    time.Now().UTC().Format(time.RFC3339),
+		Tool:      version,
+		KeyID:     keyID(signKey.Public().(ed25519.PublicKey)),
+	}
+	sig.Host, _ = os.Hostname()
+	payload, err := json.Marshal(sig)
+	if err != nil {
+		fmt.Printf("Warning: Could not sign %s: %v\n", name, err)
+		return
+	}
+	sig.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(signKey, payload))
+	data, err := json.MarshalIndent(sig, "", "  ")
+	if err == nil {
+		err = os.WriteFile(name+".sig", append(data, '\n'), 0o644)
+	}
+	if err != nil {
+		fmt.Printf("Warning: Could not write the signature of %s: %v\n", name, err)
+	}
+}
+
+// verifyFile checks a file against its <name>.sig and returns the signature
+func verifyFile(name string, pub ed25519.PublicKey) (signature, error) {
+	var sig signature
+	data, err := os.ReadFile(name + ".sig")
+	if err != nil {
+		return sig, err
+	}
+	if err := json.Unmarshal(data, &sig); err != nil {
+		return sig, fmt.Errorf("%s.sig is not a signature file: %v", name, err)
+	}
+	if sig.Version != signatureVersion || sig.Algorithm != "ed25519" {
+		return sig, fmt.Errorf("unsupported signature (version %d, algorithm %q)", sig.Version, sig.Algorithm)
+	}
+	raw, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return sig, fmt.Errorf("malformed signature: %v", err)
+	}
+	unsigned := sig
+	unsigned.Signature = ""
+	payload, err := json.Marshal(unsigned)
+	if err != nil {
+		return sig, err
+	}
+	if !ed25519.Verify(pub, payload, raw) {
+		if sig.KeyID != keyID(pub) {
+			return sig, fmt.Errorf("signed with another key (key id %s, expected %s)", sig.KeyID, keyID(pub))
+		}
+		return sig, fmt.Errorf("the signature file was altered")
+	}
+	size, digest, err := fileDigest(name)
+	if err != nil {
+		return sig, err
+	}
+	if size != sig.Size || digest != sig.SHA256 {
+		return sig, fmt.Errorf("the file was modified after it was signed")
+	}
+	return sig, nil
+}
+
+// runVerifyReport implements "verify-report --key <public key> <file>...": it checks every file
+// against its .sig and exits with status 1 if any of them fails.
+func runVerifyReport() {
+	pub, err := loadVerifyKey(verifyKey)
+	if err != nil {
+		fmt.Printf("Error: --key %s: %v\n", verifyKey, err)
+		os.Exit(1)
+	}
+	failed := 0
+	for _, name := range verifyFiles {
+		sig, err := verifyFile(name, pub)
+		if err != nil {
+			fmt.Printf("FAILED %s: %v\n", name, err)
+			failed++
+			continue
+		}
+		fmt.Printf("OK     %s (signed %s on %s by %s, key %s)\n", name, sig.Signed, sig.Host, sig.Tool, sig.KeyID)
+	}
+	if failed > 0 {
+		fmt.Printf("\n%d of %d files failed verification.\n", failed, len(verifyFiles))
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,2347 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Retention Simulation ---
+
+// retentionRule is one rule of simulate-retention. Delete rules match files by name and age;
+// keep rules keep the Keep newest matching files of every directory and reclaim the rest.
+type retentionRule struct {
+	Text   string
+	Glob   string
+	MinAge time.Duration // delete: only files at least this old (0 = any age)
+	Keep   int           // keep: number of newest files kept per directory (-1 for delete rules)
+
+	Size  int64 // Space the rule alone would reclaim
+	Files int64
+}
+
+// retentionFile is a file matched by a keep rule, kept until the per-directory ranking is done
+type retentionFile struct {
+	Dir     string
+	Size    int64
+	Mtime   int64
+	Rules   uint64 // Bit i is set if keep rule i matches
+	Deleted bool   // Already reclaimed by an earlier rule (counted once in the total)
+}
+
+var (
+	retentionRules   []*retentionRule
+	retentionFiles   []*retentionFile
+	retentionTotal   int64        // Space reclaimed by any rule
+	retentionMatched int64        // Files reclaimed by any rule
+	retentionNow     = time.Now() // File ages are measured from program start
+)
+
+// addRetentionRule parses "delete <glob> [older than <age>]" or
+// "keep <N> newest [<glob>] per directory" and exits on invalid rules.
+func addRetentionRule(text string) {
+	fields := strings.Fields(text)
+	fail := func(reason string) {
+		fmt.Printf("Error: Invalid retention rule '%s': %s\n", text, reason)
+		os.Exit(1)
+	}
+	if len(fields) == 0 {
+		fail("empty rule")
+	}
+	rule := &retentionRule{Text: strings.Join(fields, " "), Glob: "*", Keep: -1}
+	switch strings.ToLower(fields[0]) {
+	case "delete":
+		if len(fields) != 2 && !(len(fields) == 5 && strings.EqualFold(fields[2], "older") && strings.EqualFold(fields[3], "than")) {
+			fail("expected \"delete <glob> [older than <age>]\"")
+		}
+		rule.Glob = fields[1]
+		if len(fields) == 5 {
+			age, err := parseAge(fields[4])
+			if err != nil {
+				fail(err.Error())
+			}
+			rule.MinAge = age
+		}
+	case "keep":
+		n := len(fields)
+		if (n != 5 && n != 6) || !strings.EqualFold(fields[2], "newest") || !strings.EqualFold(fields[n-2], "per") || !strings.HasPrefix(strings.ToLower(fields[n-1]), "dir") {
+			fail("expected \"keep <N> newest [<glob>] per directory\"")
+		}
+		keep, err := strconv.Atoi(fields[1])
+		if err != nil || keep < 0 {
+			fail("the number of files to keep must be a non-negative integer")
+		}
+		rule.Keep = keep
+		if n == 6 {
+			rule.Glob = fields[3]
+		}
+		if countKeepRules() >= 64 {
+			fail("at most 64 keep rules are supported")
+		}
+	default:
+		fail("rules start with \"delete\" or \"keep\"")
+	}
+	if _, err := filepath.Match(rule.Glob, ""); err != nil {
+		fail("invalid glob: " + err.Error())
+	}
+	retentionRules = append(retentionRules, rule)
+}
+
+// parseAge parses ages such as 12h, 30d, 8w or 1y (365 days)
+func parseAge(s string) (time.Duration, error) {
+	units := map[byte]time.Duration{'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour, 'y': 365 * 24 * time.Hour}
+	if len(s) >= 2 {
+		if unit, ok := units[s[len(s)-1]]; ok {
+			if n, err := strconv.Atoi(s[:len(s)-1]); err == nil && n >= 0 {
+				return time.Duration(n) * unit, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("invalid age %q (use e.g. 12h, 30d, 8w, 1y)", s)
+}
+
+func countKeepRules() int {
+	n := 0
+	for _, r := range retentionRules {
+		if r.Keep >= 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// noteRetentionFile applies the delete rules to a file right away and remembers it for the keep
+// rules that match its name, which can only be decided once the whole directory is known.
+func noteRetentionFile(path string, size, mtime int64) {
+	name := filepath.Base(path)
+	age := retentionNow.Sub(time.Unix(mtime, 0))
+	deleted := false
+	var keepBits uint64
+	keepIndex := 0
+	for _, r := range retentionRules {
+		matched, _ := filepath.Match(r.Glob, name)
+		if r.Keep >= 0 {
+			if matched {
+				keepBits |= 1 << keepIndex
+			}
+			keepIndex++
+			continue
+		}
+		if matched && (r.MinAge == 0 || mtime > 0 && age >= r.MinAge) {
+			r.Size += size
+			r.Files++
+			deleted = true
+		}
+	}
+	if deleted {
+		retentionTotal += size
+		retentionMatched++
+	}
+	if keepBits != 0 {
+		retentionFiles = append(retentionFiles, &retentionFile{Dir: filepath.Dir(path), Size: size, Mtime: mtime, Rules: keepBits, Deleted: deleted})
+	}
+}
+
+// applyKeepRules ranks the files of every keep rule per directory, newest first, and reclaims
+// everything after the first Keep files.
+func applyKeepRules() {
+	keepIndex := 0
+	for _, r := range retentionRules {
+		if r.Keep < 0 {
+			continue
+		}
+		byDir := make(map[string][]*retentionFile)
+		for _, f := range retentionFiles {
+			if f.Rules&(1<<keepIndex) != 0 {
+				byDir[f.Dir] = append(byDir[f.Dir], f)
+			}
+		}
+		keepIndex++
+		for _, files := range byDir {
+			if len(files) <= r.Keep {
+				continue
+			}
+			sort.SliceStable(files, func(i, j int) bool { return files[i].Mtime > files[j].Mtime })
+			for _, f := range files[r.Keep:] {
+				r.Size += f.Size
+				r.Files++
+				if !f.Deleted {
+					f.Deleted = true
+					retentionTotal += f.Size
+					retentionMatched++
+				}
+			}
+		}
+	}
+}
+
+func printRetentionSimulation(startTime time.Time) {
+	applyKeepRules()
+
+	var scanned int64
+	for _, root := range targetPaths {
+		if s, ok := dirStats[root]; ok {
+			scanned += s.TotalSize
+		}
+	}
+	percent := func(size int64) string {
+		if scanned == 0 {
+			return "-"
+		}
+		return formatDecimal(float64(size)*100/float64(scanned), 1) + "%"
+	}
+
+	fmt.Printf("\n--- Retention Simulation (as of %s, nothing was deleted) ---\n", startTime.Format("2006-01-02 15:04"))
+	fmt.Printf("%-15s | %-15s | %-8s | %-50s\n", "Reclaim", "Files", "Share", "Rule")
+	fmt.Println(strings.Repeat("-", 70))
+	for _, r := range retentionRules {
+		fmt.Printf("%-15s | %-15s | %-8s | %s\n", formatBytes(r.Size), formatFiles(r.Files), percent(r.Size), r.Text)
+	}
+	fmt.Println(strings.Repeat("-", 70))
+	fmt.Printf("%-15s | %-15s | %-8s | %s\n", formatBytes(retentionTotal), formatFiles(retentionMatched), percent(retentionTotal), "All rules (files matched by several rules counted once)")
+	fmt.Printf("Scanned: %s\n", formatBytes(scanned))
+}
+
+// --- Backup Gap ---
+
+// catalogEntry is a file as recorded in the backup
+type catalogEntry struct {
+	Size  int64
+	Mtime int64 // Unix seconds, 0 if unknown
+}
+
+// backupCatalog maps normalized paths to their backup entry (nil unless backup-gap)
+var backupCatalog map[string]catalogEntry
+
+// Files missing from the backup and files changed since it (for the summary)
+var gapMissing, gapChanged int64
+
+// gapMtimeSlack tolerates the minute precision of tar listings and time zone rounding
+const gapMtimeSlack = 60
+
+// loadCatalog reads a restic "ls --json" or borg "list --json-lines" listing (one JSON object per
+// line), or GNU "tar -tv" output. Only regular files are kept.
+func loadCatalog(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	backupCatalog = make(map[string]catalogEntry)
+	add := func(p string, size int64, mtime int64) {
+		p = filepath.FromSlash(p)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(catalogRoot, p)
+		}
+		backupCatalog[normalizePath(p)] = catalogEntry{Size: size, Mtime: mtime}
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "{") {
+			var node struct {
+				Type       string `json:"type"`
+				StructType string `json:"struct_type"`
+				Path       string `json:"path"`
+				Size       int64  `json:"size"`
+				Mtime      string `json:"mtime"`
+			}
+			if err := json.Unmarshal([]byte(line), &node); err != nil {
+				return fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			// restic: struct_type "node", type "file"; borg: type "-"
+			if node.StructType == "snapshot" || (node.Type != "file" && node.Type != "-") || node.Path == "" {
+				continue
+			}
+			add(node.Path, node.Size, parseCatalogTime(node.Mtime))
+			continue
+		}
+
+		// GNU tar -tv: -rw-r--r-- user/group 1234 2024-01-31 12:00 path/to/file
+		fields := strings.Fields(line)
+		if len(fields) < 6 || !strings.HasPrefix(fields[0], "-") {
+			continue // Directories, links, devices
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("line %d: unrecognized catalog line", lineNo)
+		}
+		stamp := fields[3] + " " + fields[4]
+		name := strings.TrimSpace(line[strings.Index(line, stamp)+len(stamp):])
+		add(strings.TrimPrefix(name, "./"), size, parseCatalogTime(stamp))
+	}
+	return scanner.Err()
+}
+
+// parseCatalogTime parses RFC 3339 times (restic) and zone-less local times (borg, tar)
+func parseCatalogTime(v string) int64 {
+	if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return t.Unix()
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05.999999", "2006-01-02 15:04:05", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			return t.Unix()
+		}
+	}
+	return 0
+}
+
+// noteBackupGap counts a local file as unprotected if the backup has no copy of it, or only an
+// older one (size differs or mtime is newer than the backup's).
+func noteBackupGap(path string, size, apparentSize, mtime int64) {
+	entry, ok := backupCatalog[normalizePath(path)]
+	switch {
+	case !ok:
+		gapMissing++
+	case entry.Size != apparentSize || entry.Mtime > 0 && mtime > entry.Mtime+gapMtimeSlack:
+		gapChanged++
+	default:
+		return
+	}
+	s := getDirStat(filepath.Dir(path))
+	s.Unprotected += size
+	s.UnprotectedFiles++
+}
+
+func printBackupGap(list []*DirStat) {
+	var ranked []*DirStat
+	for _, s := range list {
+		if s.Unprotected > 0 {
+			ranked = append(ranked, s)
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		return ranked[i].Unprotected > ranked[j].Unprotected
+	})
+
+	fmt.Printf("\n--- Top %d Directories by Unprotected Size (not in backup or changed since) ---\n", topN)
+	fmt.Printf("%-15s | %-15s | %-8s | %-50s\n", "Unprotected", "Files", "Share", "Path")
+	fmt.Println(strings.Repeat("-", 70))
+	for i, s := range ranked {
+		if i >= topN {
+			break
+		}
+		share := "-"
+		if s.TotalSize > 0 {
+			share = fmt.Sprintf("%.0f%%", float64(s.Unprotected)*100/float64(s.TotalSize))
+		}
+		fmt.Printf("%-15s | %-15s | %-8s | %s\n", formatBytes(s.Unprotected), formatFiles(s.UnprotectedFiles), share, shownPath(s.Path))
+	}
+
+	var total, unprotected int64
+	for _, root := range targetPaths {
+		if s, ok := dirStats[root]; ok {
+			total += s.TotalSize
+			unprotected += s.Unprotected
+		}
+	}
+	fmt.Printf("\nUnprotected: %s of %s scanned (%d files missing from the backup, %d changed since)\n",
+		formatBytes(unprotected), formatBytes(total), gapMissing, gapChanged)
+}
+
+// --- Copy Planning ---
+
+// copyUnit is a piece of work for one copy worker: a directory with everything below it, or
+// only the files directly inside a directory (FilesOnly) when its subdirectories were split off.
+type copyUnit struct {
+	Path      string
+	FilesOnly bool
+	Size      int64
+	Files     int64
+}
+
+// copyShard is the set of units assigned to one worker
+type copyShard struct {
+	Units []copyUnit
+	Size  int64
+	Files int64
+}
+
+func (u copyUnit) weight() int64 {
+	if shardBalance == "files" {
+		return u.Files
+	}
+	return u.Size
+}
+
+func (s *copyShard) weight() int64 {
+	if shardBalance == "files" {
+		return s.Files
+	}
+	return s.Size
+}
+
+// planCopy splits the targets into units, breaking up the heaviest directory into its
+// subdirectories and own files until no unit exceeds a quarter of a shard's fair share (or it
+// cannot be split), and then assigns the units heaviest first to the lightest shard.
+func planCopy() error {
+	children := make(map[string][]string)
+	for p := range dirStats {
+		if parent := filepath.Dir(p); parent != p && isUnderTargets(p) && !isExactTarget(p) {
+			children[parent] = append(children[parent], p)
+		}
+	}
+
+	var units []copyUnit
+	var total int64
+	for _, root := range targetPaths {
+		if s, ok := dirStats[root]; ok {
+			u := copyUnit{Path: root, Size: s.TotalSize, Files: s.FileCount}
+			units = append(units, u)
+			total += u.weight()
+		}
+	}
+	limit := total / int64(shardCount) / 4
+	for {
+		sort.Slice(units, func(i, j int) bool {
+			if units[i].weight() != units[j].weight() {
+				return units[i].weight() > units[j].weight()
+			}
+			return units[i].Path < units[j].Path
+		})
+		if len(units) == 0 || units[0].weight() <= limit {
+			break
+		}
+		split := -1
+		for i, u := range units {
+			if u.weight() <= limit {
+				break
+			}
+			if !u.FilesOnly && len(children[u.Path]) > 0 {
+				split = i
+				break
+			}
+		}
+		if split < 0 {
+			break // The heavy units are single directories' own files
+		}
+		u := units[split]
+		units = append(units[:split], units[split+1:]...)
+		for _, c := range children[u.Path] {
+			s := dirStats[c]
+			units = append(units, copyUnit{Path: c, Size: s.TotalSize, Files: s.FileCount})
+		}
+		if s := dirStats[u.Path]; s.OwnFiles > 0 {
+			units = append(units, copyUnit{Path: u.Path, FilesOnly: true, Size: s.OwnSize, Files: s.OwnFiles})
+		}
+	}
+
+	shards := make([]*copyShard, shardCount)
+	for i := range shards {
+		shards[i] = &copyShard{}
+	}
+	for _, u := range units {
+		lightest := shards[0]
+		for _, s := range shards[1:] {
+			if s.weight() < lightest.weight() {
+				lightest = s
+			}
+		}
+		lightest.Units = append(lightest.Units, u)
+		lightest.Size += u.Size
+		lightest.Files += u.Files
+	}
+
+	fmt.Printf("\n--- Copy Plan: %d Shards Balanced by %s ---\n", shardCount, shardBalance)
+	fmt.Printf("%-8s | %-15s | %-15s | %s\n", "Shard", "Size", "Files", "Paths")
+	fmt.Println(strings.Repeat("-", 70))
+	for i, s := range shards {
+		fmt.Printf("%-8d | %-15s | %-15s | %d\n", i+1, formatBytes(s.Size), formatFiles(s.Files), len(s.Units))
+	}
+	if outputFile == "" {
+		fmt.Println("Use --output <dir> to write the path list of every shard.")
+		return nil
+	}
+
+	if err := os.MkdirAll(outputFile, 0o755); err != nil {
+		return err
+	}
+	for i, s := range shards {
+		if err := writeShard(filepath.Join(outputFile, fmt.Sprintf("shard-%02d.txt", i+1)), s); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Path lists written to %s (shard-01.txt ... shard-%02d.txt)\n", outputFile, shardCount)
+	return nil
+}
+
+// writeShard writes one path per line: directories are copied recursively; for a directory whose
+// subdirectories belong to other units, its files are listed individually.
+func writeShard(name string, shard *copyShard) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	sort.Slice(shard.Units, func(i, j int) bool { return shard.Units[i].Path < shard.Units[j].Path })
+	for _, u := range shard.Units {
+		if !u.FilesOnly {
+			fmt.Fprintln(w, u.Path)
+			continue
+		}
+		entries, err := fs.ReadDir(scannedFS(u.Path), ".")
+		if err != nil {
+			fmt.Fprintf(w, "# files directly in %s: %v\n", u.Path, err)
+			continue
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				fmt.Fprintln(w, filepath.Join(u.Path, e.Name()))
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// --- Media Files ---
+
+// mediaFormats maps file extensions to a media category and container/format name
+var mediaFormats = map[string][2]string{
+	".mp4": {"video", "MP4"}, ".m4v": {"video", "MP4"}, ".mov": {"video", "QuickTime"}, ".mkv": {"video", "Matroska"},
+	".webm": {"video", "WebM"}, ".avi": {"video", "AVI"}, ".wmv": {"video", "WMV"}, ".mxf": {"video", "MXF"},
+	".mpg": {"video", "MPEG-PS"}, ".mpeg": {"video", "MPEG-PS"}, ".ts": {"video", "MPEG-TS"}, ".m2ts": {"video", "MPEG-TS"},
+	".r3d": {"video", "REDCODE"}, ".braw": {"video", "Blackmagic RAW"}, ".prores": {"video", "ProRes"},
+	".jpg": {"image", "JPEG"}, ".jpeg": {"image", "JPEG"}, ".png": {"image", "PNG"}, ".gif": {"image", "GIF"},
+	".tif": {"image", "TIFF"}, ".tiff": {"image", "TIFF"}, ".exr": {"image", "OpenEXR"}, ".dpx": {"image", "DPX"},
+	".psd": {"image", "Photoshop"}, ".psb": {"image", "Photoshop"}, ".heic": {"image", "HEIF"}, ".webp": {"image", "WebP"},
+	".bmp": {"image", "BMP"}, ".cr2": {"image", "Camera RAW"}, ".cr3": {"image", "Camera RAW"}, ".nef": {"image", "Camera RAW"},
+	".arw": {"image", "Camera RAW"}, ".dng": {"image", "Camera RAW"}, ".raf": {"image", "Camera RAW"},
+	".wav": {"audio", "WAV"}, ".aif": {"audio", "AIFF"}, ".aiff": {"audio", "AIFF"}, ".flac": {"audio", "FLAC"},
+	".mp3": {"audio", "MP3"}, ".m4a": {"audio", "MPEG-4 Audio"}, ".aac": {"audio", "AAC"}, ".ogg": {"audio", "Ogg"},
+	".opus": {"audio", "Ogg"}, ".wma": {"audio", "WMA"},
+}
+
+// mediaSniffMinSize is the smallest file without a known extension whose first bytes are read to
+// recognize the format; smaller files are not worth the extra open/read on large trees.
+const mediaSniffMinSize = 1 << 20
+
+// mediaKey groups the breakdown by category and format
+type mediaKey struct {
+	Category string
+	Format   string
+}
+
+var (
+	mediaByFormat = make(map[mediaKey]*fileTally)
+	mediaOwn      = make(map[string]*fileTally) // Directory -> media files directly in it
+	mediaLargest  topFiles
+	mediaSniffed  int64 // Files recognized by content rather than extension
+)
+
+// noteMediaFile classifies a file by extension or, if sniff is set and the extension is unknown,
+// by its magic bytes (heavy-files-by-type).
+func noteMediaFile(path string, size, mtime int64, sniff bool) {
+	kind, ok := mediaFormats[strings.ToLower(filepath.Ext(path))]
+	if !ok && sniff && size >= mediaSniffMinSize {
+		if kind, ok = sniffMediaFormat(path); ok {
+			mediaSniffed++
+		}
+	}
+	if !ok {
+		return
+	}
+	key := mediaKey{kind[0], kind[1]}
+	if mediaByFormat[key] == nil {
+		mediaByFormat[key] = &fileTally{}
+	}
+	mediaByFormat[key].add(size, mtime)
+	dir := filepath.Dir(path)
+	if mediaOwn[dir] == nil {
+		mediaOwn[dir] = &fileTally{}
+	}
+	mediaOwn[dir].add(size, mtime)
+	mediaLargest.add(rankedFile{path, size, mtime, kind[1]})
+}
+
+// sniffMediaFormat recognizes common containers from the first bytes of a file
+func sniffMediaFormat(path string) ([2]string, bool) {
+	f, err := openScannedFile(path)
+	if err != nil {
+		return [2]string{}, false
+	}
+	defer f.Close()
+	var b [16]byte
+	n, _ := io.ReadFull(f, b[:])
+	h := b[:n]
+	switch {
+	case len(h) >= 12 && string(h[4:8]) == "ftyp":
+		switch string(h[8:12]) {
+		case "qt  ":
+			return [2]string{"video", "QuickTime"}, true
+		case "heic", "heix", "mif1":
+			return [2]string{"image", "HEIF"}, true
+		case "M4A ":
+			return [2]string{"audio", "MPEG-4 Audio"}, true
+		case "crx ":
+			return [2]string{"image", "Camera RAW"}, true
+		}
+		return [2]string{"video", "MP4"}, true
+	case bytes.HasPrefix(h, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return [2]string{"video", "Matroska"}, true
+	case len(h) >= 12 && string(h[:4]) == "RIFF" && string(h[8:12]) == "AVI ":
+		return [2]string{"video", "AVI"}, true
+	case len(h) >= 12 && string(h[:4]) == "RIFF" && string(h[8:12]) == "WAVE":
+		return [2]string{"audio", "WAV"}, true
+	case len(h) >= 12 && string(h[:4]) == "RIFF" && string(h[8:12]) == "WEBP":
+		return [2]string{"image", "WebP"}, true
+	case bytes.HasPrefix(h, []byte{0x06, 0x0E, 0x2B, 0x34}):
+		return [2]string{"video", "MXF"}, true
+	case bytes.HasPrefix(h, []byte{0xFF, 0xD8, 0xFF}):
+		return [2]string{"image", "JPEG"}, true
+	case bytes.HasPrefix(h, []byte("\x89PNG")):
+		return [2]string{"image", "PNG"}, true
+	case bytes.HasPrefix(h, []byte("GIF8")):
+		return [2]string{"image", "GIF"}, true
+	case bytes.HasPrefix(h, []byte("II*\x00")), bytes.HasPrefix(h, []byte("MM\x00*")):
+		return [2]string{"image", "TIFF"}, true
+	case bytes.HasPrefix(h, []byte{0x76, 0x2F, 0x31, 0x01}):
+		return [2]string{"image", "OpenEXR"}, true
+	case bytes.HasPrefix(h, []byte("SDPX")), bytes.HasPrefix(h, []byte("XPDS")):
+		return [2]string{"image", "DPX"}, true
+	case bytes.HasPrefix(h, []byte("8BPS")):
+		return [2]string{"image", "Photoshop"}, true
+	case bytes.HasPrefix(h, []byte("fLaC")):
+		return [2]string{"audio", "FLAC"}, true
+	case bytes.HasPrefix(h, []byte("OggS")):
+		return [2]string{"audio", "Ogg"}, true
+	case bytes.HasPrefix(h, []byte("FORM")) && len(h) >= 12 && (string(h[8:12]) == "AIFF" || string(h[8:12]) == "AIFC"):
+		return [2]string{"audio", "AIFF"}, true
+	case bytes.HasPrefix(h, []byte("ID3")):
+		return [2]string{"audio", "MP3"}, true
+	}
+	return [2]string{}, false
+}
+
+// printMediaReport prints the heavy-files-by-type report: totals per category and format, the
+// largest media files and the directories holding the most media.
+func printMediaReport() {
+	keys := make([]mediaKey, 0, len(mediaByFormat))
+	var total fileTally
+	for k, t := range mediaByFormat {
+		keys = append(keys, k)
+		total.Size += t.Size
+		total.Files += t.Files
+	}
+	if len(keys) == 0 {
+		fmt.Println("\nNo video, image or audio files found.")
+		return
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return mediaByFormat[keys[i]].Size > mediaByFormat[keys[j]].Size
+	})
+
+	fmt.Println("\n--- Media Files by Type ---")
+	fmt.Printf("%-8s | %-16s | %-15s | %-15s | %-6s | %-12s\n", "Category", "Format", "Size", "Files", "Share", "Newest")
+	fmt.Println(strings.Repeat("-", 90))
+	for _, k := range keys {
+		t := mediaByFormat[k]
+		fmt.Printf("%-8s | %-16s | %-15s | %-15s | %-6s | %-12s\n", k.Category, k.Format, formatBytes(t.Size), formatFiles(t.Files),
+			fmt.Sprintf("%.0f%%", float64(t.Size)*100/float64(max(total.Size, 1))), formatDate(t.Newest))
+	}
+
+	fmt.Printf("\n--- Top %d Largest Media Files ---\n", topN)
+	fmt.Printf("%-15s | %-16s | %-12s | %-50s\n", "Size", "Format", "Modified", "Path")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, f := range mediaLargest {
+		fmt.Printf("%-15s | %-16s | %-12s | %s\n", formatBytes(f.Size), f.Kind, formatDate(f.Mtime), shownPath(f.Path))
+	}
+
+	printTallyDirectories(fmt.Sprintf("Top %d Directories by Media Size", topN), rollUpTallies(mediaOwn))
+
+	fmt.Printf("\nMedia: %s in %d files", formatBytes(total.Size), total.Files)
+	if mediaSniffed > 0 {
+		fmt.Printf(" (%d recognized by content, not by extension)", mediaSniffed)
+	}
+	fmt.Println()
+}
+
+// --- Build Artifacts ---
+
+// devArtifact describes a kind of build output or dependency directory (dev). Generic names such
+// as build or dist only count next to a build file, so source directories with those names are
+// not reported.
+type devArtifact struct {
+	Category string
+	Name     string   // Directory name
+	Siblings []string // Build files of which one must exist in the parent; none: the name suffices
+}
+
+var devArtifacts = []devArtifact{
+	{"node_modules", "node_modules", nil},
+	{"target/", "target", []string{"Cargo.toml", "pom.xml", "build.sbt", "project.clj"}},
+	{"build/", "build", []string{"build.gradle", "build.gradle.kts", "CMakeLists.txt", "meson.build", "setup.py", "pyproject.toml", "package.json", "pubspec.yaml"}},
+	{"dist/", "dist", []string{"package.json", "setup.py", "pyproject.toml", "Cargo.toml"}},
+	{".gradle", ".gradle", nil},
+	{"DerivedData", "DerivedData", nil},
+	{"Go build cache", "go-build", nil},
+	{"Go module cache", "mod", nil}, // $GOPATH/pkg/mod, checked below
+}
+
+var devDirs = make(map[string]string) // Artifact directory -> category
+
+// noteDevDir checks whether a directory is a build artifact or dependency directory. Artifacts
+// nested in another one (node_modules inside node_modules, a venv's build/) are part of the outer.
+func noteDevDir(path string) {
+	for p := filepath.Dir(path); len(devDirs) > 0 && isUnderTargets(p); p = filepath.Dir(p) {
+		if _, ok := devDirs[p]; ok {
+			return
+		}
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+
+	name := filepath.Base(path)
+	if _, err := os.Stat(filepath.Join(path, "pyvenv.cfg")); err == nil {
+		devDirs[path] = "Python venv"
+		return
+	}
+	parent := filepath.Dir(path)
+	for _, a := range devArtifacts {
+		if name != a.Name {
+			continue
+		}
+		if a.Name == "mod" {
+			if filepath.Base(parent) != "pkg" {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(path, "cache", "download")); err != nil {
+				continue
+			}
+		}
+		found := len(a.Siblings) == 0
+		for _, s := range a.Siblings {
+			if _, err := os.Stat(filepath.Join(parent, s)); err == nil {
+				found = true
+				break
+			}
+		}
+		if found {
+			devDirs[path] = a.Category
+			return
+		}
+	}
+}
+
+// printDevReport shows the build artifacts per category, the repositories (nearest project
+// marker, see --project-markers) with the most artifacts and the largest artifact directories.
+func printDevReport() {
+	if len(devDirs) == 0 {
+		fmt.Println("\nNo build artifacts found.")
+		return
+	}
+	// fileTally.Files counts artifact directories here
+	addTally := func(m map[string]*fileTally, key string, s *DirStat) {
+		if m[key] == nil {
+			m[key] = &fileTally{}
+		}
+		m[key].Size += s.TotalSize
+		m[key].Files++
+		m[key].Newest = max(m[key].Newest, s.NewestMtime)
+	}
+	byCategory := make(map[string]*fileTally)
+	byRepo := make(map[string]*fileTally)
+	var largest topFiles
+	var total int64
+	cache := make(map[string]string)
+	for dir, category := range devDirs {
+		s := getDirStat(dir)
+		repo := projectOf(filepath.Dir(dir), cache)
+		addTally(byCategory, category, s)
+		addTally(byRepo, repo, s)
+		largest.add(rankedFile{dir, s.TotalSize, s.NewestMtime, category})
+		total += s.TotalSize
+	}
+
+	sorted := func(m map[string]*fileTally) []string {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if m[keys[i]].Size != m[keys[j]].Size {
+				return m[keys[i]].Size > m[keys[j]].Size
+			}
+			return keys[i] < keys[j]
+		})
+		return keys
+	}
+
+	fmt.Println("\n--- Build Artifacts by Category ---")
+	fmt.Printf("%-16s | %-15s | %-15s | %-12s\n", "Category", "Size", "Directories", "Newest")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, c := range sorted(byCategory) {
+		t := byCategory[c]
+		fmt.Printf("%-16s | %-15s | %-15s | %-12s\n", c, formatBytes(t.Size), fmt.Sprintf("%d Dirs", t.Files), formatDate(t.Newest))
+	}
+
+	fmt.Printf("\n--- Top %d Repositories by Build Artifacts ---\n", topN)
+	fmt.Printf("%-15s | %-15s | %-12s | %-50s\n", "Size", "Directories", "Newest", "Repository")
+	fmt.Println(strings.Repeat("-", 80))
+	for i, r := range sorted(byRepo) {
+		if i >= topN {
+			break
+		}
+		t := byRepo[r]
+		fmt.Printf("%-15s | %-15s | %-12s | %s\n", formatBytes(t.Size), fmt.Sprintf("%d Dirs", t.Files), formatDate(t.Newest), r)
+	}
+
+	fmt.Printf("\n--- Top %d Largest Artifact Directories ---\n", topN)
+	fmt.Printf("%-15s | %-16s | %-12s | %-50s\n", "Size", "Category", "Newest", "Path")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, f := range largest {
+		fmt.Printf("%-15s | %-16s | %-12s | %s\n", formatBytes(f.Size), f.Kind, formatDate(f.Mtime), shownPath(f.Path))
+	}
+	fmt.Printf("\nBuild artifacts: %s in %d directories (all can be regenerated by a build or install)\n", formatBytes(total), len(devDirs))
+}
+
+// --- Git Repositories ---
+
+// Thresholds of git gc --auto (gc.auto, gc.autoPackLimit): above them git itself would repack
+const (
+	gitLooseLimit = 6700
+	gitPackLimit  = 50
+)
+
+// A .git is reported as dwarfing its checkout if it is this many times larger (and not tiny)
+const (
+	gitDwarfRatio   = 2
+	gitDwarfMinSize = 10 * 1024 * 1024
+)
+
+// gitRepo is a repository found by git-repos: a .git directory, or a bare repository
+type gitRepo struct {
+	Root      string // Checkout (the bare repository itself if Bare)
+	GitDir    string
+	Bare      bool
+	Packs     int64
+	PackSize  int64
+	Loose     int64 // Loose objects (objects/xx/...)
+	LooseSize int64
+	GitSize   int64 // Set by printGitReport
+	Worktree  int64
+}
+
+var (
+	gitRepos    = make(map[string]*gitRepo) // Git directory -> repository
+	gitLargest  topFiles                    // Largest pack files
+	gitObjectRe = regexp.MustCompile(`^[0-9a-f]{2}$`)
+)
+
+// noteGitDir records .git directories and bare repositories (name.git with HEAD and objects/)
+func noteGitDir(path string) {
+	name := filepath.Base(path)
+	if name == ".git" {
+		gitRepos[path] = &gitRepo{Root: filepath.Dir(path), GitDir: path}
+		return
+	}
+	if !strings.HasSuffix(name, ".git") {
+		return
+	}
+	if _, err := os.Stat(filepath.Join(path, "HEAD")); err != nil {
+		return
+	}
+	if fi, err := os.Stat(filepath.Join(path, "objects")); err == nil && fi.IsDir() {
+		gitRepos[path] = &gitRepo{Root: path, GitDir: path, Bare: true}
+	}
+}
+
+// noteGitObject counts pack files and loose objects of the repositories found so far
+func noteGitObject(path string, size, mtime int64) {
+	dir := filepath.Dir(path)
+	if filepath.Base(filepath.Dir(dir)) != "objects" {
+		return
+	}
+	repo, ok := gitRepos[filepath.Dir(filepath.Dir(dir))]
+	if !ok {
+		return
+	}
+	switch {
+	case filepath.Base(dir) == "pack" && strings.HasSuffix(path, ".pack"):
+		repo.Packs++
+		repo.PackSize += size
+		gitLargest.add(rankedFile{path, size, mtime, ""})
+	case gitObjectRe.MatchString(filepath.Base(dir)):
+		repo.Loose++
+		repo.LooseSize += size
+	}
+}
+
+// issues names what is worth doing about a repository
+func (r *gitRepo) issues() string {
+	var list []string
+	if r.Loose > gitLooseLimit || r.Packs > gitPackLimit {
+		list = append(list, "git gc")
+	}
+	if !r.Bare && r.GitSize >= gitDwarfMinSize && r.GitSize > gitDwarfRatio*r.Worktree {
+		list = append(list, ".git > 2x checkout")
+	}
+	return strings.Join(list, ", ")
+}
+
+// printGitReport compares the size of every repository's .git with its checkout (excluding nested
+// repositories) and lists the largest pack files
+func printGitReport() {
+	if len(gitRepos) == 0 {
+		fmt.Println("\nNo git repositories found.")
+		return
+	}
+	byRoot := make(map[string]*gitRepo, len(gitRepos))
+	for _, r := range gitRepos {
+		r.GitSize = getDirStat(r.GitDir).TotalSize
+		if !r.Bare {
+			r.Worktree = getDirStat(r.Root).TotalSize - r.GitSize
+			byRoot[r.Root] = r
+		}
+	}
+	// A repository inside another checkout is not part of that checkout
+	for _, r := range gitRepos {
+		for p := filepath.Dir(r.Root); isUnderTargets(p); p = filepath.Dir(p) {
+			if outer, ok := byRoot[p]; ok {
+				if !isPathEqualOrSubpath(normalizePath(r.Root), normalizePath(outer.GitDir)) {
+					outer.Worktree -= getDirStat(r.Root).TotalSize
+				}
+				break
+			}
+			if filepath.Dir(p) == p {
+				break
+			}
+		}
+	}
+
+	list := make([]*gitRepo, 0, len(gitRepos))
+	var gitTotal, worktreeTotal int64
+	var gcCandidates, dwarfed int
+	for _, r := range gitRepos {
+		list = append(list, r)
+		gitTotal += r.GitSize
+		worktreeTotal += r.Worktree
+		issues := r.issues()
+		if strings.Contains(issues, "git gc") {
+			gcCandidates++
+		}
+		if strings.Contains(issues, ".git >") {
+			dwarfed++
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].GitSize != list[j].GitSize {
+			return list[i].GitSize > list[j].GitSize
+		}
+		return list[i].Root < list[j].Root
+	})
+
+	fmt.Printf("\n--- Top %d Git Repositories by .git Size ---\n", topN)
+	fmt.Printf("%-12s | %-12s | %-7s | %-6s | %-7s | %-18s | %-40s\n", ".git", "Checkout", "Ratio", "Packs", "Loose", "Issues", "Repository")
+	fmt.Println(strings.Repeat("-", 110))
+	for i, r := range list {
+		if i >= topN {
+			break
+		}
+		checkout, ratio := formatBytes(r.Worktree), "-"
+		if r.Bare {
+			checkout = "(bare)"
+		} else if r.Worktree > 0 {
+			ratio = fmt.Sprintf("%.1fx", float64(r.GitSize)/float64(r.Worktree))
+		}
+		fmt.Printf("%-12s | %-12s | %-7s | %-6d | %-7d | %-18s | %s\n", formatBytes(r.GitSize), checkout, ratio, r.Packs, r.Loose, r.issues(), shownPath(r.Root))
+	}
+
+	if len(gitLargest) > 0 {
+		fmt.Printf("\n--- Top %d Largest Pack Files ---\n", topN)
+		fmt.Printf("%-15s | %-12s | %-50s\n", "Size", "Modified", "Path")
+		fmt.Println(strings.Repeat("-", 80))
+		for _, f := range gitLargest {
+			fmt.Printf("%-15s | %-12s | %s\n", formatBytes(f.Size), formatDate(f.Mtime), shownPath(f.Path))
+		}
+	}
+
+	fmt.Printf("\n%d repositories: %s in .git, %s in checkouts; %d candidates for git gc (more than %d loose objects or %d packs), %d whose .git is more than twice the checkout (consider a shallow or partial clone)\n",
+		len(list), formatBytes(gitTotal), formatBytes(worktreeTotal), gcCandidates, gitLooseLimit, gitPackLimit, dwarfed)
+}
+
+// --- Databases ---
+
+// dbMarkers are files that identify a database directory; the directory must also have the
+// listed subdirectory (PostgreSQL keeps PG_VERSION in every base/<oid> as well) or, for
+// LSM stores, SST files.
+var dbMarkers = map[string]struct {
+	Engine string
+	Subdir string
+}{
+	"PG_VERSION": {"PostgreSQL", "base"},
+	"ibdata1":    {"MySQL/InnoDB", ""},
+	"WiredTiger": {"MongoDB", ""},
+	"CURRENT":    {"RocksDB/LevelDB", ""},
+}
+
+// Write-ahead logs, redo/binary logs and temporary space of the engines, as directories below a
+// database directory or as files directly in it
+var (
+	dbWALDirs  = []string{"pg_wal", "pg_xlog", "#innodb_redo", "journal"}
+	dbTempDirs = []string{filepath.Join("base", "pgsql_tmp"), "pg_stat_tmp", "#innodb_temp"}
+	dbWALFile  = regexp.MustCompile(`^(ib_logfile\d+|binlog\.\d{6}|.+-bin\.\d{6}|\d{6}\.log)$`)
+	dbTempFile = regexp.MustCompile(`^(ibtmp\d+|.+\.dbtmp)$`)
+	dbSQLite   = regexp.MustCompile(`(?i)\.(sqlite3?|db3?)$`)
+)
+
+// dbFiles tallies the files of one directory that matter for the database report
+type dbFiles struct {
+	WAL  int64
+	Temp int64
+	SSTs int64 // .sst/.ldb files (RocksDB, LevelDB)
+}
+
+var (
+	dbCandidates = make(map[string]string)   // Directory -> marker file found in it
+	dbDirFiles   = make(map[string]*dbFiles) // Directory -> WAL, temp and SST files directly in it
+	dbSQLiteDBs  = make(map[string]int64)    // SQLite database file -> size
+	dbSidecars   = make(map[string]int64)    // SQLite -wal/-journal/-shm file -> size
+)
+
+// noteDatabaseFile records marker files, SQLite databases and the WAL/temporary files of the
+// databases subcommand. SQLite files are confirmed by their header when the file can be read.
+func noteDatabaseFile(path string, size int64, canRead bool) {
+	name, dir := filepath.Base(path), filepath.Dir(path)
+	if _, ok := dbMarkers[name]; ok {
+		dbCandidates[dir] = name
+	}
+	for _, suffix := range []string{"-wal", "-journal", "-shm"} {
+		if strings.HasSuffix(name, suffix) {
+			dbSidecars[path] = size
+			return
+		}
+	}
+	if dbSQLite.MatchString(name) {
+		// Without reading the header only the unambiguous extensions count (.db is used for anything)
+		isDB := strings.Contains(strings.ToLower(name), ".sqlite")
+		if canRead {
+			isDB = isSQLite(path)
+		}
+		if isDB {
+			dbSQLiteDBs[path] = size
+			return
+		}
+	}
+
+	f := dbDirFiles[dir]
+	if f == nil {
+		f = &dbFiles{}
+	}
+	switch ext := filepath.Ext(name); {
+	case dbWALFile.MatchString(name):
+		f.WAL += size
+	case dbTempFile.MatchString(name):
+		f.Temp += size
+	case ext == ".sst" || ext == ".ldb":
+		f.SSTs++
+	default:
+		return
+	}
+	dbDirFiles[dir] = f
+}
+
+// isSQLite checks the 16-byte SQLite header of a regular file
+func isSQLite(path string) bool {
+	f, err := openScannedFile(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	var h [16]byte
+	_, err = io.ReadFull(f, h[:])
+	return err == nil && string(h[:]) == "SQLite format 3\x00"
+}
+
+// dbEntity is one database found by the databases subcommand
+type dbEntity struct {
+	Path   string
+	Engine string
+	Size   int64 // Total, including WAL and Temp
+	WAL    int64
+	Temp   int64
+}
+
+// findDatabases confirms the candidates and splits every database into data, WAL and temporary
+// space. A database inside another one (a RocksDB in a MongoDB data directory) is left out.
+func findDatabases() []*dbEntity {
+	var list []*dbEntity
+	for dir, marker := range dbCandidates {
+		m := dbMarkers[marker]
+		if _, ok := dirStats[filepath.Join(dir, m.Subdir)]; m.Subdir != "" && !ok {
+			continue
+		}
+		if marker == "CURRENT" && (dbDirFiles[dir] == nil || dbDirFiles[dir].SSTs == 0) {
+			continue
+		}
+		e := &dbEntity{Path: dir, Engine: m.Engine, Size: getDirStat(dir).TotalSize}
+		if f := dbDirFiles[dir]; f != nil {
+			e.WAL, e.Temp = f.WAL, f.Temp
+		}
+		for _, d := range dbWALDirs {
+			if ds, ok := dirStats[filepath.Join(dir, d)]; ok {
+				e.WAL += ds.TotalSize
+			}
+		}
+		for _, d := range dbTempDirs {
+			if ds, ok := dirStats[filepath.Join(dir, d)]; ok {
+				e.Temp += ds.TotalSize
+			}
+		}
+		list = append(list, e)
+	}
+	for path, size := range dbSQLiteDBs {
+		e := &dbEntity{Path: path, Engine: "SQLite", Size: size}
+		for _, suffix := range []string{"-wal", "-journal"} {
+			e.WAL += dbSidecars[path+suffix]
+		}
+		e.Temp = dbSidecars[path+"-shm"]
+		e.Size += e.WAL + e.Temp
+		list = append(list, e)
+	}
+
+	// Drop databases nested in another one; sorted by path, an outer database comes first
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	var outer []*dbEntity
+	for _, e := range list {
+		if len(outer) > 0 && isPathEqualOrSubpath(normalizePath(e.Path), normalizePath(outer[len(outer)-1].Path)) {
+			continue
+		}
+		outer = append(outer, e)
+	}
+	return outer
+}
+
+// printDatabaseReport lists the databases by size with their WAL/log and temporary space split out
+func printDatabaseReport() {
+	list := findDatabases()
+	if len(list) == 0 {
+		fmt.Println("\nNo databases found.")
+		return
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Size != list[j].Size {
+			return list[i].Size > list[j].Size
+		}
+		return list[i].Path < list[j].Path
+	})
+	var total, wal, temp int64
+	fmt.Printf("\n--- Top %d Databases by Size ---\n", topN)
+	fmt.Printf("%-12s | %-12s | %-12s | %-12s | %-15s | %-50s\n", "Total", "Data", "WAL/Logs", "Temp", "Engine", "Path")
+	fmt.Println(strings.Repeat("-", 110))
+	for i, e := range list {
+		total += e.Size
+		wal += e.WAL
+		temp += e.Temp
+		if i >= topN {
+			continue
+		}
+		fmt.Printf("%-12s | %-12s | %-12s | %-12s | %-15s | %s\n", formatBytes(e.Size), formatBytes(e.Size-e.WAL-e.Temp), formatBytes(e.WAL), formatBytes(e.Temp), e.Engine, shownPath(e.Path))
+	}
+	fmt.Printf("\n%d databases: %s, of which %s WAL/logs and %s temporary\n", len(list), formatBytes(total), formatBytes(wal), formatBytes(temp))
+}
+
+// --- Mail ---
+
+// Messages smaller than this are not parsed for attachments; they cannot hold large ones
+const mailParseMinSize = 64 * 1024
+
+// mailbox is a Maildir (directory with cur/ and new/) or an mbox file
+type mailbox struct {
+	Path         string
+	Format       string
+	Size         int64
+	Messages     int64
+	Unread       int64
+	OldestUnread int64 // Unix seconds, 0 if nothing is unread
+}
+
+func (m *mailbox) addMessage(size, date int64, unread bool) {
+	m.Size += size
+	m.Messages++
+	if unread {
+		m.Unread++
+		if m.OldestUnread == 0 || date < m.OldestUnread {
+			m.OldestUnread = date
+		}
+	}
+}
+
+// attachmentTally sums the attachments with one extension (decoded sizes, estimated for base64)
+type attachmentTally struct {
+	Count   int64
+	Size    int64
+	Largest int64
+}
+
+var (
+	mailboxes   = make(map[string]*mailbox)
+	attachments = make(map[string]*attachmentTally) // Lowercase extension -> attachments
+)
+
+// noteMailFile records Maildir messages (files in cur/ or new/) and mbox files (files without an
+// extension, or .mbox/.mbx, that start with a "From " line) for the mail subcommand
+func noteMailFile(path string, size, mtime int64) {
+	dir := filepath.Dir(path)
+	if sub := filepath.Base(dir); sub == "cur" || sub == "new" {
+		box := filepath.Dir(dir)
+		m := mailboxes[box]
+		if m == nil {
+			m = &mailbox{Path: box, Format: "Maildir"}
+			mailboxes[box] = m
+		}
+		// Messages in new/ have not been seen by a client; in cur/ the "S" flag marks them as read
+		_, flags, _ := strings.Cut(filepath.Base(path), ":2,")
+		m.addMessage(size, mtime, sub == "new" || !strings.Contains(flags, "S"))
+		if size >= mailParseMinSize {
+			if f, err := openScannedFile(path); err == nil {
+				if msg, err := mail.ReadMessage(bufio.NewReader(io.LimitReader(f, size))); err == nil {
+					noteAttachments(textproto.MIMEHeader(msg.Header), msg.Body, 0)
+				}
+				f.Close()
+			}
+		}
+		return
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext == "" || ext == ".mbox" || ext == ".mbx" {
+		readMbox(path, size, mtime)
+	}
+}
+
+// readMbox splits an mbox file into messages at "From " lines. A message is unread unless its
+// Status header contains "R" (set by mutt, Thunderbird and other mbox clients). Only the size
+// seen by the walk is read, so a file that keeps growing does not hold up the scan.
+func readMbox(path string, size, mtime int64) {
+	f, err := openScannedFile(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	r := bufio.NewReaderSize(io.LimitReader(f, size), 64*1024)
+	if head, err := r.Peek(5); err != nil || string(head) != "From " {
+		return
+	}
+	m := &mailbox{Path: path, Format: "mbox"}
+	var msg bytes.Buffer
+	flush := func() {
+		if msg.Len() == 0 {
+			return
+		}
+		date := mtime // Without a Date header
+		unread := true
+		if parsed, err := mail.ReadMessage(bytes.NewReader(msg.Bytes())); err == nil {
+			if t, err := parsed.Header.Date(); err == nil {
+				date = t.Unix()
+			}
+			unread = !strings.Contains(parsed.Header.Get("Status"), "R")
+			if msg.Len() >= mailParseMinSize {
+				noteAttachments(textproto.MIMEHeader(parsed.Header), parsed.Body, 0)
+			}
+		}
+		m.addMessage(int64(msg.Len()), date, unread)
+		msg.Reset()
+	}
+	for {
+		line, err := r.ReadBytes('\n')
+		if bytes.HasPrefix(line, []byte("From ")) {
+			flush()
+		} else {
+			msg.Write(line)
+		}
+		if err != nil {
+			break
+		}
+	}
+	flush()
+	m.Size = size // Including the "From " lines
+	mailboxes[path] = m
+}
+
+// noteAttachments walks the MIME parts of a message and counts every part with a file name
+func noteAttachments(h textproto.MIMEHeader, body io.Reader, depth int) {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err == nil && strings.HasPrefix(mediaType, "multipart/") && depth < 10 {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err != nil {
+				return
+			}
+			noteAttachments(p.Header, p, depth+1)
+		}
+	}
+	name := params["name"]
+	if _, dparams, err := mime.ParseMediaType(h.Get("Content-Disposition")); err == nil && dparams["filename"] != "" {
+		name = dparams["filename"]
+	}
+	if name == "" {
+		return
+	}
+	n, _ := io.Copy(io.Discard, body)
+	if strings.EqualFold(h.Get("Content-Transfer-Encoding"), "base64") {
+		n = n * 3 / 4 // Ignoring line breaks, close enough
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		ext = "(none)"
+	}
+	t := attachments[ext]
+	if t == nil {
+		t = &attachmentTally{}
+		attachments[ext] = t
+	}
+	t.Count++
+	t.Size += n
+	t.Largest = max(t.Largest, n)
+}
+
+// printMailReport lists the largest mailboxes, attachments by extension and the mailboxes with
+// the oldest unread mail (abandoned spools, cron mail nobody reads)
+func printMailReport() {
+	var list []*mailbox
+	var total, messages int64
+	for _, m := range mailboxes {
+		// A Maildir needs both cur/ and new/ (a lone "new" directory is not mail)
+		if m.Format == "Maildir" {
+			_, cur := dirStats[filepath.Join(m.Path, "cur")]
+			_, nw := dirStats[filepath.Join(m.Path, "new")]
+			if !cur || !nw {
+				continue
+			}
+		}
+		list = append(list, m)
+		total += m.Size
+		messages += m.Messages
+	}
+	if len(list) == 0 {
+		fmt.Println("\nNo Maildir or mbox mailboxes found.")
+		return
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Size != list[j].Size {
+			return list[i].Size > list[j].Size
+		}
+		return list[i].Path < list[j].Path
+	})
+	fmt.Printf("\n--- Top %d Mailboxes by Size ---\n", topN)
+	fmt.Printf("%-12s | %-10s | %-10s | %-13s | %-7s | %-50s\n", "Size", "Messages", "Unread", "Oldest Unread", "Format", "Path")
+	fmt.Println(strings.Repeat("-", 110))
+	for i, m := range list {
+		if i >= topN {
+			break
+		}
+		fmt.Printf("%-12s | %-10d | %-10d | %-13s | %-7s | %s\n", formatBytes(m.Size), m.Messages, m.Unread, formatDate(m.OldestUnread), m.Format, shownPath(m.Path))
+	}
+
+	if len(attachments) > 0 {
+		exts := make([]string, 0, len(attachments))
+		for e := range attachments {
+			exts = append(exts, e)
+		}
+		sort.Slice(exts, func(i, j int) bool {
+			if attachments[exts[i]].Size != attachments[exts[j]].Size {
+				return attachments[exts[i]].Size > attachments[exts[j]].Size
+			}
+			return exts[i] < exts[j]
+		})
+		fmt.Printf("\n--- Top %d Attachment Types by Size (messages over %s) ---\n", topN, formatBytes(mailParseMinSize))
+		fmt.Printf("%-12s | %-15s | %-10s | %-15s\n", "Extension", "Size", "Count", "Largest")
+		fmt.Println(strings.Repeat("-", 60))
+		for i, e := range exts {
+			if i >= topN {
+				break
+			}
+			t := attachments[e]
+			fmt.Printf("%-12s | %-15s | %-10d | %-15s\n", e, formatBytes(t.Size), t.Count, formatBytes(t.Largest))
+		}
+	}
+
+	var unread []*mailbox
+	for _, m := range list {
+		if m.Unread > 0 && m.OldestUnread > 0 {
+			unread = append(unread, m)
+		}
+	}
+	sort.Slice(unread, func(i, j int) bool { return unread[i].OldestUnread < unread[j].OldestUnread })
+	if len(unread) > 0 {
+		fmt.Printf("\n--- Top %d Mailboxes by Oldest Unread Mail ---\n", topN)
+		fmt.Printf("%-13s | %-10s | %-12s | %-50s\n", "Oldest Unread", "Unread", "Size", "Path")
+		fmt.Println(strings.Repeat("-", 80))
+		for i, m := range unread {
+			if i >= topN {
+				break
+			}
+			fmt.Printf("%-13s | %-10d | %-12s | %s\n", formatDate(m.OldestUnread), m.Unread, formatBytes(m.Size), shownPath(m.Path))
+		}
+	}
+	fmt.Printf("\n%d mailboxes: %s in %d messages\n", len(list), formatBytes(total), messages)
+}
+
+// --- Log Analysis ---
+
+// Rotated log names: a compression extension, a rotation number (app.log.3) and/or a date stamp
+// (messages-20261017, app-2026-10-17.log, app.log.2026-10-17_0300)
+var (
+	logCompressedExt = regexp.MustCompile(`(?i)\.(gz|bz2|xz|zst|lz4|lzma|z|zip)$`)
+	logRotationNum   = regexp.MustCompile(`\.\d{1,4}$`)
+	logDateStamp     = regexp.MustCompile(`[-_.]\d{4}-?\d{2}-?\d{2}(?:[-_T]?\d{2}(?:-?\d{2}){0,2})?`)
+)
+
+const (
+	// logCompressRatio is the compressed/original size assumed for text logs (gzip typically
+	// reaches 5-15% on logs) when estimating what compressing rotated files would reclaim.
+	logCompressRatio = 0.1
+	// logUnrotatedSize is the size above which a live log without any rotated siblings is flagged
+	logUnrotatedSize = 100 << 20
+)
+
+// logFamily is a live log file and its rotated siblings in one directory
+type logFamily struct {
+	Dir, Base        string
+	LiveSize         int64
+	HasLive          bool
+	Rotations        int64
+	Compressed       int64 // Rotated files that are compressed
+	UncompressedSize int64 // Size of rotated files that are not compressed
+	Total            int64
+	Oldest, Newest   int64
+	newestRotated    struct { // Stands in for the live file of date-only families
+		Size, Mtime int64
+		Compressed  bool
+	}
+}
+
+var logFamilies = make(map[string]*logFamily)
+
+// logFamilyName strips the rotation suffixes from a file name and reports whether it is rotated
+// and compressed.
+func logFamilyName(name string) (base string, rotated, compressed bool) {
+	base = name
+	if loc := logCompressedExt.FindStringIndex(base); loc != nil && loc[0] > 0 {
+		base, rotated, compressed = base[:loc[0]], true, true
+	}
+	if loc := logRotationNum.FindStringIndex(base); loc != nil && loc[0] > 0 {
+		base, rotated = base[:loc[0]], true
+	}
+	if loc := logDateStamp.FindStringIndex(base); loc != nil && loc[0] > 0 {
+		base, rotated = base[:loc[0]]+base[loc[1]:], true
+	}
+	return base, rotated, compressed
+}
+
+// isLogName reports whether a file name looks like a log: a .log file with any rotation suffixes
+// (app.log.1, app.log.2.gz, app-2026-10-17.log) or a name that ends in a date stamp before the
+// rotation number and compression extension (messages-20261017, syslog-20261017.gz).
+func isLogName(name string) bool {
+	if base, _, _ := logFamilyName(name); strings.HasSuffix(strings.ToLower(base), ".log") {
+		return true
+	}
+	if loc := logCompressedExt.FindStringIndex(name); loc != nil && loc[0] > 0 {
+		name = name[:loc[0]]
+	}
+	if loc := logRotationNum.FindStringIndex(name); loc != nil && loc[0] > 0 {
+		name = name[:loc[0]]
+	}
+	loc := logDateStamp.FindStringIndex(name)
+	return loc != nil && loc[0] > 0 && loc[1] == len(name)
+}
+
+// noteLogFile adds a log file to its rotation family (logs subcommand); other files are ignored
+func noteLogFile(path string, size, mtime int64) {
+	if !isLogName(filepath.Base(path)) {
+		return
+	}
+	dir := filepath.Dir(path)
+	base, rotated, compressed := logFamilyName(filepath.Base(path))
+	key := filepath.Join(dir, base)
+	fam, ok := logFamilies[key]
+	if !ok {
+		fam = &logFamily{Dir: dir, Base: base}
+		logFamilies[key] = fam
+	}
+	fam.Total += size
+	if fam.Oldest == 0 || mtime < fam.Oldest {
+		fam.Oldest = mtime
+	}
+	if mtime > fam.Newest {
+		fam.Newest = mtime
+	}
+	if !rotated {
+		fam.HasLive, fam.LiveSize = true, size
+		return
+	}
+	fam.Rotations++
+	if compressed {
+		fam.Compressed++
+	} else {
+		fam.UncompressedSize += size
+	}
+	if mtime >= fam.newestRotated.Mtime {
+		fam.newestRotated.Size, fam.newestRotated.Mtime, fam.newestRotated.Compressed = size, mtime, compressed
+	}
+}
+
+// issues lists the rotation problems of a family
+func (fam *logFamily) issues() []string {
+	var issues []string
+	if fam.Rotations == 0 && fam.LiveSize >= logUnrotatedSize {
+		issues = append(issues, "not rotated")
+	}
+	if fam.UncompressedSize > 0 {
+		issues = append(issues, "uncompressed")
+	}
+	if fam.Rotations > 0 && retentionNow.Sub(time.Unix(fam.Oldest, 0)) > 365*24*time.Hour {
+		issues = append(issues, "kept >1y")
+	}
+	return issues
+}
+
+// printLogReport lists log families by total size with rotation problems, and the space that
+// compressing the uncompressed rotated files would reclaim.
+func printLogReport() {
+	var list []*logFamily
+	var total, reclaim int64
+	var unrotated, uncompressed int
+	for _, fam := range logFamilies {
+		if !fam.HasLive && fam.Rotations > 0 {
+			// Date-stamped families (app-2026-10-17.log) have no undated file: the newest is live
+			fam.HasLive, fam.LiveSize = true, fam.newestRotated.Size
+			fam.Rotations--
+			if fam.newestRotated.Compressed {
+				fam.Compressed--
+			} else {
+				fam.UncompressedSize -= fam.LiveSize
+			}
+		}
+		list = append(list, fam)
+		total += fam.Total
+		reclaim += int64(float64(fam.UncompressedSize) * (1 - logCompressRatio))
+		if fam.Rotations == 0 && fam.LiveSize >= logUnrotatedSize {
+			unrotated++
+		}
+		if fam.UncompressedSize > 0 {
+			uncompressed++
+		}
+	}
+	if len(list) == 0 {
+		fmt.Println("\nNo files found.")
+		return
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Total != list[j].Total {
+			return list[i].Total > list[j].Total
+		}
+		return list[i].Dir+list[i].Base < list[j].Dir+list[j].Base
+	})
+
+	fmt.Printf("\n--- Top %d Log Families by Size ---\n", topN)
+	fmt.Printf("%-12s | %-12s | %-16s | %-12s | %-28s | %-50s\n", "Total", "Live", "Rotations", "Oldest", "Issues", "Family")
+	fmt.Println(strings.Repeat("-", 110))
+	for i, fam := range list {
+		if i >= topN {
+			break
+		}
+		rotations := strconv.FormatInt(fam.Rotations, 10)
+		if fam.Rotations > 0 {
+			rotations += fmt.Sprintf(" (%d comp.)", fam.Compressed)
+		}
+		issues := strings.Join(fam.issues(), ", ")
+		if issues == "" {
+			issues = "-"
+		}
+		fmt.Printf("%-12s | %-12s | %-16s | %-12s | %-28s | %s\n", formatBytes(fam.Total), formatBytes(fam.LiveSize), rotations,
+			formatDate(fam.Oldest), issues, shownPath(filepath.Join(fam.Dir, fam.Base)))
+	}
+
+	fmt.Printf("\nLogs: %s in %d families; %d not rotated (live file of %s or more without rotated copies), %d with uncompressed rotations\n",
+		formatBytes(total), len(list), unrotated, formatBytes(logUnrotatedSize), uncompressed)
+	if reclaim > 0 {
+		fmt.Printf("Compressing the rotated files (e.g. logrotate 'compress') would reclaim about %s (assuming %.0f%% compressed size)\n",
+			formatBytes(reclaim), logCompressRatio*100)
+	}
+}
+
+// --- Duplicate Trees ---
+//
+// dupes finds directories holding the same tree: repeated copies of a data set, a backup copied
+// next to the original, a project checked out twice. It compares fingerprints without modification
+// times (names and sizes, plus contents with --fingerprint-content); the directory's own name is
+// not part of it. Only the outermost duplicates are listed, not every subdirectory of a copy.
+
+type duplicateTree struct {
+	Size  int64
+	Files int64
+	Paths []string
+}
+
+// Reclaimable is the space freed by keeping a single copy
+func (d *duplicateTree) Reclaimable() int64 {
+	return d.Size * int64(len(d.Paths)-1)
+}
+
+func findDuplicateTrees() []*duplicateTree {
+	byFingerprint := make(map[[32]byte][]*DirStat)
+	for _, s := range dirStats {
+		if s.FileCount > 0 && s.TotalSize > 0 && isUnderTargets(s.Path) {
+			byFingerprint[s.Fingerprint] = append(byFingerprint[s.Fingerprint], s)
+		}
+	}
+	duplicated := func(p string) bool {
+		s, ok := dirStats[p]
+		return ok && len(byFingerprint[s.Fingerprint]) > 1 && isUnderTargets(p)
+	}
+	var list []*duplicateTree
+	for _, group := range byFingerprint {
+		if len(group) < 2 || group[0].TotalSize < minSize {
+			continue
+		}
+		// Subdirectories of copies are copies too: list them only if one of them is not inside a copy
+		outermost := false
+		for _, s := range group {
+			if parent := filepath.Dir(s.Path); parent == s.Path || !duplicated(parent) {
+				outermost = true
+				break
+			}
+		}
+		if !outermost {
+			continue
+		}
+		d := &duplicateTree{Size: group[0].TotalSize, Files: group[0].FileCount}
+		for _, s := range group {
+			d.Paths = append(d.Paths, s.Path)
+		}
+		sort.Strings(d.Paths)
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Reclaimable() != list[j].Reclaimable() {
+			return list[i].Reclaimable() > list[j].Reclaimable()
+		}
+		return list[i].Paths[0] < list[j].Paths[0]
+	})
+	return list
+}
+
+func printDuplicateTrees() {
+	list := findDuplicateTrees()
+	var total int64
+	for _, d := range list {
+		total += d.Reclaimable()
+	}
+	shown := list
+	if len(shown) > topN && !showAll {
+		shown = shown[:topN]
+	}
+	title := fmt.Sprintf("Top %d Duplicate Directory Trees by Reclaimable Size", topN)
+	if showAll {
+		title = "All Duplicate Directory Trees by Reclaimable Size"
+	}
+	fmt.Printf("\n--- %s ---\n", title)
+	fmt.Printf("%-15s | %-15s | %-15s | %s\n", "Reclaimable", "Size", "Files", "Copies")
+	fmt.Println(strings.Repeat("-", 70))
+	for _, d := range shown {
+		for i, p := range d.Paths {
+			if i == 0 {
+				fmt.Printf("%-15s | %-15s | %-15s | %s\n", formatBytes(d.Reclaimable()), formatBytes(d.Size), formatFiles(d.Files), shownPath(p))
+			} else {
+				fmt.Printf("%-15s | %-15s | %-15s | %s\n", "", "", "", shownPath(p))
+			}
+		}
+	}
+	if len(list) == 0 {
+		fmt.Println("No duplicate directory trees found.")
+		return
+	}
+	compared := "names and sizes"
+	if hashContent {
+		compared = "names, sizes and contents"
+	}
+	fmt.Printf("\nDuplicate trees: %s reclaimable in %d group(s) (%s compared, keeping one copy of each).\n",
+		formatBytes(total), len(list), compared)
+	if !hashContent {
+		fmt.Println("Note: Equal names and sizes do not prove equal contents; confirm with --fingerprint-content before deleting.")
+	}
+}
+
+// --- Archives Next to Their Extraction ---
+//
+// foo.tar.gz downloaded, extracted to foo/ and both kept: dupes also pairs archives with a sibling
+// directory named like the archive without its extension, if the directory's size matches the
+// archive's content. The content size is read from the zip directory or the tar headers, and
+// estimated from the gzip trailer (uncompressed size modulo 4 GiB) for .tar.gz; for other formats
+// it cannot be read cheaply, and a directory at least as large as the archive is a possible match.
+
+// archiveExts are the recognized archive extensions, longer ones first
+var archiveExts = []string{".tar.gz", ".tar.bz2", ".tar.xz", ".tar.zst", ".tgz", ".tbz2", ".txz", ".tar", ".zip", ".7z", ".rar"}
+
+type archiveFile struct {
+	Path string
+	Ext  string
+	Size int64
+}
+
+var archiveFiles []archiveFile
+
+func noteArchive(path string, size int64) {
+	name := strings.ToLower(filepath.Base(path))
+	for _, ext := range archiveExts {
+		if strings.HasSuffix(name, ext) && len(name) > len(ext) {
+			archiveFiles = append(archiveFiles, archiveFile{Path: path, Ext: ext, Size: size})
+			return
+		}
+	}
+}
+
+// archiveContent returns the total size and number of the files in an archive. exact is false for
+// the gzip estimate; ok is false where the format (or the file) cannot be read.
+func archiveContent(a archiveFile) (size, files int64, exact, ok bool) {
+	switch a.Ext {
+	case ".zip":
+		f, err := openScannedFile(a.Path)
+		if err != nil {
+			return 0, 0, false, false
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return 0, 0, false, false
+		}
+		r, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			return 0, 0, false, false
+		}
+		for _, f := range r.File {
+			if !f.FileInfo().IsDir() {
+				size += int64(f.UncompressedSize64)
+				files++
+			}
+		}
+		return size, files, true, true
+	case ".tar":
+		f, err := openScannedFile(a.Path)
+		if err != nil {
+			return 0, 0, false, false
+		}
+		defer f.Close()
+		// tar.Reader seeks over the file data of an *os.File: only the headers are read
+		tr := tar.NewReader(f)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return size, files, true, true
+			}
+			if err != nil {
+				return 0, 0, false, false
+			}
+			if hdr.Typeflag == tar.TypeReg {
+				size += hdr.Size
+				files++
+			}
+		}
+	case ".tar.gz", ".tgz":
+		f, err := openScannedFile(a.Path)
+		if err != nil {
+			return 0, 0, false, false
+		}
+		defer f.Close()
+		// a.Size is the allocated size in --size-mode disk: the trailer is at the end of the data
+		info, err := f.Stat()
+		if err != nil {
+			return 0, 0, false, false
+		}
+		var trailer [4]byte
+		if _, err := f.ReadAt(trailer[:], info.Size()-4); err != nil {
+			return 0, 0, false, false
+		}
+		return int64(binary.LittleEndian.Uint32(trailer[:])), 0, false, true
+	}
+	return 0, 0, false, false
+}
+
+type archivePair struct {
+	Archive archiveFile
+	Dir     *DirStat
+	Match   string // "exact", "estimate" (gzip trailer) or "possible" (size not readable)
+	Reclaim int64  // Space freed by removing the smaller of the two
+}
+
+func findArchivePairs() []*archivePair {
+	var pairs []*archivePair
+	for _, a := range archiveFiles {
+		name := filepath.Base(a.Path)
+		dir := filepath.Join(filepath.Dir(a.Path), name[:len(name)-len(a.Ext)])
+		s, ok := dirStats[dir]
+		if !ok || s.FileCount == 0 || !isUnderTargets(dir) {
+			continue
+		}
+		// File system blocks make a directory larger than its content in --size-mode disk
+		slack := int64(0)
+		if sizeMode == "disk" {
+			slack = 4096 * s.FileCount
+		}
+		tolerance := s.TotalSize/20 + slack
+		p := &archivePair{Archive: a, Dir: s, Reclaim: min(a.Size, s.TotalSize)}
+		content, files, exact, known := archiveContent(a)
+		switch {
+		case !known:
+			if s.TotalSize < a.Size {
+				continue
+			}
+			p.Match = "possible"
+		case exact:
+			if abs(s.TotalSize-content) > tolerance || files != s.FileCount {
+				continue
+			}
+			p.Match = "exact"
+		default:
+			// The tar stream adds a 512-byte header and up to 511 bytes of padding per file, and
+			// the trailer has the size modulo 4 GiB only
+			tolerance += 1024*s.FileCount + 10240
+			if tolerance >= 1<<31 {
+				continue
+			}
+			if d := int64(int32(uint32(content) - uint32(s.TotalSize))); abs(d) > tolerance {
+				continue
+			}
+			p.Match = "estimate"
+		}
+		pairs = append(pairs, p)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Reclaim != pairs[j].Reclaim {
+			return pairs[i].Reclaim > pairs[j].Reclaim
+		}
+		return pairs[i].Archive.Path < pairs[j].Archive.Path
+	})
+	return pairs
+}
+
+// printArchivePairs lists the matched pairs with the space they hold twice, and the possible pairs
+// separately: their content is not read, so they stay out of the total.
+func printArchivePairs() {
+	var pairs, possible []*archivePair
+	var total int64
+	for _, p := range findArchivePairs() {
+		if p.Match == "possible" {
+			possible = append(possible, p)
+			continue
+		}
+		pairs = append(pairs, p)
+		total += p.Reclaim
+	}
+	if len(pairs) > topN && !showAll {
+		pairs = pairs[:topN]
+	}
+	if len(possible) > topN && !showAll {
+		possible = possible[:topN]
+	}
+	title := fmt.Sprintf("Top %d Archives Kept Next to Their Extraction", topN)
+	if showAll {
+		title = "All Archives Kept Next to Their Extraction"
+	}
+	fmt.Printf("\n--- %s ---\n", title)
+	fmt.Printf("%-15s | %-15s | %-8s | %s\n", "Archive", "Extracted", "Match", "Archive Path")
+	fmt.Println(strings.Repeat("-", 70))
+	for _, p := range pairs {
+		fmt.Printf("%-15s | %-15s | %-8s | %s\n", formatBytes(p.Archive.Size), formatBytes(p.Dir.TotalSize), p.Match, shownPath(p.Archive.Path))
+	}
+	if len(pairs) == 0 {
+		fmt.Println("No archives found next to a matching extraction.")
+	} else {
+		fmt.Printf("\nBoth archive and extraction kept: removing the smaller copy of each would free %s.\n", formatBytes(total))
+		fmt.Println("Note: exact = content size and file count match, estimate = from the gzip trailer.")
+	}
+	if len(possible) == 0 {
+		return
+	}
+	title = fmt.Sprintf("Top %d Possible Archive Pairs (Content Size Not Read)", topN)
+	if showAll {
+		title = "All Possible Archive Pairs (Content Size Not Read)"
+	}
+	fmt.Printf("\n--- %s ---\n", title)
+	fmt.Printf("%-15s | %-15s | %s\n", "Archive", "Directory", "Archive Path")
+	fmt.Println(strings.Repeat("-", 70))
+	for _, p := range possible {
+		fmt.Printf("%-15s | %-15s | %s\n", formatBytes(p.Archive.Size), formatBytes(p.Dir.TotalSize), shownPath(p.Archive.Path))
+	}
+	fmt.Println("Note: the directory is named like the archive and at least as large, but the format's content size is not read; not counted in the total. Compare the listing before deleting.")
+}
+
+// --- Directory Tags ---
+
+// dirTags holds the triage notes of directories (owner, ticket, do-not-delete, ...) from the
+// sidecar file, keyed by normalized absolute path. A tag without a value is a plain flag.
+var (
+	tagsFile = "" // --tags, default <config dir>/fs-analyzer/tags.json
+	tagArgs  []string
+	dirTags  = make(map[string]map[string]string)
+)
+
+// defaultTagsFile returns the sidecar location next to the profiles
+func defaultTagsFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "fs-analyzer", "tags.json")
+}
+
+// loadTags reads the sidecar file; a missing default file simply means no tags
+func loadTags() error {
+	name := tagsFile
+	if name == "" {
+		name = defaultTagsFile()
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		if os.IsNotExist(err) && tagsFile == "" {
+			return nil
+		}
+		return err
+	}
+	var stored map[string]map[string]string
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	for p, tags := range stored {
+		dirTags[normalizePath(p)] = tags
+	}
+	return nil
+}
+
+// saveTags writes the sidecar file (via a temporary file, so a crash cannot truncate it)
+func saveTags(name string, tags map[string]map[string]string) error {
+	data, err := json.MarshalIndent(tags, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// tagsOf returns the tags of a directory as "key=value, flag", sorted by key
+func tagsOf(path string) string {
+	tags := dirTags[normalizePath(path)]
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		if tags[k] != "" {
+			keys[i] = k + "=" + tags[k]
+		}
+	}
+	return strings.Join(keys, ", ")
+}
+
+// runTagCommand implements "tag <dir> [key=value | flag | -key ...]": it sets or removes tags of a
+// directory in the sidecar file and prints the directory's tags. Without a directory, every tagged
+// directory is listed.
+func runTagCommand() {
+	name := tagsFile
+	if name == "" {
+		if name = defaultTagsFile(); name == "" {
+			fmt.Println("Error: Could not locate the user config directory; use --tags <file>")
+			os.Exit(1)
+		}
+	}
+	// Stored with the paths as given (not normalized), so the file stays readable
+	stored := make(map[string]map[string]string)
+	if data, err := os.ReadFile(name); err == nil {
+		if err := json.Unmarshal(data, &stored); err != nil {
+			fmt.Printf("Error: %s: %v\n", name, err)
+			os.Exit(1)
+		}
+	} else if !os.IsNotExist(err) {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(tagArgs) == 0 {
+		paths := make([]string, 0, len(stored))
+		for p := range stored {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		for _, p := range paths {
+			dirTags[normalizePath(p)] = stored[p]
+			fmt.Printf("%s: %s\n", p, tagsOf(p))
+		}
+		return
+	}
+
+	dir, err := filepath.Abs(tagArgs[0])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	tags := stored[dir]
+	if tags == nil {
+		tags = make(map[string]string)
+	}
+	for _, arg := range tagArgs[1:] {
+		if key, ok := strings.CutPrefix(arg, "-"); ok {
+			delete(tags, key)
+			continue
+		}
+		key, value, _ := strings.Cut(arg, "=")
+		if key == "" {
+			fmt.Printf("Error: Invalid tag %q (use key=value, flag or -key)\n", arg)
+			os.Exit(1)
+		}
+		tags[key] = value
+	}
+	if len(tagArgs) > 1 {
+		if len(tags) == 0 {
+			delete(stored, dir)
+		} else {
+			stored[dir] = tags
+		}
+		if err := saveTags(name, stored); err != nil {
+			fmt.Printf("Error writing %s: %v\n", name, err)
+			os.Exit(1)
+		}
+	}
+	dirTags[normalizePath(dir)] = tags
+	fmt.Printf("%s: %s\n", dir, tagsOf(dir))
+}
+
+// --- Diff and Watch ---
+//
+// diff compares two snapshots (--save) directory by directory; watch repeats the scan every
+// --interval, each time in a new process of this binary saving a snapshot, and prints the diff
+// against the previous round.
+
+// sizeChange is a directory whose total size differs between two snapshots (0 where it is missing)
+type sizeChange struct {
+	Path     string
+	Old, New int64
+}
+
+func runDiff() {
+	oldSnap, err := readSnapshot(diffFiles[0])
+	if err != nil {
+		fmt.Printf("Error reading %s: %v\n", diffFiles[0], err)
+		os.Exit(1)
+	}
+	newSnap, err := readSnapshot(diffFiles[1])
+	if err != nil {
+		fmt.Printf("Error reading %s: %v\n", diffFiles[1], err)
+		os.Exit(1)
+	}
+	printSnapshotDiff(oldSnap, newSnap)
+}
+
+// printSnapshotDiff prints the change of each target's total and the directories below the
+// targets that changed most, either way
+func printSnapshotDiff(oldSnap, newSnap *snapshot) {
+	targets := removeSubdirectories(append(slices.Clone(oldSnap.Targets), newSnap.Targets...))
+	under := func(p string) bool {
+		for _, t := range targets {
+			if isPathEqualOrSubpath(p, t) {
+				return true
+			}
+		}
+		return false
+	}
+	// A moved tree is listed once as a move, not as removed and new directories
+	moves := findMoves(oldSnap, newSnap, under)
+	moved := make(map[string]bool, 2*len(moves))
+	for _, m := range moves {
+		moved[m.From], moved[m.To] = true, true
+	}
+	inMove := func(p string) bool {
+		for {
+			if moved[p] {
+				return true
+			}
+			parent := filepath.Dir(p)
+			if parent == p {
+				return false
+			}
+			p = parent
+		}
+	}
+
+	changes := make(map[string]*sizeChange)
+	for _, s := range oldSnap.Dirs {
+		if under(s.Path) {
+			changes[s.Path] = &sizeChange{Path: s.Path, Old: s.TotalSize}
+		}
+	}
+	for _, s := range newSnap.Dirs {
+		if !under(s.Path) {
+			continue
+		}
+		if c, ok := changes[s.Path]; ok {
+			c.New = s.TotalSize
+		} else {
+			changes[s.Path] = &sizeChange{Path: s.Path, New: s.TotalSize}
+		}
+	}
+
+	signed := func(v int64) string {
+		if v < 0 {
+			return "-" + formatBytes(-v)
+		}
+		return "+" + formatBytes(v)
+	}
+	fmt.Printf("Comparing %s (%s) with %s (%s)\n", oldSnap.Created.Local().Format("2006-01-02 15:04:05"), oldSnap.Host,
+		newSnap.Created.Local().Format("2006-01-02 15:04:05"), newSnap.Host)
+	for _, t := range targets {
+		if c, ok := changes[t]; ok {
+			fmt.Printf("  %s: %s -> %s (%s)\n", shownPath(t), formatBytes(c.Old), formatBytes(c.New), signed(c.New-c.Old))
+		}
+	}
+
+	var list []*sizeChange
+	for p, c := range changes {
+		if c.New != c.Old && !slices.Contains(targets, p) && !inMove(p) {
+			list = append(list, c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		di, dj := list[i].New-list[i].Old, list[j].New-list[j].Old
+		if abs(di) != abs(dj) {
+			return abs(di) > abs(dj)
+		}
+		return list[i].Path < list[j].Path
+	})
+	if len(list) > topN && !showAll {
+		list = list[:topN]
+	}
+	fmt.Println("\n--- Largest Changes by Size ---")
+	exact := ""
+	if exactBytes {
+		exact = fmt.Sprintf("%-19s | ", "Change (bytes)")
+	}
+	fmt.Printf("%-15s | %s%-15s | %-15s | %s\n", "Change", exact, "Before", "After", "Path")
+	fmt.Println(strings.Repeat("-", 70+len(exact)))
+	for _, c := range list {
+		note := ""
+		switch {
+		case c.Old == 0 && c.New > 0:
+			note = " [new]"
+		case c.New == 0:
+			note = " [removed]"
+		}
+		if exactBytes {
+			exact = fmt.Sprintf("%-19s | ", formatCount(c.New-c.Old))
+			if c.New > c.Old {
+				exact = fmt.Sprintf("%-19s | ", "+"+formatCount(c.New-c.Old))
+			}
+		}
+		fmt.Printf("%-15s | %s%-15s | %-15s | %s%s\n", signed(c.New-c.Old), exact, formatBytes(c.Old), formatBytes(c.New), shownPath(c.Path), note)
+	}
+	if len(list) == 0 {
+		fmt.Println("No directory changed in size.")
+	}
+
+	if len(moves) == 0 {
+		return
+	}
+	if len(moves) > topN && !showAll {
+		moves = moves[:topN]
+	}
+	fmt.Println("\n--- Moved or Renamed Directories ---")
+	fmt.Printf("%-15s | %-10s | %s\n", "Size", "Files", "Moved From -> To")
+	fmt.Println(strings.Repeat("-", 70))
+	for _, m := range moves {
+		fmt.Printf("%-15s | %-10s | %s -> %s\n", formatBytes(m.Size), formatCount(m.Files), shownPath(m.From), shownPath(m.To))
+	}
+}
+
+// dirMove is a directory that is gone from the old snapshot and appears with the same contents
+// under another path in the new one
+type dirMove struct {
+	From, To    string
+	Size, Files int64
+}
+
+// moveKey identifies the contents of a directory across snapshots: the totals and modification
+// times, which a move or rename keeps, and the fingerprint when both scans computed one
+type moveKey struct {
+	Size, Files, OwnSize, OwnFiles, Newest, Oldest int64
+	Fingerprint                                    [32]byte
+}
+
+// findMoves pairs the directories removed between two snapshots with new ones of the same
+// contents, largest first. Only the outermost directory of a moved tree is listed. Where several
+// new directories match, the one with the same name is taken; without fingerprints a new parent
+// holding only the moved directory matches too, so of a chain of nested ones the deepest is taken.
+func findMoves(oldSnap, newSnap *snapshot, under func(string) bool) []*dirMove {
+	key := func(s *DirStat) moveKey {
+		k := moveKey{s.TotalSize, s.FileCount, s.OwnSize, s.OwnFiles, s.NewestMtime, s.OldestMtime, [32]byte{}}
+		if oldSnap.Fingerprints && newSnap.Fingerprints {
+			k.Fingerprint = s.Fingerprint
+		}
+		return k
+	}
+	oldPaths := make(map[string]bool, len(oldSnap.Dirs))
+	for _, s := range oldSnap.Dirs {
+		oldPaths[s.Path] = true
+	}
+	newPaths := make(map[string]bool, len(newSnap.Dirs))
+	added := make(map[moveKey][]*DirStat)
+	for _, s := range newSnap.Dirs {
+		newPaths[s.Path] = true
+		// Empty directories all look alike
+		if !oldPaths[s.Path] && s.FileCount > 0 && under(s.Path) {
+			added[key(s)] = append(added[key(s)], s)
+		}
+	}
+	var removed []*DirStat
+	for _, s := range oldSnap.Dirs {
+		if !newPaths[s.Path] && s.FileCount > 0 && under(s.Path) {
+			removed = append(removed, s)
+		}
+	}
+	// Outermost first, so that the subdirectories of a moved tree are skipped
+	sort.Slice(removed, func(i, j int) bool {
+		if di, dj := strings.Count(removed[i].Path, string(os.PathSeparator)), strings.Count(removed[j].Path, string(os.PathSeparator)); di != dj {
+			return di < dj
+		}
+		return removed[i].Path < removed[j].Path
+	})
+
+	var moves []*dirMove
+	within := func(p string, to bool) bool {
+		for _, m := range moves {
+			if to && isPathEqualOrSubpath(p, m.To) || !to && isPathEqualOrSubpath(p, m.From) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, s := range removed {
+		if within(s.Path, false) {
+			continue
+		}
+		var candidates, sameName []*DirStat
+		for _, c := range added[key(s)] {
+			if within(c.Path, true) {
+				continue
+			}
+			candidates = append(candidates, c)
+			if filepath.Base(c.Path) == filepath.Base(s.Path) {
+				sameName = append(sameName, c)
+			}
+		}
+		if len(candidates) > 1 && len(sameName) == 1 {
+			candidates = sameName
+		} else if len(candidates) > 1 {
+			deepest := slices.MaxFunc(candidates, func(a, b *DirStat) int { return cmp.Compare(len(a.Path), len(b.Path)) })
+			if slices.ContainsFunc(candidates, func(c *DirStat) bool { return !isPathEqualOrSubpath(deepest.Path, c.Path) }) {
+				continue
+			}
+			candidates = []*DirStat{deepest}
+		}
+		if len(candidates) != 1 {
+			continue
+		}
+		moves = append(moves, &dirMove{From: s.Path, To: candidates[0].Path, Size: s.TotalSize, Files: s.FileCount})
+	}
+	sort.Slice(moves, func(i, j int) bool {
+		if moves[i].Size != moves[j].Size {
+			return moves[i].Size > moves[j].Size
+		}
+		return moves[i].From < moves[j].From
+	})
+	return moves
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func runWatch() error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot locate this program to rerun it: %v", err)
+	}
+	dir, err := os.MkdirTemp("", "fs-analyzer-watch-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var prev *snapshot
+	for round := 1; ; round++ {
+		name := filepath.Join(dir, fmt.Sprintf("round-%d.snap", round))
+		cmd := exec.CommandContext(ctx, self, append(append([]string{"scan"}, watchArgs...), "--save", name)...)
+		var out bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &out, &out
+		fmt.Printf("=== %s ===\n", time.Now().Format("2006-01-02 15:04:05"))
+		if prev == nil {
+			// The first round shows the full report as it is written
+			cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		}
+		err := cmd.Run()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			os.Stdout.Write(out.Bytes())
+			return fmt.Errorf("scan failed: %v", err)
+		}
+		snap, err := readSnapshot(name)
+		os.Remove(name)
+		if err != nil {
+			return fmt.Errorf("reading the scan: %v", err)
+		}
+		if prev != nil {
+			printSnapshotDiff(prev, snap)
+		}
+		prev = snap
+		fmt.Printf("\nNext scan at %s (Ctrl-C to stop)\n", time.Now().Add(watchInterval).Format("15:04:05"))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(watchInterval):
+		}
+	}
+}